@@ -0,0 +1,171 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultAdaptiveBatchingInterval is the default AdaptiveBatchingParams.Interval.
+	DefaultAdaptiveBatchingInterval = 10 * time.Second
+	// DefaultAdaptiveBatchingSlowLatency is the default AdaptiveBatchingParams.SlowLatency.
+	DefaultAdaptiveBatchingSlowLatency = 200 * time.Millisecond
+)
+
+// maxHealthyFailureRate is the share of failed batches
+// above which the agent is deemed to be struggling.
+const maxHealthyFailureRate = 0.1
+
+// AdaptiveBatchingParams configures WithAdaptiveBatching. A zero minimum
+// defaults to the default of the trace bundler, 2s and 300 spans, and a
+// maximum below its minimum to the minimum.
+type AdaptiveBatchingParams struct {
+	// MinDelay and MaxDelay bound the DelayThreshold of the trace bundler.
+	MinDelay, MaxDelay time.Duration
+	// MinBundleCount and MaxBundleCount bound its BundleCountThreshold.
+	MinBundleCount, MaxBundleCount int
+	// SlowLatency is the average export latency from which the agent is deemed
+	// to be struggling. It defaults to DefaultAdaptiveBatchingSlowLatency.
+	SlowLatency time.Duration
+	// Interval is how often the batching is adjusted, from the exports in
+	// the interval. It defaults to DefaultAdaptiveBatchingInterval.
+	Interval time.Duration
+}
+
+// batchObservations are the outcomes of the trace
+// exports in an interval, only ever accessed atomically.
+type batchObservations struct {
+	sent         int64
+	failed       int64
+	latencyNanos int64
+}
+
+// observeBatch accounts for a batch of spans exported in latency.
+func (ae *Exporter) observeBatch(latency time.Duration) {
+	if ae.adaptiveBatching == nil {
+		return
+	}
+	atomic.AddInt64(&ae.batchObservations.sent, 1)
+	atomic.AddInt64(&ae.batchObservations.latencyNanos, int64(latency))
+}
+
+// observeBatchFailure accounts for a batch of spans that failed to be exported.
+func (ae *Exporter) observeBatchFailure() {
+	if ae.adaptiveBatching == nil {
+		return
+	}
+	atomic.AddInt64(&ae.batchObservations.failed, 1)
+}
+
+// adaptBatching adjusts the trace bundler every interval, until stopCh is closed.
+func (ae *Exporter) adaptBatching(stopCh <-chan bool) {
+	params := *ae.adaptiveBatching
+	interval := params.Interval
+	if interval <= 0 {
+		interval = DefaultAdaptiveBatchingInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case <-ticker.C:
+			obs := batchObservations{
+				sent:         atomic.SwapInt64(&ae.batchObservations.sent, 0),
+				failed:       atomic.SwapInt64(&ae.batchObservations.failed, 0),
+				latencyNanos: atomic.SwapInt64(&ae.batchObservations.latencyNanos, 0),
+			}
+			ae.mu.RLock()
+			current := ae.traceBundlerOptions
+			ae.mu.RUnlock()
+			if next := params.adapt(current, obs); next != current {
+				// The bundler is replaced as by UpdateOptions.
+				_ = ae.UpdateOptions(WithTraceBundlerOptions(next))
+			}
+		}
+	}
+}
+
+// adapt returns the options of the trace bundler to use after the interval
+// in which obs were observed with bo: twice larger batches, sent twice less
+// often, while the agent is healthy, and the other way around while it is
+// struggling, within the bounds of params.
+func (params AdaptiveBatchingParams) adapt(bo BundlerOptions, obs batchObservations) BundlerOptions {
+	if obs.sent+obs.failed == 0 {
+		return bo
+	}
+	slowLatency := params.SlowLatency
+	if slowLatency <= 0 {
+		slowLatency = DefaultAdaptiveBatchingSlowLatency
+	}
+	struggling := float64(obs.failed)/float64(obs.sent+obs.failed) > maxHealthyFailureRate ||
+		(obs.sent > 0 && time.Duration(obs.latencyNanos/obs.sent) >= slowLatency)
+
+	delay, count := bo.DelayThreshold, bo.BundleCountThreshold
+	if delay <= 0 {
+		delay = defaultTraceBundleDelay
+	}
+	if count <= 0 {
+		count = spanDataBufferSize
+	}
+	if struggling {
+		delay, count = delay/2, count/2
+	} else {
+		delay, count = delay*2, count*2
+	}
+
+	minDelay, maxDelay := params.MinDelay, params.MaxDelay
+	if minDelay <= 0 {
+		minDelay = defaultTraceBundleDelay
+	}
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	minCount, maxCount := params.MinBundleCount, params.MaxBundleCount
+	if minCount <= 0 {
+		minCount = spanDataBufferSize
+	}
+	if maxCount < minCount {
+		maxCount = minCount
+	}
+	bo.DelayThreshold = clampDuration(delay, minDelay, maxDelay)
+	bo.BundleCountThreshold = clampInt(count, minCount, maxCount)
+	return bo
+}
+
+func clampDuration(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func clampInt(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveBatchingParams_adapt(t *testing.T) {
+	params := AdaptiveBatchingParams{
+		MinDelay:       100 * time.Millisecond,
+		MaxDelay:       5 * time.Second,
+		MinBundleCount: 50,
+		MaxBundleCount: 1000,
+		SlowLatency:    100 * time.Millisecond,
+	}
+	fast := batchObservations{sent: 10, latencyNanos: int64(10 * 10 * time.Millisecond)}
+	slow := batchObservations{sent: 10, latencyNanos: int64(10 * 150 * time.Millisecond)}
+	failing := batchObservations{sent: 8, failed: 2, latencyNanos: int64(8 * time.Millisecond)}
+
+	tests := []struct {
+		name string
+		bo   BundlerOptions
+		obs  batchObservations
+		want BundlerOptions
+	}{
+		{"no exports", BundlerOptions{}, batchObservations{}, BundlerOptions{}},
+		{"healthy from the defaults", BundlerOptions{}, fast, BundlerOptions{DelayThreshold: 4 * time.Second, BundleCountThreshold: 600}},
+		{"healthy up to the maximum", BundlerOptions{DelayThreshold: 4 * time.Second, BundleCountThreshold: 600}, fast, BundlerOptions{DelayThreshold: 5 * time.Second, BundleCountThreshold: 1000}},
+		{"slow", BundlerOptions{DelayThreshold: time.Second, BundleCountThreshold: 200}, slow, BundlerOptions{DelayThreshold: 500 * time.Millisecond, BundleCountThreshold: 100}},
+		{"failing down to the minimum", BundlerOptions{DelayThreshold: 150 * time.Millisecond, BundleCountThreshold: 60}, failing, BundlerOptions{DelayThreshold: 100 * time.Millisecond, BundleCountThreshold: 50}},
+		{"keeps the buffer limit", BundlerOptions{BufferedByteLimit: 1 << 20}, slow, BundlerOptions{DelayThreshold: time.Second, BundleCountThreshold: 150, BufferedByteLimit: 1 << 20}},
+	}
+	for _, tt := range tests {
+		if got := params.adapt(tt.bo, tt.obs); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Without bounds, the batching stays at the defaults.
+	if got, want := (AdaptiveBatchingParams{}).adapt(BundlerOptions{}, fast), (BundlerOptions{DelayThreshold: defaultTraceBundleDelay, BundleCountThreshold: spanDataBufferSize}); got != want {
+		t.Errorf("Got %+v without bounds, want %+v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/credentials/oauth"
+)
+
+// DefaultApplicationDefaultCredentialsScope is the OAuth2 scope requested by
+// WithApplicationDefaultCredentials when no scopes are given.
+const DefaultApplicationDefaultCredentialsScope = "https://www.googleapis.com/auth/cloud-platform"
+
+type applicationDefaultCredentials []string
+
+var _ ExporterOption = (*applicationDefaultCredentials)(nil)
+
+func (adc applicationDefaultCredentials) withExporter(e *Exporter) {
+	e.useApplicationDefaultCredentials = true
+	e.applicationDefaultCredentialsScopes = append([]string{}, adc...)
+}
+
+// WithApplicationDefaultCredentials authenticates every export RPC with Google
+// Application Default Credentials, for agents and collectors hosted behind
+// IAM-authenticated endpoints on GCP. The tokens are requested for the given
+// OAuth2 scopes, or for DefaultApplicationDefaultCredentialsScope if none are given.
+//
+// The credentials are looked up by NewExporter and NewUnstartedExporter, which
+// fail if none can be found. Since they carry bearer tokens, they are only
+// sent over TLS: this option can't be combined with WithInsecure.
+func WithApplicationDefaultCredentials(scopes ...string) ExporterOption {
+	return applicationDefaultCredentials(scopes)
+}
+
+func (ae *Exporter) loadApplicationDefaultCredentials() error {
+	if !ae.useApplicationDefaultCredentials {
+		return nil
+	}
+	if ae.canDialInsecure && ae.clientTransportCredentials == nil {
+		return fmt.Errorf("ocagent: application default credentials require TLS but WithInsecure was used")
+	}
+	scopes := ae.applicationDefaultCredentialsScopes
+	if len(scopes) == 0 {
+		scopes = []string{DefaultApplicationDefaultCredentialsScope}
+	}
+	creds, err := oauth.NewApplicationDefault(context.Background(), scopes...)
+	if err != nil {
+		return fmt.Errorf("ocagent: failed to find application default credentials: %v", err)
+	}
+	ae.perRPCCredentials = creds
+	return nil
+}
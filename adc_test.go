@@ -0,0 +1,34 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewUnstartedExporter_applicationDefaultCredentialsErrors(t *testing.T) {
+	const envVar = "GOOGLE_APPLICATION_CREDENTIALS"
+	defer os.Setenv(envVar, os.Getenv(envVar))
+	os.Setenv(envVar, filepath.Join(os.TempDir(), "ocagent-no-such-credentials.json"))
+
+	if _, err := NewUnstartedExporter(WithApplicationDefaultCredentials()); err == nil {
+		t.Error("Expected an error when the credentials file doesn't exist")
+	}
+	if _, err := NewUnstartedExporter(WithInsecure(), WithApplicationDefaultCredentials()); err == nil {
+		t.Error("Expected an error when combined with WithInsecure")
+	}
+}
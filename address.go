@@ -0,0 +1,182 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+)
+
+// xdsScheme is the scheme of the targets resolved by the gRPC xDS resolver.
+const xdsScheme = "xds"
+
+// isXDSTarget reports whether addr is a target for the gRPC xDS resolver,
+// which gets the endpoints of the agent from the control plane of a service
+// mesh. Transport security is then up to WithInsecure or WithTLSCredentials.
+func isXDSTarget(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), xdsScheme+"://")
+}
+
+// resolveAgentAddress validates the agent address and normalizes it to a
+// host:port address, see normalizeHostPort. It also turns a URL-style agent
+// address, such as grpcs://agent:55678, into a host:port address and derives
+// the transport security from its scheme:
+//   - grpc:// and http:// dial without transport security,
+//   - grpcs:// and https:// dial with TLS, verified against the system's roots
+//     unless WithTLSCredentials was used.
+//
+// Combining a secure scheme with WithInsecure, or an insecure scheme with
+// WithTLSCredentials, is rejected as ambiguous.
+//
+// An xDS target, e.g. xds:///opencensus-agent, is dialed as is, see
+// isXDSTarget.
+func (ae *Exporter) resolveAgentAddress() error {
+	if ae.agentAddress == "" {
+		return nil
+	}
+	if isXDSTarget(ae.agentAddress) {
+		if resolver.Get(xdsScheme) == nil {
+			return fmt.Errorf("ocagent: agent address %q requires the gRPC xDS resolver, import google.golang.org/grpc/xds to register it", ae.agentAddress)
+		}
+		return nil
+	}
+	if !strings.Contains(ae.agentAddress, "://") {
+		addr, err := normalizeHostPort(ae.agentAddress)
+		if err != nil {
+			return fmt.Errorf("ocagent: invalid agent address %q: %v", ae.agentAddress, err)
+		}
+		ae.agentAddress = addr
+		return nil
+	}
+
+	u, err := url.Parse(ae.agentAddress)
+	if err != nil {
+		return fmt.Errorf("ocagent: invalid agent address %q: %v", ae.agentAddress, err)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return fmt.Errorf("ocagent: invalid agent address %q: only a scheme, a host and a port are allowed", ae.agentAddress)
+	}
+
+	var secure bool
+	switch strings.ToLower(u.Scheme) {
+	case "grpc", "http":
+		secure = false
+	case "grpcs", "https":
+		secure = true
+	default:
+		return fmt.Errorf("ocagent: invalid agent address %q: unsupported scheme %q", ae.agentAddress, u.Scheme)
+	}
+
+	if secure && ae.canDialInsecure {
+		return fmt.Errorf("ocagent: agent address %q requires TLS but WithInsecure was used", ae.agentAddress)
+	}
+	if !secure && ae.fipsTLSConfig != nil {
+		return fmt.Errorf("ocagent: agent address %q disables TLS but WithFIPSTLS was used", ae.agentAddress)
+	}
+	if !secure && ae.clientTransportCredentials != nil {
+		return fmt.Errorf("ocagent: agent address %q disables TLS but WithTLSCredentials was used", ae.agentAddress)
+	}
+
+	host, err := normalizeHostPort(u.Host)
+	if err != nil {
+		return fmt.Errorf("ocagent: invalid agent address %q: %v", ae.agentAddress, err)
+	}
+	ae.agentAddress = host
+	if secure {
+		// WithFIPSTLS provides the credentials of its own.
+		if ae.clientTransportCredentials == nil && ae.fipsTLSConfig == nil {
+			ae.clientTransportCredentials = credentials.NewTLS(&tls.Config{ServerName: u.Hostname()})
+			ae.tlsFromAddress = true
+		}
+	} else {
+		ae.canDialInsecure = true
+	}
+	return nil
+}
+
+// normalizeHostPort validates addr, a host and a port, and returns it with
+// DefaultAgentPort if it has no port. The host can be an IPv6 literal, with
+// or without brackets when there is no port, e.g. [::1]:55678, [::1] or ::1.
+func normalizeHostPort(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// Either there is no port, or addr is malformed.
+		host = addr
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+		if strings.ContainsAny(host, "[]") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+			return "", err
+		}
+		port = ""
+	}
+	if strings.ContainsAny(host, "[]/ ") || (strings.HasPrefix(addr, "[") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	if port == "" {
+		port = strconv.Itoa(int(DefaultAgentPort))
+	} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// SetAgentAddress changes the address of the agent that the exporter
+// exports to, for instance when the agent migrates or when it is found
+// by service discovery. If the exporter was started, it disconnects and
+// reconnects to addr right away, and the current connection is closed
+// once the new one is established.
+//
+// addr takes the same forms as with WithAddress, but it can't change
+// the transport security that the exporter was created with.
+func (ae *Exporter) SetAgentAddress(addr string) error {
+	ae.mu.Lock()
+	if ae.stopped {
+		ae.mu.Unlock()
+		return errStopped
+	}
+	prevAddress, prevCreds := ae.agentAddress, ae.clientTransportCredentials
+	prevInsecure, prevTLSFromAddress := ae.canDialInsecure, ae.tlsFromAddress
+	ae.agentAddress = addr
+	if ae.tlsFromAddress {
+		// Derive the credentials anew, for the new host name.
+		ae.clientTransportCredentials = nil
+		ae.tlsFromAddress = false
+	}
+	err := ae.resolveAgentAddress()
+	if err == nil && ae.canDialInsecure != prevInsecure {
+		err = fmt.Errorf("ocagent: agent address %q can't change the transport security of the exporter", addr)
+	}
+	if err != nil {
+		ae.agentAddress, ae.clientTransportCredentials = prevAddress, prevCreds
+		ae.canDialInsecure, ae.tlsFromAddress = prevInsecure, prevTLSFromAddress
+		ae.mu.Unlock()
+		return err
+	}
+	started := ae.started
+	ae.mu.Unlock()
+
+	if started {
+		ae.redial(fmt.Errorf("agent address changed to %q", ae.prepareAgentAddress()))
+	}
+	return nil
+}
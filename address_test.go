@@ -0,0 +1,212 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+func TestResolveAgentAddress(t *testing.T) {
+	tlsCreds := credentials.NewTLS(nil)
+	tests := []struct {
+		addr      string
+		opts      []ExporterOption
+		wantAddr  string
+		wantTLS   bool
+		wantError bool
+	}{
+		{addr: "agent:55678", opts: []ExporterOption{WithInsecure()}, wantAddr: "agent:55678"},
+		{addr: "grpc://agent:1234", wantAddr: "agent:1234"},
+		{addr: "http://agent", wantAddr: "agent:55678"},
+		{addr: "grpcs://agent:1234", wantAddr: "agent:1234", wantTLS: true},
+		{addr: "https://[::1]:1234/", wantAddr: "[::1]:1234", wantTLS: true},
+		{addr: "agent", opts: []ExporterOption{WithInsecure()}, wantAddr: "agent:55678"},
+		{addr: "[::1]:1234", opts: []ExporterOption{WithInsecure()}, wantAddr: "[::1]:1234"},
+		{addr: "[::1]", opts: []ExporterOption{WithInsecure()}, wantAddr: "[::1]:55678"},
+		{addr: "::1", opts: []ExporterOption{WithInsecure()}, wantAddr: "[::1]:55678"},
+		{addr: "http://[::1]", wantAddr: "[::1]:55678"},
+		{addr: "grpcs://agent:1234", opts: []ExporterOption{WithTLSCredentials(tlsCreds)}, wantAddr: "agent:1234", wantTLS: true},
+
+		{addr: "grpcs://agent:1234", opts: []ExporterOption{WithInsecure()}, wantError: true},
+		{addr: "grpc://agent:1234", opts: []ExporterOption{WithTLSCredentials(tlsCreds)}, wantError: true},
+		{addr: "ftp://agent:1234", wantError: true},
+		{addr: "grpc://agent:1234/v1/traces", wantError: true},
+		{addr: "grpc://", wantError: true},
+		{addr: "agent:port", opts: []ExporterOption{WithInsecure()}, wantError: true},
+		{addr: "agent:65536", opts: []ExporterOption{WithInsecure()}, wantError: true},
+		{addr: "agent:1:2", opts: []ExporterOption{WithInsecure()}, wantError: true},
+		{addr: "[agent]:1234", opts: []ExporterOption{WithInsecure()}, wantError: true},
+		{addr: "grpc://agent:port", wantError: true},
+	}
+
+	for i, tt := range tests {
+		exp, err := NewUnstartedExporter(append(tt.opts, WithAddress(tt.addr))...)
+		if tt.wantError {
+			if err == nil {
+				t.Errorf("#%d: %q: expected an error", i, tt.addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: %q: unexpected error: %v", i, tt.addr, err)
+			continue
+		}
+		if exp.agentAddress != tt.wantAddr {
+			t.Errorf("#%d: agentAddress = %q, want %q", i, exp.agentAddress, tt.wantAddr)
+		}
+		if gotTLS := exp.clientTransportCredentials != nil; gotTLS != tt.wantTLS {
+			t.Errorf("#%d: %q: TLS = %v, want %v", i, tt.addr, gotTLS, tt.wantTLS)
+		}
+		if !tt.wantTLS && !exp.canDialInsecure {
+			t.Errorf("#%d: %q: expected an insecure connection", i, tt.addr)
+		}
+	}
+}
+
+func TestSetAgentAddress_rejectsTransportSecurityChanges(t *testing.T) {
+	exp, err := NewUnstartedExporter(WithAddress("grpcs://agent:1234"))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	if err := exp.SetAgentAddress("grpc://other:1234"); err == nil {
+		t.Error("Expected an error when disabling TLS")
+	}
+	if exp.agentAddress != "agent:1234" || exp.clientTransportCredentials == nil || exp.canDialInsecure {
+		t.Errorf("A rejected address changed the exporter: %q", exp.agentAddress)
+	}
+
+	if err := exp.SetAgentAddress("grpcs://other"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exp.agentAddress != "other:55678" {
+		t.Errorf("agentAddress = %q, want %q", exp.agentAddress, "other:55678")
+	}
+	if got := exp.clientTransportCredentials.Info().ServerName; got != "other" {
+		t.Errorf("ServerName = %q, want %q", got, "other")
+	}
+}
+
+func TestSetAgentAddress_reconnectsToTheNewAgent(t *testing.T) {
+	startAgent := func() (*metricsAgent, string, func()) {
+		ln, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to get an available TCP address: %v", err)
+		}
+		ma := new(metricsAgent)
+		srv := grpc.NewServer()
+		agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+		return ma, ln.Addr().String(), srv.Stop
+	}
+	_, firstAddr, stopFirst := startAgent()
+	defer stopFirst()
+	second, secondAddr, stopSecond := startAgent()
+	defer stopSecond()
+
+	ocexp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(firstAddr),
+		// Long enough that only SetAgentAddress can trigger the reconnection.
+		WithReconnectionPeriod(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	if err := ocexp.SetAgentAddress(secondAddr); err != nil {
+		t.Fatalf("SetAgentAddress: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		requests := 0
+		second.forEachRequest(func(*agentmetricspb.ExportMetricsServiceRequest) {
+			requests++
+		})
+		if requests > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("The exporter did not connect to the new agent")
+}
+
+func TestResolveAgentAddress_xds(t *testing.T) {
+	const target = "xds:///opencensus-agent"
+	if _, err := NewExporter(WithInsecure(), WithAddress(target)); err == nil {
+		t.Fatal("Got no error without the xDS resolver")
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+	ma := new(metricsAgent)
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	// Stands in for the xDS resolver, which the tests aren't built with.
+	xds := manual.NewBuilderWithScheme(xdsScheme)
+	xds.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: ln.Addr().String()}}})
+	prev := resolver.Get(xdsScheme)
+	resolver.Register(xds)
+	defer func() {
+		// The registration is process-wide, so the test doesn't leak it.
+		if prev != nil {
+			resolver.Register(prev)
+		} else {
+			resolver.UnregisterForTesting(xdsScheme)
+		}
+	}()
+
+	ocexp, err := NewExporter(WithInsecure(), WithAddress(target), WithReconnectionPeriod(2*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+	if ocexp.agentAddress != target {
+		t.Errorf("agentAddress = %q, want %q", ocexp.agentAddress, target)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		requests := 0
+		ma.forEachRequest(func(*agentmetricspb.ExportMetricsServiceRequest) {
+			requests++
+		})
+		if requests > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("The exporter did not connect to the agent resolved by xDS")
+}
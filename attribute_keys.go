@@ -0,0 +1,83 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"strings"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// AttributeKeyMapping renames the keys of span attributes,
+// as configured by WithAttributeKeyMapping.
+type AttributeKeyMapping struct {
+	// Exact maps keys to their new names.
+	Exact map[string]string
+	// Prefixes maps key prefixes to their replacements, e.g. "http." to
+	// "http.request." renames "http.method" to "http.request.method".
+	// The longest matching prefix applies. Exact takes precedence.
+	Prefixes map[string]string
+}
+
+func (akm *AttributeKeyMapping) rename(key string) string {
+	if renamed, ok := akm.Exact[key]; ok {
+		return renamed
+	}
+	var longest string
+	found := false
+	for prefix := range akm.Prefixes {
+		if strings.HasPrefix(key, prefix) && (!found || len(prefix) > len(longest)) {
+			longest, found = prefix, true
+		}
+	}
+	if !found {
+		return key
+	}
+	return akm.Prefixes[longest] + key[len(longest):]
+}
+
+// renameAttributes renames the keys of attrs. An attribute already
+// set under the new name of a key is kept over the renamed one.
+func (akm *AttributeKeyMapping) renameAttributes(attrs *tracepb.Span_Attributes) {
+	if attrs == nil || len(attrs.AttributeMap) == 0 {
+		return
+	}
+	var renamed map[string]*tracepb.AttributeValue
+	for key, value := range attrs.AttributeMap {
+		if newKey := akm.rename(key); newKey != key {
+			if renamed == nil {
+				renamed = make(map[string]*tracepb.AttributeValue)
+			}
+			renamed[newKey] = value
+			delete(attrs.AttributeMap, key)
+		}
+	}
+	for key, value := range renamed {
+		if _, ok := attrs.AttributeMap[key]; !ok {
+			attrs.AttributeMap[key] = value
+		}
+	}
+}
+
+// renameSpanAttributes renames the keys of the attributes
+// of span and of its annotations.
+func (akm *AttributeKeyMapping) renameSpanAttributes(span *tracepb.Span) {
+	akm.renameAttributes(span.Attributes)
+	for _, te := range span.GetTimeEvents().GetTimeEvent() {
+		if annotation := te.GetAnnotation(); annotation != nil {
+			akm.renameAttributes(annotation.Attributes)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestAttributeKeyMapping_rename(t *testing.T) {
+	akm := &AttributeKeyMapping{
+		Exact: map[string]string{"http.url": "url.full"},
+		Prefixes: map[string]string{
+			"http.":       "http.request.",
+			"http.status": "http.response.status",
+		},
+	}
+	tests := []struct {
+		key, want string
+	}{
+		{key: "http.url", want: "url.full"},
+		{key: "http.method", want: "http.request.method"},
+		{key: "http.status_code", want: "http.response.status_code"},
+		{key: "db.statement", want: "db.statement"},
+	}
+	for _, tt := range tests {
+		if got := akm.rename(tt.key); got != tt.want {
+			t.Errorf("rename(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestExporter_spanToProtoSpanRenamesAttributes(t *testing.T) {
+	ae := &Exporter{attributeKeyMapping: &AttributeKeyMapping{
+		Exact: map[string]string{"old": "new", "legacy": "kept"},
+	}}
+	sd := &trace.SpanData{
+		Attributes: map[string]interface{}{"old": "a", "legacy": "b", "kept": "c"},
+		Annotations: []trace.Annotation{
+			{Message: "annotation", Attributes: map[string]interface{}{"old": int64(1)}},
+		},
+	}
+	span := ae.spanToProtoSpan(sd)
+
+	attrs := span.Attributes.AttributeMap
+	if len(attrs) != 2 || attrs["new"].GetStringValue().GetValue() != "a" {
+		t.Errorf("Span attributes not renamed: %v", attrs)
+	}
+	if got := attrs["kept"].GetStringValue().GetValue(); got != "c" {
+		t.Errorf("The attribute set under the new name was replaced: got %q", got)
+	}
+	annotationAttrs := span.TimeEvents.TimeEvent[0].GetAnnotation().Attributes.AttributeMap
+	if annotationAttrs["new"].GetIntValue() != 1 {
+		t.Errorf("Annotation attributes not renamed: %v", annotationAttrs)
+	}
+}
+
+func TestNewExporter_withDefaultSpanAttributes(t *testing.T) {
+	ae, err := NewUnstartedExporter(
+		WithDefaultSpanAttributes(map[string]interface{}{"region": "eu", "version": int64(2)}),
+		WithAttributeKeyMapping(AttributeKeyMapping{Exact: map[string]string{"zone": "region"}}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+
+	attrs := ae.spanToProtoSpan(&trace.SpanData{}).Attributes.AttributeMap
+	if attrs["region"].GetStringValue().GetValue() != "eu" || attrs["version"].GetIntValue() != 2 {
+		t.Errorf("Default attributes not added to a span without attributes: %v", attrs)
+	}
+
+	// The attributes of the span win, once renamed.
+	sd := &trace.SpanData{Attributes: map[string]interface{}{"zone": "us"}}
+	attrs = ae.spanToProtoSpan(sd).Attributes.AttributeMap
+	if got := attrs["region"].GetStringValue().GetValue(); got != "us" {
+		t.Errorf("The attribute of the span was overwritten: got %q, want %q", got, "us")
+	}
+	if len(attrs) != 2 {
+		t.Errorf("Got attributes %v, want region and version", attrs)
+	}
+}
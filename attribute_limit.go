@@ -0,0 +1,68 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sort"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// attributeLimit caps the attributes of the exported spans,
+// as configured by WithSpanAttributeLimit.
+type attributeLimit struct {
+	max int
+	// priority ranks the keys kept first, lower ranks first.
+	priority map[string]int
+}
+
+func newAttributeLimit(max int, priorityKeys []string) *attributeLimit {
+	al := &attributeLimit{max: max, priority: make(map[string]int, len(priorityKeys))}
+	for i, key := range priorityKeys {
+		if _, ok := al.priority[key]; !ok {
+			al.priority[key] = i
+		}
+	}
+	return al
+}
+
+// limit drops the attributes of span beyond the limit, keeping the
+// priority keys first, then the others by key, and adds their number
+// to the dropped attributes count of span.
+func (al *attributeLimit) limit(span *tracepb.Span) {
+	attrs := span.GetAttributes()
+	if attrs == nil || len(attrs.AttributeMap) <= al.max {
+		return
+	}
+	keys := make([]string, 0, len(attrs.AttributeMap))
+	for key := range attrs.AttributeMap {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, iok := al.priority[keys[i]]
+		pj, jok := al.priority[keys[j]]
+		switch {
+		case iok && jok:
+			return pi < pj
+		case iok != jok:
+			return iok
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys[al.max:] {
+		delete(attrs.AttributeMap, key)
+	}
+	attrs.DroppedAttributesCount += int32(len(keys) - al.max)
+}
@@ -0,0 +1,61 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestNewExporter_withSpanAttributeLimit(t *testing.T) {
+	ae, err := NewUnstartedExporter(
+		WithSpanAttributeLimit(3, "http.status_code", "error"),
+		WithDefaultSpanAttributes(map[string]interface{}{"region": "eu"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+
+	span := ae.spanToProtoSpan(&trace.SpanData{
+		Attributes: map[string]interface{}{
+			"b":                "1",
+			"a":                "2",
+			"error":            true,
+			"http.status_code": int64(500),
+		},
+	})
+	var keys []string
+	for key := range span.Attributes.AttributeMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if want := []string{"a", "error", "http.status_code"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Kept attributes: got %v want %v", keys, want)
+	}
+	if g, w := span.Attributes.DroppedAttributesCount, int32(2); g != w {
+		t.Errorf("DroppedAttributesCount: got %d want %d", g, w)
+	}
+
+	span = ae.spanToProtoSpan(&trace.SpanData{Attributes: map[string]interface{}{"a": "1"}})
+	if g, w := len(span.Attributes.AttributeMap), 2; g != w {
+		t.Errorf("Attributes under the limit: got %d want %d", g, w)
+	}
+	if g := span.Attributes.DroppedAttributesCount; g != 0 {
+		t.Errorf("DroppedAttributesCount under the limit: got %d want 0", g)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy decides how long the exporter waits between its attempts to
+// reconnect to the agent.
+type BackoffPolicy interface {
+	// NextDelay returns how long to wait after a connection attempt. attempt
+	// is the number of consecutive failed attempts so far and err is the error
+	// of the last one, or 0 and nil if the exporter just connected, in which
+	// case the delay bounds how soon it reconnects if it's disconnected again.
+	NextDelay(attempt int, err error) time.Duration
+}
+
+var (
+	// jitterMu protects jitterRand, shared by the policies of all the exporters.
+	jitterMu sync.Mutex
+	// No strong seeding required, nano time can
+	// already help with pseudo uniqueness.
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration in [0, max).
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int63n(int64(max)))
+}
+
+// ConstantBackoff waits Period, 10 seconds if it's not positive, after every
+// attempt. A random jitter of up to 70% of Period is added to avoid lockstep
+// retrials of other exporters, which could result in an innocent DDOS of the
+// agent. It is the policy used by default and by WithReconnectionPeriod.
+type ConstantBackoff struct {
+	Period time.Duration
+}
+
+var _ BackoffPolicy = ConstantBackoff{}
+
+// NextDelay implements BackoffPolicy.
+func (cb ConstantBackoff) NextDelay(attempt int, err error) time.Duration {
+	period := cb.Period
+	if period <= 0 {
+		period = defaultConnReattemptPeriod
+	}
+	return period + jitter(1+time.Duration(0.7*float64(period)))
+}
+
+// ExponentialBackoff waits Initial after the first failed attempt, and
+// Multiplier times longer after each further one, up to Max. The delay is
+// randomly reduced by up to half to spread the retrials of many exporters.
+// Non-positive fields take the defaults of 1 second for Initial, 2 minutes
+// for Max and 2 for Multiplier, which must otherwise be at least 1.
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+var _ BackoffPolicy = ExponentialBackoff{}
+
+// NextDelay implements BackoffPolicy.
+func (eb ExponentialBackoff) NextDelay(attempt int, err error) time.Duration {
+	initial, max, multiplier := eb.Initial, eb.Max, eb.Multiplier
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if max <= 0 {
+		max = 2 * time.Minute
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(initial)
+	if attempt > 1 {
+		delay *= math.Pow(multiplier, float64(attempt-1))
+	}
+	if delay > float64(max) {
+		delay = float64(max)
+	}
+	return time.Duration(delay)/2 + jitter(time.Duration(delay)/2+1)
+}
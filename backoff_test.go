@@ -0,0 +1,101 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	for _, period := range []time.Duration{0, time.Second} {
+		want := period
+		if want == 0 {
+			want = defaultConnReattemptPeriod
+		}
+		for attempt := 0; attempt < 5; attempt++ {
+			got := ConstantBackoff{Period: period}.NextDelay(attempt, errors.New("failed"))
+			if got < want || got > want+want*7/10+1 {
+				t.Errorf("Period %v, attempt %d: got %v, want %v plus up to 70%%", period, attempt, got, want)
+			}
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	eb := ExponentialBackoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 3}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 3 * time.Second},
+		{3, 9 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		got := eb.NextDelay(tt.attempt, errors.New("failed"))
+		if got < tt.max/2 || got > tt.max {
+			t.Errorf("Attempt %d: got %v, want within [%v, %v]", tt.attempt, got, tt.max/2, tt.max)
+		}
+	}
+}
+
+type recordingBackoff chan int
+
+func (rb recordingBackoff) NextDelay(attempt int, err error) time.Duration {
+	if err != nil {
+		select {
+		case rb <- attempt:
+		default:
+		}
+	}
+	return time.Millisecond
+}
+
+func TestNewExporter_withBackoffPolicy(t *testing.T) {
+	// Nothing listens on the address once the listener is closed.
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	ln.Close()
+
+	attempts := make(recordingBackoff, 100)
+	ae, err := NewExporter(
+		WithInsecure(),
+		WithAddress(ln.Addr().String()),
+		WithBackoffPolicy(attempts),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer ae.Stop()
+
+	for want := 1; want <= 3; want++ {
+		select {
+		case got := <-attempts:
+			if got != want {
+				t.Fatalf("Got attempt %d, want %d", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Attempt %d was never made", want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// The node attributes of WithBatchIDs.
+const (
+	// BatchIDAttributeKey holds the ID of the batch, which is unique
+	// across exporters and processes.
+	BatchIDAttributeKey = "ocagent.batch_id"
+	// BatchSequenceAttributeKey holds the sequence number of the batch
+	// among the batches of the exporter, starting at 1.
+	BatchSequenceAttributeKey = "ocagent.batch_seq"
+)
+
+// BatchIDHeader is the gRPC metadata that carries the batch ID of the
+// unary exports with WithBatchIDs.
+const BatchIDHeader = "ocagent-batch-id"
+
+// batchIDs numbers the batches of an exporter.
+type batchIDs struct {
+	// prefix is random, so that the IDs of different exporters differ.
+	prefix string
+	seq    uint64
+}
+
+func newBatchIDs() *batchIDs {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return &batchIDs{prefix: hex.EncodeToString(b[:])}
+}
+
+// next returns the ID and the sequence number of the next batch.
+func (bi *batchIDs) next() (id string, seq uint64) {
+	seq = atomic.AddUint64(&bi.seq, 1)
+	return fmt.Sprintf("%s-%d", bi.prefix, seq), seq
+}
+
+// stampBatchID sets the batch ID attributes on the node of req, unless
+// it already has some, e.g. when a spooled batch is marshaled again.
+func (ae *Exporter) stampBatchID(req proto.Message) {
+	if ae.batchIDs == nil {
+		return
+	}
+	var node **commonpb.Node
+	var what string
+	switch req := req.(type) {
+	case *agenttracepb.ExportTraceServiceRequest:
+		node, what = &req.Node, fmt.Sprintf("%d spans", len(req.Spans))
+	case *agentmetricspb.ExportMetricsServiceRequest:
+		node, what = &req.Node, fmt.Sprintf("%d metrics", len(req.Metrics))
+	default:
+		return
+	}
+	if _, ok := (*node).GetAttributes()[BatchIDAttributeKey]; ok {
+		return
+	}
+
+	stamped := ae.nodeInfo
+	if *node != nil {
+		stamped = *node
+	}
+	cp := *stamped
+	cp.Attributes = make(map[string]string, len(stamped.GetAttributes())+2)
+	for k, v := range stamped.GetAttributes() {
+		cp.Attributes[k] = v
+	}
+	id, seq := ae.batchIDs.next()
+	cp.Attributes[BatchIDAttributeKey] = id
+	cp.Attributes[BatchSequenceAttributeKey] = strconv.FormatUint(seq, 10)
+	*node = &cp
+	if ae.logger != nil {
+		ae.logger("ocagent: sending %s as batch %s", what, id)
+	}
+}
+
+// withBatchIDHeader adds the batch ID of req, if any, to the outgoing metadata of ctx.
+func withBatchIDHeader(ctx context.Context, req *agenttracepb.ExportTraceServiceRequest) context.Context {
+	id, ok := req.GetNode().GetAttributes()[BatchIDAttributeKey]
+	if !ok {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, BatchIDHeader, id)
+}
@@ -0,0 +1,83 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func TestExporter_withBatchIDs(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	ma := new(metricsAgent)
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	ocexp, err := NewExporter(WithInsecure(), WithAddress(ln.Addr().String()), WithBatchIDs())
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	for i := 0; i < 2; i++ {
+		batch := &agentmetricspb.ExportMetricsServiceRequest{
+			Metrics: []*metricspb.Metric{{MetricDescriptor: &metricspb.MetricDescriptor{Name: "m"}}},
+		}
+		if err := ocexp.ExportMetricsServiceRequest(batch); err != nil {
+			t.Fatalf("Failed to export the metrics: %v", err)
+		}
+	}
+
+	var ids, seqs []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ids) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		ids, seqs = nil, nil
+		ma.forEachRequest(func(req *agentmetricspb.ExportMetricsServiceRequest) {
+			if len(req.Metrics) == 0 {
+				return
+			}
+			attrs := req.GetNode().GetAttributes()
+			ids = append(ids, attrs[BatchIDAttributeKey])
+			seqs = append(seqs, attrs[BatchSequenceAttributeKey])
+		})
+	}
+	if len(ids) != 2 {
+		t.Fatalf("The agent received %d batches, want 2", len(ids))
+	}
+	if seqs[0] != "1" || seqs[1] != "2" {
+		t.Errorf("Got sequence numbers %v, want [1 2]", seqs)
+	}
+	if ids[0] == ids[1] || !strings.HasSuffix(ids[0], "-1") || !strings.HasSuffix(ids[1], "-2") {
+		t.Errorf("Got batch IDs %v", ids)
+	}
+	if got := ocexp.nodeInfo.Attributes[BatchIDAttributeKey]; got != "" {
+		t.Errorf("The node of the exporter was stamped with batch %q", got)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+// The self-metrics of the sizes of the span batches, to tune the thresholds of
+// WithTraceBundlerOptions. Register BatchSpansView and BatchBytesView to export them.
+var (
+	MeasureBatchSpans = stats.Int64(
+		"contrib.go.opencensus.io/exporter/ocagent/batch_spans",
+		"Number of spans in a batch sent to the agent",
+		stats.UnitDimensionless)
+	MeasureBatchBytes = stats.Int64(
+		"contrib.go.opencensus.io/exporter/ocagent/batch_bytes",
+		"Serialized size of a batch of spans sent to the agent",
+		stats.UnitBytes)
+
+	BatchSpansView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/batch_spans",
+		Description: "Distribution of the number of spans in the batches sent to the agent",
+		Measure:     MeasureBatchSpans,
+		Aggregation: view.Distribution(1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000),
+	}
+	BatchBytesView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/batch_bytes",
+		Description: "Distribution of the serialized sizes of the batches of spans sent to the agent",
+		Measure:     MeasureBatchBytes,
+		Aggregation: view.Distribution(1<<10, 4<<10, 16<<10, 64<<10, 256<<10, 1<<20, 4<<20, 16<<20),
+	}
+)
+
+// recordBatchSize records the size of batch, about to be sent to the agent.
+func recordBatchSize(batch *marshaledTraceRequest) {
+	stats.Record(context.Background(),
+		MeasureBatchSpans.M(int64(len(batch.spans))),
+		MeasureBatchBytes.M(int64(len(batch.data))))
+}
@@ -0,0 +1,50 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestRecordBatchSize(t *testing.T) {
+	if err := view.Register(BatchSpansView, BatchBytesView); err != nil {
+		t.Fatalf("Failed to register the views: %v", err)
+	}
+	defer view.Unregister(BatchSpansView, BatchBytesView)
+
+	recordBatchSize(&marshaledTraceRequest{
+		marshaledRequest: &marshaledRequest{data: make([]byte, 3000)},
+		spans:            make([]marshaledSpan, 3),
+	})
+
+	for _, tt := range []struct {
+		view *view.View
+		sum  float64
+	}{
+		{BatchSpansView, 3},
+		{BatchBytesView, 3000},
+	} {
+		rows, err := view.RetrieveData(tt.view.Name)
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("%s: got rows %v, err %v", tt.view.Name, rows, err)
+		}
+		dist := rows[0].Data.(*view.DistributionData)
+		if dist.Count != 1 || dist.Sum() != tt.sum {
+			t.Errorf("%s: got count %d, sum %v, want 1 and %v", tt.view.Name, dist.Count, dist.Sum(), tt.sum)
+		}
+	}
+}
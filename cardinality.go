@@ -0,0 +1,199 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// OverflowLabelValue is the value of every label of the series into which
+// WithMetricCardinalityLimit aggregates the excess series of a metric.
+const OverflowLabelValue = "__overflow__"
+
+// The self-metric of WithMetricCardinalityLimit. Register OverflowSeriesView to export it.
+var (
+	MeasureOverflowSeries = stats.Int64(
+		"contrib.go.opencensus.io/exporter/ocagent/overflow_series",
+		"Number of series aggregated into overflow series",
+		stats.UnitDimensionless)
+
+	OverflowSeriesView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/overflow_series",
+		Description: "Number of series aggregated into overflow series",
+		Measure:     MeasureOverflowSeries,
+		Aggregation: view.Sum(),
+	}
+)
+
+// cardinalityLimiter remembers, per metric, the first limit label sets that
+// were exported. Any other label set is exported as the overflow series.
+type cardinalityLimiter struct {
+	limit int
+
+	mu     sync.Mutex
+	series map[string]map[string]bool
+}
+
+func newCardinalityLimiter(limit int) *cardinalityLimiter {
+	return &cardinalityLimiter{limit: limit, series: make(map[string]map[string]bool)}
+}
+
+// limitMetric replaces the series of metric beyond the limit by a single
+// overflow series, and returns the number of series that it replaced.
+func (cl *cardinalityLimiter) limitMetric(metric *metricspb.Metric) int {
+	desc := metric.GetMetricDescriptor()
+	if desc == nil || len(metric.Timeseries) <= 0 {
+		return 0
+	}
+
+	cl.mu.Lock()
+	known := cl.series[desc.Name]
+	if known == nil {
+		known = make(map[string]bool)
+		cl.series[desc.Name] = known
+	}
+	kept := metric.Timeseries[:0]
+	var overflow *metricspb.TimeSeries
+	n := 0
+	for _, ts := range metric.Timeseries {
+		key := labelSetKey(ts.LabelValues)
+		if !known[key] && len(known) < cl.limit {
+			known[key] = true
+		}
+		if known[key] {
+			kept = append(kept, ts)
+			continue
+		}
+		n++
+		if overflow == nil {
+			overflow = newOverflowSeries(ts, len(desc.LabelKeys))
+			continue
+		}
+		mergeSeries(overflow, ts)
+	}
+	cl.mu.Unlock()
+
+	if overflow != nil {
+		kept = append(kept, overflow)
+	}
+	metric.Timeseries = kept
+	return n
+}
+
+func labelSetKey(labelValues []*metricspb.LabelValue) string {
+	var sb strings.Builder
+	for _, lv := range labelValues {
+		if lv.GetHasValue() {
+			sb.WriteByte('+')
+		} else {
+			sb.WriteByte('-')
+		}
+		sb.WriteString(lv.GetValue())
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+// newOverflowSeries returns an overflow series with numLabels
+// labels, whose points start with those of ts.
+func newOverflowSeries(ts *metricspb.TimeSeries, numLabels int) *metricspb.TimeSeries {
+	labelValues := make([]*metricspb.LabelValue, numLabels)
+	for i := range labelValues {
+		labelValues[i] = &metricspb.LabelValue{Value: OverflowLabelValue, HasValue: true}
+	}
+	return &metricspb.TimeSeries{
+		StartTimestamp: ts.StartTimestamp,
+		LabelValues:    labelValues,
+		Points:         ts.Points,
+	}
+}
+
+// mergeSeries adds the values of the points of src to those of dst.
+func mergeSeries(dst, src *metricspb.TimeSeries) {
+	for i, pt := range src.Points {
+		if i >= len(dst.Points) {
+			dst.Points = append(dst.Points, pt)
+			continue
+		}
+		dst.Points[i] = mergePoints(dst.Points[i], pt)
+	}
+}
+
+func mergePoints(dst, src *metricspb.Point) *metricspb.Point {
+	merged := &metricspb.Point{Timestamp: dst.Timestamp}
+	switch dv := dst.Value.(type) {
+	case *metricspb.Point_Int64Value:
+		merged.Value = &metricspb.Point_Int64Value{Int64Value: dv.Int64Value + src.GetInt64Value()}
+	case *metricspb.Point_DoubleValue:
+		merged.Value = &metricspb.Point_DoubleValue{DoubleValue: dv.DoubleValue + src.GetDoubleValue()}
+	case *metricspb.Point_DistributionValue:
+		merged.Value = &metricspb.Point_DistributionValue{
+			DistributionValue: mergeDistributions(dv.DistributionValue, src.GetDistributionValue()),
+		}
+	default:
+		merged.Value = dst.Value
+	}
+	return merged
+}
+
+// mergeDistributions returns the distribution of the values of both a and b,
+// which must have the same bucket options.
+func mergeDistributions(a, b *metricspb.DistributionValue) *metricspb.DistributionValue {
+	if b == nil || b.Count == 0 {
+		return a
+	}
+	if a.Count == 0 {
+		return b
+	}
+	merged := &metricspb.DistributionValue{
+		Count:         a.Count + b.Count,
+		Sum:           a.Sum + b.Sum,
+		BucketOptions: a.BucketOptions,
+		Buckets:       make([]*metricspb.DistributionValue_Bucket, len(a.Buckets)),
+	}
+	for i, bucket := range a.Buckets {
+		count := bucket.Count
+		if i < len(b.Buckets) {
+			count += b.Buckets[i].Count
+		}
+		merged.Buckets[i] = &metricspb.DistributionValue_Bucket{Count: count}
+	}
+	// Chan et al.'s formula to combine the sums of squared deviations.
+	delta := b.Sum/float64(b.Count) - a.Sum/float64(a.Count)
+	merged.SumOfSquaredDeviation = a.SumOfSquaredDeviation + b.SumOfSquaredDeviation +
+		delta*delta*float64(a.Count)*float64(b.Count)/float64(merged.Count)
+	return merged
+}
+
+// limitCardinality applies WithMetricCardinalityLimit to metrics.
+func (ae *Exporter) limitCardinality(metrics []*metricspb.Metric) {
+	if ae.cardinalityLimiter == nil {
+		return
+	}
+	n := 0
+	for _, metric := range metrics {
+		n += ae.cardinalityLimiter.limitMetric(metric)
+	}
+	if n > 0 {
+		stats.Record(context.Background(), MeasureOverflowSeries.M(int64(n)))
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func int64Series(method string, value int64) *metricspb.TimeSeries {
+	return &metricspb.TimeSeries{
+		LabelValues: []*metricspb.LabelValue{{Value: method, HasValue: true}},
+		Points:      []*metricspb.Point{{Value: &metricspb.Point_Int64Value{Int64Value: value}}},
+	}
+}
+
+func TestCardinalityLimiter_limitMetric(t *testing.T) {
+	cl := newCardinalityLimiter(2)
+	desc := &metricspb.MetricDescriptor{
+		Name:      "calls",
+		LabelKeys: []*metricspb.LabelKey{{Key: "method"}},
+	}
+
+	metric := &metricspb.Metric{
+		MetricDescriptor: desc,
+		Timeseries:       []*metricspb.TimeSeries{int64Series("a", 1), int64Series("b", 2)},
+	}
+	if n := cl.limitMetric(metric); n != 0 || len(metric.Timeseries) != 2 {
+		t.Fatalf("Within the limit: got %d overflowing series and %d series", n, len(metric.Timeseries))
+	}
+
+	// The label sets seen first remain exported, whatever their order.
+	metric = &metricspb.Metric{
+		MetricDescriptor: desc,
+		Timeseries: []*metricspb.TimeSeries{
+			int64Series("c", 3), int64Series("b", 4), int64Series("d", 5), int64Series("a", 6),
+		},
+	}
+	if n := cl.limitMetric(metric); n != 2 {
+		t.Errorf("Got %d overflowing series, want 2", n)
+	}
+	got := make(map[string]int64)
+	for _, ts := range metric.Timeseries {
+		got[ts.LabelValues[0].Value] = ts.Points[0].GetInt64Value()
+	}
+	want := map[string]int64{"a": 6, "b": 4, OverflowLabelValue: 8}
+	if len(got) != len(want) {
+		t.Fatalf("Got series %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Series %q: got %d, want %d", k, got[k], v)
+		}
+	}
+}
+
+func TestMergeDistributions(t *testing.T) {
+	// {1, 3} and {5}
+	a := &metricspb.DistributionValue{
+		Count: 2, Sum: 4, SumOfSquaredDeviation: 2,
+		Buckets: []*metricspb.DistributionValue_Bucket{{Count: 1}, {Count: 1}, {Count: 0}},
+	}
+	b := &metricspb.DistributionValue{
+		Count: 1, Sum: 5, SumOfSquaredDeviation: 0,
+		Buckets: []*metricspb.DistributionValue_Bucket{{Count: 0}, {Count: 0}, {Count: 1}},
+	}
+	got := mergeDistributions(a, b)
+	if got.Count != 3 || got.Sum != 9 || got.SumOfSquaredDeviation != 8 {
+		t.Errorf("Got count=%d sum=%v ssd=%v, want count=3 sum=9 ssd=8", got.Count, got.Sum, got.SumOfSquaredDeviation)
+	}
+	for i, bucket := range got.Buckets {
+		if bucket.Count != 1 {
+			t.Errorf("Bucket #%d: got %d, want 1", i, bucket.Count)
+		}
+	}
+}
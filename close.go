@@ -0,0 +1,42 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// DefaultCloseTimeout bounds how long Close waits for the exporter to stop.
+const DefaultCloseTimeout = 10 * time.Second
+
+var _ io.Closer = (*Exporter)(nil)
+
+var errCloseTimeout = errors.New("ocagent: timed out stopping the exporter")
+
+// Close stops the exporter like Stop, but waits no longer than
+// DefaultCloseTimeout, so that the exporter composes with the helpers and the
+// defers that expect an io.Closer. Closing an exporter that is already
+// stopped is a no-op.
+func (ae *Exporter) Close() error {
+	ae.mu.RLock()
+	stopped := ae.stopped
+	ae.mu.RUnlock()
+	if stopped {
+		return nil
+	}
+	return ae.stopWithin(DefaultCloseTimeout)
+}
@@ -0,0 +1,67 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExporter_Close(t *testing.T) {
+	ae, err := NewExporter(WithInsecure(), WithDryRun(nil))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	if err := ae.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	ae.mu.RLock()
+	stopped := ae.stopped
+	ae.mu.RUnlock()
+	if !stopped {
+		t.Error("The exporter wasn't stopped")
+	}
+
+	if err := ae.Close(); err != nil {
+		t.Errorf("Closing again: %v", err)
+	}
+}
+
+func TestExporter_concurrentStops(t *testing.T) {
+	ae, err := NewExporter(WithInsecure(), WithDryRun(nil))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	errs := make(chan error, 3)
+	go func() { errs <- ae.Stop() }()
+	go func() { errs <- ae.Close() }()
+	go func() { errs <- ae.stopWithin(time.Nanosecond) }()
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil && err != errCloseTimeout {
+			t.Errorf("Stop #%d: %v", i, err)
+		}
+	}
+
+	// A stop that timed out keeps going: the later ones wait for it.
+	if err := ae.Stop(); err != nil && err != errNotStarted {
+		t.Errorf("Stopping again: %v", err)
+	}
+	ae.mu.RLock()
+	stopped := ae.stopped
+	ae.mu.RUnlock()
+	if !stopped {
+		t.Error("The exporter wasn't stopped")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+// SetGzipCompressionLevel sets the level at which the exporters compress
+// requests with UseCompressor("gzip"), one of the levels defined by package
+// compress/gzip except for gzip.HuffmanOnly. Lower levels trade size for
+// speed, which often suits latency-sensitive, high-volume exporters better
+// than the default level.
+//
+// gRPC keeps a single gzip compressor per process, so the level applies to
+// every gRPC client in the process that uses gzip, and it must only be set
+// during initialization, e.g. in an init function, before any gzip compressed
+// RPC is made: it isn't safe to call concurrently with them.
+func SetGzipCompressionLevel(level int) error {
+	return gzip.SetLevel(level)
+}
+
+// compressionCallOptions returns the call options that enable the configured
+// compressor on an RPC, or none if compress is false or no compressor is set.
+func (ae *Exporter) compressionCallOptions(compress bool) []grpc.CallOption {
+	compressor := ae.currentCompressor()
+	if !compress || compressor == "" {
+		return nil
+	}
+	return []grpc.CallOption{grpc.UseCompressor(compressor)}
+}
+
+// exportCallOptions returns the options of the export RPCs: the ones
+// of WithCallOptions, followed by the compressor if compress is set.
+func (ae *Exporter) exportCallOptions(compress bool) []grpc.CallOption {
+	compression := ae.compressionCallOptions(compress)
+	if len(ae.callOptions) == 0 {
+		return compression
+	}
+	opts := make([]grpc.CallOption, 0, len(ae.callOptions)+len(compression))
+	opts = append(opts, ae.callOptions...)
+	return append(opts, compression...)
+}
+
+func (ae *Exporter) currentCompressor() string {
+	ae.mu.RLock()
+	defer ae.mu.RUnlock()
+
+	return ae.compressor
+}
+
+// isCompressionRejection reports whether err is the agent failing an RPC
+// because it has no decompressor for the compressor of the exporter.
+func isCompressionRejection(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.Unimplemented && strings.Contains(st.Message(), "grpc-encoding")
+}
+
+// compressionRejected disables the compressor if err is the agent rejecting
+// it, so that the exporter sends uncompressed data from then on rather than
+// failing every batch. Streams are created with their compressor, so they
+// only fall back once they are reopened on the next connection.
+func (ae *Exporter) compressionRejected(err error) bool {
+	if !isCompressionRejection(err) {
+		return false
+	}
+	ae.mu.Lock()
+	compressor := ae.compressor
+	ae.compressor = ""
+	ae.mu.Unlock()
+	if compressor != "" {
+		ae.recordEvent(EventCompressionDisabled, compressor, 0)
+		if ae.logger != nil {
+			ae.logger("ocagent: the agent rejected the %q compressor, sending uncompressed data instead: %v", compressor, err)
+		}
+	}
+	return true
+}
+
+// metricsExporterFor returns the metrics stream that batch should be sent on,
+// and the generation of the metrics streams. gRPC fixes the compressor of a
+// stream when it is created, so batches that are worth compressing are sent
+// on a separate, compressed stream.
+func (ae *Exporter) metricsExporterFor(batch *marshaledRequest) (agentmetricspb.MetricsService_ExportClient, uint64) {
+	ae.mu.RLock()
+	defer ae.mu.RUnlock()
+
+	if ae.compressedMetricsExporter != nil && len(batch.data) >= ae.metricsCompressionThreshold {
+		return ae.compressedMetricsExporter, ae.streamGenerations.metrics
+	}
+	return ae.metricsExporter, ae.streamGenerations.metrics
+}
@@ -0,0 +1,164 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// noDecompressorAgent is an agent without any decompressor: it fails the
+// RPCs with compressed messages, as gRPC does for an unknown compressor.
+// Unless rejectStreams is set, only the unary exports are failed.
+type noDecompressorAgent struct {
+	rejectStreams bool
+
+	mu    sync.Mutex
+	spans int
+}
+
+func (na *noDecompressorAgent) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	if rc, ok := grpc.ServerTransportStreamFromContext(stream.Context()).(interface{ RecvCompress() string }); ok && rc.RecvCompress() != "" {
+		if na.rejectStreams || method == exportOneMethod {
+			return status.Errorf(codes.Unimplemented, "grpc: Decompressor is not installed for grpc-encoding %q", rc.RecvCompress())
+		}
+	}
+	switch method {
+	case exportOneMethod:
+		req := new(agenttracepb.ExportTraceServiceRequest)
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		na.addSpans(len(req.Spans))
+		return stream.SendMsg(new(agenttracepb.ExportTraceServiceResponse))
+	case "/opencensus.proto.agent.trace.v1.TraceService/Export":
+		for {
+			req := new(agenttracepb.ExportTraceServiceRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			na.addSpans(len(req.Spans))
+		}
+	default:
+		<-stream.Context().Done()
+		return nil
+	}
+}
+
+func (na *noDecompressorAgent) addSpans(n int) {
+	na.mu.Lock()
+	na.spans += n
+	na.mu.Unlock()
+}
+
+func (na *noDecompressorAgent) receivedSpans() int {
+	na.mu.Lock()
+	defer na.mu.Unlock()
+	return na.spans
+}
+
+func startNoDecompressorAgent(t *testing.T, rejectStreams bool) (*noDecompressorAgent, string, func()) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	na := &noDecompressorAgent{rejectStreams: rejectStreams}
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(na.handle))
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	return na, ln.Addr().String(), srv.Stop
+}
+
+func TestIsCompressionRejection(t *testing.T) {
+	if !isCompressionRejection(status.Error(codes.Unimplemented, `grpc: Decompressor is not installed for grpc-encoding "gzip"`)) {
+		t.Error("A missing decompressor wasn't recognized")
+	}
+	if isCompressionRejection(status.Error(codes.Unimplemented, "unknown service")) {
+		t.Error("An unimplemented service was taken for a rejected compressor")
+	}
+}
+
+func TestExporter_fallsBackWhenTheAgentRejectsTheCompressorOfUnaryExports(t *testing.T) {
+	na, addr, stop := startNoDecompressorAgent(t, false)
+	defer stop()
+
+	ae, err := NewExporter(
+		WithInsecure(),
+		WithAddress(addr),
+		UseCompressor(gzip.Name),
+		WithUnaryBatchExporter(UnaryExporterParams{}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer ae.Stop()
+
+	batch := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}}},
+	}
+	if err := ae.ExportTraceServiceRequest(batch); err != nil {
+		t.Fatalf("The export failed rather than falling back: %v", err)
+	}
+	if got := na.receivedSpans(); got != 1 {
+		t.Errorf("Received %d spans, want 1", got)
+	}
+	if got := ae.currentCompressor(); got != "" {
+		t.Errorf("The compressor is still %q", got)
+	}
+}
+
+func TestExporter_fallsBackWhenTheAgentRejectsTheCompressorOfStreams(t *testing.T) {
+	na, addr, stop := startNoDecompressorAgent(t, true)
+	defer stop()
+
+	ae, err := NewExporter(
+		WithInsecure(),
+		WithAddress(addr),
+		UseCompressor(gzip.Name),
+		WithReconnectionPeriod(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer ae.Stop()
+
+	batch := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}}},
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		_ = ae.ExportTraceServiceRequest(batch)
+		if na.receivedSpans() > 0 {
+			if got := ae.currentCompressor(); got != "" {
+				t.Errorf("The compressor is still %q", got)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("The exporter never fell back to uncompressed streams")
+}
@@ -0,0 +1,280 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ExporterConfig is an alternative to the functional options: it describes the
+// configuration of an exporter as a single value, which can be unmarshaled from
+// JSON or YAML, validated, compared and logged. The zero value uses the defaults.
+type ExporterConfig struct {
+	Address            string             `json:"address,omitempty" yaml:"address,omitempty"`
+	ServiceName        string             `json:"service_name,omitempty" yaml:"service_name,omitempty"`
+	Insecure           bool               `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	TLS                *TLSConfig         `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Headers            map[string]string  `json:"headers,omitempty" yaml:"headers,omitempty"`
+	TraceHeaders       map[string]string  `json:"trace_headers,omitempty" yaml:"trace_headers,omitempty"`
+	MetricsHeaders     map[string]string  `json:"metrics_headers,omitempty" yaml:"metrics_headers,omitempty"`
+	Compressor         string             `json:"compressor,omitempty" yaml:"compressor,omitempty"`
+	ReconnectionPeriod Duration           `json:"reconnection_period,omitempty" yaml:"reconnection_period,omitempty"`
+	TraceBatching      *BatchingConfig    `json:"trace_batching,omitempty" yaml:"trace_batching,omitempty"`
+	ViewDataBatching   *BatchingConfig    `json:"view_data_batching,omitempty" yaml:"view_data_batching,omitempty"`
+	UnaryExport        *UnaryExportConfig `json:"unary_export,omitempty" yaml:"unary_export,omitempty"`
+	Retry              *RetryConfig       `json:"retry,omitempty" yaml:"retry,omitempty"`
+}
+
+// TLSConfig configures TLS with the agent.
+type TLSConfig struct {
+	// CAFile is a PEM file with the certificates used to verify the agent.
+	CAFile     string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+}
+
+// BatchingConfig is the serializable form of BundlerOptions.
+type BatchingConfig struct {
+	Delay         Duration `json:"delay,omitempty" yaml:"delay,omitempty"`
+	Count         int      `json:"count,omitempty" yaml:"count,omitempty"`
+	BufferedBytes int      `json:"buffered_bytes,omitempty" yaml:"buffered_bytes,omitempty"`
+}
+
+// UnaryExportConfig is the serializable form of UnaryExporterParams.
+type UnaryExportConfig struct {
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+// RetryConfig is the serializable form of RetryParams,
+// with an ExponentialBackoff.
+type RetryConfig struct {
+	MaxAttempts    int      `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	InitialBackoff Duration `json:"initial_backoff,omitempty" yaml:"initial_backoff,omitempty"`
+	MaxBackoff     Duration `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+	MaxElapsedTime Duration `json:"max_elapsed_time,omitempty" yaml:"max_elapsed_time,omitempty"`
+}
+
+// Duration is a time.Duration that is written as a string such as "1.5s"
+// when marshaled to, or unmarshaled from, JSON and YAML.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) parse(s string) error {
+	pd, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(pd)
+	return nil
+}
+
+var errInsecureAndTLS = errors.New("insecure and tls are mutually exclusive")
+
+// Validate reports the first inconsistency found in the configuration, if any.
+func (cfg *ExporterConfig) Validate() error {
+	if cfg.Insecure && cfg.TLS != nil {
+		return errInsecureAndTLS
+	}
+	if cfg.ReconnectionPeriod < 0 {
+		return fmt.Errorf("negative reconnection_period %v", cfg.ReconnectionPeriod)
+	}
+	for name, b := range map[string]*BatchingConfig{"trace_batching": cfg.TraceBatching, "view_data_batching": cfg.ViewDataBatching} {
+		if b != nil && (b.Delay < 0 || b.Count < 0 || b.BufferedBytes < 0) {
+			return fmt.Errorf("negative value in %s", name)
+		}
+	}
+	if r := cfg.Retry; r != nil && (r.MaxAttempts < 0 || r.InitialBackoff < 0 || r.MaxBackoff < 0 || r.MaxElapsedTime < 0) {
+		return errors.New("negative value in retry")
+	}
+	return nil
+}
+
+// Options validates the configuration and returns the equivalent exporter options.
+func (cfg *ExporterConfig) Options() ([]ExporterOption, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []ExporterOption
+	if cfg.Address != "" {
+		opts = append(opts, WithAddress(cfg.Address))
+	}
+	if cfg.ServiceName != "" {
+		opts = append(opts, WithServiceName(cfg.ServiceName))
+	}
+	if cfg.Insecure {
+		opts = append(opts, WithInsecure())
+	}
+	if cfg.TLS != nil {
+		creds, err := credentials.NewClientTLSFromFile(cfg.TLS.CAFile, cfg.TLS.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLSCredentials(creds))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, WithHeaders(cfg.Headers))
+	}
+	if len(cfg.TraceHeaders) > 0 {
+		opts = append(opts, WithTraceHeaders(cfg.TraceHeaders))
+	}
+	if len(cfg.MetricsHeaders) > 0 {
+		opts = append(opts, WithMetricsHeaders(cfg.MetricsHeaders))
+	}
+	if cfg.Compressor != "" {
+		opts = append(opts, UseCompressor(cfg.Compressor))
+	}
+	if cfg.ReconnectionPeriod > 0 {
+		opts = append(opts, WithReconnectionPeriod(time.Duration(cfg.ReconnectionPeriod)))
+	}
+	if b := cfg.TraceBatching; b != nil {
+		opts = append(opts, WithTraceBundlerOptions(b.bundlerOptions()))
+	}
+	if b := cfg.ViewDataBatching; b != nil {
+		opts = append(opts, WithViewDataBundlerOptions(b.bundlerOptions()))
+	}
+	if u := cfg.UnaryExport; u != nil {
+		opts = append(opts, WithUnaryBatchExporter(UnaryExporterParams{Timeout: time.Duration(u.Timeout)}))
+	}
+	if r := cfg.Retry; r != nil {
+		opts = append(opts, WithRetry(r.retryParams()))
+	}
+	return opts, nil
+}
+
+// Build creates and starts an exporter from the configuration, like NewExporter.
+// Any extra options are applied after, and hence take precedence over, the
+// configuration, e.g. for settings such as a resource detector that can't be
+// expressed in a file.
+func (cfg *ExporterConfig) Build(extra ...ExporterOption) (*Exporter, error) {
+	opts, err := cfg.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewExporter(append(opts, extra...)...)
+}
+
+// String returns a description of the configuration that is safe to log:
+// the values of the headers, which often carry credentials, are redacted.
+func (cfg ExporterConfig) String() string {
+	cfg.Headers = redactHeaders(cfg.Headers)
+	cfg.TraceHeaders = redactHeaders(cfg.TraceHeaders)
+	cfg.MetricsHeaders = redactHeaders(cfg.MetricsHeaders)
+	blob, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Sprintf("ExporterConfig{error: %v}", err)
+	}
+	return string(blob)
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	redacted := make(map[string]string, len(headers))
+	for key := range headers {
+		redacted[key] = "REDACTED"
+	}
+	return redacted
+}
+
+// Diff returns the names of the settings that differ between cfg and other,
+// sorted alphabetically, e.g. to log what a configuration reload changes.
+func (cfg *ExporterConfig) Diff(other *ExporterConfig) []string {
+	var a, b map[string]interface{}
+	blobA, _ := json.Marshal(cfg)
+	blobB, _ := json.Marshal(other)
+	_ = json.Unmarshal(blobA, &a)
+	_ = json.Unmarshal(blobB, &b)
+
+	var diff []string
+	for key, va := range a {
+		if vb, ok := b[key]; !ok || !jsonEqual(va, vb) {
+			diff = append(diff, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			diff = append(diff, key)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+func jsonEqual(a, b interface{}) bool {
+	blobA, _ := json.Marshal(a)
+	blobB, _ := json.Marshal(b)
+	return string(blobA) == string(blobB)
+}
+
+func (b *BatchingConfig) bundlerOptions() BundlerOptions {
+	return BundlerOptions{
+		DelayThreshold:       time.Duration(b.Delay),
+		BundleCountThreshold: b.Count,
+		BufferedByteLimit:    b.BufferedBytes,
+	}
+}
+
+func (r *RetryConfig) retryParams() RetryParams {
+	p := RetryParams{
+		MaxAttempts:    r.MaxAttempts,
+		MaxElapsedTime: time.Duration(r.MaxElapsedTime),
+	}
+	if r.InitialBackoff > 0 || r.MaxBackoff > 0 {
+		// The bound that isn't set keeps the default of RetryParams.
+		backoff := defaultRetryBackoff
+		if r.InitialBackoff > 0 {
+			backoff.Initial = time.Duration(r.InitialBackoff)
+		}
+		if r.MaxBackoff > 0 {
+			backoff.Max = time.Duration(r.MaxBackoff)
+		}
+		p.Backoff = backoff
+	}
+	return p
+}
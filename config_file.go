@@ -0,0 +1,94 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LoadConfigFile reads the exporter options from a YAML file, or from a JSON file
+// if its name ends in ".json". This lets exporters across a fleet be configured
+// outside of code. The recognized keys are:
+//
+//	address: "agent.example.com:55678"
+//	service_name: "frontend"
+//	insecure: false
+//	tls:
+//	  ca_file: "/etc/ocagent/ca.pem"
+//	  server_name: "agent.example.com"
+//	headers:
+//	  api-key: "secret"
+//	trace_headers:
+//	  api-key: "traces-secret"
+//	metrics_headers:
+//	  api-key: "metrics-secret"
+//	compressor: "gzip"
+//	reconnection_period: "5s"
+//	trace_batching:
+//	  delay: "1s"
+//	  count: 300
+//	  buffered_bytes: 8388608
+//	view_data_batching:
+//	  delay: "10s"
+//	unary_export:
+//	  timeout: "5s"
+//	retry:
+//	  max_attempts: 5
+//	  initial_backoff: "200ms"
+//	  max_backoff: "10s"
+//	  max_elapsed_time: "30s"
+//
+// Unknown keys are rejected in both formats.
+//
+// Options that are passed to NewExporter after the returned ones take precedence.
+func LoadConfigFile(path string) ([]ExporterOption, error) {
+	cfg, err := LoadExporterConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := cfg.Options()
+	if err != nil {
+		return nil, fmt.Errorf("ocagent: config file %q: %v", path, err)
+	}
+	return opts, nil
+}
+
+// LoadExporterConfig reads an ExporterConfig from a file in the
+// format described by LoadConfigFile, without validating it.
+func LoadExporterConfig(path string) (*ExporterConfig, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(ExporterConfig)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(blob))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	} else {
+		err = yaml.UnmarshalStrict(blob, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ocagent: config file %q: %v", path, err)
+	}
+	return cfg, nil
+}
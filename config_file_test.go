@@ -0,0 +1,120 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-config")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config.yaml": `
+address: "agent:55678"
+service_name: "frontend"
+insecure: true
+headers:
+  api-key: "secret"
+reconnection_period: "5s"
+trace_batching:
+  delay: "1s"
+  count: 10
+retry:
+  max_attempts: 5
+  initial_backoff: "200ms"
+`,
+		"config.json": `{
+	"address": "agent:55678",
+	"service_name": "frontend",
+	"insecure": true,
+	"headers": {"api-key": "secret"},
+	"reconnection_period": "5s",
+	"trace_batching": {"delay": "1s", "count": 10},
+	"retry": {"max_attempts": 5, "initial_backoff": "200ms"}
+}`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %q: %v", name, err)
+		}
+		opts, err := LoadConfigFile(path)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", name, err)
+			continue
+		}
+		exp, err := NewUnstartedExporter(opts...)
+		if err != nil {
+			t.Errorf("%q: failed to create the exporter: %v", name, err)
+			continue
+		}
+
+		if g, w := exp.agentAddress, "agent:55678"; g != w {
+			t.Errorf("%q: address: got %q want %q", name, g, w)
+		}
+		if g, w := exp.serviceName, "frontend"; g != w {
+			t.Errorf("%q: service name: got %q want %q", name, g, w)
+		}
+		if !exp.canDialInsecure {
+			t.Errorf("%q: expected insecure dialing", name)
+		}
+		if g, w := exp.headers, map[string]string{"api-key": "secret"}; !reflect.DeepEqual(g, w) {
+			t.Errorf("%q: headers: got %v want %v", name, g, w)
+		}
+		if g, w := exp.reconnectionPeriod, 5*time.Second; g != w {
+			t.Errorf("%q: reconnection period: got %v want %v", name, g, w)
+		}
+		if g, w := exp.traceBundlerOptions, (BundlerOptions{DelayThreshold: time.Second, BundleCountThreshold: 10}); g != w {
+			t.Errorf("%q: trace bundler options: got %+v want %+v", name, g, w)
+		}
+		wantRetry := &RetryParams{MaxAttempts: 5, Backoff: ExponentialBackoff{Initial: 200 * time.Millisecond, Max: 5 * time.Second}}
+		if g, w := exp.retryParams, wantRetry; !reflect.DeepEqual(g, w) {
+			t.Errorf("%q: retry params: got %+v want %+v", name, g, w)
+		}
+	}
+}
+
+func TestLoadConfigFile_unknownKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-config")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"config.yaml": "adress: agent:55678\n",
+		"config.json": `{"adress": "agent:55678"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %q: %v", name, err)
+		}
+		if _, err := LoadConfigFile(path); err == nil {
+			t.Errorf("%q: expected an error for a misspelled key", name)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExporterConfig_validate(t *testing.T) {
+	tests := []struct {
+		cfg     ExporterConfig
+		wantErr bool
+	}{
+		{cfg: ExporterConfig{}},
+		{cfg: ExporterConfig{Insecure: true, Address: "agent:55678"}},
+		{cfg: ExporterConfig{Insecure: true, TLS: &TLSConfig{}}, wantErr: true},
+		{cfg: ExporterConfig{ReconnectionPeriod: Duration(-time.Second)}, wantErr: true},
+		{cfg: ExporterConfig{TraceBatching: &BatchingConfig{Count: -1}}, wantErr: true},
+	}
+
+	for i, tt := range tests {
+		err := tt.cfg.Validate()
+		if g, w := err != nil, tt.wantErr; g != w {
+			t.Errorf("#%d: got error %v, want error: %t", i, err, w)
+		}
+	}
+}
+
+func TestExporterConfig_stringRedactsHeaders(t *testing.T) {
+	cfg := ExporterConfig{
+		Address:            "agent:55678",
+		Headers:            map[string]string{"api-key": "secret"},
+		MetricsHeaders:     map[string]string{"metrics-key": "secret"},
+		ReconnectionPeriod: Duration(5 * time.Second),
+	}
+	got := cfg.String()
+	want := `{"address":"agent:55678","headers":{"api-key":"REDACTED"},"metrics_headers":{"metrics-key":"REDACTED"},"reconnection_period":"5s"}`
+	if got != want {
+		t.Errorf("Got:  %s\nWant: %s", got, want)
+	}
+	if !strings.Contains(cfg.Headers["api-key"], "secret") {
+		t.Error("String must not modify the configuration")
+	}
+}
+
+func TestExporterConfig_diff(t *testing.T) {
+	a := &ExporterConfig{Address: "agent:55678", Insecure: true, Headers: map[string]string{"k": "v1"}}
+	b := &ExporterConfig{Address: "agent:55678", Compressor: "gzip", Headers: map[string]string{"k": "v2"}}
+
+	got := a.Diff(b)
+	want := []string{"compressor", "headers", "insecure"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v want %v", got, want)
+	}
+}
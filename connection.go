@@ -15,16 +15,30 @@
 package ocagent
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
 	"sync/atomic"
 	"time"
 	"unsafe"
 )
 
+// Connection states, stored in Exporter.connState. They are read on every
+// batch, hence they are only ever accessed atomically, never under a lock.
+const (
+	// stateIdle is the state before the first connection attempt: batches
+	// are optimistically treated as if the exporter were connected.
+	stateIdle int32 = iota
+	stateConnected
+	stateDisconnected
+)
+
 func (ae *Exporter) lastConnectError() error {
+	if atomic.LoadInt32(&ae.connState) != stateDisconnected {
+		return nil
+	}
 	errPtr := (*error)(atomic.LoadPointer(&ae.lastConnectErrPtr))
 	if errPtr == nil {
+		// The exporter reconnected in the meantime.
 		return nil
 	}
 	return *errPtr
@@ -39,8 +53,18 @@ func (ae *Exporter) saveLastConnectError(err error) {
 }
 
 func (ae *Exporter) setStateDisconnected(err error) {
+	ae.throttleOn(err)
+	ae.compressionRejected(err)
+	if atomic.LoadInt32(&ae.connState) != stateDisconnected {
+		ae.recordEvent(EventDisconnected, fmt.Sprint(err), 0)
+	}
 	err = fmt.Errorf("no active connection, last connection error: %v", err)
+	// The error is saved before the state changes, so that
+	// it is set whenever the exporter is seen disconnected.
 	ae.saveLastConnectError(err)
+	if atomic.SwapInt32(&ae.connState, stateDisconnected) != stateDisconnected {
+		atomic.StoreInt64(&ae.disconnectedSinceUnixNano, time.Now().UnixNano())
+	}
 	select {
 	case ae.disconnectedCh <- true:
 	default:
@@ -48,11 +72,15 @@ func (ae *Exporter) setStateDisconnected(err error) {
 }
 
 func (ae *Exporter) setStateConnected() {
+	ae.recordEvent(EventConnected, ae.prepareAgentAddress(), 0)
+	ae.countConnection()
+	atomic.StoreInt32(&ae.connState, stateConnected)
 	ae.saveLastConnectError(nil)
+	ae.kickSpool()
 }
 
 func (ae *Exporter) connected() bool {
-	return ae.lastConnectError() == nil
+	return atomic.LoadInt32(&ae.connState) != stateDisconnected
 }
 
 const defaultConnReattemptPeriod = 10 * time.Second
@@ -62,18 +90,12 @@ func (ae *Exporter) indefiniteBackgroundConnection() error {
 		ae.backgroundConnectionDoneCh <- true
 	}()
 
-	connReattemptPeriod := ae.reconnectionPeriod
-	if connReattemptPeriod <= 0 {
-		connReattemptPeriod = defaultConnReattemptPeriod
+	policy := ae.backoffPolicy
+	if policy == nil {
+		policy = ConstantBackoff{Period: ae.reconnectionPeriod}
 	}
 
-	// No strong seeding required, nano time can
-	// already help with pseudo uniqueness.
-	rng := rand.New(rand.NewSource(time.Now().UnixNano() + rand.Int63n(1024)))
-
-	// maxJitter: 1 + (70% of the connectionReattemptPeriod)
-	maxJitter := int64(1 + 0.7*float64(connReattemptPeriod))
-
+	attempt := 0
 	for {
 		// Otherwise these will be the normal scenarios to enable
 		// reconnections if we trip out.
@@ -88,20 +110,21 @@ func (ae *Exporter) indefiniteBackgroundConnection() error {
 			// Normal scenario that we'll wait for
 		}
 
-		if err := ae.connect(); err == nil {
+		err := ae.connect()
+		if err == nil {
+			attempt = 0
 			ae.setStateConnected()
 		} else {
+			attempt++
 			ae.setStateDisconnected(err)
 		}
 
-		// Apply some jitter to avoid lockstep retrials of other
-		// agent-exporters. Lockstep retrials could result in an
-		// innocent DDOS, by clogging the machine's resources and network.
-		jitter := time.Duration(rng.Int63n(maxJitter))
 		select {
 		case <-ae.stopCh:
 			return errStopped
-		case <-time.After(connReattemptPeriod + jitter):
+		case <-ae.reconnectCh:
+			// SetAgentAddress or Reconnect: don't wait to dial the agent.
+		case <-time.After(policy.NextDelay(attempt, err)):
 		}
 	}
 }
@@ -113,3 +136,37 @@ func (ae *Exporter) connect() error {
 	}
 	return ae.enableConnectionStreams(cc)
 }
+
+// Reconnect tears down the connection to the agent and dials it again right
+// away, regardless of the backoff policy, e.g. after the agent's endpoint or
+// credentials were rotated. The current connection is closed once the new
+// one is established, and the exporter reports itself disconnected meanwhile.
+func (ae *Exporter) Reconnect() error {
+	ae.mu.RLock()
+	started, stopped := ae.started, ae.stopped
+	ae.mu.RUnlock()
+
+	if stopped {
+		return errStopped
+	}
+	if !started {
+		return errNotStarted
+	}
+	ae.redial(errReconnectRequested)
+	return nil
+}
+
+var errReconnectRequested = errors.New("reconnection requested")
+
+// redial disconnects the exporter for reason, and has the
+// background connection dial the agent again without delay.
+func (ae *Exporter) redial(reason error) {
+	if ae.dryRun != nil {
+		return
+	}
+	ae.setStateDisconnected(reason)
+	select {
+	case ae.reconnectCh <- true:
+	default:
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// ConnectivityState returns the state of the gRPC channel to the agent, which
+// tells more than whether the exporter is connected: e.g. CONNECTING while the
+// agent is dialed, or TRANSIENT_FAILURE while it can't be reached. It is IDLE
+// before the exporter first dials the agent and SHUTDOWN once it is stopped.
+func (ae *Exporter) ConnectivityState() connectivity.State {
+	ae.mu.RLock()
+	cc, stopped := ae.grpcClientConn, ae.stopped
+	ae.mu.RUnlock()
+	switch {
+	case stopped:
+		return connectivity.Shutdown
+	case cc == nil:
+		return connectivity.Idle
+	default:
+		return cc.GetState()
+	}
+}
+
+// watchConnectivity reports the states of cc to the connectivity state
+// callback for as long as cc is the connection to the agent.
+func (ae *Exporter) watchConnectivity(cc *grpc.ClientConn) {
+	state := cc.GetState()
+	for {
+		ae.mu.RLock()
+		current := ae.grpcClientConn == cc
+		ae.mu.RUnlock()
+		if !current {
+			// cc was replaced by a new connection, which reports its own states.
+			return
+		}
+		ae.connectivityStateCallback(state)
+		if state == connectivity.Shutdown || !cc.WaitForStateChange(context.Background(), state) {
+			return
+		}
+		state = cc.GetState()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+func TestExporter_connectivityStateCallback(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	states := make(chan connectivity.State, 100)
+	exp, err := ocagent.NewUnstartedExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(time.Hour),
+		ocagent.WithConnectivityStateCallback(func(state connectivity.State) {
+			states <- state
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	if got := exp.ConnectivityState(); got != connectivity.Idle {
+		t.Errorf("Before Start: got %v, want %v", got, connectivity.Idle)
+	}
+	if err := exp.Start(); err != nil {
+		t.Fatalf("Failed to start the exporter: %v", err)
+	}
+
+	waitForState := func(want connectivity.State) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case state := <-states:
+				if state == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("The exporter never reported %v", want)
+			}
+		}
+	}
+	waitForState(connectivity.Ready)
+	if got := exp.ConnectivityState(); got != connectivity.Ready {
+		t.Errorf("Once connected: got %v, want %v", got, connectivity.Ready)
+	}
+
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("Failed to stop the exporter: %v", err)
+	}
+	waitForState(connectivity.Shutdown)
+	if got := exp.ConnectivityState(); got != connectivity.Shutdown {
+		t.Errorf("Once stopped: got %v, want %v", got, connectivity.Shutdown)
+	}
+}
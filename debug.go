@@ -0,0 +1,78 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// DebugEnvVar is the environment variable that, when set to a true value such
+// as "1", makes every exporter print a summary of each outgoing request to
+// stderr, without any code change, e.g. to diagnose conversion issues.
+const DebugEnvVar = "OCAGENT_EXPORTER_DEBUG"
+
+// maxDebugProtoLen bounds the text of each request printed with DebugEnvVar.
+const maxDebugProtoLen = 1024
+
+// debugWriter is where requests are printed with DebugEnvVar.
+type debugWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func debugWriterFromEnv() *debugWriter {
+	if on, _ := strconv.ParseBool(os.Getenv(DebugEnvVar)); !on {
+		return nil
+	}
+	return &debugWriter{w: os.Stderr}
+}
+
+// debugRequest prints a summary of req, which is about to be sent, with DebugEnvVar.
+func (ae *Exporter) debugRequest(signal string, req proto.Message) {
+	if ae.debug == nil {
+		return
+	}
+	size := 0
+	if mr, ok := req.(*marshaledRequest); ok {
+		size = len(mr.data)
+		req = mr.Message
+	} else {
+		size = proto.Size(req)
+	}
+	var count string
+	switch req := req.(type) {
+	case *agenttracepb.ExportTraceServiceRequest:
+		count = fmt.Sprintf("%d spans", len(req.Spans))
+	case *agentmetricspb.ExportMetricsServiceRequest:
+		count = fmt.Sprintf("%d metrics", len(req.Metrics))
+	}
+	text := proto.CompactTextString(req)
+	if len(text) > maxDebugProtoLen {
+		text = text[:maxDebugProtoLen] + "..."
+	}
+
+	ae.debug.mu.Lock()
+	defer ae.debug.mu.Unlock()
+	fmt.Fprintf(ae.debug.w, "ocagent: sending %s (%s, %d bytes): %s\n", signal, count, size, text)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestDebugWriterFromEnv(t *testing.T) {
+	defer os.Setenv(DebugEnvVar, os.Getenv(DebugEnvVar))
+
+	for _, value := range []string{"", "0", "false", "yes"} {
+		os.Setenv(DebugEnvVar, value)
+		if dw := debugWriterFromEnv(); dw != nil {
+			t.Errorf("%s=%q: got a debug writer", DebugEnvVar, value)
+		}
+	}
+	for _, value := range []string{"1", "true"} {
+		os.Setenv(DebugEnvVar, value)
+		if dw := debugWriterFromEnv(); dw == nil {
+			t.Errorf("%s=%q: got no debug writer", DebugEnvVar, value)
+		}
+	}
+}
+
+func TestExporter_debugRequest(t *testing.T) {
+	buf := new(bytes.Buffer)
+	ae := &Exporter{debug: &debugWriter{w: buf}}
+	req := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: strings.Repeat("x", 2*maxDebugProtoLen)}}},
+	}
+	mr, err := ae.marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	ae.debugRequest(teeSignalTraces, mr)
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "ocagent: sending traces (1 spans, ") || !strings.HasSuffix(got, "...\n") {
+		t.Errorf("Unexpected summary: %q", got)
+	}
+	if len(got) > 2*maxDebugProtoLen {
+		t.Errorf("The summary wasn't truncated: %d bytes", len(got))
+	}
+}
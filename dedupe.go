@@ -0,0 +1,94 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// metricKey identifies the metrics that can be merged: those with the
+// same name, type and label keys.
+func metricKey(desc *metricspb.MetricDescriptor) string {
+	var sb strings.Builder
+	sb.WriteString(desc.GetName())
+	sb.WriteByte(0)
+	sb.WriteString(desc.GetType().String())
+	for _, lk := range desc.GetLabelKeys() {
+		sb.WriteByte(0)
+		sb.WriteString(lk.GetKey())
+	}
+	return sb.String()
+}
+
+// dedupedMetric is a metric of a batch and the index of its timeseries by label set.
+type dedupedMetric struct {
+	metric *metricspb.Metric
+	series map[string]int
+}
+
+// add adds series to the timeseries of dm, replacing the ones with the same
+// label set if their last point is older.
+func (dm *dedupedMetric) add(series []*metricspb.TimeSeries) {
+	for _, ts := range series {
+		key := labelSetKey(ts.LabelValues)
+		i, ok := dm.series[key]
+		if !ok {
+			dm.series[key] = len(dm.metric.Timeseries)
+			dm.metric.Timeseries = append(dm.metric.Timeseries, ts)
+			continue
+		}
+		if timestampBefore(lastPointTimestamp(dm.metric.Timeseries[i]), lastPointTimestamp(ts)) {
+			dm.metric.Timeseries[i] = ts
+		}
+	}
+}
+
+func lastPointTimestamp(ts *metricspb.TimeSeries) *timestamp.Timestamp {
+	if len(ts.Points) == 0 {
+		return nil
+	}
+	return ts.Points[len(ts.Points)-1].GetTimestamp()
+}
+
+// dedupeMetrics merges the metrics of a batch that have the same name, type
+// and label keys, as happens when several views alias a measure under the
+// same name, into the first of them. A timeseries is sent once per label set:
+// of duplicates, the one with the latest point is kept rather than adding
+// them up, since they count the same measurements. The metrics left are
+// returned, reusing the storage of metrics.
+func dedupeMetrics(metrics []*metricspb.Metric) []*metricspb.Metric {
+	deduped := make(map[string]*dedupedMetric, len(metrics))
+	kept := metrics[:0]
+	for _, metric := range metrics {
+		key := metricKey(metric.GetMetricDescriptor())
+		if dm, ok := deduped[key]; ok {
+			dm.add(metric.Timeseries)
+			continue
+		}
+		// The timeseries of the first metric are added back one by
+		// one, as they may have duplicates among themselves too.
+		series := metric.Timeseries
+		metric.Timeseries = make([]*metricspb.TimeSeries, 0, len(series))
+		dm := &dedupedMetric{metric: metric, series: make(map[string]int, len(series))}
+		dm.add(series)
+		deduped[key] = dm
+		kept = append(kept, metric)
+	}
+	return kept
+}
@@ -0,0 +1,67 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func TestDedupeMetrics(t *testing.T) {
+	desc := &metricspb.MetricDescriptor{
+		Name:      "calls",
+		Type:      metricspb.MetricDescriptor_CUMULATIVE_INT64,
+		LabelKeys: []*metricspb.LabelKey{{Key: "method"}},
+	}
+	at := func(ts *metricspb.TimeSeries, seconds int64) *metricspb.TimeSeries {
+		ts.Points[0].Timestamp = &timestamp.Timestamp{Seconds: seconds}
+		return ts
+	}
+	older, newer := at(int64Series("a", 1), 1), at(int64Series("a", 2), 2)
+	b := at(int64Series("b", 3), 1)
+	// Same name but other label keys: can't be merged.
+	other := &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{Name: "calls", Type: metricspb.MetricDescriptor_CUMULATIVE_INT64},
+		Timeseries:       []*metricspb.TimeSeries{{Points: []*metricspb.Point{{}}}},
+	}
+
+	got := dedupeMetrics([]*metricspb.Metric{
+		{MetricDescriptor: desc, Timeseries: []*metricspb.TimeSeries{older, b}},
+		other,
+		{MetricDescriptor: desc, Timeseries: []*metricspb.TimeSeries{newer, b}},
+	})
+	want := []*metricspb.Metric{
+		{MetricDescriptor: desc, Timeseries: []*metricspb.TimeSeries{newer, b}},
+		other,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v\nwant %v", got, want)
+	}
+
+	// Duplicates within a single metric are dropped too.
+	got = dedupeMetrics([]*metricspb.Metric{
+		{MetricDescriptor: desc, Timeseries: []*metricspb.TimeSeries{newer, older}},
+	})
+	want = []*metricspb.Metric{
+		{MetricDescriptor: desc, Timeseries: []*metricspb.TimeSeries{newer}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %v\nwant %v", got, want)
+	}
+}
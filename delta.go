@@ -0,0 +1,177 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// deltaConverter turns cumulative points into delta points. The metrics
+// protocol has no delta type, hence a delta point is exported as a cumulative
+// point whose start is the end of the previous point of its series.
+type deltaConverter struct {
+	mu sync.Mutex
+	// previous is the last cumulative point of each series, keyed
+	// by the name of its metric followed by its label set.
+	previous map[string]*metricspb.Point
+}
+
+func newDeltaConverter() *deltaConverter {
+	return &deltaConverter{previous: make(map[string]*metricspb.Point)}
+}
+
+func isCumulative(t metricspb.MetricDescriptor_Type) bool {
+	switch t {
+	case metricspb.MetricDescriptor_CUMULATIVE_INT64,
+		metricspb.MetricDescriptor_CUMULATIVE_DOUBLE,
+		metricspb.MetricDescriptor_CUMULATIVE_DISTRIBUTION:
+		return true
+	default:
+		return false
+	}
+}
+
+// convertMetric replaces the points of the cumulative series of metric
+// by their difference with the previous points of the same series. The
+// first point of a series is its delta since the start of the series. A
+// point that isn't after the previous one of its series, e.g. a repeated
+// report, is removed from metric, since it would count the values again.
+func (dc *deltaConverter) convertMetric(metric *metricspb.Metric) {
+	desc := metric.GetMetricDescriptor()
+	if desc == nil || !isCumulative(desc.Type) {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	kept := metric.Timeseries[:0]
+	for _, ts := range metric.Timeseries {
+		// View data carry a single point per series.
+		if len(ts.Points) != 1 {
+			kept = append(kept, ts)
+			continue
+		}
+		key := desc.Name + "\x00" + labelSetKey(ts.LabelValues)
+		cur := ts.Points[0]
+		prev := dc.previous[key]
+		if prev != nil && !timestampBefore(prev.Timestamp, cur.Timestamp) {
+			continue
+		}
+		dc.previous[key] = cur
+		if prev == nil {
+			kept = append(kept, ts)
+			continue
+		}
+		delta, ok := subtractPoints(cur, prev)
+		if !ok {
+			// The series was reset, its cumulative point is its delta.
+			kept = append(kept, ts)
+			continue
+		}
+		kept = append(kept, &metricspb.TimeSeries{
+			StartTimestamp: prev.Timestamp,
+			LabelValues:    ts.LabelValues,
+			Points:         []*metricspb.Point{delta},
+		})
+	}
+	metric.Timeseries = kept
+}
+
+func timestampBefore(a, b *timestamp.Timestamp) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.Seconds < b.Seconds || (a.Seconds == b.Seconds && a.Nanos < b.Nanos)
+}
+
+// subtractPoints returns cur-prev, or false if
+// cur isn't the continuation of prev.
+func subtractPoints(cur, prev *metricspb.Point) (*metricspb.Point, bool) {
+	delta := &metricspb.Point{Timestamp: cur.Timestamp}
+	switch cv := cur.Value.(type) {
+	case *metricspb.Point_Int64Value:
+		pv, ok := prev.Value.(*metricspb.Point_Int64Value)
+		if !ok || cv.Int64Value < pv.Int64Value {
+			return nil, false
+		}
+		delta.Value = &metricspb.Point_Int64Value{Int64Value: cv.Int64Value - pv.Int64Value}
+	case *metricspb.Point_DoubleValue:
+		pv, ok := prev.Value.(*metricspb.Point_DoubleValue)
+		if !ok || cv.DoubleValue < pv.DoubleValue {
+			return nil, false
+		}
+		delta.Value = &metricspb.Point_DoubleValue{DoubleValue: cv.DoubleValue - pv.DoubleValue}
+	case *metricspb.Point_DistributionValue:
+		pv, ok := prev.Value.(*metricspb.Point_DistributionValue)
+		if !ok {
+			return nil, false
+		}
+		dist, ok := subtractDistributions(cv.DistributionValue, pv.DistributionValue)
+		if !ok {
+			return nil, false
+		}
+		delta.Value = &metricspb.Point_DistributionValue{DistributionValue: dist}
+	default:
+		return nil, false
+	}
+	return delta, true
+}
+
+// subtractDistributions returns the distribution of the values of cur that
+// weren't in prev yet, or false if cur doesn't contain all the values of prev.
+func subtractDistributions(cur, prev *metricspb.DistributionValue) (*metricspb.DistributionValue, bool) {
+	if cur.Count < prev.Count || len(cur.Buckets) != len(prev.Buckets) {
+		return nil, false
+	}
+	delta := &metricspb.DistributionValue{
+		Count:         cur.Count - prev.Count,
+		Sum:           cur.Sum - prev.Sum,
+		BucketOptions: cur.BucketOptions,
+		Buckets:       make([]*metricspb.DistributionValue_Bucket, len(cur.Buckets)),
+	}
+	for i, bucket := range cur.Buckets {
+		count := bucket.Count - prev.Buckets[i].Count
+		if count < 0 {
+			return nil, false
+		}
+		delta.Buckets[i] = &metricspb.DistributionValue_Bucket{Count: count}
+	}
+	if delta.Count > 0 && prev.Count > 0 {
+		// The inverse of the combination done by mergeDistributions.
+		d := delta.Sum/float64(delta.Count) - prev.Sum/float64(prev.Count)
+		delta.SumOfSquaredDeviation = cur.SumOfSquaredDeviation - prev.SumOfSquaredDeviation -
+			d*d*float64(prev.Count)*float64(delta.Count)/float64(cur.Count)
+		if delta.SumOfSquaredDeviation < 0 {
+			// Rounding errors.
+			delta.SumOfSquaredDeviation = 0
+		}
+	}
+	return delta, true
+}
+
+// convertToDelta applies WithDeltaTemporality to metrics.
+func (ae *Exporter) convertToDelta(metrics []*metricspb.Metric) {
+	if ae.deltaConverter == nil {
+		return
+	}
+	for _, metric := range metrics {
+		ae.deltaConverter.convertMetric(metric)
+	}
+}
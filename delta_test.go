@@ -0,0 +1,109 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func cumulativeMetric(seconds int64, value int64) *metricspb.Metric {
+	return &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{
+			Name: "calls",
+			Type: metricspb.MetricDescriptor_CUMULATIVE_INT64,
+		},
+		Timeseries: []*metricspb.TimeSeries{{
+			StartTimestamp: &timestamp.Timestamp{Seconds: 100},
+			Points: []*metricspb.Point{{
+				Timestamp: &timestamp.Timestamp{Seconds: seconds},
+				Value:     &metricspb.Point_Int64Value{Int64Value: value},
+			}},
+		}},
+	}
+}
+
+func TestDeltaConverter_convertMetric(t *testing.T) {
+	dc := newDeltaConverter()
+	tests := []struct {
+		end       int64
+		value     int64
+		wantStart int64
+		wantValue int64
+	}{
+		{end: 110, value: 5, wantStart: 100, wantValue: 5},
+		{end: 120, value: 12, wantStart: 110, wantValue: 7},
+		{end: 130, value: 12, wantStart: 120, wantValue: 0},
+		// A reset
+		{end: 140, value: 3, wantStart: 100, wantValue: 3},
+		{end: 150, value: 4, wantStart: 140, wantValue: 1},
+	}
+	for i, tt := range tests {
+		metric := cumulativeMetric(tt.end, tt.value)
+		dc.convertMetric(metric)
+		ts := metric.Timeseries[0]
+		if ts.StartTimestamp.Seconds != tt.wantStart || ts.Points[0].GetInt64Value() != tt.wantValue {
+			t.Errorf("#%d: got start=%d value=%d, want start=%d value=%d", i,
+				ts.StartTimestamp.Seconds, ts.Points[0].GetInt64Value(), tt.wantStart, tt.wantValue)
+		}
+	}
+}
+
+func TestDeltaConverter_dropsRepeatedPoints(t *testing.T) {
+	dc := newDeltaConverter()
+	dc.convertMetric(cumulativeMetric(110, 5))
+
+	// Reported again, or out of order: neither counts the values twice.
+	for _, end := range []int64{110, 105} {
+		metric := cumulativeMetric(end, 5)
+		dc.convertMetric(metric)
+		if n := len(metric.Timeseries); n != 0 {
+			t.Errorf("end=%d: got %d series, want the series dropped", end, n)
+		}
+	}
+
+	metric := cumulativeMetric(120, 12)
+	dc.convertMetric(metric)
+	ts := metric.Timeseries[0]
+	if ts.StartTimestamp.Seconds != 110 || ts.Points[0].GetInt64Value() != 7 {
+		t.Errorf("got start=%d value=%d, want start=110 value=7",
+			ts.StartTimestamp.Seconds, ts.Points[0].GetInt64Value())
+	}
+}
+
+func TestSubtractDistributions(t *testing.T) {
+	// {1, 3, 5} minus {1, 3}
+	cur := &metricspb.DistributionValue{
+		Count: 3, Sum: 9, SumOfSquaredDeviation: 8,
+		Buckets: []*metricspb.DistributionValue_Bucket{{Count: 1}, {Count: 1}, {Count: 1}},
+	}
+	prev := &metricspb.DistributionValue{
+		Count: 2, Sum: 4, SumOfSquaredDeviation: 2,
+		Buckets: []*metricspb.DistributionValue_Bucket{{Count: 1}, {Count: 1}, {Count: 0}},
+	}
+	got, ok := subtractDistributions(cur, prev)
+	if !ok {
+		t.Fatal("Expected a delta")
+	}
+	if got.Count != 1 || got.Sum != 5 || got.SumOfSquaredDeviation != 0 {
+		t.Errorf("Got count=%d sum=%v ssd=%v, want count=1 sum=5 ssd=0", got.Count, got.Sum, got.SumOfSquaredDeviation)
+	}
+	if _, ok := subtractDistributions(prev, cur); ok {
+		t.Error("Expected no delta for a reset distribution")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DisconnectionAlert is passed to the callback of WithDisconnectionAlert.
+type DisconnectionAlert struct {
+	// Since is when the exporter got disconnected from the agent.
+	Since time.Time
+	// Duration is how long the exporter has been disconnected,
+	// or was until it reconnected.
+	Duration time.Duration
+	// Recovered is set once the exporter reconnected to the agent.
+	Recovered bool
+	// LastError is the last connection error, while disconnected.
+	LastError error
+}
+
+// maxDisconnectionCheckPeriod bounds how late a disconnection alert can be.
+const maxDisconnectionCheckPeriod = time.Second
+
+// watchDisconnections invokes the callback of WithDisconnectionAlert once the
+// exporter is disconnected for longer than the threshold, and once it
+// reconnects after that, until stopCh is closed.
+func (ae *Exporter) watchDisconnections(stopCh <-chan bool) {
+	period := ae.disconnectionAlertThreshold / 4
+	if period > maxDisconnectionCheckPeriod {
+		period = maxDisconnectionCheckPeriod
+	} else if period <= 0 {
+		period = ae.disconnectionAlertThreshold
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var alerted bool
+	var since time.Time
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case now := <-ticker.C:
+			if ae.connected() {
+				if alerted {
+					alerted = false
+					ae.disconnectionAlert(DisconnectionAlert{Since: since, Duration: now.Sub(since), Recovered: true})
+				}
+				continue
+			}
+			nanos := atomic.LoadInt64(&ae.disconnectedSinceUnixNano)
+			if alerted || nanos == 0 {
+				continue
+			}
+			since = time.Unix(0, nanos)
+			if d := now.Sub(since); d >= ae.disconnectionAlertThreshold {
+				alerted = true
+				ae.disconnectionAlert(DisconnectionAlert{Since: since, Duration: d, LastError: ae.lastConnectError()})
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"time"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+// drainTimeout bounds how long Stop waits for the agent
+// to receive what was sent on the streams.
+const drainTimeout = time.Second
+
+func (ae *Exporter) isDraining() bool {
+	return atomic.LoadInt32(&ae.draining) != 0
+}
+
+// drainStreams half-closes the streams to the agent and waits, for at most
+// drainTimeout, until the agent ends them, so that the batches already sent
+// on them aren't lost when the connection is closed.
+func (ae *Exporter) drainStreams() {
+	if !ae.connected() {
+		return
+	}
+
+	ae.mu.RLock()
+	traceStreams := ae.traceStreams
+	metricsExporters := []agentmetricspb.MetricsService_ExportClient{ae.metricsExporter, ae.compressedMetricsExporter}
+	ae.mu.RUnlock()
+
+	var done []chan struct{}
+	for _, ts := range traceStreams {
+		for _, ts := range []*traceStream{ts, ts.compressed} {
+			if ts == nil {
+				continue
+			}
+			ts.senderMu.Lock()
+			_ = ts.client.CloseSend()
+			ts.senderMu.Unlock()
+			done = append(done, ts.done)
+		}
+	}
+	for _, metricsExporter := range metricsExporters {
+		if metricsExporter == nil {
+			continue
+		}
+		ae.senderMu.Lock()
+		_ = metricsExporter.CloseSend()
+		ae.senderMu.Unlock()
+
+		ended := make(chan struct{})
+		go func(metricsExporter agentmetricspb.MetricsService_ExportClient) {
+			defer close(ended)
+			ae.recvMu.Lock()
+			defer ae.recvMu.Unlock()
+			for {
+				if _, err := metricsExporter.Recv(); err != nil {
+					return
+				}
+			}
+		}(metricsExporter)
+		done = append(done, ended)
+	}
+
+	timeout := time.NewTimer(drainTimeout)
+	defer timeout.Stop()
+	for _, ch := range done {
+		select {
+		case <-ch:
+		case <-timeout.C:
+			return
+		}
+	}
+}
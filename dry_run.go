@@ -0,0 +1,122 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/stats/view"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// ValidationProblem is a problem found by WithDryRun in a span or a metric.
+type ValidationProblem struct {
+	// Signal is either "traces" or "metrics".
+	Signal string
+	// Name is the name of the span or of the metric.
+	Name string
+	// Problem describes what is wrong.
+	Problem string
+}
+
+func (vp ValidationProblem) String() string {
+	return fmt.Sprintf("%s %q: %s", vp.Signal, vp.Name, vp.Problem)
+}
+
+// maxSpanSize is the size from which a span can't be sent to an
+// agent that keeps the default maximum message size of gRPC.
+const maxSpanSize = fourMegabytes
+
+func (ae *Exporter) reportProblem(signal, name, format string, args ...interface{}) {
+	ae.dryRun(ValidationProblem{Signal: signal, Name: name, Problem: fmt.Sprintf(format, args...)})
+}
+
+func (ae *Exporter) validateSpan(span *tracepb.Span) {
+	name := span.GetName().GetValue()
+	if name == "" {
+		ae.reportProblem(teeSignalTraces, name, "the span has no name")
+	}
+	if isZeroID(span.TraceId) {
+		ae.reportProblem(teeSignalTraces, name, "invalid trace ID %x", span.TraceId)
+	}
+	if isZeroID(span.SpanId) {
+		ae.reportProblem(teeSignalTraces, name, "invalid span ID %x", span.SpanId)
+	}
+	if timestampBefore(span.EndTime, span.StartTime) {
+		ae.reportProblem(teeSignalTraces, name, "the span ends before it starts")
+	}
+	if size := proto.Size(span); size > maxSpanSize {
+		ae.reportProblem(teeSignalTraces, name, "the span is %d bytes, more than the %d bytes that the agent accepts", size, maxSpanSize)
+	}
+}
+
+func isZeroID(id []byte) bool {
+	for _, b := range id {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (ae *Exporter) validateViewData(vd *view.Data) {
+	metric, err := viewDataToMetric(vd)
+	if err != nil {
+		name := ""
+		if vd.View != nil {
+			name = vd.View.Name
+		}
+		ae.reportProblem(teeSignalMetrics, name, "the view data can't be converted: %v", err)
+		return
+	}
+	ae.validateMetric(metric)
+}
+
+func (ae *Exporter) validateMetric(metric *metricspb.Metric) {
+	desc := metric.GetMetricDescriptor()
+	name := desc.GetName()
+	if name == "" {
+		ae.reportProblem(teeSignalMetrics, name, "the metric has no name")
+	}
+	if desc.GetType() == metricspb.MetricDescriptor_UNSPECIFIED {
+		ae.reportProblem(teeSignalMetrics, name, "the metric type is UNSPECIFIED")
+	}
+	keys := make(map[string]bool)
+	for _, lk := range desc.GetLabelKeys() {
+		switch {
+		case lk.Key == "":
+			ae.reportProblem(teeSignalMetrics, name, "empty label key")
+		case !utf8.ValidString(lk.Key):
+			ae.reportProblem(teeSignalMetrics, name, "label key %q isn't valid UTF-8", lk.Key)
+		case keys[lk.Key]:
+			ae.reportProblem(teeSignalMetrics, name, "duplicate label key %q", lk.Key)
+		}
+		keys[lk.Key] = true
+	}
+	for _, ts := range metric.Timeseries {
+		if len(ts.LabelValues) != len(desc.GetLabelKeys()) {
+			ae.reportProblem(teeSignalMetrics, name, "a series has %d label values for %d label keys", len(ts.LabelValues), len(desc.GetLabelKeys()))
+		}
+		for _, lv := range ts.LabelValues {
+			if !utf8.ValidString(lv.GetValue()) {
+				ae.reportProblem(teeSignalMetrics, name, "label value %q isn't valid UTF-8", lv.GetValue())
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"time"
+)
+
+// SamplerType is the type of a sampler applied by the exporter.
+type SamplerType int
+
+const (
+	// SamplerProbability samples a fraction of the traces.
+	SamplerProbability SamplerType = iota + 1
+	// SamplerAlwaysOn samples all the traces.
+	SamplerAlwaysOn
+	// SamplerAlwaysOff samples none of the traces.
+	SamplerAlwaysOff
+	// SamplerFallback is the sampler passed to WithFallbackSampler.
+	SamplerFallback
+)
+
+func (st SamplerType) String() string {
+	switch st {
+	case SamplerProbability:
+		return "probability"
+	case SamplerAlwaysOn:
+		return "always_on"
+	case SamplerAlwaysOff:
+		return "always_off"
+	case SamplerFallback:
+		return "fallback"
+	default:
+		return "unknown"
+	}
+}
+
+// AppliedSampler describes the sampler that the exporter last applied.
+type AppliedSampler struct {
+	Type SamplerType
+	// Probability is the sampling probability of a SamplerProbability.
+	Probability float64
+	// AppliedAt is when the sampler was applied.
+	AppliedAt time.Time
+}
+
+// EffectiveSampler returns the sampler that the exporter applied most recently,
+// either from a configuration pushed by the agent or passed to ApplyConfig or,
+// with WithFallbackSampler, the fallback sampler. It reports false if the
+// exporter hasn't applied any sampler yet. Note that the sampler can since
+// have been replaced by the application with trace.ApplyConfig.
+func (ae *Exporter) EffectiveSampler() (AppliedSampler, bool) {
+	as, ok := ae.effectiveSampler.Load().(AppliedSampler)
+	return as, ok
+}
+
+func (ae *Exporter) setEffectiveSampler(st SamplerType, probability float64) {
+	ae.effectiveSampler.Store(AppliedSampler{Type: st, Probability: probability, AppliedAt: time.Now()})
+	if st == SamplerProbability {
+		ae.recordEvent(EventConfigUpdated, fmt.Sprintf("%s sampler (%v)", st, probability), 0)
+	} else {
+		ae.recordEvent(EventConfigUpdated, st.String()+" sampler", 0)
+	}
+}
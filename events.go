@@ -0,0 +1,160 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventConnected is recorded when the exporter connects to the agent.
+	EventConnected EventKind = iota + 1
+	// EventDisconnected is recorded when the exporter loses its connection.
+	EventDisconnected
+	// EventDropped is recorded when spans or metrics are dropped.
+	EventDropped
+	// EventConfigUpdated is recorded when a sampler is applied.
+	EventConfigUpdated
+	// EventThrottled is recorded when the agent asks the exporter to pause,
+	// or when WithFlowControl pauses it.
+	EventThrottled
+	// EventCompressionDisabled is recorded when the agent rejects the
+	// compressor, and the exporter falls back to uncompressed data.
+	EventCompressionDisabled
+	// EventBatchSent is sent to the channels of Watch when a batch is
+	// exported. It isn't kept in the history of WithEventHistory.
+	EventBatchSent
+)
+
+func (ek EventKind) String() string {
+	switch ek {
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventDropped:
+		return "dropped"
+	case EventConfigUpdated:
+		return "config_updated"
+	case EventThrottled:
+		return "throttled"
+	case EventCompressionDisabled:
+		return "compression_disabled"
+	case EventBatchSent:
+		return "batch_sent"
+	default:
+		return "unknown"
+	}
+}
+
+// The reasons for dropping spans or metrics, in the Detail of an EventDropped.
+const (
+	dropReasonShed         = "shed under pressure"
+	dropReasonBufferFull   = "buffer full"
+	dropReasonOversized    = "larger than a bundle"
+	dropReasonDisconnected = "disconnected from the agent"
+	dropReasonSpoolFull    = "spool full"
+	dropReasonStopping     = "exporter stopping"
+	dropReasonStale        = "older than the max span age"
+	dropReasonMarshal      = "failed to be marshaled"
+)
+
+// Event is a significant event in the life of the exporter.
+type Event struct {
+	Time time.Time
+	Kind EventKind
+	// Detail describes the event, e.g. the error that caused a disconnection,
+	// or the signal of an EventBatchSent, "traces" or "metrics".
+	Detail string
+	// Count is the number of spans or metrics of an EventDropped or an
+	// EventBatchSent. In the history, consecutive drops with the same Detail
+	// are merged into a single event, whose Time is that of the last drop.
+	Count int64
+}
+
+// eventRing keeps the most recent events, up to its capacity.
+type eventRing struct {
+	mu     sync.Mutex
+	events []Event
+	// next is the index of the slot for the next event, once events is full.
+	next int
+}
+
+func newEventRing(capacity int) *eventRing {
+	return &eventRing{events: make([]Event, 0, capacity)}
+}
+
+func (er *eventRing) record(ev Event) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	if last := er.last(); last != nil && ev.Kind == EventDropped && last.Kind == EventDropped && last.Detail == ev.Detail {
+		last.Time = ev.Time
+		last.Count += ev.Count
+		return
+	}
+	if len(er.events) < cap(er.events) {
+		er.events = append(er.events, ev)
+		return
+	}
+	er.events[er.next] = ev
+	er.next = (er.next + 1) % len(er.events)
+}
+
+func (er *eventRing) last() *Event {
+	n := len(er.events)
+	if n == 0 {
+		return nil
+	}
+	// next is only ever non-zero once events is full.
+	return &er.events[(er.next+n-1)%n]
+}
+
+// snapshot returns the events, oldest first.
+func (er *eventRing) snapshot() []Event {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	events := make([]Event, 0, len(er.events))
+	events = append(events, er.events[er.next:]...)
+	return append(events, er.events[:er.next]...)
+}
+
+// recordEvent records an event for WithEventHistory, and sends it to the watchers.
+func (ae *Exporter) recordEvent(kind EventKind, detail string, count int64) {
+	if ae.events == nil && ae.watchers.empty() {
+		return
+	}
+	ev := Event{Time: time.Now(), Kind: kind, Detail: detail, Count: count}
+	if ae.events != nil && kind != EventBatchSent {
+		ae.events.record(ev)
+	}
+	ae.watchers.send(ev)
+}
+
+// RecentEvents returns the most recent significant events of the exporter,
+// oldest first, as kept by WithEventHistory: its connections to the agent and
+// their losses, the spans and metrics it dropped, and the samplers it applied.
+// It returns nil without WithEventHistory.
+func (ae *Exporter) RecentEvents() []Event {
+	if ae.events == nil {
+		return nil
+	}
+	return ae.events.snapshot()
+}
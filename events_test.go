@@ -0,0 +1,107 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEventRing_keepsMostRecent(t *testing.T) {
+	er := newEventRing(3)
+	for i := 0; i < 5; i++ {
+		er.record(Event{Kind: EventDisconnected, Detail: fmt.Sprint(i)})
+	}
+	var got []string
+	for _, ev := range er.snapshot() {
+		got = append(got, ev.Detail)
+	}
+	if want := "[2 3 4]"; fmt.Sprint(got) != want {
+		t.Errorf("Got events %v, want %s", got, want)
+	}
+}
+
+func TestEventRing_mergesConsecutiveDrops(t *testing.T) {
+	er := newEventRing(2)
+	er.record(Event{Kind: EventDisconnected})
+	er.record(Event{Kind: EventDropped, Detail: "spans: full", Count: 1})
+	// Merged into the last event, even once the ring is full.
+	er.record(Event{Kind: EventDropped, Detail: "spans: full", Count: 2})
+	er.record(Event{Kind: EventDropped, Detail: "metrics: full", Count: 4})
+	er.record(Event{Kind: EventDropped, Detail: "metrics: full", Count: 8})
+
+	got := er.snapshot()
+	if len(got) != 2 {
+		t.Fatalf("Got %d events, want 2", len(got))
+	}
+	if got[0].Detail != "spans: full" || got[0].Count != 3 {
+		t.Errorf("Got %+v, want 3 spans dropped", got[0])
+	}
+	if got[1].Detail != "metrics: full" || got[1].Count != 12 {
+		t.Errorf("Got %+v, want 12 metrics dropped", got[1])
+	}
+}
+
+func TestExporter_Watch(t *testing.T) {
+	ae := new(Exporter)
+	ch, cancel := ae.Watch(2)
+	ae.recordEvent(EventConnected, "agent:55678", 0)
+	ae.recordEvent(EventBatchSent, teeSignalTraces, 5)
+	// Discarded, the channel is full.
+	ae.recordEvent(EventDropped, "spans: buffer full", 1)
+
+	if ev := <-ch; ev.Kind != EventConnected {
+		t.Errorf("Got %+v, want an EventConnected", ev)
+	}
+	if ev := <-ch; ev.Kind != EventBatchSent || ev.Detail != teeSignalTraces || ev.Count != 5 {
+		t.Errorf("Got %+v, want a batch of 5 spans sent", ev)
+	}
+	if ae.RecentEvents() != nil {
+		t.Errorf("Got a history of events without WithEventHistory")
+	}
+
+	cancel()
+	if ev, ok := <-ch; ok {
+		t.Errorf("Got %+v after cancel, want the channel closed", ev)
+	}
+	// The subscription is already ended.
+	cancel()
+	ae.recordEvent(EventDisconnected, "EOF", 0)
+}
+
+func TestExporter_WatchDoesNotKeepBatchesSent(t *testing.T) {
+	ae := &Exporter{events: newEventRing(4)}
+	ch, cancel := ae.Watch(1)
+	defer cancel()
+	ae.recordEvent(EventBatchSent, teeSignalMetrics, 3)
+
+	if ev := <-ch; ev.Kind != EventBatchSent {
+		t.Errorf("Got %+v, want an EventBatchSent", ev)
+	}
+	if got := ae.RecentEvents(); len(got) != 0 {
+		t.Errorf("Got history %+v, want no event", got)
+	}
+}
+
+func TestExporter_WatchDisconnections(t *testing.T) {
+	ae := new(Exporter)
+	ch, cancel := ae.Watch(1)
+	defer cancel()
+	ae.setStateDisconnected(fmt.Errorf("EOF"))
+
+	if ev := <-ch; ev.Kind != EventDisconnected || ev.Detail != "EOF" {
+		t.Errorf("Got %+v, want an EventDisconnected", ev)
+	}
+}
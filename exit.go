@@ -0,0 +1,86 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultExitFlushTimeout bounds how long Exit waits for the exporters to flush.
+const DefaultExitFlushTimeout = 5 * time.Second
+
+// exitFlushers are the started exporters created with WithFlushOnExit.
+var exitFlushers = struct {
+	mu        sync.Mutex
+	exporters map[*Exporter]bool
+}{exporters: make(map[*Exporter]bool)}
+
+func (ae *Exporter) registerExitFlush() {
+	exitFlushers.mu.Lock()
+	exitFlushers.exporters[ae] = true
+	exitFlushers.mu.Unlock()
+}
+
+func (ae *Exporter) unregisterExitFlush() {
+	exitFlushers.mu.Lock()
+	delete(exitFlushers.exporters, ae)
+	exitFlushers.mu.Unlock()
+}
+
+// FlushAll flushes the exporters created with WithFlushOnExit that are still
+// running, waiting no longer than timeout if it is positive. Go has no hook to
+// run code when main returns, but a short-lived program can defer FlushAll at
+// the top of main to deliver its last batches even if it forgets to stop its
+// exporters.
+func FlushAll(timeout time.Duration) {
+	exitFlushers.mu.Lock()
+	exporters := make([]*Exporter, 0, len(exitFlushers.exporters))
+	for ae := range exitFlushers.exporters {
+		exporters = append(exporters, ae)
+	}
+	exitFlushers.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ae := range exporters {
+		wg.Add(1)
+		go func(ae *Exporter) {
+			defer wg.Done()
+			ae.Flush()
+		}(ae)
+	}
+	if timeout <= 0 {
+		wg.Wait()
+		return
+	}
+	flushed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(timeout):
+	}
+}
+
+// Exit is os.Exit preceded by FlushAll, waiting no longer than
+// DefaultExitFlushTimeout, for the programs that exit with a status
+// code rather than by returning from main.
+func Exit(code int) {
+	FlushAll(DefaultExitFlushTimeout)
+	os.Exit(code)
+}
@@ -0,0 +1,129 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+type fallbackSampler struct {
+	sampler trace.Sampler
+	after   time.Duration
+}
+
+var _ ExporterOption = (*fallbackSampler)(nil)
+
+func (fs *fallbackSampler) withExporter(e *Exporter) {
+	e.fallbackSampler = fs
+}
+
+// WithFallbackSampler makes sampling deterministic during agent outages: sampler
+// is applied as the default sampler, with trace.ApplyConfig, if no sampling
+// configuration was received from the agent within after of Start, or if the
+// configuration stream with the agent has been down for longer than after.
+// Configurations received from the agent later on replace it as usual.
+func WithFallbackSampler(sampler trace.Sampler, after time.Duration) ExporterOption {
+	return &fallbackSampler{sampler: sampler, after: after}
+}
+
+// fallbackSamplerState tracks whether the fallback sampler must be applied.
+type fallbackSamplerState struct {
+	mu                   sync.Mutex
+	timer                *time.Timer
+	timerGen             uint64
+	remoteConfigReceived bool
+
+	// configStreamGen identifies the latest config stream, the only
+	// one whose end means that the stream with the agent is down.
+	configStreamGen uint64
+}
+
+// armFallbackSampler schedules the fallback sampler to be applied, unless it
+// already is scheduled. The schedule is canceled by disarmFallbackSampler.
+func (ae *Exporter) armFallbackSampler() {
+	fs := ae.fallbackSampler
+	if fs == nil {
+		return
+	}
+	st := &ae.fallbackSamplerState
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.timer == nil {
+		st.timerGen++
+		gen := st.timerGen
+		st.timer = time.AfterFunc(fs.after, func() { ae.applyFallbackSampler(gen) })
+	}
+}
+
+func (ae *Exporter) disarmFallbackSampler() {
+	st := &ae.fallbackSamplerState
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+}
+
+// applyFallbackSampler is invoked by the timer of generation gen.
+func (ae *Exporter) applyFallbackSampler(gen uint64) {
+	st := &ae.fallbackSamplerState
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.timer == nil || st.timerGen != gen {
+		// Disarmed in the meantime.
+		return
+	}
+	st.timer = nil
+	trace.ApplyConfig(trace.Config{DefaultSampler: ae.fallbackSampler.sampler})
+	ae.setEffectiveSampler(SamplerFallback, 0)
+}
+
+// configStreamStarted is invoked whenever a new config stream is opened,
+// it returns the generation of the stream.
+func (ae *Exporter) configStreamStarted() uint64 {
+	st := &ae.fallbackSamplerState
+	gen := atomic.AddUint64(&st.configStreamGen, 1)
+	st.mu.Lock()
+	received := st.remoteConfigReceived
+	st.mu.Unlock()
+	if received {
+		ae.disarmFallbackSampler()
+	}
+	return gen
+}
+
+// configStreamEnded is invoked when the config stream of generation gen ends.
+func (ae *Exporter) configStreamEnded(gen uint64) {
+	if atomic.LoadUint64(&ae.fallbackSamplerState.configStreamGen) == gen {
+		ae.armFallbackSampler()
+	}
+}
+
+// remoteConfigApplied is invoked whenever a configuration from the agent was applied.
+func (ae *Exporter) remoteConfigApplied() {
+	st := &ae.fallbackSamplerState
+	st.mu.Lock()
+	st.remoteConfigReceived = true
+	st.mu.Unlock()
+	ae.disarmFallbackSampler()
+}
@@ -0,0 +1,64 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"runtime"
+)
+
+// unstoppedSentinel is only referenced by its exporter, which it doesn't
+// reference in return, so that it is finalized along with the exporter.
+// The exporter itself can't have a finalizer: it is part of reference
+// cycles, e.g. with its bundlers, whose finalizers are never run.
+type unstoppedSentinel struct {
+	address string
+	logf    func(format string, args ...interface{})
+	teeFile *teeFile
+	spool   *spool
+}
+
+func (ae *Exporter) setFinalizer() {
+	if !ae.finalizerWarning {
+		return
+	}
+	ae.sentinel = &unstoppedSentinel{
+		address: ae.prepareAgentAddress(),
+		logf:    ae.logger,
+		teeFile: ae.teeFile,
+		spool:   ae.spool,
+	}
+	runtime.SetFinalizer(ae.sentinel, (*unstoppedSentinel).finalize)
+}
+
+// clearFinalizer is invoked by Stop.
+func (ae *Exporter) clearFinalizer() {
+	if ae.sentinel != nil {
+		runtime.SetFinalizer(ae.sentinel, nil)
+	}
+}
+
+// finalize warns about an exporter that was garbage collected
+// without Stop, and releases the files that it holds.
+func (us *unstoppedSentinel) finalize() {
+	if us.logf != nil {
+		us.logf("ocagent: an exporter for %s was garbage collected without being stopped: its buffered spans and view data were lost", us.address)
+	}
+	if us.teeFile != nil {
+		_ = us.teeFile.close()
+	}
+	if us.spool != nil {
+		_ = us.spool.close()
+	}
+}
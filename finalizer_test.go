@@ -0,0 +1,60 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+func TestNewUnstartedExporter_withFinalizerWarning(t *testing.T) {
+	logged := make(chan string, 1)
+	logf := func(format string, args ...interface{}) {
+		select {
+		case logged <- fmt.Sprintf(format, args...):
+		default:
+		}
+	}
+	newForgottenExporter := func() {
+		_, err := ocagent.NewUnstartedExporter(
+			ocagent.WithInsecure(),
+			ocagent.WithLogger(logf),
+			ocagent.WithFinalizerWarning())
+		if err != nil {
+			t.Fatalf("Failed to create a new agent exporter: %v", err)
+		}
+	}
+	newForgottenExporter()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case msg := <-logged:
+			if !strings.Contains(msg, "without being stopped") {
+				t.Errorf("Unexpected warning: %q", msg)
+			}
+			return
+		case <-deadline:
+			t.Fatal("The forgotten exporter wasn't reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// fipsCipherSuites are the FIPS 140-2 approved cipher suites of TLS 1.2.
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the FIPS 140-2 approved elliptic curves.
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+type fipsTLS struct {
+	config *tls.Config
+}
+
+var _ ExporterOption = (*fipsTLS)(nil)
+
+func (ft fipsTLS) withExporter(e *Exporter) {
+	cfg := new(tls.Config)
+	if ft.config != nil {
+		cfg = ft.config.Clone()
+	}
+	e.fipsTLSConfig = cfg
+}
+
+// WithFIPSTLS restricts the connection to the agent to TLS 1.2 with the cipher
+// suites and elliptic curves approved by FIPS 140-2, as required in regulated
+// environments. The agent is verified as configured by config, e.g. its
+// RootCAs, or against the system's roots, plus the PEM files of
+// WithSystemCertPool, if config is nil or has no RootCAs. The cipher suites,
+// curves and versions of config are overridden.
+//
+// NewExporter and NewUnstartedExporter refuse the options that would weaken
+// or bypass it: WithInsecure, an insecure grpc:// or http:// address,
+// WithTLSInsecureSkipVerify or a config with InsecureSkipVerify, and
+// WithTLSCredentials, whose configuration can't be checked.
+func WithFIPSTLS(config *tls.Config) ExporterOption {
+	return fipsTLS{config: config}
+}
+
+// fipsCredentials returns the transport credentials of WithFIPSTLS, unless
+// other options would weaken them.
+func (ae *Exporter) fipsCredentials() (credentials.TransportCredentials, error) {
+	cfg := ae.fipsTLSConfig
+	switch {
+	case ae.canDialInsecure:
+		return nil, errors.New("ocagent: WithFIPSTLS can't be combined with WithInsecure")
+	case ae.clientTransportCredentials != nil:
+		return nil, errors.New("ocagent: WithFIPSTLS can't be combined with WithTLSCredentials or WithTLSInsecureSkipVerify")
+	case cfg.InsecureSkipVerify:
+		return nil, errors.New("ocagent: WithFIPSTLS can't skip the verification of the agent")
+	}
+	if cfg.RootCAs == nil && ae.systemCertPoolPEMFiles != nil {
+		pool, err := systemCertPoolWith(ae.systemCertPoolPEMFiles)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	cfg.MinVersion = tls.VersionTLS12
+	cfg.MaxVersion = tls.VersionTLS12
+	cfg.CipherSuites = fipsCipherSuites
+	cfg.CurvePreferences = fipsCurves
+	return credentials.NewTLS(cfg), nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultFlowControlSlowSend is the default FlowControlParams.SlowSend.
+	DefaultFlowControlSlowSend = 500 * time.Millisecond
+	// DefaultFlowControlPause is the default FlowControlParams.Pause.
+	DefaultFlowControlPause = time.Second
+)
+
+// FlowControlParams configures WithFlowControl.
+type FlowControlParams struct {
+	// SlowSend is how long sending a batch must take for the connection to
+	// the agent to be deemed congested. A send blocks once gRPC's flow control
+	// window is exhausted, i.e. when the agent doesn't keep up with reading.
+	// It defaults to DefaultFlowControlSlowSend.
+	SlowSend time.Duration
+	// Pause is how long the exporter stops sending once the connection is
+	// deemed congested. It defaults to DefaultFlowControlPause.
+	Pause time.Duration
+}
+
+// observeSend pauses the exports if sending a batch took latency, which
+// reveals that the agent applies backpressure.
+func (ae *Exporter) observeSend(latency time.Duration) {
+	fc := ae.flowControl
+	if fc == nil {
+		return
+	}
+	slowSend := fc.SlowSend
+	if slowSend <= 0 {
+		slowSend = DefaultFlowControlSlowSend
+	}
+	if latency < slowSend {
+		return
+	}
+	pause := fc.Pause
+	if pause <= 0 {
+		pause = DefaultFlowControlPause
+	}
+	if pause > maxThrottleDelay {
+		pause = maxThrottleDelay
+	}
+	ae.pauseExports(pause, fmt.Sprintf("%v, sending took %v", pause, latency))
+}
@@ -0,0 +1,42 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObserveSend(t *testing.T) {
+	ae := new(Exporter)
+	WithFlowControl(FlowControlParams{SlowSend: 100 * time.Millisecond, Pause: time.Minute}).withExporter(ae)
+	WithEventHistory(10).withExporter(ae)
+
+	ae.observeSend(10 * time.Millisecond)
+	if until := atomic.LoadInt64(&ae.throttledUntilUnixNano); until != 0 {
+		t.Fatalf("A fast send paused the exports until %v", time.Unix(0, until))
+	}
+
+	start := time.Now()
+	ae.observeSend(200 * time.Millisecond)
+	until := time.Unix(0, atomic.LoadInt64(&ae.throttledUntilUnixNano))
+	if until.Before(start.Add(time.Minute)) || until.After(time.Now().Add(time.Minute)) {
+		t.Errorf("A slow send paused the exports until %v, want a minute from %v", until, start)
+	}
+	if events := ae.RecentEvents(); len(events) != 1 || events[0].Kind != EventThrottled {
+		t.Errorf("Got events %v, want an EventThrottled", events)
+	}
+}
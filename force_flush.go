@@ -0,0 +1,48 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"go.opencensus.io/metric/metricproducer"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+)
+
+// ForceFlushMetrics reads the current values of all registered views,
+// and of any other producer registered with metricproducer.GlobalManager,
+// sends them to the agent and then waits like Flush does.
+//
+// Views are otherwise only reported once per reporting period, so
+// measurements recorded just before the program exits are lost unless
+// ForceFlushMetrics is called before Stop.
+func (ae *Exporter) ForceFlushMetrics() {
+	ae.uploadMetrics(readProducers())
+	ae.Flush()
+}
+
+func readProducers() []*metricspb.Metric {
+	var metrics []*metricspb.Metric
+	for _, producer := range metricproducer.GlobalManager().GetAll() {
+		for _, m := range producer.Read() {
+			pm, err := transform.MetricToProto(m)
+			if err == nil {
+				metrics = append(metrics, pm)
+			}
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,94 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+func TestExporter_ForceFlushMetricsReadsViews(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	_, agentPortStr, _ := net.SplitHostPort(ln.Addr().String())
+	ma := new(metricsAgent)
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	ocexp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(":"+agentPortStr),
+		WithReconnectionPeriod(2*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	mJobs := stats.Int64("force_flush/jobs", "The number of jobs", stats.UnitDimensionless)
+	v := &view.View{
+		Name:        "force_flush/jobs",
+		Description: "The number of jobs",
+		Measure:     mJobs,
+		Aggregation: view.Sum(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatalf("Failed to register the view: %v", err)
+	}
+	defer view.Unregister(v)
+	stats.Record(context.Background(), mJobs.M(7))
+
+	// Record is asynchronous, so retry until the view has picked it up.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		ocexp.ForceFlushMetrics()
+		found := false
+		ma.forEachRequest(func(req *agentmetricspb.ExportMetricsServiceRequest) {
+			for _, metric := range req.Metrics {
+				if metric.GetMetricDescriptor().GetName() != v.Name {
+					continue
+				}
+				for _, ts := range metric.Timeseries {
+					for _, pt := range ts.Points {
+						if pt.GetInt64Value() == 7 {
+							found = true
+						}
+					}
+				}
+			}
+		})
+		if found {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("The view data was not sent by ForceFlushMetrics")
+}
@@ -9,8 +9,9 @@ require (
 	golang.org/x/net v0.0.0-20190628185345-da137c7871d7 // indirect
 	golang.org/x/sys v0.0.0-20190712062909-fae7ac547cb7 // indirect
 	google.golang.org/api v0.7.0
-	google.golang.org/genproto v0.0.0-20190716160619-c506a9f90610 // indirect
+	google.golang.org/genproto v0.0.0-20190716160619-c506a9f90610
 	google.golang.org/grpc v1.22.0
+	gopkg.in/yaml.v2 v2.2.2
 )
 
 replace github.com/census-instrumentation/opencensus-proto => github.com/omnition/opencensus-proto v0.2.2-omnition-1
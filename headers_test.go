@@ -0,0 +1,140 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	traceConfigMethod   = "/opencensus.proto.agent.trace.v1.TraceService/Config"
+	metricsExportMethod = "/opencensus.proto.agent.metrics.v1.MetricsService/Export"
+)
+
+// runHeaderAgent runs an agent that records the value of the header
+// key of each method, and returns its address.
+func runHeaderAgent(t *testing.T, key string) (addr string, values func() map[string]string, stop func()) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+
+	var mu sync.Mutex
+	recorded := make(map[string]string)
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		if vals := md.Get(key); len(vals) == 1 {
+			mu.Lock()
+			recorded[method] = vals[0]
+			mu.Unlock()
+		}
+		<-stream.Context().Done()
+		return nil
+	}))
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	values = func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := make(map[string]string, len(recorded))
+		for method, val := range recorded {
+			got[method] = val
+		}
+		return got
+	}
+	return ln.Addr().String(), values, srv.Stop
+}
+
+// waitForHeaders waits until values returns as many methods as want, then compares them.
+func waitForHeaders(t *testing.T, values func() map[string]string, want map[string]string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := values()
+		if len(got) >= len(want) {
+			for method, val := range want {
+				if got[method] != val {
+					t.Errorf("%s: got %q want %q", method, got[method], val)
+				}
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Got headers %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewExporter_perSignalHeaders(t *testing.T) {
+	addr, values, stop := runHeaderAgent(t, "api-key")
+	defer stop()
+
+	exp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(addr),
+		WithHeaders(map[string]string{"api-key": "shared"}),
+		WithMetricsHeaders(map[string]string{"api-key": "metrics"}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	waitForHeaders(t, values, map[string]string{
+		traceExportMethod:   "shared",
+		traceConfigMethod:   "shared",
+		metricsExportMethod: "metrics",
+	})
+}
+
+// callCredentials adds a header to the RPCs that they are passed to.
+type callCredentials map[string]string
+
+func (cc callCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return cc, nil
+}
+
+func (cc callCredentials) RequireTransportSecurity() bool { return false }
+
+func TestNewExporter_withCallOptions(t *testing.T) {
+	addr, values, stop := runHeaderAgent(t, "call-option")
+	defer stop()
+
+	exp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(addr),
+		WithCallOptions(grpc.PerRPCCredentials(callCredentials{"call-option": "set"})))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	waitForHeaders(t, values, map[string]string{
+		traceExportMethod:   "set",
+		metricsExportMethod: "set",
+	})
+	if got, ok := values()[traceConfigMethod]; ok {
+		t.Errorf("The config stream, which exports nothing, got the call options: %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// healthStatus is the body written by HealthHandler.
+type healthStatus struct {
+	Status            string     `json:"status"`
+	LastError         string     `json:"last_error,omitempty"`
+	LastExportTime    *time.Time `json:"last_export_time,omitempty"`
+	ConnectivityState string     `json:"connectivity_state"`
+}
+
+// HealthHandler returns an http.Handler that reports the health of the
+// exporter, e.g. for the readiness or liveness probes of Kubernetes. It
+// responds with 200 OK while the exporter is connected to the agent, and with
+// 503 Service Unavailable otherwise. The JSON body holds the status, the last
+// connection error, the time of the last successful export, if any, and the
+// ConnectivityState of the gRPC channel.
+func (ae *Exporter) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ae.mu.RLock()
+		started, stopped := ae.started, ae.stopped
+		ae.mu.RUnlock()
+
+		var hs healthStatus
+		code := http.StatusOK
+		switch {
+		case stopped:
+			hs.Status, code = "stopped", http.StatusServiceUnavailable
+		case !started:
+			hs.Status, code = "not started", http.StatusServiceUnavailable
+		case !ae.connected():
+			hs.Status, code = "disconnected", http.StatusServiceUnavailable
+			if err := ae.lastConnectError(); err != nil {
+				hs.LastError = err.Error()
+			}
+		default:
+			hs.Status = "connected"
+		}
+		hs.ConnectivityState = ae.ConnectivityState().String()
+		if nanos := atomic.LoadInt64(&ae.lastExportUnixNano); nanos != 0 {
+			t := time.Unix(0, nanos).UTC()
+			hs.LastExportTime = &t
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(hs)
+	})
+}
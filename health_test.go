@@ -0,0 +1,66 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	"go.opencensus.io/trace"
+)
+
+func checkHealth(t *testing.T, exp *ocagent.Exporter, wantCode int, wantStatus string) map[string]interface{} {
+	rec := httptest.NewRecorder()
+	exp.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode the body %q: %v", rec.Body.String(), err)
+	}
+	if rec.Code != wantCode || body["status"] != wantStatus {
+		t.Errorf("Got %d %v, want %d %q", rec.Code, body["status"], wantCode, wantStatus)
+	}
+	return body
+}
+
+func TestExporter_HealthHandler(t *testing.T) {
+	ma := runMockAgent(t)
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "span"})
+	exp.Flush()
+	if body := checkHealth(t, exp, http.StatusOK, "connected"); body["last_export_time"] == nil {
+		t.Error("The last export time wasn't reported")
+	}
+
+	// Sending on the trace streams fails once the agent is gone.
+	ma.stop()
+	exp.ExportSpan(&trace.SpanData{Name: "lost"})
+	exp.Flush()
+	if body := checkHealth(t, exp, http.StatusServiceUnavailable, "disconnected"); body["last_error"] == nil {
+		t.Error("The last connection error wasn't reported")
+	}
+}
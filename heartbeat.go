@@ -0,0 +1,83 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// HeartbeatMetricName is the name of the metric sent with WithHeartbeat.
+const HeartbeatMetricName = "contrib.go.opencensus.io/exporter/ocagent/uptime"
+
+var heartbeatDescriptor = &metricspb.MetricDescriptor{
+	Name:        HeartbeatMetricName,
+	Description: "Time since the process of the exporter started",
+	Unit:        "s",
+	Type:        metricspb.MetricDescriptor_CUMULATIVE_DOUBLE,
+	LabelKeys:   []*metricspb.LabelKey{{Key: "exporter_version"}},
+}
+
+// heartbeatMetric returns the uptime of the process at now.
+func heartbeatMetric(now time.Time) *metricspb.Metric {
+	return &metricspb.Metric{
+		MetricDescriptor: heartbeatDescriptor,
+		Timeseries: []*metricspb.TimeSeries{{
+			StartTimestamp: transform.Timestamp(startTime),
+			LabelValues:    []*metricspb.LabelValue{{Value: Version, HasValue: true}},
+			Points: []*metricspb.Point{{
+				Timestamp: transform.Timestamp(now),
+				Value:     &metricspb.Point_DoubleValue{DoubleValue: now.Sub(startTime).Seconds()},
+			}},
+		}},
+	}
+}
+
+// appendHeartbeat appends the heartbeat metric to metrics, if enabled.
+func (ae *Exporter) appendHeartbeat(metrics []*metricspb.Metric) []*metricspb.Metric {
+	if ae.heartbeatInterval <= 0 {
+		return metrics
+	}
+	atomic.StoreInt32(&ae.heartbeatSent, 1)
+	return append(metrics, heartbeatMetric(time.Now()))
+}
+
+// sendHeartbeats sends the heartbeat metric on its own every heartbeat
+// interval in which no view data was pushed, until stopCh is closed.
+func (ae *Exporter) sendHeartbeats(stopCh <-chan bool) {
+	ticker := time.NewTicker(ae.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case now := <-ticker.C:
+			if atomic.SwapInt32(&ae.heartbeatSent, 0) == 1 {
+				continue
+			}
+			ae.enqueue(outgoingBatch{metrics: &agentmetricspb.ExportMetricsServiceRequest{
+				Metrics:  []*metricspb.Metric{heartbeatMetric(now)},
+				Resource: resourceProtoFromEnv(),
+			}})
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+func TestHeartbeatMetric(t *testing.T) {
+	now := startTime.Add(90 * time.Second)
+	metric := heartbeatMetric(now)
+	if got := metric.GetMetricDescriptor().GetName(); got != HeartbeatMetricName {
+		t.Errorf("Name: got %q, want %q", got, HeartbeatMetricName)
+	}
+	ts := metric.Timeseries[0]
+	if got := ts.LabelValues[0].GetValue(); got != Version {
+		t.Errorf("Version: got %q, want %q", got, Version)
+	}
+	if got := ts.Points[0].GetDoubleValue(); got != 90 {
+		t.Errorf("Uptime: got %v, want 90", got)
+	}
+}
+
+func TestExporter_sendsHeartbeatsWhenIdle(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	_, agentPortStr, _ := net.SplitHostPort(ln.Addr().String())
+	ma := new(metricsAgent)
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	ocexp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(":"+agentPortStr),
+		WithReconnectionPeriod(2*time.Millisecond),
+		WithHeartbeat(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		heartbeats := 0
+		ma.forEachRequest(func(req *agentmetricspb.ExportMetricsServiceRequest) {
+			for _, metric := range req.Metrics {
+				if metric.GetMetricDescriptor().GetName() == HeartbeatMetricName {
+					heartbeats++
+				}
+			}
+		})
+		if heartbeats >= 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No heartbeats were received")
+}
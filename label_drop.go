@@ -0,0 +1,114 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// labelDropper strips label keys from the metrics, either from
+// all of them or from the metrics of specific views.
+type labelDropper struct {
+	all    map[string]bool
+	byView map[string]map[string]bool
+}
+
+func (ld *labelDropper) add(viewName string, keys []string) {
+	dropped := ld.all
+	if viewName != "" {
+		if ld.byView == nil {
+			ld.byView = make(map[string]map[string]bool)
+		}
+		dropped = ld.byView[viewName]
+	}
+	if dropped == nil {
+		dropped = make(map[string]bool)
+		if viewName == "" {
+			ld.all = dropped
+		} else {
+			ld.byView[viewName] = dropped
+		}
+	}
+	for _, key := range keys {
+		dropped[key] = true
+	}
+}
+
+func (ld *labelDropper) dropped(viewName, key string) bool {
+	return ld.all[key] || ld.byView[viewName][key]
+}
+
+// dropLabels strips the dropped label keys from metric, adding up the values
+// of the series whose remaining labels are the same.
+func (ld *labelDropper) dropLabels(metric *metricspb.Metric) {
+	desc := metric.GetMetricDescriptor()
+	if desc == nil {
+		return
+	}
+	var kept []int
+	for i, lk := range desc.LabelKeys {
+		if !ld.dropped(desc.Name, lk.GetKey()) {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == len(desc.LabelKeys) {
+		return
+	}
+
+	// The descriptors are shared, see transform.ViewToMetricDescriptor.
+	stripped := *desc
+	stripped.LabelKeys = make([]*metricspb.LabelKey, len(kept))
+	for i, k := range kept {
+		stripped.LabelKeys[i] = desc.LabelKeys[k]
+	}
+	metric.MetricDescriptor = &stripped
+
+	seriesByLabels := make(map[string]*metricspb.TimeSeries)
+	timeseries := metric.Timeseries[:0]
+	for _, ts := range metric.Timeseries {
+		labelValues := make([]*metricspb.LabelValue, len(kept))
+		for i, k := range kept {
+			if k < len(ts.LabelValues) {
+				labelValues[i] = ts.LabelValues[k]
+			} else {
+				labelValues[i] = &metricspb.LabelValue{}
+			}
+		}
+		key := labelSetKey(labelValues)
+		if merged := seriesByLabels[key]; merged != nil {
+			mergeSeries(merged, ts)
+			continue
+		}
+		merged := &metricspb.TimeSeries{
+			StartTimestamp: ts.StartTimestamp,
+			LabelValues:    labelValues,
+			Points:         append([]*metricspb.Point(nil), ts.Points...),
+		}
+		seriesByLabels[key] = merged
+		timeseries = append(timeseries, merged)
+	}
+	metric.Timeseries = timeseries
+}
+
+// dropLabelKeys applies WithDroppedLabelKeys and
+// WithDroppedViewLabelKeys to metrics.
+func (ae *Exporter) dropLabelKeys(metrics []*metricspb.Metric) {
+	if ae.labelDropper == nil {
+		return
+	}
+	for _, metric := range metrics {
+		ae.labelDropper.dropLabels(metric)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func callsMetric(name string) *metricspb.Metric {
+	series := func(method, user string, value int64) *metricspb.TimeSeries {
+		return &metricspb.TimeSeries{
+			LabelValues: []*metricspb.LabelValue{{Value: method, HasValue: true}, {Value: user, HasValue: true}},
+			Points:      []*metricspb.Point{{Value: &metricspb.Point_Int64Value{Int64Value: value}}},
+		}
+	}
+	return &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{
+			Name:      name,
+			LabelKeys: []*metricspb.LabelKey{{Key: "method"}, {Key: "user"}},
+		},
+		Timeseries: []*metricspb.TimeSeries{
+			series("get", "alice", 1), series("get", "bob", 2), series("put", "alice", 4),
+		},
+	}
+}
+
+func TestLabelDropper_dropLabels(t *testing.T) {
+	ld := new(labelDropper)
+	ld.add("", []string{"user"})
+
+	metric := callsMetric("calls")
+	desc := metric.MetricDescriptor
+	ld.dropLabels(metric)
+
+	if got := len(desc.LabelKeys); got != 2 {
+		t.Errorf("The shared descriptor was modified: got %d label keys, want 2", got)
+	}
+	if keys := metric.MetricDescriptor.LabelKeys; len(keys) != 1 || keys[0].Key != "method" {
+		t.Fatalf("Got label keys %v, want [method]", keys)
+	}
+	got := make(map[string]int64)
+	for _, ts := range metric.Timeseries {
+		if len(ts.LabelValues) != 1 {
+			t.Fatalf("Got label values %v, want one", ts.LabelValues)
+		}
+		got[ts.LabelValues[0].Value] = ts.Points[0].GetInt64Value()
+	}
+	want := map[string]int64{"get": 3, "put": 4}
+	if len(got) != len(want) {
+		t.Fatalf("Got series %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Series %q: got %d, want %d", k, got[k], v)
+		}
+	}
+}
+
+func TestLabelDropper_byView(t *testing.T) {
+	ld := new(labelDropper)
+	ld.add("calls", []string{"method"})
+
+	other := callsMetric("other")
+	ld.dropLabels(other)
+	if len(other.MetricDescriptor.LabelKeys) != 2 || len(other.Timeseries) != 3 {
+		t.Errorf("The metric of another view was changed: %v", other)
+	}
+
+	calls := callsMetric("calls")
+	ld.dropLabels(calls)
+	if keys := calls.MetricDescriptor.LabelKeys; len(keys) != 1 || keys[0].Key != "user" {
+		t.Fatalf("Got label keys %v, want [user]", keys)
+	}
+	if len(calls.Timeseries) != 2 {
+		t.Errorf("Got %d series, want 2", len(calls.Timeseries))
+	}
+}
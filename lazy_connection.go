@@ -0,0 +1,66 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// dialLazily starts connecting to the agent in the background,
+// the first time it is invoked once started with WithLazyConnection.
+func (ae *Exporter) dialLazily() {
+	if !ae.lazyConnection || atomic.LoadInt32(&ae.lazyDialed) != 0 {
+		return
+	}
+	ae.mu.RLock()
+	started := ae.started
+	ae.mu.RUnlock()
+	if !started || !atomic.CompareAndSwapInt32(&ae.lazyDialed, 0, 1) {
+		return
+	}
+	go func() {
+		ae.connectFirst()
+		close(ae.lazyDialAttempted)
+		_ = ae.indefiniteBackgroundConnection()
+	}()
+}
+
+// waitLazyDial is like dialLazily, but it also waits, at most until ctx is
+// done, for the first attempt to connect, so that the data about to be sent
+// isn't dropped for want of a connection.
+func (ae *Exporter) waitLazyDial(ctx context.Context) error {
+	if !ae.lazyConnection {
+		return nil
+	}
+	ae.dialLazily()
+	if atomic.LoadInt32(&ae.lazyDialed) == 0 {
+		// Not started.
+		return nil
+	}
+	select {
+	case <-ae.lazyDialAttempted:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// endUndialed lets Stop proceed if the agent was never dialed.
+func (ae *Exporter) endUndialed() {
+	if ae.lazyConnection && ae.dryRun == nil && atomic.CompareAndSwapInt32(&ae.lazyDialed, 0, 1) {
+		close(ae.backgroundConnectionDoneCh)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+var errUnsupportedSampler = errors.New("ocagent: the config has no probability or constant sampler")
+
+// ApplyConfig installs the sampler of cfg as the default sampler, with
+// trace.ApplyConfig, and sends it to the agent on the Config stream, so that
+// the agent's view of the library configuration stays accurate when the
+// sampler is changed locally. The config is sent again on the streams opened
+// after a reconnection. Only the probability and constant samplers are
+// supported, as with the configs pushed by the agent, and the other fields
+// of cfg are ignored.
+func (ae *Exporter) ApplyConfig(cfg *tracepb.TraceConfig) error {
+	if !ae.applyTraceConfig(cfg) {
+		return errUnsupportedSampler
+	}
+	return ae.publishConfig(&tracepb.TraceConfig{Sampler: cfg.Sampler})
+}
+
+// publishConfig sends cfg on the current config stream,
+// unless it is the configuration that was last sent.
+func (ae *Exporter) publishConfig(cfg *tracepb.TraceConfig) error {
+	ae.configMu.Lock()
+	defer ae.configMu.Unlock()
+
+	ae.appliedConfig = cfg
+	if ae.configStream == nil || proto.Equal(ae.publishedConfig, cfg) {
+		return nil
+	}
+	if err := ae.configStream.Send(&agenttracepb.CurrentLibraryConfig{Config: cfg}); err != nil {
+		return err
+	}
+	ae.publishedConfig = cfg
+	return nil
+}
+
+// setConfigStream makes configStream the stream that configs are published
+// on, and sends on it the configuration applied last, if any.
+func (ae *Exporter) setConfigStream(configStream agenttracepb.TraceService_ConfigClient) error {
+	ae.configMu.Lock()
+	defer ae.configMu.Unlock()
+
+	ae.configStream = configStream
+	ae.publishedConfig = nil
+	if ae.appliedConfig == nil {
+		return nil
+	}
+	if err := configStream.Send(&agenttracepb.CurrentLibraryConfig{Config: ae.appliedConfig}); err != nil {
+		return err
+	}
+	ae.publishedConfig = ae.appliedConfig
+	return nil
+}
+
+// replyConfig sends back the configuration applied from the agent.
+func (ae *Exporter) replyConfig(configStream agenttracepb.TraceService_ConfigClient, cfg *tracepb.TraceConfig) error {
+	ae.configMu.Lock()
+	defer ae.configMu.Unlock()
+
+	if err := configStream.Send(&agenttracepb.CurrentLibraryConfig{Config: cfg}); err != nil {
+		return err
+	}
+	ae.appliedConfig = cfg
+	if configStream == ae.configStream {
+		ae.publishedConfig = cfg
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestExporter_ApplyConfigRejectsUnsupportedSamplers(t *testing.T) {
+	ae := &Exporter{}
+	for _, cfg := range []*tracepb.TraceConfig{
+		nil,
+		{},
+		{Sampler: &tracepb.TraceConfig_RateLimitingSampler{RateLimitingSampler: &tracepb.RateLimitingSampler{Qps: 10}}},
+	} {
+		if err := ae.ApplyConfig(cfg); err != errUnsupportedSampler {
+			t.Errorf("ApplyConfig(%v) = %v, want %v", cfg, err, errUnsupportedSampler)
+		}
+	}
+	if _, ok := ae.EffectiveSampler(); ok {
+		t.Error("A sampler was applied")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/encoding"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// marshaledRequest is an export request along with its wire encoding, which
+// is computed once. It implements proto.Marshaler so that gRPC, the tee file
+// and the spool all reuse that encoding, e.g. when a batch is retried or
+// spooled after a failed send, instead of marshaling the request again.
+type marshaledRequest struct {
+	proto.Message
+	data []byte
+}
+
+var _ proto.Marshaler = (*marshaledRequest)(nil)
+
+func (mr *marshaledRequest) Marshal() ([]byte, error) { return mr.data, nil }
+
+// unwrapRequest returns the request that msg carries, if it is a marshaledRequest.
+func unwrapRequest(msg proto.Message) proto.Message {
+	if mr, ok := msg.(*marshaledRequest); ok {
+		return mr.Message
+	}
+	return msg
+}
+
+// passthroughCodec hands the encoding of marshaledRequests over to gRPC
+// as is, and marshals every other message with Codec.
+type passthroughCodec struct {
+	encoding.Codec
+}
+
+func (pc passthroughCodec) Marshal(v interface{}) ([]byte, error) {
+	if mr, ok := v.(*marshaledRequest); ok {
+		return mr.data, nil
+	}
+	return pc.Codec.Marshal(v)
+}
+
+// marshal encodes req with the codec set by WithCodec, if any.
+func (ae *Exporter) marshal(req proto.Message) (*marshaledRequest, error) {
+	if mr, ok := req.(*marshaledRequest); ok {
+		return mr, nil
+	}
+	ae.stampBatchID(req)
+	var data []byte
+	var err error
+	if ae.codec != nil {
+		data, err = ae.codec.Marshal(req)
+	} else {
+		data, err = proto.Marshal(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &marshaledRequest{Message: req, data: data}, nil
+}
+
+// marshaledSpan is a span along with its encoding as
+// a field of an ExportTraceServiceRequest.
+type marshaledSpan struct {
+	span  *tracepb.Span
+	field []byte
+}
+
+// marshaledTraceRequest is a marshaled ExportTraceServiceRequest that keeps
+// the encoding of each of its spans, so that it can be split into smaller
+// requests, e.g. one per trace stream or to fit the agent's message size
+// limit, by concatenating bytes instead of marshaling the spans again.
+type marshaledTraceRequest struct {
+	*marshaledRequest
+
+	req *agenttracepb.ExportTraceServiceRequest
+	// header holds the encoding of all the fields of req but its spans.
+	header []byte
+	spans  []marshaledSpan
+}
+
+const traceRequestSpansField = 2
+
+func (ae *Exporter) marshalTraceRequest(req *agenttracepb.ExportTraceServiceRequest) (*marshaledTraceRequest, error) {
+	mr, err := ae.marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return splitTraceRequest(req, mr.data)
+}
+
+// splitTraceRequest finds the encoding of each span of req in data, the
+// encoding of req. It only walks the top-level fields, which are all
+// length-delimited in an ExportTraceServiceRequest.
+func splitTraceRequest(req *agenttracepb.ExportTraceServiceRequest, data []byte) (*marshaledTraceRequest, error) {
+	mtr := &marshaledTraceRequest{
+		marshaledRequest: &marshaledRequest{Message: req, data: data},
+		req:              req,
+		spans:            make([]marshaledSpan, 0, len(req.Spans)),
+	}
+	for i := 0; i < len(data); {
+		key, n := proto.DecodeVarint(data[i:])
+		if n == 0 || key&7 != proto.WireBytes {
+			return nil, fmt.Errorf("ocagent: malformed trace request at byte %d", i)
+		}
+		size, m := proto.DecodeVarint(data[i+n:])
+		if m == 0 || uint64(len(data)-i-n-m) < size {
+			return nil, fmt.Errorf("ocagent: truncated trace request at byte %d", i)
+		}
+		end := i + n + m + int(size)
+		if key>>3 == traceRequestSpansField {
+			if len(mtr.spans) == len(req.Spans) {
+				return nil, fmt.Errorf("ocagent: trace request encodes more spans than it has")
+			}
+			mtr.spans = append(mtr.spans, marshaledSpan{span: req.Spans[len(mtr.spans)], field: data[i:end]})
+		} else {
+			mtr.header = append(mtr.header, data[i:end]...)
+		}
+		i = end
+	}
+	if len(mtr.spans) != len(req.Spans) {
+		return nil, fmt.Errorf("ocagent: trace request encodes %d spans, want %d", len(mtr.spans), len(req.Spans))
+	}
+	return mtr, nil
+}
+
+// withSpans returns a request with the same node and resource
+// as mtr, and spans, which must come from mtr.
+func (mtr *marshaledTraceRequest) withSpans(spans []marshaledSpan) *marshaledTraceRequest {
+	size := len(mtr.header)
+	for _, ms := range spans {
+		size += len(ms.field)
+	}
+	data := make([]byte, 0, size)
+	data = append(data, mtr.header...)
+	req := &agenttracepb.ExportTraceServiceRequest{
+		Node:     mtr.req.Node,
+		Resource: mtr.req.Resource,
+		Spans:    make([]*tracepb.Span, 0, len(spans)),
+	}
+	for _, ms := range spans {
+		data = append(data, ms.field...)
+		req.Spans = append(req.Spans, ms.span)
+	}
+	return &marshaledTraceRequest{
+		marshaledRequest: &marshaledRequest{Message: req, data: data},
+		req:              req,
+		header:           mtr.header,
+		spans:            spans,
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/encoding"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	resourcepb "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestMarshaledTraceRequest_withSpans(t *testing.T) {
+	req := &agenttracepb.ExportTraceServiceRequest{
+		Node:     &commonpb.Node{Identifier: &commonpb.ProcessIdentifier{HostName: "host"}},
+		Resource: &resourcepb.Resource{Type: "container"},
+		Spans: []*tracepb.Span{
+			{TraceId: []byte{1}, Name: &tracepb.TruncatableString{Value: "a"}},
+			{TraceId: []byte{2}, Name: &tracepb.TruncatableString{Value: "b"}},
+			{TraceId: []byte{3}, Name: &tracepb.TruncatableString{Value: "c"}},
+		},
+	}
+
+	mtr, err := new(Exporter).marshalTraceRequest(req)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if g, w := len(mtr.spans), 3; g != w {
+		t.Fatalf("Spans: got %d want %d", g, w)
+	}
+
+	half := mtr.withSpans(mtr.spans[1:])
+	got := new(agenttracepb.ExportTraceServiceRequest)
+	if err := proto.Unmarshal(half.data, got); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	want := &agenttracepb.ExportTraceServiceRequest{Node: req.Node, Resource: req.Resource, Spans: req.Spans[1:]}
+	if !proto.Equal(got, want) {
+		t.Errorf("Got %v\nwant %v", got, want)
+	}
+	if !proto.Equal(half.req, want) {
+		t.Errorf("Request: got %v\nwant %v", half.req, want)
+	}
+
+	// The encoding is reused as is by anything that marshals the request.
+	data, err := proto.Marshal(half.marshaledRequest)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if string(data) != string(half.data) {
+		t.Error("proto.Marshal didn't reuse the encoding of the request")
+	}
+}
+
+func TestSplitTraceRequest_mismatch(t *testing.T) {
+	req := &agenttracepb.ExportTraceServiceRequest{Spans: []*tracepb.Span{{TraceId: []byte{1}}}}
+	data, err := proto.Marshal(&agenttracepb.ExportTraceServiceRequest{})
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if _, err := splitTraceRequest(req, data); err == nil {
+		t.Error("Expected an error when the encoding doesn't match the request")
+	}
+	if _, err := splitTraceRequest(req, []byte{0x12, 0x05}); err == nil {
+		t.Error("Expected an error for a truncated encoding")
+	}
+}
+
+type failingCodec struct {
+	encoding.Codec
+}
+
+func (failingCodec) Marshal(v interface{}) ([]byte, error) {
+	return nil, errors.New("codec failure")
+}
+
+func TestExporter_sendTracesDropsUnmarshalableBatches(t *testing.T) {
+	var logged []string
+	ae, err := NewUnstartedExporter(
+		WithInsecure(),
+		WithCodec(failingCodec{Codec: encoding.GetCodec("proto")}),
+		WithLogger(func(format string, args ...interface{}) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+
+	ae.sendTraces(&agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte{1}}, {TraceId: []byte{2}}},
+	})
+	if g, w := atomic.LoadInt64(&ae.counters.droppedSpans), int64(2); g != w {
+		t.Errorf("Dropped spans: got %d want %d", g, w)
+	}
+	if len(logged) != 1 || !strings.Contains(logged[0], "codec failure") {
+		t.Errorf("Logged %q, want the marshaling error", logged)
+	}
+}
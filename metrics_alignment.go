@@ -0,0 +1,90 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+// metricsAlignment holds the view data until the next wall-clock
+// boundary of interval for WithMetricsIntervalAlignment.
+type metricsAlignment struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// pending is the latest view data of each view. Earlier view data
+	// of the same view are superseded, since they are cumulative.
+	pending map[*view.View]*view.Data
+	order   []*view.View
+}
+
+func (ma *metricsAlignment) hold(vdl []*view.Data) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	if ma.pending == nil {
+		ma.pending = make(map[*view.View]*view.Data)
+	}
+	for _, vd := range vdl {
+		if _, ok := ma.pending[vd.View]; !ok {
+			ma.order = append(ma.order, vd.View)
+		}
+		ma.pending[vd.View] = vd
+	}
+}
+
+func (ma *metricsAlignment) release() []*view.Data {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	vdl := make([]*view.Data, 0, len(ma.order))
+	for _, v := range ma.order {
+		vdl = append(vdl, ma.pending[v])
+	}
+	ma.pending, ma.order = nil, nil
+	return vdl
+}
+
+// nextBoundary returns the first multiple of interval since the Unix epoch after now.
+func (ma *metricsAlignment) nextBoundary(now time.Time) time.Time {
+	return now.Truncate(ma.interval).Add(ma.interval)
+}
+
+func (ae *Exporter) alignMetrics(stopCh <-chan bool) {
+	timer := time.NewTimer(time.Until(ae.metricsAlignment.nextBoundary(time.Now())))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case now := <-timer.C:
+			ae.uploadViewData(ae.metricsAlignment.release())
+			timer.Reset(time.Until(ae.metricsAlignment.nextBoundary(now)))
+		}
+	}
+}
+
+// flushAlignedMetrics ships the view data held until the next boundary.
+func (ae *Exporter) flushAlignedMetrics() {
+	if ae.metricsAlignment == nil {
+		return
+	}
+	ae.uploadViewData(ae.metricsAlignment.release())
+}
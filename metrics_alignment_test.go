@@ -0,0 +1,59 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestMetricsAlignment_nextBoundary(t *testing.T) {
+	ma := &metricsAlignment{interval: 30 * time.Second}
+	tests := []struct {
+		now, want string
+	}{
+		{now: "2019-06-01T10:00:00Z", want: "2019-06-01T10:00:30Z"},
+		{now: "2019-06-01T10:00:12Z", want: "2019-06-01T10:00:30Z"},
+		{now: "2019-06-01T10:00:30Z", want: "2019-06-01T10:01:00Z"},
+		{now: "2019-06-01T10:00:59.999Z", want: "2019-06-01T10:01:00Z"},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := ma.nextBoundary(now); !got.Equal(want) {
+			t.Errorf("nextBoundary(%s) = %s, want %s", tt.now, got.Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestMetricsAlignment_holdKeepsLatestPerView(t *testing.T) {
+	ma := &metricsAlignment{interval: time.Minute}
+	v1, v2 := &view.View{Name: "v1"}, &view.View{Name: "v2"}
+	first := &view.Data{View: v1}
+	second := &view.Data{View: v2}
+	latest := &view.Data{View: v1}
+
+	ma.hold([]*view.Data{first, second})
+	ma.hold([]*view.Data{latest})
+	got := ma.release()
+	if len(got) != 2 || got[0] != latest || got[1] != second {
+		t.Errorf("Got %v, want the latest view data of v1 then v2", got)
+	}
+	if got := ma.release(); len(got) != 0 {
+		t.Errorf("Got %d view data after release, want none", len(got))
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// MetricsPullParams configures WithMetricsPull.
+type MetricsPullParams struct {
+	// Address is the address to serve the MetricsService on, e.g. ":55679".
+	Address string
+
+	// ServerOptions are the options of the gRPC server,
+	// e.g. grpc.Creds to serve the MetricsService over TLS.
+	ServerOptions []grpc.ServerOption
+}
+
+// metricsPull serves the latest metrics to the agents that pull them.
+type metricsPull struct {
+	params MetricsPullParams
+	ae     *Exporter
+
+	listener net.Listener
+	server   *grpc.Server
+
+	mu     sync.Mutex
+	latest map[string]*metricspb.Metric
+}
+
+var _ agentmetricspb.MetricsServiceServer = (*metricsPull)(nil)
+
+// serve starts serving the MetricsService on the address of the params.
+func (mp *metricsPull) serve() error {
+	lis, err := net.Listen("tcp", mp.params.Address)
+	if err != nil {
+		return fmt.Errorf("ocagent: failed to serve the metrics to pull: %v", err)
+	}
+	mp.listener = lis
+	mp.server = grpc.NewServer(mp.params.ServerOptions...)
+	agentmetricspb.RegisterMetricsServiceServer(mp.server, mp)
+	go func() {
+		_ = mp.server.Serve(lis)
+	}()
+	return nil
+}
+
+func (mp *metricsPull) stop() {
+	if mp.server != nil {
+		mp.server.Stop()
+	}
+}
+
+// add keeps the latest point of each metric of metrics, until it is pulled.
+func (mp *metricsPull) add(metrics []*metricspb.Metric) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if mp.latest == nil {
+		mp.latest = make(map[string]*metricspb.Metric)
+	}
+	for _, metric := range metrics {
+		if desc := metric.GetMetricDescriptor(); desc != nil {
+			mp.latest[desc.Name] = metric
+		}
+	}
+}
+
+// snapshot returns the latest metrics, sorted by name.
+func (mp *metricsPull) snapshot() []*metricspb.Metric {
+	mp.mu.Lock()
+	metrics := make([]*metricspb.Metric, 0, len(mp.latest))
+	for _, metric := range mp.latest {
+		metrics = append(metrics, metric)
+	}
+	mp.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].MetricDescriptor.Name < metrics[j].MetricDescriptor.Name
+	})
+	return metrics
+}
+
+// Export replies to every message of the agent, a pull, with an
+// ExportMetricsServiceRequest holding the latest metrics.
+func (mp *metricsPull) Export(stream agentmetricspb.MetricsService_ExportServer) error {
+	for {
+		if _, err := stream.Recv(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		reply := &agentmetricspb.ExportMetricsServiceRequest{
+			Node:     mp.ae.nodeInfo,
+			Resource: mp.ae.resource,
+			Metrics:  mp.snapshot(),
+		}
+		if err := stream.SendMsg(reply); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func TestExporter_metricsPull(t *testing.T) {
+	ocexp, err := NewExporter(
+		WithInsecure(),
+		WithLazyConnection(),
+		WithServiceName("puller-test"),
+		WithMetricsPull(MetricsPullParams{Address: "localhost:0"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	gauge := func(name string, value int64) *metricspb.Metric {
+		return &metricspb.Metric{
+			MetricDescriptor: &metricspb.MetricDescriptor{Name: name, Type: metricspb.MetricDescriptor_GAUGE_INT64},
+			Timeseries: []*metricspb.TimeSeries{{
+				Points: []*metricspb.Point{{Value: &metricspb.Point_Int64Value{Int64Value: value}}},
+			}},
+		}
+	}
+	for _, metrics := range [][]*metricspb.Metric{
+		{gauge("b", 1), gauge("a", 2)},
+		{gauge("b", 3)},
+	} {
+		if err := ocexp.ExportMetricsServiceRequest(&agentmetricspb.ExportMetricsServiceRequest{Metrics: metrics}); err != nil {
+			t.Fatalf("Failed to export the metrics: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, ocexp.metricsPull.listener.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to dial the exporter: %v", err)
+	}
+	defer cc.Close()
+	stream, err := agentmetricspb.NewMetricsServiceClient(cc).Export(ctx)
+	if err != nil {
+		t.Fatalf("Failed to open the Export stream: %v", err)
+	}
+	if err := stream.Send(&agentmetricspb.ExportMetricsServiceRequest{}); err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	pulled := new(agentmetricspb.ExportMetricsServiceRequest)
+	if err := stream.RecvMsg(pulled); err != nil {
+		t.Fatalf("Failed to receive the pulled metrics: %v", err)
+	}
+
+	if got := pulled.GetNode().GetServiceInfo().GetName(); got != "puller-test" {
+		t.Errorf("Node service name = %q, want %q", got, "puller-test")
+	}
+	want := map[string]int64{"a": 2, "b": 3}
+	if len(pulled.Metrics) != len(want) {
+		t.Fatalf("Pulled %d metrics, want %d", len(pulled.Metrics), len(want))
+	}
+	for i, name := range []string{"a", "b"} {
+		metric := pulled.Metrics[i]
+		if got := metric.MetricDescriptor.Name; got != name {
+			t.Errorf("Metric #%d is %q, want %q", i, got, name)
+			continue
+		}
+		if got := metric.Timeseries[0].Points[0].GetInt64Value(); got != want[name] {
+			t.Errorf("Metric %q = %d, want %d", name, got, want[name])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"time"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// Mirror receives a copy of every batch that the exporter sends to the
+// agent, e.g. to send it to an OTLP endpoint as well while migrating to
+// OpenTelemetry. The otel module provides such a Mirror.
+//
+// The batches carry the Node and the Resource of the exporter, and they
+// must not be modified.
+type Mirror interface {
+	MirrorTraces(ctx context.Context, req *agenttracepb.ExportTraceServiceRequest) error
+	MirrorMetrics(ctx context.Context, req *agentmetricspb.ExportMetricsServiceRequest) error
+}
+
+// mirrorTimeout bounds each call to the Mirror.
+const mirrorTimeout = 10 * time.Second
+
+// mirrorBatch queues a copy of batch for the mirror. The mirror fails
+// independently of the agent: the batch is copied whether or not the
+// agent is reachable, and dropped, rather than delaying the agent,
+// if the mirror fell behind.
+func (ae *Exporter) mirrorBatch(batch outgoingBatch) {
+	if ae.mirror == nil {
+		return
+	}
+	switch {
+	case batch.traces != nil:
+		req := *batch.traces
+		if req.Node == nil {
+			req.Node = ae.nodeInfo
+		}
+		if req.Resource == nil {
+			req.Resource = ae.resource
+		}
+		batch.traces = &req
+
+	case batch.metrics != nil:
+		req := *batch.metrics
+		if req.Node == nil {
+			req.Node = ae.nodeInfo
+		}
+		if req.Resource == nil {
+			req.Resource = ae.resource
+		}
+		batch.metrics = &req
+	}
+
+	select {
+	case ae.mirrorQueue <- batch:
+	default:
+		if ae.logger != nil {
+			ae.logger("ocagent: the mirror fell behind, a batch was dropped")
+		}
+	}
+}
+
+// runMirror sends the batches queued by mirrorBatch to the mirror, on a
+// goroutine of its own so that a slow mirror never stalls the sender.
+func (ae *Exporter) runMirror(stopCh <-chan bool) {
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case batch := <-ae.mirrorQueue:
+			ae.sendToMirror(batch)
+		}
+	}
+}
+
+func (ae *Exporter) sendToMirror(batch outgoingBatch) {
+	if batch.flushed != nil {
+		close(batch.flushed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+	var err error
+	if batch.traces != nil {
+		err = ae.mirror.MirrorTraces(ctx, batch.traces)
+	} else if batch.metrics != nil {
+		err = ae.mirror.MirrorMetrics(ctx, batch.metrics)
+	}
+	if err != nil && ae.logger != nil {
+		ae.logger("ocagent: failed to mirror a batch: %v", err)
+	}
+}
+
+// waitForMirror blocks until all the batches queued so far for the mirror
+// have been sent to it.
+func (ae *Exporter) waitForMirror() {
+	ae.mu.RLock()
+	started := ae.started
+	ae.mu.RUnlock()
+	if ae.mirror == nil || !started {
+		return
+	}
+
+	flushed := make(chan struct{})
+	select {
+	case ae.mirrorQueue <- outgoingBatch{flushed: flushed}:
+	case <-ae.stopCh:
+		return
+	}
+	select {
+	case <-flushed:
+	case <-ae.stopCh:
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+type recordingMirror struct {
+	mu      sync.Mutex
+	traces  []*agenttracepb.ExportTraceServiceRequest
+	metrics []*agentmetricspb.ExportMetricsServiceRequest
+}
+
+func (rm *recordingMirror) MirrorTraces(ctx context.Context, req *agenttracepb.ExportTraceServiceRequest) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.traces = append(rm.traces, req)
+	return nil
+}
+
+func (rm *recordingMirror) MirrorMetrics(ctx context.Context, req *agentmetricspb.ExportMetricsServiceRequest) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.metrics = append(rm.metrics, req)
+	return nil
+}
+
+func TestMirror_receivesBatchesWhileTheAgentIsDown(t *testing.T) {
+	// Nothing listens on this address anymore.
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	rm := new(recordingMirror)
+	exp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(addr),
+		WithServiceName("mirrored"),
+		WithMirror(rm),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}},
+		Name:        "span",
+		StartTime:   time.Now(),
+		EndTime:     time.Now(),
+	})
+	_ = exp.ExportMetricsServiceRequest(&agentmetricspb.ExportMetricsServiceRequest{
+		Metrics: []*metricspb.Metric{{MetricDescriptor: &metricspb.MetricDescriptor{Name: "m"}}},
+	})
+	exp.Flush()
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if len(rm.traces) != 1 || len(rm.traces[0].Spans) != 1 {
+		t.Fatalf("Mirrored traces: got %v, want one batch of one span", rm.traces)
+	}
+	if got := rm.traces[0].GetNode().GetServiceInfo().GetName(); got != "mirrored" {
+		t.Errorf("Mirrored traces: service name %q, want %q", got, "mirrored")
+	}
+	if len(rm.metrics) != 1 || len(rm.metrics[0].Metrics) != 1 {
+		t.Fatalf("Mirrored metrics: got %v, want one batch of one metric", rm.metrics)
+	}
+	if rm.metrics[0].Node == nil {
+		t.Error("Mirrored metrics: the Node wasn't set")
+	}
+}
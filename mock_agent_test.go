@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
 
 	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
 	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
@@ -43,6 +44,10 @@ type mockAgent struct {
 
 	traceNodes      []*commonpb.Node
 	receivedConfigs []*agenttracepb.CurrentLibraryConfig
+	// streamSpans holds the spans received on each Export stream,
+	// and streamEncodings the grpc-encoding of the streams.
+	streamSpans     [][]*tracepb.Span
+	streamEncodings []string
 
 	configsToSend          chan *agenttracepb.UpdatedLibraryConfig
 	closeConfigsToSendOnce sync.Once
@@ -126,7 +131,16 @@ func (ma *mockAgent) Export(tses agenttracepb.TraceService_ExportServer) error {
 	if in == nil || in.Node == nil {
 		return fmt.Errorf("the first message must contain the node identifier")
 	}
+	var encoding string
+	if enc, ok := tses.Context().Value(encodingKey{}).(*string); ok {
+		encoding = *enc
+	}
+	ma.mu.Lock()
 	ma.traceNodes = append(ma.traceNodes, in.Node)
+	stream := len(ma.streamSpans)
+	ma.streamSpans = append(ma.streamSpans, nil)
+	ma.streamEncodings = append(ma.streamEncodings, encoding)
+	ma.mu.Unlock()
 
 	// Now that we have the node identifier, let's start receiving spans.
 	for {
@@ -136,6 +150,7 @@ func (ma *mockAgent) Export(tses agenttracepb.TraceService_ExportServer) error {
 		}
 		ma.mu.Lock()
 		ma.spans = append(ma.spans, req.Spans...)
+		ma.streamSpans[stream] = append(ma.streamSpans[stream], req.Spans...)
 		ma.traceNodes = append(ma.traceNodes, req.Node)
 		ma.mu.Unlock()
 	}
@@ -174,6 +189,10 @@ func runMockAgent(t *testing.T) *mockAgent {
 }
 
 func runMockAgentAtAddr(t *testing.T, addr string) *mockAgent {
+	return runMockAgentWithServerOptions(t, addr)
+}
+
+func runMockAgentWithServerOptions(t *testing.T, addr string, opts ...grpc.ServerOption) *mockAgent {
 	var deferFuncs []func() error
 	ln, err := net.Listen("tcp", addr)
 	if err != nil {
@@ -181,7 +200,7 @@ func runMockAgentAtAddr(t *testing.T, addr string) *mockAgent {
 	}
 	deferFuncs = append(deferFuncs, ln.Close)
 
-	srv := grpc.NewServer()
+	srv := grpc.NewServer(append([]grpc.ServerOption{grpc.StatsHandler(encodingRecorder{})}, opts...)...)
 	ma := makeMockAgent(t)
 	agenttracepb.RegisterTraceServiceServer(srv, ma)
 	go func() {
@@ -217,6 +236,25 @@ func (ma *mockAgent) getSpans() []*tracepb.Span {
 	return spans
 }
 
+// getStreamSpans returns the spans received on each Export stream.
+func (ma *mockAgent) getStreamSpans() [][]*tracepb.Span {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	streamSpans := make([][]*tracepb.Span, len(ma.streamSpans))
+	for i, spans := range ma.streamSpans {
+		streamSpans[i] = append([]*tracepb.Span{}, spans...)
+	}
+	return streamSpans
+}
+
+func (ma *mockAgent) getStreamEncodings() []string {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+
+	return append([]string{}, ma.streamEncodings...)
+}
+
 func (ma *mockAgent) getReceivedConfigs() []*agenttracepb.CurrentLibraryConfig {
 	ma.mu.Lock()
 	receivedConfigs := append([]*agenttracepb.CurrentLibraryConfig{}, ma.receivedConfigs...)
@@ -232,3 +270,27 @@ func (ma *mockAgent) getTraceNodes() []*commonpb.Node {
 
 	return traceNodes
 }
+
+// encodingKey is the context key of the grpc-encoding of an RPC.
+type encodingKey struct{}
+
+// encodingRecorder records the grpc-encoding of the RPCs in their context.
+type encodingRecorder struct{}
+
+func (encodingRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, encodingKey{}, new(string))
+}
+
+func (encodingRecorder) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	if in, ok := rs.(*stats.InHeader); ok {
+		if enc, ok := ctx.Value(encodingKey{}).(*string); ok {
+			*enc = in.Compression
+		}
+	}
+}
+
+func (encodingRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (encodingRecorder) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,192 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+)
+
+// multiExporterQueueSize bounds the spans and view data
+// queued for each of the exporters of a MultiExporter.
+const multiExporterQueueSize = 1024
+
+// MultiExporter fans spans and view data out to several exporters, e.g. this
+// exporter and another one during a migration. Each exporter is isolated from
+// the others: it is passed the spans and the view data on a goroutine and
+// from a bounded queue of its own, so that a slow or blocked exporter drops
+// its copies rather than delaying the others, and a panic in it is recovered.
+type MultiExporter struct {
+	queues []*exporterQueue
+
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+
+	// OnPanic, if set, is invoked with the exporter that panicked and the
+	// recovered value, which are logged with log.Printf otherwise.
+	// It must be set before the MultiExporter is used.
+	OnPanic func(exporter interface{}, recovered interface{})
+
+	// OnDrop, if set, is invoked with the exporter whose queue is full
+	// whenever a span or view data is dropped for it, which is logged with
+	// log.Printf otherwise. It must be set before the MultiExporter is used.
+	OnDrop func(exporter interface{})
+}
+
+// exporterQueue holds the calls to make to an exporter of a MultiExporter.
+type exporterQueue struct {
+	exporter      interface{}
+	traceExporter trace.Exporter
+	viewExporter  view.Exporter
+	calls         chan func()
+}
+
+var _ trace.Exporter = (*MultiExporter)(nil)
+var _ view.Exporter = (*MultiExporter)(nil)
+
+// NewMultiExporter returns a MultiExporter that fans out to exporters. Each
+// of them must be a trace.Exporter, a view.Exporter or both, and receives the
+// spans and the view data in order. Stop ends the goroutines of the
+// MultiExporter.
+func NewMultiExporter(exporters ...interface{}) (*MultiExporter, error) {
+	me := new(MultiExporter)
+	for i, exp := range exporters {
+		te, isTraceExporter := exp.(trace.Exporter)
+		ve, isViewExporter := exp.(view.Exporter)
+		if !isTraceExporter && !isViewExporter {
+			return nil, fmt.Errorf("ocagent: exporter #%d (%T) is neither a trace.Exporter nor a view.Exporter", i, exp)
+		}
+		me.queues = append(me.queues, &exporterQueue{
+			exporter:      exp,
+			traceExporter: te,
+			viewExporter:  ve,
+			calls:         make(chan func(), multiExporterQueueSize),
+		})
+	}
+	for _, q := range me.queues {
+		me.wg.Add(1)
+		go me.run(q)
+	}
+	return me, nil
+}
+
+// ExportSpan queues sd for each of the trace exporters.
+func (me *MultiExporter) ExportSpan(sd *trace.SpanData) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	if me.stopped {
+		return
+	}
+	for _, q := range me.queues {
+		if te := q.traceExporter; te != nil {
+			me.enqueue(q, func() { te.ExportSpan(sd) })
+		}
+	}
+}
+
+// ExportView queues vd for each of the view exporters.
+func (me *MultiExporter) ExportView(vd *view.Data) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	if me.stopped {
+		return
+	}
+	for _, q := range me.queues {
+		if ve := q.viewExporter; ve != nil {
+			me.enqueue(q, func() { ve.ExportView(vd) })
+		}
+	}
+}
+
+// Flush waits until the spans and view data queued so far are passed to the
+// exporters, then invokes the Flush method of each of the exporters that
+// have one.
+func (me *MultiExporter) Flush() {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+	if me.stopped {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, q := range me.queues {
+		exp := q.exporter
+		wg.Add(1)
+		q.calls <- func() {
+			defer wg.Done()
+			if f, ok := exp.(interface{ Flush() }); ok {
+				f.Flush()
+			}
+		}
+	}
+	wg.Wait()
+}
+
+// Stop waits until the spans and view data queued so far are passed to the
+// exporters, and ends the goroutines of the MultiExporter. The spans and view
+// data exported afterwards are ignored. The exporters aren't stopped.
+func (me *MultiExporter) Stop() {
+	me.mu.Lock()
+	if me.stopped {
+		me.mu.Unlock()
+		return
+	}
+	me.stopped = true
+	for _, q := range me.queues {
+		close(q.calls)
+	}
+	me.mu.Unlock()
+	me.wg.Wait()
+}
+
+// enqueue queues fn for the exporter of q,
+// unless the exporter fell behind.
+func (me *MultiExporter) enqueue(q *exporterQueue, fn func()) {
+	select {
+	case q.calls <- fn:
+	default:
+		if me.OnDrop != nil {
+			me.OnDrop(q.exporter)
+		} else {
+			log.Printf("ocagent: exporter %T fell behind, its copy was dropped", q.exporter)
+		}
+	}
+}
+
+// run makes the calls queued for the exporter of q until Stop.
+func (me *MultiExporter) run(q *exporterQueue) {
+	defer me.wg.Done()
+	for fn := range q.calls {
+		me.isolate(q.exporter, fn)
+	}
+}
+
+func (me *MultiExporter) isolate(exporter interface{}, fn func()) {
+	defer func() {
+		r := recover()
+		switch {
+		case r == nil:
+		case me.OnPanic != nil:
+			me.OnPanic(exporter, r)
+		default:
+			log.Printf("ocagent: exporter %T panicked: %v", exporter, r)
+		}
+	}()
+	fn()
+}
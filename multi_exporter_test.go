@@ -0,0 +1,121 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+)
+
+type panickingExporter struct{}
+
+func (panickingExporter) ExportSpan(*trace.SpanData) { panic("ExportSpan") }
+func (panickingExporter) ExportView(*view.Data)      { panic("ExportView") }
+
+type viewRecorder struct {
+	views []*view.Data
+}
+
+func (vr *viewRecorder) ExportView(vd *view.Data) { vr.views = append(vr.views, vd) }
+
+func TestMultiExporter_isolatesExporters(t *testing.T) {
+	spans := new(spanRecorder)
+	views := new(viewRecorder)
+	me, err := ocagent.NewMultiExporter(panickingExporter{}, spans, views)
+	if err != nil {
+		t.Fatalf("Failed to create a multi-exporter: %v", err)
+	}
+	var panics []interface{}
+	me.OnPanic = func(_ interface{}, recovered interface{}) {
+		panics = append(panics, recovered)
+	}
+
+	defer me.Stop()
+
+	me.ExportSpan(&trace.SpanData{Name: "span"})
+	me.ExportView(&view.Data{})
+	me.Flush()
+
+	if names := spans.names(); len(names) != 1 || names[0] != "span" {
+		t.Errorf("Got spans %q, want the span", names)
+	}
+	if len(views.views) != 1 {
+		t.Errorf("Got %d view data, want 1", len(views.views))
+	}
+	if len(panics) != 2 || panics[0] != "ExportSpan" || panics[1] != "ExportView" {
+		t.Errorf("Got panics %v", panics)
+	}
+}
+
+type blockedExporter struct {
+	unblock chan struct{}
+}
+
+func (be blockedExporter) ExportSpan(*trace.SpanData) { <-be.unblock }
+
+func TestMultiExporter_slowExportersDropTheirCopies(t *testing.T) {
+	blocked := blockedExporter{unblock: make(chan struct{})}
+	spans := new(spanRecorder)
+	me, err := ocagent.NewMultiExporter(blocked, spans)
+	if err != nil {
+		t.Fatalf("Failed to create a multi-exporter: %v", err)
+	}
+	defer me.Stop()
+	var drops int
+	me.OnDrop = func(exporter interface{}) {
+		if exporter != blocked {
+			t.Errorf("Dropped a copy for %T", exporter)
+		}
+		drops++
+	}
+
+	// More spans than the queue of the blocked exporter holds, each
+	// passed to the other exporter before the next one is exported.
+	const n = 1100
+	exported := make(chan struct{})
+	go func() {
+		defer close(exported)
+		for i := 0; i < n; i++ {
+			me.ExportSpan(&trace.SpanData{Name: "span"})
+			for len(spans.names()) <= i {
+				time.Sleep(time.Microsecond)
+			}
+		}
+	}()
+	select {
+	case <-exported:
+	case <-time.After(10 * time.Second):
+		t.Fatal("The blocked exporter stalled the others")
+	}
+	close(blocked.unblock)
+	me.Flush()
+
+	if got := len(spans.names()); got != n {
+		t.Errorf("Got %d spans, want %d", got, n)
+	}
+	if drops == 0 {
+		t.Error("The blocked exporter dropped no copy")
+	}
+}
+
+func TestNewMultiExporter_rejectsNonExporters(t *testing.T) {
+	if _, err := ocagent.NewMultiExporter("not an exporter"); err == nil {
+		t.Error("Expected an error")
+	}
+}
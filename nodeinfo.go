@@ -19,6 +19,8 @@ import (
 
 	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
 	"go.opencensus.io"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
 )
 
 // NodeWithStartTime creates a node using nodeName and derives:
@@ -31,7 +33,7 @@ func NodeWithStartTime(nodeName string) *commonpb.Node {
 		Identifier: &commonpb.ProcessIdentifier{
 			HostName:       os.Getenv("HOSTNAME"),
 			Pid:            uint32(os.Getpid()),
-			StartTimestamp: timeToTimestamp(startTime),
+			StartTimestamp: transform.Timestamp(startTime),
 		},
 		LibraryInfo: &commonpb.LibraryInfo{
 			Language:           commonpb.LibraryInfo_GO_LANG,
@@ -16,17 +16,22 @@ package ocagent
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/golang/protobuf/proto"
 	"google.golang.org/api/support/bundler"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
@@ -35,6 +40,8 @@ import (
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
 
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
 	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
 	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
 	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
@@ -60,9 +67,9 @@ var _ view.Exporter = (*Exporter)(nil)
 type Exporter struct {
 	// mu protects the non-atomic and non-channel variables
 	mu sync.RWMutex
-	// senderMu protects the concurrent unsafe send on traceExporter client
+	// senderMu protects the concurrent unsafe send on metricsExporter client
 	senderMu sync.Mutex
-	// recvMu protects the concurrent unsafe recv on traceExporter client
+	// recvMu protects the concurrent unsafe recv on metricsExporter client
 	recvMu                sync.Mutex
 	started               bool
 	stopped               bool
@@ -71,33 +78,199 @@ type Exporter struct {
 	canDialInsecure       bool
 	useUnaryBatchExporter bool
 	unaryExportTimeout    time.Duration
+	retryParams           *RetryParams
 	traceSvcClient        agenttracepb.TraceServiceClient
-	traceExporter         agenttracepb.TraceService_ExportClient
+	traceStreams          []*traceStream
+	streamGenerations     streamGenerations
+	traceResponseHandler  func(*agenttracepb.ExportTraceServiceResponse)
+	numTraceStreams       int
 	metricsExporter       agentmetricspb.MetricsService_ExportClient
-	nodeInfo              *commonpb.Node
-	grpcClientConn        *grpc.ClientConn
-	reconnectionPeriod    time.Duration
-	resourceDetector      resource.Detector
-	resource              *resourcepb.Resource
-	compressor            string
-	headers               map[string]string
-	lastConnectErrPtr     unsafe.Pointer
-	startOnce             sync.Once
-	stopCh                chan bool
-	disconnectedCh        chan bool
+	// compressedMetricsExporter is only set if metrics are
+	// compressed above metricsCompressionThreshold bytes.
+	compressedMetricsExporter agentmetricspb.MetricsService_ExportClient
+	nodeInfo                  *commonpb.Node
+	nodeStartTime             time.Time
+	grpcClientConn            *grpc.ClientConn
+	reconnectionPeriod        time.Duration
+	backoffPolicy             BackoffPolicy
+	resourceDetector          resource.Detector
+	resource                  *resourcepb.Resource
+	compressor                string
+	codec                     encoding.Codec
+	// traceCompressionThreshold and metricsCompressionThreshold are the
+	// sizes in bytes below which batches are sent uncompressed.
+	traceCompressionThreshold   int
+	metricsCompressionThreshold int
+	headers                     map[string]string
+	traceHeaders                map[string]string
+	metricsHeaders              map[string]string
+	tenantHeaders               map[string]map[string]string
+	connState                   int32
+	lastConnectErrPtr           unsafe.Pointer
+	startOnce                   sync.Once
+	stopCh                      chan bool
+	disconnectedCh              chan bool
+	reconnectCh                 chan bool
 
 	backgroundConnectionDoneCh chan bool
 
+	// stopping is set once Stop is invoked, and stopDoneCh
+	// closed once the exporter is stopped.
+	stopping   bool
+	stopDoneCh chan struct{}
+
+	// lazyConnection defers dialing the agent until the first export.
+	// lazyDialed is set once it is dialed, and lazyDialAttempted
+	// closed once the first attempt to connect is over.
+	lazyConnection    bool
+	lazyDialed        int32
+	lazyDialAttempted chan struct{}
+
 	traceBundler *bundler.Bundler
 
+	// sendQueue feeds the batches produced by the bundlers to the sender goroutine.
+	sendQueue chan outgoingBatch
+
+	// mirror, if set, receives a copy of the batches through mirrorQueue.
+	mirror      Mirror
+	mirrorQueue chan outgoingBatch
+
 	// viewDataBundler is the bundler to enable conversion
 	// from OpenCensus-Go view.Data to metricspb.Metric.
 	// Please do not confuse it with metricsBundler!
 	viewDataBundler *bundler.Bundler
 
-	clientTransportCredentials credentials.TransportCredentials
+	traceBundlerOptions    BundlerOptions
+	viewDataBundlerOptions BundlerOptions
+
+	// spanFilter, if set, decides which spans are exported.
+	spanFilter func(*trace.SpanData) bool
+
+	attributeKeyMapping *AttributeKeyMapping
+	// defaultSpanAttributes are converted once, and shared by all the spans.
+	defaultSpanAttributes map[string]*tracepb.AttributeValue
+	timeEventLimits       TimeEventLimits
+
+	tenantStreamsMu      sync.Mutex
+	tenantMetricsStreams map[string]*tenantMetricsStream
+
+	// heartbeatSent is set when the heartbeat metric was pushed with view data.
+	heartbeatInterval time.Duration
+	heartbeatSent     int32
+
+	runtimeMetricsInterval time.Duration
+	processMetricsInterval time.Duration
+
+	// configStream is the stream that the library config is published on,
+	// publishedConfig the config last sent on it and appliedConfig the
+	// config last applied, either locally or from the agent.
+	configMu        sync.Mutex
+	configStream    agenttracepb.TraceService_ConfigClient
+	publishedConfig *tracepb.TraceConfig
+	appliedConfig   *tracepb.TraceConfig
+
+	// connectivityStateCallback, if set, is called with
+	// the states of the gRPC channel to the agent.
+	connectivityStateCallback func(connectivity.State)
+
+	// disconnectionAlert, if set, is called once the exporter is disconnected
+	// for disconnectionAlertThreshold, since disconnectedSinceUnixNano.
+	disconnectionAlert          func(DisconnectionAlert)
+	disconnectionAlertThreshold time.Duration
+	disconnectedSinceUnixNano   int64
+
+	onSuccess func(ExportStats)
+	events    *eventRing
+	watchers  watchers
+
+	// connectedOnce is set once the streams were first established.
+	connectedOnce int32
+	// draining is set once Stop was invoked, to drop the new spans and views.
+	draining int32
+
+	counters   exporterCounters
+	expvarName string
+	debug      *debugWriter
+	dryRun     func(ValidationProblem)
+
+	logger           func(format string, args ...interface{})
+	flushOnExit      bool
+	finalizerWarning bool
+	sentinel         *unstoppedSentinel
+
+	// lastExportUnixNano is when a batch was last exported successfully.
+	lastExportUnixNano int64
+	// throttledUntilUnixNano is when the pause requested by the agent ends.
+	throttledUntilUnixNano int64
+
+	// bufferedSpanBytes is the size of the spans in the trace bundler.
+	bufferedSpanBytes int64
+	// pendingSpans is the number of spans buffered or being sent.
+	pendingSpans      int64
+	maxSpanAge        time.Duration
+	errorSpanPriority bool
+	errorTraces       errorTraces
+	loadShedding      *LoadSheddingParams
+	flowControl       *FlowControlParams
+	adaptiveBatching  *AdaptiveBatchingParams
+	batchObservations batchObservations
+	transportParams   *TransportParams
+	spillExporter     trace.Exporter
+
+	labelDropper       *labelDropper
+	cardinalityLimiter *cardinalityLimiter
+	deltaConverter     *deltaConverter
+	metricsAlignment   *metricsAlignment
+	unitMapping        func(unit string) string
+
+	fallbackSampler      *fallbackSampler
+	fallbackSamplerState fallbackSamplerState
+	effectiveSampler     atomic.Value // AppliedSampler
 
-	grpcDialOptions []grpc.DialOption
+	clientTransportCredentials credentials.TransportCredentials
+	// tlsFromAddress is set if clientTransportCredentials were derived
+	// from a grpcs:// or https:// agent address.
+	tlsFromAddress bool
+	// systemCertPoolPEMFiles, if non-nil, are extra PEM files added to the
+	// system's roots to build clientTransportCredentials.
+	systemCertPoolPEMFiles []string
+	// fipsTLSConfig, if non-nil, is the TLS configuration of WithFIPSTLS.
+	fipsTLSConfig *tls.Config
+
+	// reloadedConfig is the configuration last applied by ReloadConfigFile.
+	reloadMu       sync.Mutex
+	reloadedConfig *ExporterConfig
+
+	useApplicationDefaultCredentials    bool
+	applicationDefaultCredentialsScopes []string
+	perRPCCredentials                   credentials.PerRPCCredentials
+
+	grpcDialOptions       []grpc.DialOption
+	callOptions           []grpc.CallOption
+	noSelfInstrumentation bool
+
+	teeFileParams *TeeFileParams
+	teeFile       *teeFile
+
+	spoolParams *SpoolParams
+	spool       *spool
+
+	// traceAssembler, if set, buffers spans until their trace is complete.
+	traceAssembler *traceAssembler
+	// spanRollup, if set, summarizes the spans of WithSpanRollup.
+	spanRollup *spanRollup
+
+	// uploads are the batches being sent, which Stop waits for.
+	uploads inFlightUploads
+
+	// metricsPull, if set, serves the metrics to the agent instead of pushing them.
+	metricsPull *metricsPull
+	// batchIDs, if set, numbers the export requests.
+	batchIDs *batchIDs
+	// strictOrdering keeps the spans in the order they were exported.
+	strictOrdering bool
+	// attributeLimit, if set, caps the attributes of the exported spans.
+	attributeLimit *attributeLimit
 }
 
 func NewExporter(opts ...ExporterOption) (*Exporter, error) {
@@ -111,27 +284,69 @@ func NewExporter(opts ...ExporterOption) (*Exporter, error) {
 	return exp, nil
 }
 
-const spanDataBufferSize = 300
+const (
+	spanDataBufferSize      = 300
+	defaultTraceBundleDelay = 2 * time.Second
+)
 
 func NewUnstartedExporter(opts ...ExporterOption) (*Exporter, error) {
 	e := new(Exporter)
 	for _, opt := range opts {
 		opt.withExporter(e)
 	}
-	traceBundler := bundler.NewBundler((*trace.SpanData)(nil), func(bundle interface{}) {
-		e.uploadTraces(bundle.([]*trace.SpanData))
-	})
-	traceBundler.DelayThreshold = 2 * time.Second
-	traceBundler.BundleCountThreshold = spanDataBufferSize
-	e.traceBundler = traceBundler
-
-	viewDataBundler := bundler.NewBundler((*view.Data)(nil), func(bundle interface{}) {
-		e.uploadViewData(bundle.([]*view.Data))
-	})
-	viewDataBundler.DelayThreshold = 2 * time.Second
-	viewDataBundler.BundleCountThreshold = 500 // TODO: (@odeke-em) make this configurable.
-	e.viewDataBundler = viewDataBundler
+	// WithFIPSTLS applies the system cert pool to its own configuration.
+	if e.systemCertPoolPEMFiles != nil && e.clientTransportCredentials == nil && e.fipsTLSConfig == nil {
+		creds, err := systemCertPoolCredentials(e.systemCertPoolPEMFiles)
+		if err != nil {
+			return nil, err
+		}
+		e.clientTransportCredentials = creds
+	}
+	if err := e.checkStrictOrdering(); err != nil {
+		return nil, err
+	}
+	if err := e.resolveAgentAddress(); err != nil {
+		return nil, err
+	}
+	// After the address, so that an invalid one is reported as such.
+	if e.fipsTLSConfig != nil {
+		creds, err := e.fipsCredentials()
+		if err != nil {
+			return nil, err
+		}
+		e.clientTransportCredentials = creds
+	}
+	if err := e.loadApplicationDefaultCredentials(); err != nil {
+		return nil, err
+	}
+	e.traceBundler = e.newTraceBundler(nil)
+	e.viewDataBundler = e.newViewDataBundler()
+	e.sendQueue = make(chan outgoingBatch, sendQueueSize)
+	if e.mirror != nil {
+		e.mirrorQueue = make(chan outgoingBatch, sendQueueSize)
+	}
+	e.debug = debugWriterFromEnv()
+	if e.serviceName == "" {
+		e.serviceName = defaultServiceName()
+	}
 	e.nodeInfo = NodeWithStartTime(e.serviceName)
+	if !e.nodeStartTime.IsZero() {
+		e.nodeInfo.Identifier.StartTimestamp = transform.Timestamp(e.nodeStartTime)
+	}
+	if e.teeFileParams != nil {
+		tf, err := openTeeFile(*e.teeFileParams)
+		if err != nil {
+			return nil, err
+		}
+		e.teeFile = tf
+	}
+	if e.spoolParams != nil {
+		sp, err := openSpool(*e.spoolParams)
+		if err != nil {
+			return nil, err
+		}
+		e.spool = sp
+	}
 	if e.resourceDetector != nil {
 		res, err := e.resourceDetector(context.Background())
 		if err != nil {
@@ -143,10 +358,65 @@ func NewUnstartedExporter(opts ...ExporterOption) (*Exporter, error) {
 	} else {
 		e.resource = resourceProtoFromEnv()
 	}
+	// Last, since a published expvar can't be taken back.
+	if err := e.publishExpvar(); err != nil {
+		return nil, err
+	}
+	e.setFinalizer()
 
 	return e, nil
 }
 
+// newTraceBundler returns a bundler that uploads the spans added to it.
+// If ready is non-nil, no bundle is uploaded before it is closed.
+func (ae *Exporter) newTraceBundler(ready <-chan struct{}) *bundler.Bundler {
+	traceBundler := bundler.NewBundler((*bundledSpan)(nil), func(bundle interface{}) {
+		if ready != nil {
+			<-ready
+		}
+		bundled := bundle.([]*bundledSpan)
+		spans := make([]*tracepb.Span, 0, len(bundled))
+		size := 0
+		for _, bs := range bundled {
+			if bs.span == nil {
+				spans = append(spans, bs.batch...)
+			} else {
+				spans = append(spans, bs.span)
+			}
+			size += bs.size
+		}
+		atomic.AddInt64(&ae.bufferedSpanBytes, -int64(size))
+		if ae.spillBundle(bundled) {
+			atomic.AddInt64(&ae.pendingSpans, -int64(len(spans)))
+			return
+		}
+		ae.uploadTraces(spans)
+	})
+	traceBundler.DelayThreshold = defaultTraceBundleDelay
+	traceBundler.BundleCountThreshold = spanDataBufferSize
+	ae.traceBundlerOptions.applyTo(traceBundler)
+	if ae.strictOrdering {
+		// Bundles are handled in order, one at a time.
+		traceBundler.HandlerLimit = 1
+	}
+	return traceBundler
+}
+
+func (ae *Exporter) newViewDataBundler() *bundler.Bundler {
+	viewDataBundler := bundler.NewBundler((*view.Data)(nil), func(bundle interface{}) {
+		vdl := bundle.([]*view.Data)
+		if ae.metricsAlignment != nil {
+			ae.metricsAlignment.hold(vdl)
+			return
+		}
+		ae.uploadViewData(vdl)
+	})
+	viewDataBundler.DelayThreshold = 2 * time.Second
+	viewDataBundler.BundleCountThreshold = 500
+	ae.viewDataBundlerOptions.applyTo(viewDataBundler)
+	return viewDataBundler
+}
+
 const (
 	maxInitialConfigRetries = 10
 	maxInitialTracesRetries = 10
@@ -158,6 +428,15 @@ var (
 	errStopped        = errors.New("stopped")
 )
 
+var (
+	// ErrStopping is returned by TryExportSpan and TryExportView
+	// once Stop was invoked.
+	ErrStopping = errors.New("ocagent: the exporter is stopping")
+	// ErrShed is returned by TryExportSpan for a span dropped
+	// under pressure, see WithErrorSpanPriority and WithLoadShedding.
+	ErrShed = errors.New("ocagent: span shed under pressure")
+)
+
 // Start dials to the agent, establishing a connection to it. It also
 // initiates the Config and Trace services by sending over the initial
 // messages that consist of the node identifier. Start invokes a background
@@ -166,32 +445,92 @@ var (
 func (ae *Exporter) Start() error {
 	var err = errAlreadyStarted
 	ae.startOnce.Do(func() {
+		if ae.metricsPull != nil {
+			if err = ae.metricsPull.serve(); err != nil {
+				return
+			}
+		}
+
 		ae.mu.Lock()
 		ae.started = true
 		ae.disconnectedCh = make(chan bool, 1)
+		ae.reconnectCh = make(chan bool, 1)
 		ae.stopCh = make(chan bool)
 		ae.backgroundConnectionDoneCh = make(chan bool)
+		ae.stopDoneCh = make(chan struct{})
+		ae.lazyDialAttempted = make(chan struct{})
 		ae.mu.Unlock()
 
-		// An optimistic first connection attempt to ensure that
-		// applications under heavy load can immediately process
-		// data. See https://github.com/census-ecosystem/opencensus-go-exporter-ocagent/pull/63
-		if err := ae.connect(); err == nil {
-			ae.setStateConnected()
-		} else {
-			ae.setStateDisconnected(err)
+		go ae.runSender(ae.stopCh)
+		if ae.mirror != nil {
+			go ae.runMirror(ae.stopCh)
+		}
+		if ae.flushOnExit {
+			ae.registerExitFlush()
+		}
+		if ae.traceAssembler != nil {
+			go ae.sweepTraces(ae.stopCh)
+		}
+		if ae.spanRollup != nil {
+			go ae.rollUpSpans(ae.stopCh)
+		}
+		if ae.metricsAlignment != nil {
+			go ae.alignMetrics(ae.stopCh)
+		}
+		if ae.heartbeatInterval > 0 {
+			go ae.sendHeartbeats(ae.stopCh)
+		}
+		if ae.runtimeMetricsInterval > 0 {
+			go ae.collectRuntimeMetrics(ae.stopCh)
+		}
+		if ae.processMetricsInterval > 0 {
+			go ae.collectProcessMetrics(ae.stopCh)
+		}
+		if ae.adaptiveBatching != nil {
+			go ae.adaptBatching(ae.stopCh)
+		}
+		if ae.disconnectionAlert != nil {
+			go ae.watchDisconnections(ae.stopCh)
+		}
+		if ae.dryRun != nil {
+			// No connection is ever attempted.
+			close(ae.backgroundConnectionDoneCh)
+			err = nil
+			return
 		}
-		go ae.indefiniteBackgroundConnection()
+
+		// Until the agent sends a sampling configuration.
+		ae.armFallbackSampler()
 
 		err = nil
+		if ae.lazyConnection {
+			// The agent is dialed on the first export, see dialLazily.
+			return
+		}
+		ae.connectFirst()
+		go ae.indefiniteBackgroundConnection()
 	})
 
 	return err
 }
 
+// connectFirst makes an optimistic first connection attempt to ensure that
+// applications under heavy load can immediately process data.
+// See https://github.com/census-ecosystem/opencensus-go-exporter-ocagent/pull/63
+func (ae *Exporter) connectFirst() {
+	if err := ae.connect(); err == nil {
+		ae.setStateConnected()
+	} else {
+		ae.setStateDisconnected(err)
+	}
+}
+
 func (ae *Exporter) prepareAgentAddress() string {
-	if ae.agentAddress != "" {
-		return ae.agentAddress
+	ae.mu.RLock()
+	agentAddress := ae.agentAddress
+	ae.mu.RUnlock()
+	if agentAddress != "" {
+		return agentAddress
 	}
 	return fmt.Sprintf("%s:%d", DefaultAgentHost, DefaultAgentPort)
 }
@@ -199,7 +538,7 @@ func (ae *Exporter) prepareAgentAddress() string {
 func (ae *Exporter) enableConnectionStreams(cc *grpc.ClientConn) error {
 	ae.mu.RLock()
 	started := ae.started
-	nodeInfo := ae.nodeInfo
+	nodeInfo := ae.connectionNode(ae.nodeInfo)
 	ae.mu.RUnlock()
 
 	if !started {
@@ -213,6 +552,9 @@ func (ae *Exporter) enableConnectionStreams(cc *grpc.ClientConn) error {
 	}
 	ae.grpcClientConn = cc
 	ae.mu.Unlock()
+	if ae.connectivityStateCallback != nil {
+		go ae.watchConnectivity(cc)
+	}
 
 	if err := ae.createTraceServiceConnection(ae.grpcClientConn, nodeInfo); err != nil {
 		return err
@@ -223,27 +565,32 @@ func (ae *Exporter) enableConnectionStreams(cc *grpc.ClientConn) error {
 func (ae *Exporter) createTraceServiceConnection(cc *grpc.ClientConn, node *commonpb.Node) error {
 	// Initiate the trace service by sending over node identifier info.
 	traceSvcClient := agenttracepb.NewTraceServiceClient(cc)
-	ctx := ae.newGRPCContext()
-	traceExporter, err := traceSvcClient.Export(ctx)
-	if err != nil {
-		return fmt.Errorf("Exporter.Start:: TraceServiceClient: %v", err)
-	}
-
-	firstTraceMessage := &agenttracepb.ExportTraceServiceRequest{
-		Node:     node,
-		Resource: ae.resource,
-	}
-	if err := traceExporter.Send(firstTraceMessage); err != nil {
-		return fmt.Errorf("Exporter.Start:: Failed to initiate the Config service: %v", err)
+	numStreams, compressAbove := ae.traceStreamLayout()
+	twinStreams := ae.currentCompressor() != "" && compressAbove > 0
+	traceStreams := make([]*traceStream, 0, numStreams)
+	for i := 0; i < numStreams; i++ {
+		ts, err := ae.openTraceStream(traceSvcClient, node, !twinStreams)
+		if err != nil {
+			return err
+		}
+		if twinStreams {
+			// Batches at or above the threshold go out on a compressed twin stream.
+			if ts.compressed, err = ae.openTraceStream(traceSvcClient, node, true); err != nil {
+				return err
+			}
+			ts.compressAbove = compressAbove
+		}
+		traceStreams = append(traceStreams, ts)
 	}
 
 	ae.mu.Lock()
 	ae.traceSvcClient = traceSvcClient
-	ae.traceExporter = traceExporter
+	ae.traceStreams = traceStreams
+	ae.streamGenerations.traces++
 	ae.mu.Unlock()
 
 	// Initiate the config service by sending over node identifier info.
-	configStream, err := traceSvcClient.Config(context.Background())
+	configStream, err := traceSvcClient.Config(ae.newGRPCContext(teeSignalTraces), ae.compressionCallOptions(true)...)
 	if err != nil {
 		return fmt.Errorf("Exporter.Start:: ConfigStream: %v", err)
 	}
@@ -251,54 +598,136 @@ func (ae *Exporter) createTraceServiceConnection(cc *grpc.ClientConn, node *comm
 	if err := configStream.Send(firstCfgMessage); err != nil {
 		return fmt.Errorf("Exporter.Start:: Failed to initiate the Config service: %v", err)
 	}
+	if err := ae.setConfigStream(configStream); err != nil {
+		return fmt.Errorf("Exporter.Start:: Failed to send the library config: %v", err)
+	}
 
 	// In the background, handle trace configurations that are beamed down
 	// by the agent, but also reply to it with the applied configuration.
-	go ae.handleConfigStreaming(configStream)
+	gen := ae.configStreamStarted()
+	go func() {
+		_ = ae.handleConfigStreaming(configStream)
+		ae.configStreamEnded(gen)
+	}()
 	return nil
 }
 
-func (ae *Exporter) createMetricsServiceConnection(cc *grpc.ClientConn, node *commonpb.Node) error {
-	metricsSvcClient := agentmetricspb.NewMetricsServiceClient(cc)
-	metricsExporter, err := metricsSvcClient.Export(context.Background())
+func (ae *Exporter) openTraceStream(traceSvcClient agenttracepb.TraceServiceClient, node *commonpb.Node, compress bool) (*traceStream, error) {
+	ctx := ae.newGRPCContext(teeSignalTraces)
+	traceExporter, err := traceSvcClient.Export(ctx, ae.exportCallOptions(compress)...)
 	if err != nil {
-		return fmt.Errorf("MetricsExporter: failed to start the service client: %v", err)
+		return nil, fmt.Errorf("Exporter.Start:: TraceServiceClient: %v", err)
 	}
-	// Initiate the metrics service by sending over the first message just containing the Node and Resource.
-	firstMetricsMessage := &agentmetricspb.ExportMetricsServiceRequest{
+
+	firstTraceMessage := &agenttracepb.ExportTraceServiceRequest{
 		Node:     node,
 		Resource: ae.resource,
 	}
-	if err := metricsExporter.Send(firstMetricsMessage); err != nil {
-		return fmt.Errorf("MetricsExporter:: failed to send the first message: %v", err)
+	if err := traceExporter.Send(firstTraceMessage); err != nil {
+		return nil, fmt.Errorf("Exporter.Start:: Failed to initiate the Config service: %v", err)
+	}
+	return newTraceStream(traceExporter, ae.traceResponseHandler, ae.traceStreamEnded), nil
+}
+
+func (ae *Exporter) createMetricsServiceConnection(cc *grpc.ClientConn, node *commonpb.Node) error {
+	metricsSvcClient := agentmetricspb.NewMetricsServiceClient(cc)
+	twinStreams := ae.currentCompressor() != "" && ae.metricsCompressionThreshold > 0
+	metricsExporter, err := openMetricsStream(ae.newGRPCContext(teeSignalMetrics), metricsSvcClient, node, ae.resource, ae.exportCallOptions(!twinStreams))
+	if err != nil {
+		return err
+	}
+	var compressedMetricsExporter agentmetricspb.MetricsService_ExportClient
+	if twinStreams {
+		// Batches at or above the threshold go out on a compressed twin stream.
+		compressedMetricsExporter, err = openMetricsStream(ae.newGRPCContext(teeSignalMetrics), metricsSvcClient, node, ae.resource, ae.exportCallOptions(true))
+		if err != nil {
+			return err
+		}
 	}
 
 	ae.mu.Lock()
 	ae.metricsExporter = metricsExporter
+	ae.compressedMetricsExporter = compressedMetricsExporter
+	ae.streamGenerations.metrics++
 	ae.mu.Unlock()
 
 	// With that we are good to go and can start sending metrics
 	return nil
 }
 
+func openMetricsStream(ctx context.Context, metricsSvcClient agentmetricspb.MetricsServiceClient, node *commonpb.Node, res *resourcepb.Resource, opts []grpc.CallOption) (agentmetricspb.MetricsService_ExportClient, error) {
+	metricsExporter, err := metricsSvcClient.Export(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("MetricsExporter: failed to start the service client: %v", err)
+	}
+	// Initiate the metrics service by sending over the first message just containing the Node and Resource.
+	firstMetricsMessage := &agentmetricspb.ExportMetricsServiceRequest{
+		Node:     node,
+		Resource: res,
+	}
+	if err := metricsExporter.Send(firstMetricsMessage); err != nil {
+		return nil, fmt.Errorf("MetricsExporter:: failed to send the first message: %v", err)
+	}
+	return metricsExporter, nil
+}
+
 func (ae *Exporter) dialToAgent() (*grpc.ClientConn, error) {
 	addr := ae.prepareAgentAddress()
+	ae.mu.RLock()
+	transportCredentials := ae.clientTransportCredentials
+	ae.mu.RUnlock()
 	var dialOpts []grpc.DialOption
-	if ae.clientTransportCredentials != nil {
-		dialOpts = append(dialOpts, grpc.WithTransportCredentials(ae.clientTransportCredentials))
+	if transportCredentials != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(transportCredentials))
 	} else if ae.canDialInsecure {
 		dialOpts = append(dialOpts, grpc.WithInsecure())
+	} else {
+		// Neither credentials nor WithInsecure were set: rather than failing
+		// to dial at all, default to TLS verified against the system's roots.
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
 	}
-	if ae.compressor != "" {
-		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(ae.compressor)))
+	if ae.codec != nil {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.ForceCodec(passthroughCodec{ae.codec})))
+	}
+	if ae.perRPCCredentials != nil {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(ae.perRPCCredentials))
+	}
+	if !ae.noSelfInstrumentation {
+		// The spans of the exporter's own RPCs are never sampled, or
+		// exporting them would cause more RPCs, and so on.
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(&ocgrpc.ClientHandler{
+			StartOptions: trace.StartOptions{Sampler: trace.NeverSample()},
+		}))
+	}
+	if ae.transportParams != nil {
+		dialOpts = append(dialOpts, ae.transportParams.dialOptions()...)
 	}
-	dialOpts = append(dialOpts, grpc.WithStatsHandler(&ocgrpc.ClientHandler{}))
 	if len(ae.grpcDialOptions) != 0 {
 		dialOpts = append(dialOpts, ae.grpcDialOptions...)
 	}
 
-	ctx := ae.newGRPCContext()
-	return grpc.DialContext(ctx, addr, dialOpts...)
+	return grpc.DialContext(context.Background(), addr, dialOpts...)
+}
+
+// applyTraceConfig installs the sampler of cfg as the default sampler. It
+// reports false if cfg has no sampler that the exporter supports.
+func (ae *Exporter) applyTraceConfig(cfg *tracepb.TraceConfig) bool {
+	if psamp := cfg.GetProbabilitySampler(); psamp != nil {
+		trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(psamp.SamplingProbability)})
+		ae.setEffectiveSampler(SamplerProbability, psamp.SamplingProbability)
+	} else if csamp := cfg.GetConstantSampler(); csamp != nil {
+		alwaysSample := csamp.Decision == tracepb.ConstantSampler_ALWAYS_ON
+		if alwaysSample {
+			trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+			ae.setEffectiveSampler(SamplerAlwaysOn, 1)
+		} else {
+			trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
+			ae.setEffectiveSampler(SamplerAlwaysOff, 0)
+		}
+	} else { // TODO: Add the rate limiting sampler here
+		return false
+	}
+	return true
 }
 
 func (ae *Exporter) handleConfigStreaming(configStream agenttracepb.TraceService_ConfigClient) error {
@@ -316,20 +745,11 @@ func (ae *Exporter) handleConfigStreaming(configStream agenttracepb.TraceService
 		}
 
 		// Otherwise now apply the trace configuration sent down from the agent
-		if psamp := cfg.GetProbabilitySampler(); psamp != nil {
-			trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(psamp.SamplingProbability)})
-		} else if csamp := cfg.GetConstantSampler(); csamp != nil {
-			alwaysSample := csamp.Decision == tracepb.ConstantSampler_ALWAYS_ON
-			if alwaysSample {
-				trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
-			} else {
-				trace.ApplyConfig(trace.Config{DefaultSampler: trace.NeverSample()})
-			}
-		} else { // TODO: Add the rate limiting sampler here
-		}
+		ae.applyTraceConfig(cfg)
+		ae.remoteConfigApplied()
 
 		// Then finally send back to upstream the newly applied configuration
-		err = configStream.Send(&agenttracepb.CurrentLibraryConfig{Config: &tracepb.TraceConfig{Sampler: cfg.Sampler}})
+		err = ae.replyConfig(configStream, &tracepb.TraceConfig{Sampler: cfg.Sampler})
 		if err != nil {
 			return err
 		}
@@ -337,29 +757,59 @@ func (ae *Exporter) handleConfigStreaming(configStream agenttracepb.TraceService
 }
 
 // Stop shuts down all the connections and resources
-// related to the exporter.
+// related to the exporter. From the moment Stop is invoked, the spans
+// and view data passed to ExportSpan and ExportView are dropped and
+// counted as such, while the data already buffered is flushed and sent.
+// The connection is closed once the batches being sent are, or after five
+// seconds at most. The calls made while the exporter is being stopped,
+// e.g. by a Close that gave up waiting, wait for it to be stopped.
 func (ae *Exporter) Stop() error {
-	ae.mu.RLock()
+	ae.mu.Lock()
 	cc := ae.grpcClientConn
 	started := ae.started
-	stopped := ae.stopped
-	ae.mu.RUnlock()
+	stopping := ae.stopping
+	stopDoneCh := ae.stopDoneCh
+	if started {
+		ae.stopping = true
+	}
+	ae.mu.Unlock()
 
 	if !started {
 		return errNotStarted
 	}
-	if stopped {
-		// TODO: tell the user that we've already stopped, so perhaps a sentinel error?
+	if stopping {
+		<-stopDoneCh
 		return nil
 	}
 
+	// Drain: new data is dropped from now on, while
+	// the data already buffered is flushed and sent.
+	atomic.StoreInt32(&ae.draining, 1)
+	ae.unregisterExitFlush()
 	ae.Flush()
+	ae.waitForUploads()
+	ae.drainStreams()
+	if ae.metricsPull != nil {
+		ae.metricsPull.stop()
+	}
+	ae.disarmFallbackSampler()
+	ae.clearFinalizer()
 
 	// Now close the underlying gRPC connection.
 	var err error
 	if cc != nil {
 		err = cc.Close()
 	}
+	if ae.teeFile != nil {
+		if terr := ae.teeFile.close(); err == nil {
+			err = terr
+		}
+	}
+	if ae.spool != nil {
+		if serr := ae.spool.close(); err == nil {
+			err = serr
+		}
+	}
 
 	// At this point we can change the state variables: started and stopped
 	ae.mu.Lock()
@@ -369,62 +819,265 @@ func (ae *Exporter) Stop() error {
 	close(ae.stopCh)
 
 	// Ensure that the backgroundConnector returns
+	ae.endUndialed()
 	<-ae.backgroundConnectionDoneCh
+	close(stopDoneCh)
 
 	return err
 }
 
 // ExportSpan exports a single span to the configured destination.
 // This is usually used by the client libraries to export to the local
-// OC agent
+// OC agent. The span is dropped if it can't be buffered, see TryExportSpan.
 func (ae *Exporter) ExportSpan(sd *trace.SpanData) {
+	_ = ae.TryExportSpan(sd)
+}
+
+// TryExportSpan is like ExportSpan, but it reports why the span was dropped
+// rather than being buffered: ErrStopping once Stop was invoked, ErrShed if
+// it was dropped under pressure, or the error of the trace bundler, e.g.
+// bundler.ErrOverflow when the span buffer is full.
+// The span was handed to the exporter of WithSpillExporter, if any.
+func (ae *Exporter) TryExportSpan(sd *trace.SpanData) error {
 	if sd == nil {
-		return
+		return nil
+	}
+	ae.mu.RLock()
+	spanFilter := ae.spanFilter
+	traceBundler := ae.traceBundler
+	ae.mu.RUnlock()
+	span, size, err := ae.prepareSpan(sd, spanFilter, traceBundler)
+	if span == nil {
+		return err
+	}
+	return ae.bundleSpans(traceBundler, []*tracepb.Span{span}, []*trace.SpanData{sd}, size)
+}
+
+// AddSpans exports a batch of spans, as is convenient for adapters that receive
+// spans in batches, e.g. from a message queue. The spans go through the same
+// filtering and conversion as with ExportSpan, nil spans being skipped, but
+// are added to the trace bundler as a single item, so they are sent in the
+// same request, and buffered or dropped as a whole if the span buffer is full.
+// The trace bundler sets no BundleByteLimit, so no batch fails with
+// bundler.ErrOversizedItem, but one larger than the BufferedByteLimit of
+// BundlerOptions never fits in the span buffer: it fails with
+// bundler.ErrOverflow and is dropped, or spilled, as a whole.
+// With WithTraceCompleteBatching, they are buffered by trace as with ExportSpan.
+func (ae *Exporter) AddSpans(sdl []*trace.SpanData) {
+	ae.mu.RLock()
+	spanFilter := ae.spanFilter
+	traceBundler := ae.traceBundler
+	ae.mu.RUnlock()
+
+	var spans []*tracepb.Span
+	var kept []*trace.SpanData
+	var size int
+	for _, sd := range sdl {
+		if sd == nil {
+			continue
+		}
+		if span, spanSize, _ := ae.prepareSpan(sd, spanFilter, traceBundler); span != nil {
+			spans = append(spans, span)
+			kept = append(kept, sd)
+			size += spanSize
+		}
+	}
+	if len(spans) > 0 {
+		_ = ae.bundleSpans(traceBundler, spans, kept, size)
+	}
+}
+
+// prepareSpan takes sd through the steps that precede the trace bundler:
+// filtering, the draining check, rollup and convertSpan. It returns the
+// converted span to add to traceBundler and its size, or a nil span if sd
+// was consumed or dropped, along with the reason why it was dropped.
+func (ae *Exporter) prepareSpan(sd *trace.SpanData, spanFilter func(*trace.SpanData) bool, traceBundler *bundler.Bundler) (*tracepb.Span, int, error) {
+	if spanFilter != nil && !spanFilter(sd) {
+		return nil, 0, nil
+	}
+	if ae.isDraining() {
+		ae.spill(sd, dropReasonStopping)
+		return nil, 0, ErrStopping
+	}
+	if ae.spanRollup != nil && ae.spanRollup.add(sd) {
+		return nil, 0, nil
+	}
+	return ae.convertSpan(sd, traceBundler)
+}
+
+// convertSpan converts sd and returns the span to add to traceBundler and its
+// size, unless the span is validated by WithDryRun, buffered by the trace
+// assembler of WithTraceCompleteBatching or shed under pressure.
+func (ae *Exporter) convertSpan(sd *trace.SpanData, traceBundler *bundler.Bundler) (*tracepb.Span, int, error) {
+	// Spans are converted right away, rather than when their bundle is
+	// uploaded, so that the bundler accounts for their actual size.
+	span := ae.spanToProtoSpan(sd)
+	if ae.dryRun != nil {
+		ae.validateSpan(span)
+		return nil, 0, nil
+	}
+	if ae.traceAssembler != nil {
+		ae.dialLazily()
+		atomic.AddInt64(&ae.pendingSpans, 1)
+		spans, ok := ae.traceAssembler.add(sd, span)
+		if !ok {
+			atomic.AddInt64(&ae.pendingSpans, -1)
+			ae.spill(sd, dropReasonBufferFull)
+			return nil, 0, bundler.ErrOverflow
+		}
+		if spans != nil {
+			ae.uploadCompleteTrace(spans)
+		}
+		return nil, 0, nil
 	}
-	_ = ae.traceBundler.Add(sd, 1)
+	size := proto.Size(span)
+	if ae.shedSpan(sd, size, traceBundler.BufferedByteLimit) {
+		ae.spill(sd, dropReasonShed)
+		return nil, 0, ErrShed
+	}
+	return span, size, nil
+}
+
+// bufferSpan converts sd and adds it to traceBundler, or
+// to the trace assembler of WithTraceCompleteBatching.
+func (ae *Exporter) bufferSpan(sd *trace.SpanData, traceBundler *bundler.Bundler) error {
+	span, size, err := ae.convertSpan(sd, traceBundler)
+	if span == nil {
+		return err
+	}
+	return ae.bundleSpans(traceBundler, []*tracepb.Span{span}, []*trace.SpanData{sd}, size)
+}
+
+// bundleSpans adds spans, converted from sds and of size bytes in all, to
+// traceBundler as a single item, so that they are sent in the same request.
+func (ae *Exporter) bundleSpans(traceBundler *bundler.Bundler, spans []*tracepb.Span, sds []*trace.SpanData, size int) error {
+	bs := &bundledSpan{size: size}
+	if len(spans) == 1 {
+		bs.span = spans[0]
+	} else {
+		bs.batch = spans
+	}
+	if ae.spillExporter != nil {
+		if len(sds) == 1 {
+			bs.sd = sds[0]
+		} else {
+			bs.batchData = sds
+		}
+	}
+	ae.dialLazily()
+	if err := traceBundler.Add(bs, size); err != nil {
+		for _, sd := range sds {
+			ae.spill(sd, bundlerDropReason(err))
+		}
+		return err
+	}
+	atomic.AddInt64(&ae.bufferedSpanBytes, int64(size))
+	atomic.AddInt64(&ae.pendingSpans, int64(len(sds)))
+	return nil
 }
 
 // ExportTraceServiceRequest exports a span batch using streaming or unary gRPC depending on
 // whether `WithUnaryTraceExporter()` was used or not.
 func (ae *Exporter) ExportTraceServiceRequest(batch *agenttracepb.ExportTraceServiceRequest) error {
+	return ae.ExportTraceServiceRequestContext(context.Background(), batch)
+}
+
+// ExportTraceServiceRequestContext is like ExportTraceServiceRequest but lets the caller
+// bound the export with ctx. With WithUnaryBatchExporter, ctx is the context of the RPC, so
+// its deadline, cancellation and outgoing metadata all apply. Otherwise, the batch is sent
+// on the long-lived trace stream and ExportTraceServiceRequestContext returns ctx.Err() as
+// soon as ctx is done, even though the send itself can't be interrupted.
+func (ae *Exporter) ExportTraceServiceRequestContext(ctx context.Context, batch *agenttracepb.ExportTraceServiceRequest) error {
+	if batch == nil || len(batch.Spans) == 0 {
+		return nil
+	}
+	if ae.dryRun != nil {
+		for _, span := range batch.Spans {
+			ae.validateSpan(span)
+		}
+		return nil
+	}
+	if _, err := ae.headersFor(ctx, teeSignalTraces); err != nil {
+		return err
+	}
+	if err := ae.waitLazyDial(ctx); err != nil {
+		return err
+	}
+	ae.uploads.begin()
+	defer ae.uploads.end()
+	ae.mirrorBatch(outgoingBatch{traces: batch})
+	_, hasTenant := tenantFromContext(ctx)
+	if (ae.useUnaryBatchExporter || hasTenant) && batch.Node == nil {
+		batch.Node = ae.nodeInfo
+	}
+	// Marshal the batch once, its halves reuse the encoding of its spans if it has to be split.
+	mtr, err := ae.marshalTraceRequest(batch)
+	if err != nil {
+		return err
+	}
+	return ae.exportTraceRequestWithRetry(ctx, mtr)
+}
+
+func (ae *Exporter) exportTraceRequest(ctx context.Context, batch *marshaledTraceRequest) error {
+	if err := ae.waitThrottle(ctx); err != nil {
+		return err
+	}
+	start := time.Now()
+	// The trace streams are opened with the shared headers, the batches
+	// of a tenant are sent with unary calls carrying the tenant's.
+	_, hasTenant := tenantFromContext(ctx)
+	unary := ae.useUnaryBatchExporter || hasTenant
 	var err error
-	if ae.useUnaryBatchExporter {
-		err = ae.exportTraceServiceRequestUnary(batch)
+	if unary {
+		err = ae.exportTraceServiceRequestUnary(ctx, batch)
 	} else {
-		err = ae.exportTraceServiceRequestStream(batch)
+		err = ae.exportTraceServiceRequestStream(ctx, batch)
 	}
 
 	if err == nil {
+		ae.traceExported(batch, start)
 		return nil
 	}
+	if ctx.Err() != nil {
+		// The caller gave up on the export, which says nothing about the connection.
+		return err
+	}
+	if _, ok := retryDelay(err); ok {
+		// The agent is overloaded and asked for a pause, splitting the batch
+		// would only make it worse. Only a stream has to be reopened.
+		if unary {
+			ae.throttleOn(err)
+		} else {
+			ae.setStateDisconnected(err)
+		}
+		return err
+	}
+	if hasTenant {
+		// Neither does a failure that might be due to the tenant's headers.
+		return err
+	}
 
 	if status.Code(err) == codes.ResourceExhausted {
 		// Assumes that the default msg size (4MiB) was not reduced on the receiving side.
-		if batch.XXX_Size() > fourMegabytes && len(batch.Spans) > 2 {
+		if len(batch.data) > fourMegabytes && len(batch.spans) > 2 {
 			// Slice and try again
-			b := &agenttracepb.ExportTraceServiceRequest{
-				Node:     batch.Node,
-				Resource: batch.Resource,
-			}
 			// Known-issue: it is possible to get partial success and failure for the second half.
 			// In this case the caller will receive failure for the full batch and may retry it later
 			// causing same spans that succeeded on first half to be submit again. The alternative is for
 			// the caller to check the size and do its own slicing but that doesn't take into account the
 			// compressed size so it can be performing eager slicing.
-			allSpans := batch.Spans[:]
+			allSpans := batch.spans[:]
 			mid := len(allSpans) / 2
-			b.Spans = allSpans[:mid]
 			if err = ae.connect(); err != nil {
 				ae.setStateDisconnected(err)
 				return err
 			}
-			err = ae.ExportTraceServiceRequest(b)
+			err = ae.exportTraceRequest(ctx, batch.withSpans(allSpans[:mid]))
 			if err != nil {
 				ae.setStateDisconnected(err)
 				return err
 			}
-			b.Spans = allSpans[mid:]
-			err = ae.ExportTraceServiceRequest(b)
+			err = ae.exportTraceRequest(ctx, batch.withSpans(allSpans[mid:]))
 			if err != nil {
 				ae.setStateDisconnected(err)
 				return err
@@ -438,11 +1091,12 @@ func (ae *Exporter) ExportTraceServiceRequest(batch *agenttracepb.ExportTraceSer
 	return err
 }
 
-func (ae *Exporter) exportTraceServiceRequestUnary(req *agenttracepb.ExportTraceServiceRequest) error {
-	if req == nil || len(req.Spans) == 0 {
-		return nil
-	}
+// exportOneMethod is the full name of the unary trace export RPC. It is
+// invoked directly, rather than with TraceServiceClient.ExportOne, so that
+// the pre-computed encoding of the batch can be handed over to gRPC.
+const exportOneMethod = "/opencensus.proto.agent.trace.v1.TraceService/ExportOne"
 
+func (ae *Exporter) exportTraceServiceRequestUnary(ctx context.Context, req *marshaledTraceRequest) error {
 	select {
 	case <-ae.stopCh:
 		return errStopped
@@ -451,25 +1105,31 @@ func (ae *Exporter) exportTraceServiceRequestUnary(req *agenttracepb.ExportTrace
 		if lastConnectErr := ae.lastConnectError(); lastConnectErr != nil {
 			return fmt.Errorf("ExportTraceServiceRequest: no active connection, last connection error: %v", lastConnectErr)
 		}
-		if req.Node == nil {
-			req.Node = ae.nodeInfo
+		headers, err := ae.headersFor(ctx, teeSignalTraces)
+		if err != nil {
+			return err
 		}
-		ctx := ae.newGRPCContext()
+		ctx := withBatchIDHeader(withOutgoingHeaders(ctx, headers), req.req)
 		if ae.unaryExportTimeout > 0 {
 			var cancel func()
 			ctx, cancel = context.WithDeadline(ctx, time.Now().Add(ae.unaryExportTimeout))
 			defer cancel()
 		}
-		_, err := ae.traceSvcClient.ExportOne(ctx, req)
+		ae.teeRequest(teeSignalTraces, req.marshaledRequest)
+		compress := ae.traceCompressionThreshold <= 0 || len(req.data) >= ae.traceCompressionThreshold
+		ae.mu.RLock()
+		cc := ae.grpcClientConn
+		ae.mu.RUnlock()
+		err = cc.Invoke(ctx, exportOneMethod, req.marshaledRequest, new(agenttracepb.ExportTraceServiceResponse), ae.exportCallOptions(compress)...)
+		if compress && ae.compressionRejected(err) {
+			// The compressor is disabled now, the batch is sent again without it.
+			err = cc.Invoke(ctx, exportOneMethod, req.marshaledRequest, new(agenttracepb.ExportTraceServiceResponse))
+		}
 		return err
 	}
 }
 
-func (ae *Exporter) exportTraceServiceRequestStream(batch *agenttracepb.ExportTraceServiceRequest) error {
-	if batch == nil || len(batch.Spans) == 0 {
-		return nil
-	}
-
+func (ae *Exporter) exportTraceServiceRequestStream(ctx context.Context, batch *marshaledTraceRequest) error {
 	select {
 	case <-ae.stopCh:
 		return errStopped
@@ -479,25 +1139,29 @@ func (ae *Exporter) exportTraceServiceRequestStream(batch *agenttracepb.ExportTr
 			return lastConnectErr
 		}
 
-		ae.senderMu.Lock()
-		err := ae.traceExporter.Send(batch)
-		ae.senderMu.Unlock()
-		if err != nil {
-			if err == io.EOF {
-				ae.recvMu.Lock()
-				// Perform a .Recv to try to find out why the RPC actually ended.
-				// See:
-				//   * https://github.com/grpc/grpc-go/blob/d389f9fac68eea0dcc49957d0b4cca5b3a0a7171/stream.go#L98-L100
-				//   * https://groups.google.com/forum/#!msg/grpc-io/XcN4hA9HonI/F_UDiejTAwAJ
-				for {
-					_, err = ae.traceExporter.Recv()
-					if err != nil {
-						break
-					}
-				}
-				ae.recvMu.Unlock()
-			}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
+		ae.teeRequest(teeSignalTraces, batch.marshaledRequest)
+		var err error
+		if ctx.Done() == nil {
+			err = ae.sendOnCurrentTraceStreams(batch)
+		} else {
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- ae.sendOnCurrentTraceStreams(batch)
+			}()
+			select {
+			case err = <-errCh:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err == ErrTemporarilyDisconnected {
+			return err
+		}
+		if err != nil {
 			ae.setStateDisconnected(err)
 			if err != io.EOF {
 				return err
@@ -507,11 +1171,37 @@ func (ae *Exporter) exportTraceServiceRequestStream(batch *agenttracepb.ExportTr
 	}
 }
 
+// ExportView exports the view data to the agent. The view data
+// is dropped if it can't be buffered, see TryExportView.
 func (ae *Exporter) ExportView(vd *view.Data) {
+	_ = ae.TryExportView(vd)
+}
+
+// TryExportView is like ExportView, but it reports why the view data was
+// dropped rather than being buffered: ErrStopping once Stop was invoked, or
+// the error of the view data bundler, e.g. bundler.ErrOverflow when its
+// buffer is full. Such errors are also logged with the logger of WithLogger.
+func (ae *Exporter) TryExportView(vd *view.Data) error {
 	if vd == nil {
-		return
+		return nil
 	}
-	_ = ae.viewDataBundler.Add(vd, 1)
+	if ae.dryRun != nil {
+		ae.validateViewData(vd)
+		return nil
+	}
+	if ae.isDraining() {
+		ae.dropViewData(vd, dropReasonStopping)
+		return ErrStopping
+	}
+	ae.dialLazily()
+	ae.mu.RLock()
+	viewDataBundler := ae.viewDataBundler
+	ae.mu.RUnlock()
+	if err := viewDataBundler.Add(vd, 1); err != nil {
+		ae.dropViewData(vd, bundlerDropReason(err))
+		return err
+	}
+	return nil
 }
 
 // ExportMetricsServiceRequest sends proto metrics with the metrics service client.
@@ -519,7 +1209,31 @@ func (ae *Exporter) ExportMetricsServiceRequest(batch *agentmetricspb.ExportMetr
 	if batch == nil || len(batch.Metrics) == 0 {
 		return nil
 	}
+	if ae.dryRun != nil {
+		for _, metric := range batch.Metrics {
+			ae.validateMetric(metric)
+		}
+		return nil
+	}
+	if ae.metricsPull != nil {
+		ae.metricsPull.add(batch.Metrics)
+		return nil
+	}
+	_ = ae.waitLazyDial(context.Background())
+	ae.uploads.begin()
+	defer ae.uploads.end()
+	ae.mirrorBatch(outgoingBatch{metrics: batch})
+	mr, err := ae.marshal(batch)
+	if err != nil {
+		return err
+	}
+	if err := ae.waitThrottle(context.Background()); err != nil {
+		return err
+	}
+	return ae.exportMetricsRequest(mr)
+}
 
+func (ae *Exporter) exportMetricsRequest(batch *marshaledRequest) error {
 	select {
 	case <-ae.stopCh:
 		return errStopped
@@ -529,10 +1243,21 @@ func (ae *Exporter) ExportMetricsServiceRequest(batch *agentmetricspb.ExportMetr
 			return fmt.Errorf("ExportMetricsServiceRequest: no active connection, last connection error: %v", lastConnectErr)
 		}
 
+		metricsExporter, gen := ae.metricsExporterFor(batch)
+		if metricsExporter == nil {
+			// Not connected yet, e.g. before the first export with WithLazyConnection.
+			return ErrTemporarilyDisconnected
+		}
+		ae.teeRequest(teeSignalMetrics, batch)
+		start := time.Now()
 		ae.senderMu.Lock()
-		err := ae.metricsExporter.Send(batch)
+		err := metricsExporter.SendMsg(batch)
 		ae.senderMu.Unlock()
-		if err != nil {
+		if err == nil {
+			ae.metricsExported(batch, start)
+		} else if ae.metricsStreamReplaced(gen) {
+			return ErrTemporarilyDisconnected
+		} else {
 			if err == io.EOF {
 				ae.recvMu.Lock()
 				// Perform a .Recv to try to find out why the RPC actually ended.
@@ -540,7 +1265,7 @@ func (ae *Exporter) ExportMetricsServiceRequest(batch *agentmetricspb.ExportMetr
 				//   * https://github.com/grpc/grpc-go/blob/d389f9fac68eea0dcc49957d0b4cca5b3a0a7171/stream.go#L98-L100
 				//   * https://groups.google.com/forum/#!msg/grpc-io/XcN4hA9HonI/F_UDiejTAwAJ
 				for {
-					_, err = ae.metricsExporter.Recv()
+					_, err = metricsExporter.Recv()
 					if err != nil {
 						break
 					}
@@ -557,51 +1282,118 @@ func (ae *Exporter) ExportMetricsServiceRequest(batch *agentmetricspb.ExportMetr
 	}
 }
 
-func ocSpanDataToPbSpans(sdl []*trace.SpanData) []*tracepb.Span {
-	if len(sdl) == 0 {
-		return nil
+func (ae *Exporter) currentTraceStreams() []*traceStream {
+	ae.mu.RLock()
+	streams := ae.traceStreams
+	ae.mu.RUnlock()
+	return streams
+}
+
+// newGRPCContext returns a context that carries the headers of signal.
+func (ae *Exporter) newGRPCContext(signal string) context.Context {
+	return withOutgoingHeaders(context.Background(), ae.signalHeaders(signal))
+}
+
+// signalHeaders returns the headers to send the batches of signal with: the
+// ones of WithHeaders, overridden by the ones of WithTraceHeaders or
+// WithMetricsHeaders for signal.
+func (ae *Exporter) signalHeaders(signal string) map[string]string {
+	ae.mu.RLock()
+	headers := ae.headers
+	signalHeaders := ae.traceHeaders
+	if signal == teeSignalMetrics {
+		signalHeaders = ae.metricsHeaders
 	}
-	protoSpans := make([]*tracepb.Span, 0, len(sdl))
-	for _, sd := range sdl {
-		if sd != nil {
-			protoSpans = append(protoSpans, ocSpanToProtoSpan(sd))
-		}
+	ae.mu.RUnlock()
+	if len(signalHeaders) == 0 {
+		return headers
+	}
+	merged := make(map[string]string, len(headers)+len(signalHeaders))
+	for k, v := range headers {
+		merged[k] = v
 	}
-	return protoSpans
+	for k, v := range signalHeaders {
+		merged[k] = v
+	}
+	return merged
 }
 
-func (ae *Exporter) newGRPCContext() context.Context {
-	ctx := context.Background()
-	if len(ae.headers) > 0 {
-		ctx = metadata.NewOutgoingContext(ctx, metadata.New(ae.headers))
+func withOutgoingHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) > 0 {
+		md := metadata.New(headers)
+		if callerMD, ok := metadata.FromOutgoingContext(ctx); ok {
+			md = metadata.Join(md, callerMD)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
 	}
 	return ctx
 }
 
-func (ae *Exporter) uploadTraces(sdl []*trace.SpanData) {
+// uploadTraces hands protoSpans, which are accounted in pendingSpans,
+// over to the sender goroutine.
+func (ae *Exporter) uploadTraces(protoSpans []*tracepb.Span) {
+	_ = ae.waitLazyDial(context.Background())
 	select {
 	case <-ae.stopCh:
+		atomic.AddInt64(&ae.pendingSpans, -int64(len(protoSpans)))
 		return
 
 	default:
-		if !ae.connected() {
+		batch := outgoingBatch{
+			traces: &agenttracepb.ExportTraceServiceRequest{
+				Spans:    protoSpans,
+				Resource: resourceProtoFromEnv(),
+			},
+		}
+		// With a spool, batches produced while disconnected are kept for later.
+		if !ae.connected() && ae.spool == nil {
+			atomic.AddInt64(&ae.counters.droppedSpans, int64(len(protoSpans)))
+			ae.recordEvent(EventDropped, "spans: "+dropReasonDisconnected, int64(len(protoSpans)))
+			if len(protoSpans) != 0 {
+				// The mirror doesn't depend on the agent.
+				ae.mirrorBatch(batch)
+			}
+			atomic.AddInt64(&ae.pendingSpans, -int64(len(protoSpans)))
 			return
 		}
 
-		protoSpans := ocSpanDataToPbSpans(sdl)
 		if len(protoSpans) == 0 {
 			return
 		}
-		ae.senderMu.Lock()
-		err := ae.traceExporter.Send(&agenttracepb.ExportTraceServiceRequest{
-			Spans:    protoSpans,
-			Resource: resourceProtoFromEnv(),
-		})
-		ae.senderMu.Unlock()
-		if err != nil {
+		if !ae.enqueue(batch) {
+			atomic.AddInt64(&ae.pendingSpans, -int64(len(protoSpans)))
+		}
+	}
+}
+
+func (ae *Exporter) sendTraces(batch *agenttracepb.ExportTraceServiceRequest) {
+	// The batch may have waited, e.g. for the agent to lift a pause.
+	if ae.evictStaleSpans(batch, time.Now()) && len(batch.Spans) == 0 {
+		return
+	}
+	// The tee file, the trace streams and the spool all reuse this encoding.
+	mtr, err := ae.marshalTraceRequest(batch)
+	if err != nil {
+		ae.dropUnmarshalable(batch, err)
+		return
+	}
+	recordBatchSize(mtr)
+	if !ae.connected() {
+		ae.observeBatchFailure()
+		ae.spoolRequest(teeSignalTraces, mtr.marshaledRequest)
+		return
+	}
+	ae.teeRequest(teeSignalTraces, mtr.marshaledRequest)
+	start := time.Now()
+	if err := ae.sendOnCurrentTraceStreams(mtr); err != nil {
+		ae.observeBatchFailure()
+		if err != ErrTemporarilyDisconnected {
 			ae.setStateDisconnected(err)
 		}
+		ae.spoolRequest(teeSignalTraces, mtr.marshaledRequest)
+		return
 	}
+	ae.traceExported(mtr, start)
 }
 
 func ocViewDataToPbMetrics(vdl []*view.Data) []*metricspb.Metric {
@@ -622,10 +1414,27 @@ func ocViewDataToPbMetrics(vdl []*view.Data) []*metricspb.Metric {
 }
 
 func (ae *Exporter) uploadViewData(vdl []*view.Data) {
-	protoMetrics := ocViewDataToPbMetrics(vdl)
+	_ = ae.waitLazyDial(context.Background())
+	ae.uploadMetrics(ocViewDataToPbMetrics(vdl))
+}
+
+// uploadMetrics processes protoMetrics as configured and enqueues them
+// for the sender.
+func (ae *Exporter) uploadMetrics(protoMetrics []*metricspb.Metric) {
 	if len(protoMetrics) == 0 {
 		return
 	}
+	protoMetrics = dedupeMetrics(protoMetrics)
+	ae.mapUnits(protoMetrics)
+	ae.dropLabelKeys(protoMetrics)
+	ae.limitCardinality(protoMetrics)
+	if ae.metricsPull != nil {
+		// The agent pulls the latest cumulative points.
+		ae.metricsPull.add(ae.appendHeartbeat(protoMetrics))
+		return
+	}
+	ae.convertToDelta(protoMetrics)
+	protoMetrics = ae.appendHeartbeat(protoMetrics)
 	req := &agentmetricspb.ExportMetricsServiceRequest{
 		Metrics:  protoMetrics,
 		Resource: resourceProtoFromEnv(),
@@ -633,12 +1442,30 @@ func (ae *Exporter) uploadViewData(vdl []*view.Data) {
 		// a) Figure out how to derive a Node from the environment
 		// or better letting users of the exporter configure it.
 	}
-	ae.ExportMetricsServiceRequest(req)
+	ae.enqueue(outgoingBatch{metrics: req})
 }
 
+// Flush waits for all the spans and view data buffered so far
+// to be converted and sent to the agent.
 func (ae *Exporter) Flush() {
-	ae.traceBundler.Flush()
-	ae.viewDataBundler.Flush()
+	ae.flushSpanRollups()
+	ae.flushPendingTraces()
+	ae.mu.RLock()
+	traceBundler, viewDataBundler := ae.traceBundler, ae.viewDataBundler
+	ae.mu.RUnlock()
+	traceBundler.Flush()
+	viewDataBundler.Flush()
+	ae.flushAlignedMetrics()
+	ae.waitForSender()
+	ae.waitForMirror()
+}
+
+// PendingSpans returns the number of spans passed to ExportSpan that are
+// still buffered, or being sent to the agent. Spans are buffered for up to
+// the delay threshold of the trace bundler, so a batch job that waits for
+// the count to drop to zero before exiting can invoke Flush to hurry them.
+func (ae *Exporter) PendingSpans() int64 {
+	return atomic.LoadInt64(&ae.pendingSpans)
 }
 
 func resourceProtoFromEnv() *resourcepb.Resource {
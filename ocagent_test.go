@@ -16,10 +16,18 @@ package ocagent_test
 
 import (
 	"context"
+	"expvar"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,7 +36,11 @@ import (
 	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
 	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
 	opencensus "go.opencensus.io"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
 )
 
 func TestNewExporter_end_to_end(t *testing.T) {
@@ -442,6 +454,13 @@ func TestNewExporter_agentConnectionDiesThenReconnects(t *testing.T) {
 			t.Errorf("Round #%d: Connected agent: spans: got %d want %d", j, g, w)
 		}
 
+		// The node tells the agent how many times the exporter reconnected.
+		if nodes := nma.getTraceNodes(); len(nodes) == 0 {
+			t.Errorf("Round #%d: Connected agent: no node was received", j)
+		} else if g, w := nodes[0].Attributes[ocagent.ReconnectsAttributeKey], strconv.Itoa(j+1); g != w {
+			t.Errorf("Round #%d: Connected agent: reconnects attribute: got %q want %q", j, g, w)
+		}
+
 		dSpans := ma.getSpans()
 		// Expecting 0 spans to have been received by the original but now dead agent
 		if g, w := len(dSpans), 0; g != w {
@@ -495,26 +514,1155 @@ func TestNewExporter_withAddress(t *testing.T) {
 	}
 }
 
-// Best case comparison for information that we can externally introspect
-func sameProcessIdentifier(n1, n2 *commonpb.ProcessIdentifier) bool {
-	if n1 == nil || n2 == nil {
-		return n1 == n2
+func TestNewExporter_defaultsToTLS(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an address: %v", err)
+	}
+	defer ln.Close()
+
+	firstByte := make(chan byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(conn, b); err == nil {
+			firstByte <- b[0]
+		}
+	}()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithAddress(ln.Addr().String()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer exp.Stop()
+
+	select {
+	case b := <-firstByte:
+		// 0x16 is the record type of a TLS handshake.
+		if b != 0x16 {
+			t.Errorf("First byte sent = %#x, want a TLS handshake record", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the exporter to connect")
 	}
-	return n1.HostName == n2.HostName && n1.Pid == n2.Pid
 }
 
-func sameLibraryInfo(li1, li2 *commonpb.LibraryInfo) bool {
-	if li1 == nil || li2 == nil {
-		return li1 == li2
+func TestNewExporter_withTraceStreams(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	numStreams := 3
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithTraceStreams(numStreams))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	// Two spans per trace.
+	n := 20
+	for i := 0; i < n; i++ {
+		exp.ExportSpan(&trace.SpanData{
+			SpanContext: trace.SpanContext{TraceID: trace.TraceID{byte(i / 2), 1, 2, 3}},
+			Name:        "sharded",
+		})
+	}
+	exp.Flush()
+	<-time.After(50 * time.Millisecond)
+
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+	ma.stop()
+
+	if g, w := len(ma.getSpans()), n; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+	// Each stream is initiated with a message carrying the node identifier.
+	var nodes int
+	for _, node := range ma.getTraceNodes() {
+		if node != nil {
+			nodes++
+		}
+	}
+	if g, w := nodes, numStreams; g != w {
+		t.Errorf("Initiated streams: got %d want %d", g, w)
+	}
+
+	// All the spans of a trace go out on the same stream.
+	streamOf := make(map[string]int)
+	for stream, spans := range ma.getStreamSpans() {
+		for _, span := range spans {
+			traceID := string(span.TraceId)
+			if prev, ok := streamOf[traceID]; ok && prev != stream {
+				t.Errorf("Trace %x: spans on streams %d and %d", span.TraceId, prev, stream)
+			}
+			streamOf[traceID] = stream
+		}
+	}
+	if g, w := len(streamOf), n/2; g != w {
+		t.Errorf("Traces: got %d want %d", g, w)
+	}
+	usedStreams := make(map[int]bool)
+	for _, stream := range streamOf {
+		usedStreams[stream] = true
+	}
+	if len(usedStreams) < 2 {
+		t.Errorf("The traces weren't sharded: they all went out on stream %v", usedStreams)
 	}
-	return li1.Language == li2.Language &&
-		li1.ExporterVersion == li2.ExporterVersion &&
-		li1.CoreLibraryVersion == li2.CoreLibraryVersion
 }
 
-func sameServiceInfo(si1, si2 *commonpb.ServiceInfo) bool {
-	if si1 == nil || si2 == nil {
-		return si1 == si2
+func TestNewUnstartedExporter_flushDoesNotBlock(t *testing.T) {
+	exp, err := ocagent.NewUnstartedExporter(ocagent.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+
+	done := make(chan bool)
+	go func() {
+		exp.Flush()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Flush on an unstarted exporter blocked")
+	}
+}
+
+func TestNewExporter_withCompressionThreshold(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.UseCompressor(gzip.Name),
+		ocagent.WithTraceCompressionThreshold(1024))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	// The first batch stays below the threshold, the second one exceeds it.
+	small := []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: "small"}}}
+	large := make([]*tracepb.Span, 0, 100)
+	for i := 0; i < 100; i++ {
+		large = append(large, &tracepb.Span{Name: &tracepb.TruncatableString{Value: strings.Repeat("large", 10)}})
+	}
+	for _, spans := range [][]*tracepb.Span{small, large} {
+		if err := exp.ExportTraceServiceRequest(&agenttracepb.ExportTraceServiceRequest{Spans: spans}); err != nil {
+			t.Errorf("Failed to export %d spans: %v", len(spans), err)
+		}
+	}
+	<-time.After(50 * time.Millisecond)
+
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+	ma.stop()
+
+	if g, w := len(ma.getSpans()), len(small)+len(large); g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+	spansByEncoding := make(map[string]int)
+	encodings := ma.getStreamEncodings()
+	for i, spans := range ma.getStreamSpans() {
+		spansByEncoding[encodings[i]] += len(spans)
+	}
+	if g, w := spansByEncoding[""], len(small); g != w {
+		t.Errorf("Uncompressed spans: got %d want %d", g, w)
+	}
+	if g, w := spansByEncoding[gzip.Name], len(large); g != w {
+		t.Errorf("Gzip compressed spans: got %d want %d", g, w)
+	}
+}
+
+func TestNewExporter_spoolsWhileDisconnected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-spool")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Grab an address and release it so that the agent is initially unreachable.
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to grab an available port: %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	reconnectionPeriod := 20 * time.Millisecond
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(address),
+		ocagent.WithReconnectionPeriod(reconnectionPeriod),
+		ocagent.WithSpool(ocagent.SpoolParams{Path: filepath.Join(dir, "spool")}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		exp.ExportSpan(&trace.SpanData{Name: "spooled"})
+	}
+	exp.Flush()
+
+	ma := runMockAgentAtAddr(t, address)
+	defer ma.stop()
+
+	// Give the exporter some time to reconnect and replay the spool.
+	<-time.After(reconnectionPeriod * 10)
+	exp.Flush()
+
+	if g, w := len(ma.getSpans()), n; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+}
+
+func TestSetGzipCompressionLevel_invalid(t *testing.T) {
+	err := ocagent.SetGzipCompressionLevel(42)
+	if err == nil || !strings.Contains(err.Error(), "invalid gzip compression level") {
+		t.Errorf("Got error %v, want an invalid gzip compression level error", err)
+	}
+}
+
+func TestNewExporter_withTraceCompleteBatching(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithTraceCompleteBatching(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	traceID := trace.TraceID{1, 2, 3}
+	for i := 0; i < 3; i++ {
+		exp.ExportSpan(&trace.SpanData{
+			SpanContext:  trace.SpanContext{TraceID: traceID, SpanID: trace.SpanID{byte(i + 2)}},
+			ParentSpanID: trace.SpanID{1},
+			Name:         "child",
+		})
+	}
+	<-time.After(50 * time.Millisecond)
+	if g := len(ma.getSpans()); g != 0 {
+		t.Errorf("Spans sent before the root span ended: got %d want 0", g)
+	}
+
+	exp.ExportSpan(&trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: traceID, SpanID: trace.SpanID{1}},
+		Name:        "root",
+	})
+	<-time.After(50 * time.Millisecond)
+	if g, w := len(ma.getSpans()), 4; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+}
+
+func TestNewExporter_exportTraceServiceRequestContext(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	for _, unary := range []bool{false, true} {
+		opts := []ocagent.ExporterOption{
+			ocagent.WithInsecure(),
+			ocagent.WithAddress(ma.address),
+			ocagent.WithReconnectionPeriod(50 * time.Millisecond),
+		}
+		if unary {
+			opts = append(opts, ocagent.WithUnaryBatchExporter(ocagent.UnaryExporterParams{}))
+		}
+		exp, err := ocagent.NewExporter(opts...)
+		if err != nil {
+			t.Fatalf("Failed to create a new agent exporter: %v", err)
+		}
+
+		batch := &agenttracepb.ExportTraceServiceRequest{
+			Spans: []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: "withContext"}}},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := exp.ExportTraceServiceRequestContext(ctx, batch); err == nil {
+			t.Errorf("Unary=%t: expected an error with a canceled context", unary)
+		}
+		if err := exp.ExportTraceServiceRequestContext(context.Background(), batch); err != nil {
+			t.Errorf("Unary=%t: unexpected error: %v", unary, err)
+		}
+		exp.Stop()
+	}
+}
+
+func TestNewExporter_addSpans(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	sdl := []*trace.SpanData{{Name: "first"}, nil, {Name: "second"}, {Name: "third"}}
+	exp.AddSpans(sdl)
+	exp.Flush()
+	<-time.After(20 * time.Millisecond)
+
+	if g, w := len(ma.getSpans()), 3; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+}
+
+func TestNewExporter_addSpansInOneRequest(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	var mu sync.Mutex
+	var exported []ocagent.ExportStats
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		// Every item of the bundler would go out on its own.
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BundleCountThreshold: 1}),
+		ocagent.WithOnSuccess(func(es ocagent.ExportStats) {
+			mu.Lock()
+			exported = append(exported, es)
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.AddSpans([]*trace.SpanData{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	exp.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exported) != 1 || exported[0].Spans != 3 {
+		t.Errorf("Got exports %+v, want a single one of 3 spans", exported)
+	}
+}
+
+type countingCodec struct {
+	encoding.Codec
+	marshals int64
+}
+
+func (cc *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	atomic.AddInt64(&cc.marshals, 1)
+	return cc.Codec.Marshal(v)
+}
+
+func TestNewExporter_withCodec(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	codec := &countingCodec{Codec: encoding.GetCodec("proto")}
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithCodec(codec),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "encoded"})
+	<-time.After(20 * time.Millisecond)
+	exp.Flush()
+	<-time.After(20 * time.Millisecond)
+
+	if g, w := len(ma.getSpans()), 1; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+	if atomic.LoadInt64(&codec.marshals) == 0 {
+		t.Error("The custom codec was never used")
+	}
+}
+
+func TestNewExporter_updateOptions(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	if err := exp.UpdateOptions(ocagent.WithAddress("localhost:1")); err == nil {
+		t.Error("Expected an error when updating the address")
+	}
+
+	err = exp.UpdateOptions(
+		ocagent.WithHeaders(map[string]string{"key": "value"}),
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BundleCountThreshold: 10}),
+		ocagent.WithSpanFilter(func(sd *trace.SpanData) bool { return sd.Name != "filtered" }))
+	if err != nil {
+		t.Fatalf("Failed to update the options: %v", err)
+	}
+
+	exp.AddSpans([]*trace.SpanData{{Name: "kept"}, {Name: "filtered"}, {Name: "kept"}})
+	exp.Flush()
+	<-time.After(20 * time.Millisecond)
+
+	if g, w := len(ma.getSpans()), 2; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+}
+
+func TestNewExporter_traceBundlerCountsBytes(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BufferedByteLimit: 256}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	// The span that is larger than BufferedByteLimit is dropped.
+	exp.ExportSpan(&trace.SpanData{Name: "small"})
+	exp.ExportSpan(&trace.SpanData{Name: strings.Repeat("large", 100)})
+	exp.Flush()
+	<-time.After(20 * time.Millisecond)
+
+	spans := ma.getSpans()
+	if g, w := len(spans), 1; g != w {
+		t.Fatalf("Spans: got %d want %d", g, w)
+	}
+	if g, w := spans[0].Name.GetValue(), "small"; g != w {
+		t.Errorf("Span name: got %q want %q", g, w)
+	}
+}
+
+func TestNewExporter_withErrorSpanPriority(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithErrorSpanPriority(),
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{
+			DelayThreshold:       time.Hour,
+			BundleCountThreshold: 1000,
+			BufferedByteLimit:    2000,
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	// Fill the buffer with OK spans, far beyond its capacity.
+	for i := 0; i < 200; i++ {
+		exp.ExportSpan(&trace.SpanData{Name: "ok", SpanContext: trace.SpanContext{TraceID: trace.TraceID{1}}, ParentSpanID: trace.SpanID{1}})
+	}
+	exp.ExportSpan(&trace.SpanData{
+		Name:         "error",
+		SpanContext:  trace.SpanContext{TraceID: trace.TraceID{2}},
+		ParentSpanID: trace.SpanID{1},
+		Status:       trace.Status{Code: trace.StatusCodeUnavailable},
+	})
+	exp.ExportSpan(&trace.SpanData{Name: "error-root", SpanContext: trace.SpanContext{TraceID: trace.TraceID{2}}})
+	exp.ExportSpan(&trace.SpanData{Name: "ok-root", SpanContext: trace.SpanContext{TraceID: trace.TraceID{3}}})
+	exp.Flush()
+	<-time.After(20 * time.Millisecond)
+
+	names := make(map[string]int)
+	for _, span := range ma.getSpans() {
+		names[span.Name.GetValue()]++
+	}
+	if names["error"] != 1 || names["error-root"] != 1 {
+		t.Errorf("The error span and its root must be kept, got %v", names)
+	}
+	if names["ok-root"] != 0 || names["ok"] == 0 || names["ok"] == 200 {
+		t.Errorf("OK spans must be dropped once the buffer is near capacity, got %v", names)
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (sr *spanRecorder) ExportSpan(sd *trace.SpanData) {
+	sr.mu.Lock()
+	sr.spans = append(sr.spans, sd)
+	sr.mu.Unlock()
+}
+
+func (sr *spanRecorder) names() []string {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	var names []string
+	for _, sd := range sr.spans {
+		names = append(names, sd.Name)
+	}
+	return names
+}
+
+func TestNewExporter_withSpillExporter(t *testing.T) {
+	// Nothing listens on this address, hence the exporter stays disconnected.
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an address: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	spilled := new(spanRecorder)
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(addr),
+		ocagent.WithReconnectionPeriod(time.Hour),
+		ocagent.WithSpillExporter(spilled),
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BufferedByteLimit: 256}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "disconnected"})
+	exp.ExportSpan(&trace.SpanData{Name: strings.Repeat("overflow", 100)})
+	exp.Flush()
+
+	names := spilled.names()
+	if len(names) != 2 || names[0] != strings.Repeat("overflow", 100) || names[1] != "disconnected" {
+		t.Errorf("Spilled spans: got %q", names)
+	}
+}
+
+func TestNewExporter_addSpansSpillsOversizedBatches(t *testing.T) {
+	spilled := new(spanRecorder)
+	exp, err := ocagent.NewUnstartedExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithSpillExporter(spilled),
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BufferedByteLimit: 256}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+
+	// Each span fits in the span buffer, but not the batch.
+	name := strings.Repeat("x", 100)
+	exp.AddSpans([]*trace.SpanData{{Name: name}, {Name: name}, {Name: name}})
+
+	if names := spilled.names(); len(names) != 3 {
+		t.Errorf("Spilled spans: got %d, want the 3 of the batch", len(names))
+	}
+}
+
+func TestNewExporter_withFallbackSampler(t *testing.T) {
+	// Nothing listens on this address, hence no configuration is ever received.
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an address: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(addr),
+		ocagent.WithReconnectionPeriod(time.Hour),
+		ocagent.WithFallbackSampler(trace.NeverSample(), 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	if _, span := trace.StartSpan(context.Background(), "before"); !span.SpanContext().IsSampled() {
+		t.Error("The fallback sampler was applied too early")
+	}
+	<-time.After(200 * time.Millisecond)
+	if _, span := trace.StartSpan(context.Background(), "after"); span.SpanContext().IsSampled() {
+		t.Error("The fallback sampler wasn't applied")
+	}
+}
+
+func TestNewExporter_effectiveSampler(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	exp, err := ocagent.NewExporter(ocagent.WithInsecure(), ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	if _, ok := exp.EffectiveSampler(); ok {
+		t.Fatal("Got an effective sampler before any configuration was received")
+	}
+
+	ma.configsToSend <- &agenttracepb.UpdatedLibraryConfig{
+		Config: &tracepb.TraceConfig{
+			Sampler: &tracepb.TraceConfig_ProbabilitySampler{
+				ProbabilitySampler: &tracepb.ProbabilitySampler{SamplingProbability: 0.25},
+			},
+		},
+	}
+	<-time.After(50 * time.Millisecond)
+
+	as, ok := exp.EffectiveSampler()
+	if !ok {
+		t.Fatal("Expected an effective sampler")
+	}
+	if as.Type != ocagent.SamplerProbability || as.Probability != 0.25 {
+		t.Errorf("EffectiveSampler() = %s(%v), want probability(0.25)", as.Type, as.Probability)
+	}
+	if as.AppliedAt.IsZero() {
+		t.Error("AppliedAt wasn't set")
+	}
+}
+
+func TestNewExporter_withOnSuccess(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	var mu sync.Mutex
+	var exported []ocagent.ExportStats
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithOnSuccess(func(es ocagent.ExportStats) {
+			mu.Lock()
+			exported = append(exported, es)
+			mu.Unlock()
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.AddSpans([]*trace.SpanData{{Name: "a"}, {Name: "b"}, {Name: "c"}})
+	exp.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exported) != 1 {
+		t.Fatalf("Got %d successful exports, want 1", len(exported))
+	}
+	if es := exported[0]; es.Spans != 3 || es.Metrics != 0 || es.Bytes <= 0 || es.Latency <= 0 {
+		t.Errorf("Got %+v, want 3 spans with their size and latency", es)
+	}
+}
+
+// expvarRuns numbers the runs of the tests that publish expvars,
+// since a published name can't be taken back, e.g. with -count=2.
+var expvarRuns int64
+
+func TestNewExporter_withExpvar(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	name := fmt.Sprintf("%s_%d", t.Name(), atomic.AddInt64(&expvarRuns, 1))
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithExpvar(name))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.AddSpans([]*trace.SpanData{{Name: "a"}, {Name: "b"}})
+	exp.Flush()
+
+	m, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		t.Fatal("The counters weren't published")
+	}
+	if got := m.Get("exported_spans").String(); got != "2" {
+		t.Errorf("exported_spans: got %s, want 2", got)
+	}
+	if got := m.Get("dropped_spans").String(); got != "0" {
+		t.Errorf("dropped_spans: got %s, want 0", got)
+	}
+
+	_, err = ocagent.NewUnstartedExporter(ocagent.WithInsecure(), ocagent.WithExpvar(name))
+	if err == nil {
+		t.Error("Expected an error for an expvar name that is already published")
+	}
+}
+
+func TestNewExporter_withExpvarConcurrently(t *testing.T) {
+	name := fmt.Sprintf("%s_%d", t.Name(), atomic.AddInt64(&expvarRuns, 1))
+	const n = 8
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := ocagent.NewUnstartedExporter(ocagent.WithInsecure(), ocagent.WithExpvar(name))
+			errs <- err
+		}()
+	}
+	var published int
+	for i := 0; i < n; i++ {
+		if <-errs == nil {
+			published++
+		}
+	}
+	if published != 1 {
+		t.Errorf("Got %d exporters publishing %q, want 1", published, name)
+	}
+}
+
+func TestNewExporter_withEventHistory(t *testing.T) {
+	ma := runMockAgent(t)
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(time.Hour),
+		ocagent.WithEventHistory(10))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	// Sending on the trace streams fails once the agent is gone.
+	ma.stop()
+	for i := 0; i < 3; i++ {
+		exp.ExportSpan(&trace.SpanData{Name: "lost"})
+		exp.Flush()
+	}
+
+	var kinds []string
+	for _, ev := range exp.RecentEvents() {
+		kinds = append(kinds, ev.Kind.String())
+	}
+	if len(kinds) < 3 || kinds[0] != "connected" || kinds[1] != "disconnected" || kinds[len(kinds)-1] != "dropped" {
+		t.Errorf("Got events %v, want connected, disconnected then dropped", kinds)
+	}
+}
+
+func TestNewExporter_withDryRun(t *testing.T) {
+	// Nothing listens on this address, but no connection is attempted anyway.
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an address: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var problems []string
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(addr),
+		ocagent.WithDryRun(func(vp ocagent.ValidationProblem) {
+			problems = append(problems, vp.String())
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+
+	exp.ExportSpan(&trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}},
+		Name:        "valid",
+	})
+	exp.ExportSpan(&trace.SpanData{Name: "no-ids"})
+	m := stats.Int64("dry_run/measure", "", stats.UnitDimensionless)
+	exp.ExportView(&view.Data{View: &view.View{Name: "no-aggregation", Measure: m}})
+
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+	want := []string{
+		`traces "no-ids": invalid trace ID 00000000000000000000000000000000`,
+		`traces "no-ids": invalid span ID 0000000000000000`,
+		`metrics "no-aggregation": the metric type is UNSPECIFIED`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("Got problems:\n%s\nwant:\n%s", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// Best case comparison for information that we can externally introspect
+func sameProcessIdentifier(n1, n2 *commonpb.ProcessIdentifier) bool {
+	if n1 == nil || n2 == nil {
+		return n1 == n2
+	}
+	return n1.HostName == n2.HostName && n1.Pid == n2.Pid
+}
+
+func sameLibraryInfo(li1, li2 *commonpb.LibraryInfo) bool {
+	if li1 == nil || li2 == nil {
+		return li1 == li2
+	}
+	return li1.Language == li2.Language &&
+		li1.ExporterVersion == li2.ExporterVersion &&
+		li1.CoreLibraryVersion == li2.CoreLibraryVersion
+}
+
+func sameServiceInfo(si1, si2 *commonpb.ServiceInfo) bool {
+	if si1 == nil || si2 == nil {
+		return si1 == si2
+	}
+	return si1.Name == si2.Name
+}
+
+func TestNewExporter_neverSamplesItsOwnRPCs(t *testing.T) {
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithUnaryBatchExporter(ocagent.UnaryExporterParams{}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+	trace.RegisterExporter(exp)
+	defer trace.UnregisterExporter(exp)
+
+	// Each unary export is an RPC, whose span would be exported in turn.
+	for i := 0; i < 3; i++ {
+		batch := &agenttracepb.ExportTraceServiceRequest{
+			Spans: []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: "span"}}},
+		}
+		if err := exp.ExportTraceServiceRequest(batch); err != nil {
+			t.Fatalf("Failed to export: %v", err)
+		}
+	}
+	exp.Flush()
+	<-time.After(50 * time.Millisecond)
+
+	for _, span := range ma.getSpans() {
+		if name := span.GetName().GetValue(); strings.HasPrefix(name, "opencensus.proto.agent.") {
+			t.Errorf("The span of the exporter's own RPC %q was exported", name)
+		}
+	}
+}
+
+func TestNewExporter_withFlushOnExit(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithFlushOnExit(),
+		// Without FlushAll, the span would only go out in an hour.
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{DelayThreshold: time.Hour}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "last"})
+	ocagent.FlushAll(time.Second)
+	<-time.After(50 * time.Millisecond)
+
+	if got := len(ma.getSpans()); got != 1 {
+		t.Errorf("Got %d spans, want the last one flushed", got)
+	}
+}
+
+func TestExporter_ApplyConfig(t *testing.T) {
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	ma := runMockAgent(t)
+	defer ma.stop()
+	ma.transitionToReceivingClientConfigs()
+
+	exp, err := ocagent.NewExporter(ocagent.WithInsecure(), ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	cfg := &tracepb.TraceConfig{
+		Sampler: &tracepb.TraceConfig_ProbabilitySampler{
+			ProbabilitySampler: &tracepb.ProbabilitySampler{SamplingProbability: 0.25},
+		},
+	}
+	if err := exp.ApplyConfig(cfg); err != nil {
+		t.Fatalf("Failed to apply the config: %v", err)
+	}
+	if as, _ := exp.EffectiveSampler(); as.Type != ocagent.SamplerProbability || as.Probability != 0.25 {
+		t.Errorf("EffectiveSampler = %+v, want the applied probability sampler", as)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, got := range ma.getReceivedConfigs() {
+			if got.GetConfig().GetProbabilitySampler().GetSamplingProbability() == 0.25 {
+				return
+			}
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	t.Fatalf("The applied config wasn't published, got %v", ma.getReceivedConfigs())
+}
+
+func TestNewExporter_withStartTime(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	start := time.Date(2019, time.March, 4, 5, 6, 7, 8, time.UTC)
+	exp, err := ocagent.NewExporter(ocagent.WithInsecure(), ocagent.WithAddress(ma.address), ocagent.WithStartTime(start))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	<-time.After(50 * time.Millisecond)
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+	ma.stop()
+
+	traceNodes := ma.getTraceNodes()
+	if len(traceNodes) == 0 {
+		t.Fatal("No node was received")
+	}
+	ts := traceNodes[0].GetIdentifier().GetStartTimestamp()
+	if got := time.Unix(ts.GetSeconds(), int64(ts.GetNanos())).UTC(); !got.Equal(start) {
+		t.Errorf("StartTimestamp = %v, want %v", got, start)
+	}
+}
+
+func TestNewExporter_stopDrains(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithEventHistory(10))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	<-time.After(50 * time.Millisecond)
+
+	// Buffered before Stop, hence sent.
+	for i := 0; i < 5; i++ {
+		exp.ExportSpan(&trace.SpanData{Name: "buffered"})
+	}
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("Failed to stop the exporter: %v", err)
+	}
+	// Exported after Stop, hence dropped.
+	exp.ExportSpan(&trace.SpanData{Name: "late"})
+	exp.ExportView(&view.Data{View: &view.View{Name: "late"}})
+	ma.stop()
+
+	if g, w := len(ma.getSpans()), 5; g != w {
+		t.Errorf("Spans: got %d want %d", g, w)
+	}
+	var details []string
+	for _, ev := range exp.RecentEvents() {
+		if ev.Kind.String() == "dropped" {
+			details = append(details, ev.Detail)
+		}
+	}
+	if want := []string{"spans: exporter stopping", "metrics: exporter stopping"}; !reflect.DeepEqual(details, want) {
+		t.Errorf("Dropped events: got %q want %q", details, want)
+	}
+}
+
+func TestNewExporter_pendingSpans(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(ocagent.WithInsecure(), ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+	<-time.After(50 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		exp.ExportSpan(&trace.SpanData{Name: "pending"})
+	}
+	if g, w := exp.PendingSpans(), int64(5); g != w {
+		t.Errorf("Before Flush: got %d want %d", g, w)
+	}
+	exp.Flush()
+	if g, w := exp.PendingSpans(), int64(0); g != w {
+		t.Errorf("After Flush: got %d want %d", g, w)
+	}
+}
+
+func TestNewExporter_reconnect(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewUnstartedExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		// Long enough that only Reconnect can trigger the reconnection.
+		ocagent.WithReconnectionPeriod(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	if err := exp.Reconnect(); err == nil || !strings.Contains(err.Error(), "not started") {
+		t.Errorf("Reconnect before Start: got %v, want a \"not started\" error", err)
+	}
+	if err := exp.Start(); err != nil {
+		t.Fatalf("Failed to start the exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	if err := exp.Reconnect(); err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, node := range ma.getTraceNodes() {
+			if node.GetAttributes()[ocagent.ReconnectsAttributeKey] == "1" {
+				return
+			}
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+	t.Fatalf("The exporter did not reconnect, got nodes %v", ma.getTraceNodes())
+}
+
+func TestNewExporter_selfTest(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewUnstartedExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	if err := exp.SelfTest(context.Background()); err == nil || !strings.Contains(err.Error(), "not started") {
+		t.Errorf("SelfTest before Start: got %v, want a \"not started\" error", err)
+	}
+	if err := exp.Start(); err != nil {
+		t.Fatalf("Failed to start the exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := exp.SelfTest(ctx); err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	spans := ma.getUnarySpans()
+	if len(spans) != 1 || spans[0].GetName().GetValue() != ocagent.SelfTestSpanName {
+		t.Errorf("Got spans %v, want the self test span", spans)
+	}
+}
+
+func TestNewExporter_withLazyConnection(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithLazyConnection())
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	<-time.After(50 * time.Millisecond)
+	if nodes := ma.getTraceNodes(); len(nodes) != 0 {
+		t.Fatalf("Connected before the first export, got nodes %v", nodes)
+	}
+
+	exp.ExportSpan(&trace.SpanData{Name: "first"})
+	exp.Flush()
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+	ma.stop()
+
+	spans := ma.getSpans()
+	if len(spans) != 1 || spans[0].GetName().GetValue() != "first" {
+		t.Errorf("Got spans %v, want the first span", spans)
+	}
+}
+
+func TestNewExporter_withLazyConnectionNeverDials(t *testing.T) {
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		// Nothing listens on this address.
+		ocagent.WithAddress("localhost:1"),
+		ocagent.WithLazyConnection())
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+}
+
+func TestNewExporter_withDisconnectionAlert(t *testing.T) {
+	ma := runMockAgent(t)
+
+	alerts := make(chan ocagent.DisconnectionAlert, 4)
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(20*time.Millisecond),
+		ocagent.WithDisconnectionAlert(100*time.Millisecond, func(alert ocagent.DisconnectionAlert) {
+			alerts <- alert
+		}))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	ma.stop()
+	select {
+	case alert := <-alerts:
+		if alert.Recovered || alert.Duration < 100*time.Millisecond || alert.LastError == nil {
+			t.Errorf("Got %+v, want an alert of a disconnection of 100ms or more", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No alert of the disconnection")
+	}
+
+	nma := runMockAgentAtAddr(t, ma.address)
+	defer nma.stop()
+	select {
+	case alert := <-alerts:
+		if !alert.Recovered {
+			t.Errorf("Got %+v, want the alert of the recovery", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No alert of the recovery")
 	}
-	return si1.Name == si2.Name
 }
@@ -0,0 +1,69 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"time"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+// ExportStats describes a batch successfully exported to the agent.
+type ExportStats struct {
+	// Spans is the number of spans in a trace batch.
+	Spans int
+	// Metrics is the number of metrics in a metrics batch.
+	Metrics int
+	// Bytes is the size of the encoded batch, before compression.
+	Bytes int
+	// Latency is how long the export took. For batches sent on a stream,
+	// that is the time to send them, since the agent doesn't acknowledge them.
+	Latency time.Duration
+}
+
+func (ae *Exporter) traceExported(batch *marshaledTraceRequest, start time.Time) {
+	latency := time.Since(start)
+	ae.observeSend(latency)
+	ae.observeBatch(latency)
+	atomic.StoreInt64(&ae.lastExportUnixNano, time.Now().UnixNano())
+	atomic.AddInt64(&ae.counters.exportedSpans, int64(len(batch.spans)))
+	ae.recordEvent(EventBatchSent, teeSignalTraces, int64(len(batch.spans)))
+	if ae.onSuccess == nil {
+		return
+	}
+	ae.onSuccess(ExportStats{
+		Spans:   len(batch.spans),
+		Bytes:   len(batch.data),
+		Latency: latency,
+	})
+}
+
+func (ae *Exporter) metricsExported(batch *marshaledRequest, start time.Time) {
+	stats := ExportStats{
+		Bytes:   len(batch.data),
+		Latency: time.Since(start),
+	}
+	ae.observeSend(stats.Latency)
+	if req, ok := batch.Message.(*agentmetricspb.ExportMetricsServiceRequest); ok {
+		stats.Metrics = len(req.Metrics)
+	}
+	atomic.StoreInt64(&ae.lastExportUnixNano, time.Now().UnixNano())
+	atomic.AddInt64(&ae.counters.exportedMetrics, int64(stats.Metrics))
+	ae.recordEvent(EventBatchSent, teeSignalMetrics, int64(stats.Metrics))
+	if ae.onSuccess != nil {
+		ae.onSuccess(stats)
+	}
+}
@@ -18,8 +18,16 @@ import (
 	"time"
 
 	"go.opencensus.io/resource"
+	"go.opencensus.io/trace"
+	"google.golang.org/api/support/bundler"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
 )
 
 const (
@@ -85,7 +93,9 @@ func (igc *insecureGrpcConnection) withExporter(e *Exporter) {
 
 // WithInsecure disables client transport security for the exporter's gRPC connection
 // just like grpc.WithInsecure() https://godoc.org/google.golang.org/grpc#WithInsecure
-// does. Note, by default, client security is required unless WithInsecure is used.
+// does. Note, by default, client security is required unless WithInsecure is used:
+// if neither WithInsecure nor WithTLSCredentials is set, the exporter connects
+// with TLS, verifying the agent against the system's root certificates.
 func WithInsecure() ExporterOption { return new(insecureGrpcConnection) }
 
 type addressSetter string
@@ -99,6 +109,20 @@ var _ ExporterOption = (*addressSetter)(nil)
 // WithAddress allows one to set the address that the exporter will
 // connect to the agent on. If unset, it will instead try to use
 // connect to DefaultAgentHost:DefaultAgentPort
+//
+// The address is a host and a port, the port defaulting to DefaultAgentPort,
+// e.g. agent:55678, agent or [::1]:55678. NewExporter rejects a malformed address.
+//
+// The address can also be a URL such as grpcs://agent:55678, in which case the
+// scheme selects the transport security: grpc:// and http:// connect without
+// it, like WithInsecure, while grpcs:// and https:// connect with TLS, verifying
+// the agent against the system's roots unless WithTLSCredentials is used.
+//
+// In a service mesh, the address can be an xDS target such as
+// xds:///opencensus-agent, whose endpoints are resolved by the gRPC xDS
+// resolver. The exporter doesn't link it in, since it needs a newer gRPC than
+// this module requires and pulls in the xDS protocol: the application
+// registers it by importing google.golang.org/grpc/xds.
 func WithAddress(addr string) ExporterOption {
 	return addressSetter(addr)
 }
@@ -112,7 +136,8 @@ func (sns serviceNameSetter) withExporter(e *Exporter) {
 var _ ExporterOption = (*serviceNameSetter)(nil)
 
 // WithServiceName allows one to set/override the service name
-// that the exporter will report to the agent.
+// that the exporter will report to the agent. It defaults to the
+// name of the executable.
 func WithServiceName(serviceName string) ExporterOption {
 	return serviceNameSetter(serviceName)
 }
@@ -121,8 +146,12 @@ type reconnectionPeriod time.Duration
 
 func (rp reconnectionPeriod) withExporter(e *Exporter) {
 	e.reconnectionPeriod = time.Duration(rp)
+	e.backoffPolicy = nil
 }
 
+// WithReconnectionPeriod makes the exporter wait rp between its attempts to
+// reconnect to the agent, as ConstantBackoff{Period: rp} does. It overrides
+// any previous WithBackoffPolicy.
 func WithReconnectionPeriod(rp time.Duration) ExporterOption {
 	return reconnectionPeriod(rp)
 }
@@ -138,10 +167,32 @@ func (c compressorSetter) withExporter(e *Exporter) {
 // with google.golang.org/grpc/encoding. This can be done by encoding.RegisterCompressor. Some
 // compressors auto-register on import, such as gzip, which can be registered by calling
 // `import _ "google.golang.org/grpc/encoding/gzip"`
+//
+// If the agent rejects the compressor, the exporter falls back to sending
+// uncompressed data, and records an EventCompressionDisabled.
 func UseCompressor(compressorName string) ExporterOption {
 	return compressorSetter(compressorName)
 }
 
+type codecSetter struct {
+	encoding.Codec
+}
+
+var _ ExporterOption = (*codecSetter)(nil)
+
+func (c *codecSetter) withExporter(e *Exporter) {
+	e.codec = c.Codec
+}
+
+// WithCodec makes the exporter marshal its export RPCs with the given codec
+// instead of the default protobuf one, e.g. with a codec built on generated
+// marshalers to cut the CPU spent serializing large span batches. The codec
+// must produce the protobuf wire format since the agent decodes requests as
+// regular protobuf messages.
+func WithCodec(codec encoding.Codec) ExporterOption {
+	return &codecSetter{Codec: codec}
+}
+
 type headerSetter map[string]string
 
 func (h headerSetter) withExporter(e *Exporter) {
@@ -187,3 +238,946 @@ func WithGRPCDialOption(opts ...grpc.DialOption) ExporterOption {
 func (opts grpcDialOptions) withExporter(e *Exporter) {
 	e.grpcDialOptions = opts
 }
+
+type traceStreamsSetter int
+
+var _ ExporterOption = (*traceStreamsSetter)(nil)
+
+func (tss traceStreamsSetter) withExporter(e *Exporter) {
+	e.numTraceStreams = int(tss)
+}
+
+// WithTraceStreams sets the number of concurrent Export streams that the
+// exporter opens on the trace service. Spans are sharded across the streams
+// by trace ID, so all the spans of a trace travel on the same stream while
+// unrelated traces are sent in parallel. Values less than 1 are treated as 1,
+// which is also the default.
+func WithTraceStreams(n int) ExporterOption {
+	return traceStreamsSetter(n)
+}
+
+type traceCompressionThreshold int
+
+var _ ExporterOption = (*traceCompressionThreshold)(nil)
+
+func (tct traceCompressionThreshold) withExporter(e *Exporter) {
+	e.traceCompressionThreshold = int(tct)
+}
+
+// WithTraceCompressionThreshold sets the size in bytes below which trace
+// batches are sent without the compressor set by UseCompressor, since small
+// batches often end up both slower and larger once compressed.
+// Streams have their compressor fixed when they are created, so setting a
+// threshold opens an extra compressed stream next to each trace stream.
+func WithTraceCompressionThreshold(nBytes int) ExporterOption {
+	return traceCompressionThreshold(nBytes)
+}
+
+type metricsCompressionThreshold int
+
+var _ ExporterOption = (*metricsCompressionThreshold)(nil)
+
+func (mct metricsCompressionThreshold) withExporter(e *Exporter) {
+	e.metricsCompressionThreshold = int(mct)
+}
+
+// WithMetricsCompressionThreshold is the metrics counterpart of
+// WithTraceCompressionThreshold.
+func WithMetricsCompressionThreshold(nBytes int) ExporterOption {
+	return metricsCompressionThreshold(nBytes)
+}
+
+type teeFileParams TeeFileParams
+
+var _ ExporterOption = (*teeFileParams)(nil)
+
+func (tfp *teeFileParams) withExporter(e *Exporter) {
+	e.teeFileParams = (*TeeFileParams)(tfp)
+}
+
+// WithTeeFile makes the exporter also write every request that it sends to
+// the agent to a local file, for debugging and auditing purposes.
+func WithTeeFile(p TeeFileParams) ExporterOption {
+	tfp := teeFileParams(p)
+	return &tfp
+}
+
+type spoolParams SpoolParams
+
+var _ ExporterOption = (*spoolParams)(nil)
+
+func (sp *spoolParams) withExporter(e *Exporter) {
+	e.spoolParams = (*SpoolParams)(sp)
+}
+
+// WithSpool makes the exporter write the batches that it can't send while
+// disconnected from the agent to a bounded file on disk, instead of dropping
+// them. Spooled batches are replayed, in order, once the connection recovers.
+func WithSpool(p SpoolParams) ExporterOption {
+	sp := spoolParams(p)
+	return &sp
+}
+
+type traceCompleteBatching time.Duration
+
+var _ ExporterOption = (*traceCompleteBatching)(nil)
+
+func (tcb traceCompleteBatching) withExporter(e *Exporter) {
+	if tcb <= 0 {
+		tcb = traceCompleteBatching(DefaultTraceCompleteMaxWait)
+	}
+	e.traceAssembler = newTraceAssembler(time.Duration(tcb))
+}
+
+// DefaultTraceCompleteMaxWait is the maximum time that spans are held back
+// by WithTraceCompleteBatching if no positive duration is passed to it.
+const DefaultTraceCompleteMaxWait = 30 * time.Second
+
+// WithTraceCompleteBatching makes the exporter buffer spans by trace ID and
+// send a whole trace in a single request once its local root span ends,
+// which helps tail-sampling in collectors downstream of the agent.
+// Traces whose root hasn't ended after maxWait are sent as they are. At most
+// 10000 traces are buffered: beyond, the spans of new traces are dropped.
+func WithTraceCompleteBatching(maxWait time.Duration) ExporterOption {
+	return traceCompleteBatching(maxWait)
+}
+
+// BundlerOptions tunes how spans or view data are batched before
+// being sent to the agent. Zero values keep the defaults.
+type BundlerOptions struct {
+	// DelayThreshold is the maximum time that an item waits before its bundle is sent.
+	DelayThreshold time.Duration
+	// BundleCountThreshold is the number of items that triggers sending a bundle.
+	BundleCountThreshold int
+	// BufferedByteLimit is the maximum number of bytes buffered before new items are dropped.
+	BufferedByteLimit int
+}
+
+func (bo BundlerOptions) applyTo(b *bundler.Bundler) {
+	if bo.DelayThreshold > 0 {
+		b.DelayThreshold = bo.DelayThreshold
+	}
+	if bo.BundleCountThreshold > 0 {
+		b.BundleCountThreshold = bo.BundleCountThreshold
+	}
+	if bo.BufferedByteLimit > 0 {
+		b.BufferedByteLimit = bo.BufferedByteLimit
+	}
+}
+
+type traceBundlerOptions BundlerOptions
+
+var _ ExporterOption = (*traceBundlerOptions)(nil)
+
+func (tbo traceBundlerOptions) withExporter(e *Exporter) {
+	e.traceBundlerOptions = BundlerOptions(tbo)
+}
+
+// WithTraceBundlerOptions tunes the batching of spans passed to ExportSpan.
+func WithTraceBundlerOptions(bo BundlerOptions) ExporterOption {
+	return traceBundlerOptions(bo)
+}
+
+type viewDataBundlerOptions BundlerOptions
+
+var _ ExporterOption = (*viewDataBundlerOptions)(nil)
+
+func (vbo viewDataBundlerOptions) withExporter(e *Exporter) {
+	e.viewDataBundlerOptions = BundlerOptions(vbo)
+}
+
+// WithViewDataBundlerOptions tunes the batching of view data passed to ExportView.
+func WithViewDataBundlerOptions(bo BundlerOptions) ExporterOption {
+	return viewDataBundlerOptions(bo)
+}
+
+type spanFilter func(*trace.SpanData) bool
+
+var _ ExporterOption = (*spanFilter)(nil)
+
+func (sf spanFilter) withExporter(e *Exporter) {
+	e.spanFilter = sf
+}
+
+// WithSpanFilter registers a filter that is invoked on each span passed to
+// ExportSpan: only the spans that it returns true for are exported. It can
+// be used to sample spans further after the OpenCensus sampler.
+func WithSpanFilter(filter func(*trace.SpanData) bool) ExporterOption {
+	return spanFilter(filter)
+}
+
+type errorSpanPriority bool
+
+var _ ExporterOption = (*errorSpanPriority)(nil)
+
+func (esp errorSpanPriority) withExporter(e *Exporter) {
+	e.errorSpanPriority = bool(esp)
+}
+
+// WithErrorSpanPriority makes the exporter favor error spans when its span
+// buffer is near capacity, e.g. while the agent is slow or unreachable: once
+// ErrorSpanPriorityUtilization of the trace bundler's BufferedByteLimit is in
+// use, spans with an OK status are dropped, leaving the remaining room to the
+// spans with an error status and to the local root spans of their traces.
+// Up to 4096 traces with an error are remembered until their local root
+// span is exported, the oldest ones being forgotten first.
+func WithErrorSpanPriority() ExporterOption {
+	return errorSpanPriority(true)
+}
+
+type loadShedding LoadSheddingParams
+
+var _ ExporterOption = (*loadShedding)(nil)
+
+func (ls loadShedding) withExporter(e *Exporter) {
+	params := LoadSheddingParams(ls)
+	e.loadShedding = &params
+}
+
+// WithLoadShedding makes the exporter degrade gracefully as its span buffer
+// fills up, e.g. while the agent is slow or unreachable: rather than dropping
+// every span once the buffer is full, spans are dropped at random with a
+// probability that rises with the buffer's utilization, as configured by params.
+// The dropped spans are reported by ShedSpansView, and the drop probability by
+// SheddingDropProbabilityView. Combined with WithErrorSpanPriority, error
+// spans are never dropped at random.
+func WithLoadShedding(params LoadSheddingParams) ExporterOption {
+	return loadShedding(params)
+}
+
+type metricCardinalityLimit int
+
+var _ ExporterOption = (*metricCardinalityLimit)(nil)
+
+func (mcl metricCardinalityLimit) withExporter(e *Exporter) {
+	if mcl > 0 {
+		e.cardinalityLimiter = newCardinalityLimiter(int(mcl))
+	}
+}
+
+// WithMetricCardinalityLimit bounds the number of distinct label sets exported
+// per metric of the views passed to ExportView, protecting the agent and the
+// backend from cardinality explosions. The first limit label sets of a metric
+// are exported as is, while the values of any other label set are added up
+// into a single series whose labels are all OverflowLabelValue. The number of
+// series aggregated that way is reported by OverflowSeriesView.
+func WithMetricCardinalityLimit(limit int) ExporterOption {
+	return metricCardinalityLimit(limit)
+}
+
+type deltaTemporality bool
+
+var _ ExporterOption = (*deltaTemporality)(nil)
+
+func (dt deltaTemporality) withExporter(e *Exporter) {
+	if dt {
+		e.deltaConverter = newDeltaConverter()
+	}
+}
+
+// WithDeltaTemporality makes the exporter convert the cumulative view data
+// passed to ExportView into delta points, for the backends behind the agent
+// that prefer delta temporality. Each point is then the difference with the
+// previous point exported for the same series, and starts when that previous
+// point ended. The first point of a series, and the first point after a reset,
+// are exported as is.
+func WithDeltaTemporality() ExporterOption {
+	return deltaTemporality(true)
+}
+
+type metricsIntervalAlignment time.Duration
+
+var _ ExporterOption = (*metricsIntervalAlignment)(nil)
+
+func (mia metricsIntervalAlignment) withExporter(e *Exporter) {
+	if mia > 0 {
+		e.metricsAlignment = &metricsAlignment{interval: time.Duration(mia)}
+	}
+}
+
+// WithMetricsIntervalAlignment aligns the pushes of the view data passed to
+// ExportView to the wall-clock boundaries of interval, e.g. to :00 and :30 of
+// each minute with an interval of 30 seconds, so that dashboards fed through
+// the agent get consistent bucket boundaries across instances. View data are
+// held until the next boundary, when the latest view data of each view are
+// sent. Flush and Stop send the held view data immediately.
+func WithMetricsIntervalAlignment(interval time.Duration) ExporterOption {
+	return metricsIntervalAlignment(interval)
+}
+
+type unitMapping func(unit string) string
+
+var _ ExporterOption = (*unitMapping)(nil)
+
+func (um unitMapping) withExporter(e *Exporter) {
+	e.unitMapping = um
+}
+
+// WithUnitMapping registers mapping to customize the units of the metrics
+// converted from the view data passed to ExportView. The units of the measures
+// are first normalized to UCUM, the Unified Code for Units of Measure: common
+// spellings like "bytes" or "milliseconds" become "By" or "ms". mapping is then
+// invoked with each normalized unit, and returns the unit to export.
+func WithUnitMapping(mapping func(unit string) string) ExporterOption {
+	return unitMapping(mapping)
+}
+
+type attributeKeyMapping AttributeKeyMapping
+
+var _ ExporterOption = (*attributeKeyMapping)(nil)
+
+func (akm attributeKeyMapping) withExporter(e *Exporter) {
+	mapping := AttributeKeyMapping(akm)
+	e.attributeKeyMapping = &mapping
+}
+
+// WithAttributeKeyMapping renames the keys of the attributes of the spans
+// passed to ExportSpan, and of their annotations, as configured by mapping.
+// It eases migrations to new attribute naming conventions without touching
+// every call site.
+func WithAttributeKeyMapping(mapping AttributeKeyMapping) ExporterOption {
+	return attributeKeyMapping(mapping)
+}
+
+type timeEventLimits TimeEventLimits
+
+var _ ExporterOption = (*timeEventLimits)(nil)
+
+func (tel timeEventLimits) withExporter(e *Exporter) {
+	e.timeEventLimits = TimeEventLimits(tel)
+}
+
+// WithTimeEventLimits caps the annotations and the message events exported
+// per span, so that spans with thousands of events don't dominate the size of
+// the batches. Beyond the limits, the oldest events are dropped, and their
+// number is recorded in the dropped counts of the exported span.
+func WithTimeEventLimits(limits TimeEventLimits) ExporterOption {
+	return timeEventLimits(limits)
+}
+
+type onSuccess func(ExportStats)
+
+var _ ExporterOption = (*onSuccess)(nil)
+
+func (os onSuccess) withExporter(e *Exporter) {
+	e.onSuccess = os
+}
+
+// WithOnSuccess registers fn to be invoked after each batch of spans or
+// metrics is successfully exported to the agent, with the statistics of the
+// batch, so that applications can build their own delivery SLIs without
+// wrapping the exporter. fn is invoked synchronously, hence it must be fast.
+func WithOnSuccess(fn func(ExportStats)) ExporterOption {
+	return onSuccess(fn)
+}
+
+type expvarName string
+
+var _ ExporterOption = (*expvarName)(nil)
+
+func (en expvarName) withExporter(e *Exporter) {
+	e.expvarName = string(en)
+}
+
+// WithExpvar publishes the counters of the exporter through expvar under
+// name, so that the scrapers of /debug/vars pick them up: the spans and the
+// metrics exported and dropped, the reconnections to the agent, and the number
+// of batches waiting to be sent. Since expvar can't unpublish a variable, each
+// name can only be used once per process: NewUnstartedExporter returns an
+// error if name is already published. For the same reason, the published
+// variables keep the exporter reachable, and their values readable, after
+// it is stopped.
+func WithExpvar(name string) ExporterOption {
+	return expvarName(name)
+}
+
+type eventHistory int
+
+var _ ExporterOption = (*eventHistory)(nil)
+
+func (eh eventHistory) withExporter(e *Exporter) {
+	if eh > 0 {
+		e.events = newEventRing(int(eh))
+	}
+}
+
+// WithEventHistory makes the exporter keep its last n significant events in
+// memory: connections to the agent and their losses, drops of spans and
+// metrics, and sampler updates. They are returned by RecentEvents, so that
+// support engineers can reconstruct what happened before a telemetry gap.
+func WithEventHistory(n int) ExporterOption {
+	return eventHistory(n)
+}
+
+type dryRun func(ValidationProblem)
+
+var _ ExporterOption = (*dryRun)(nil)
+
+func (dr dryRun) withExporter(e *Exporter) {
+	if dr == nil {
+		dr = func(ValidationProblem) {}
+	}
+	e.dryRun = dr
+}
+
+// WithDryRun turns the exporter into a validator, e.g. for CI pipelines that
+// check instrumentation: it never connects to the agent, and the spans and
+// the view data that it receives are converted and checked, rather than sent.
+// report is invoked with each problem found, such as spans that are too large
+// for the agent, metrics of an UNSPECIFIED type, or invalid labels.
+func WithDryRun(report func(ValidationProblem)) ExporterOption {
+	return dryRun(report)
+}
+
+type logger func(format string, args ...interface{})
+
+var _ ExporterOption = (*logger)(nil)
+
+func (l logger) withExporter(e *Exporter) {
+	e.logger = l
+}
+
+// WithLogger registers logf, e.g. log.Printf, to log the problems
+// of the exporter that can't be reported otherwise.
+func WithLogger(logf func(format string, args ...interface{})) ExporterOption {
+	return logger(logf)
+}
+
+type finalizerWarning bool
+
+var _ ExporterOption = (*finalizerWarning)(nil)
+
+func (fw finalizerWarning) withExporter(e *Exporter) {
+	e.finalizerWarning = bool(fw)
+}
+
+// WithFinalizerWarning makes the exporter log, with the logger of WithLogger,
+// if it is garbage collected without Stop, which loses its buffered spans and
+// view data and leaks its tee and spool files. Note that a started exporter is
+// referenced by its own goroutines until Stop, hence it is never collected:
+// the warning catches the exporters created with NewUnstartedExporter and
+// then forgotten, while a started exporter that is never stopped leaks.
+func WithFinalizerWarning() ExporterOption {
+	return finalizerWarning(true)
+}
+
+type tenantHeaders map[string]map[string]string
+
+var _ ExporterOption = (*tenantHeaders)(nil)
+
+func (th tenantHeaders) withExporter(e *Exporter) {
+	e.tenantHeaders = map[string]map[string]string(th)
+}
+
+// WithTenantHeaders configures, for relays exporting on behalf of several
+// tenants, the headers to send the batches of each tenant with, e.g. its
+// auth token or tenant ID. They override the ones of WithHeaders. The tenant
+// of a batch is set with WithTenant on the context it's exported with, and
+// exporting for a tenant without headers fails.
+func WithTenantHeaders(headers map[string]map[string]string) ExporterOption {
+	return tenantHeaders(headers)
+}
+
+type heartbeat time.Duration
+
+var _ ExporterOption = (*heartbeat)(nil)
+
+func (h heartbeat) withExporter(e *Exporter) {
+	e.heartbeatInterval = time.Duration(h)
+}
+
+// WithHeartbeat makes the exporter send, with every push of view data, a
+// HeartbeatMetricName metric holding the uptime of the process and the
+// version of the exporter. It's also sent on its own every interval without
+// any view data, so that backends can tell an idle application from a broken
+// pipeline. A non-positive interval disables the heartbeat.
+func WithHeartbeat(interval time.Duration) ExporterOption {
+	return heartbeat(interval)
+}
+
+type connectivityStateCallback func(connectivity.State)
+
+var _ ExporterOption = (*connectivityStateCallback)(nil)
+
+func (csc connectivityStateCallback) withExporter(e *Exporter) {
+	e.connectivityStateCallback = csc
+}
+
+// WithConnectivityStateCallback registers fn to be called with every state
+// of the gRPC channel to the agent, i.e. IDLE, CONNECTING, READY,
+// TRANSIENT_FAILURE and, once the exporter is stopped, SHUTDOWN. fn is called
+// from a goroutine of the exporter and should return quickly.
+func WithConnectivityStateCallback(fn func(connectivity.State)) ExporterOption {
+	return connectivityStateCallback(fn)
+}
+
+type backoffPolicy struct {
+	BackoffPolicy
+}
+
+var _ ExporterOption = (*backoffPolicy)(nil)
+
+func (bp backoffPolicy) withExporter(e *Exporter) {
+	e.backoffPolicy = bp.BackoffPolicy
+}
+
+// WithBackoffPolicy sets the policy that decides how long the exporter waits
+// between its attempts to reconnect to the agent, e.g. ExponentialBackoff or a
+// custom one that waits more for some classes of errors. It overrides any
+// previous WithReconnectionPeriod.
+func WithBackoffPolicy(policy BackoffPolicy) ExporterOption {
+	return backoffPolicy{policy}
+}
+
+type retryParams RetryParams
+
+var _ ExporterOption = (*retryParams)(nil)
+
+func (rp *retryParams) withExporter(e *Exporter) {
+	e.retryParams = (*RetryParams)(rp)
+}
+
+// WithRetry makes ExportTraceServiceRequest retry the batches that failed
+// transiently, with UNAVAILABLE or DEADLINE_EXCEEDED or because the connection
+// to the agent was lost, instead of returning the first error. The retries
+// give up as soon as the context of ExportTraceServiceRequestContext is done.
+func WithRetry(p RetryParams) ExporterOption {
+	return (*retryParams)(&p)
+}
+
+type noSelfInstrumentation bool
+
+var _ ExporterOption = (*noSelfInstrumentation)(nil)
+
+func (nsi noSelfInstrumentation) withExporter(e *Exporter) {
+	e.noSelfInstrumentation = bool(nsi)
+}
+
+// WithoutSelfInstrumentation disables the gRPC stats and traces of the
+// RPCs of the exporter to the agent. Their spans are never sampled anyway,
+// so that the exporter doesn't export spans about its own exports.
+func WithoutSelfInstrumentation() ExporterOption {
+	return noSelfInstrumentation(true)
+}
+
+type traceResponseHandler func(*agenttracepb.ExportTraceServiceResponse)
+
+var _ ExporterOption = (*traceResponseHandler)(nil)
+
+func (trh traceResponseHandler) withExporter(e *Exporter) {
+	e.traceResponseHandler = trh
+}
+
+// WithTraceResponseHandler registers fn to be called with the responses that
+// the agent sends on the trace export streams. The streams are always read
+// from, so that one closed by the agent is noticed as it happens, rather than
+// when the next batch fails to be sent on it.
+func WithTraceResponseHandler(fn func(*agenttracepb.ExportTraceServiceResponse)) ExporterOption {
+	return traceResponseHandler(fn)
+}
+
+type flushOnExit bool
+
+var _ ExporterOption = (*flushOnExit)(nil)
+
+func (foe flushOnExit) withExporter(e *Exporter) {
+	e.flushOnExit = bool(foe)
+}
+
+// WithFlushOnExit registers the exporter, once started and until it is
+// stopped, to be flushed by FlushAll and Exit, so that short-lived programs
+// that forget to stop it still deliver their last batches most of the time.
+func WithFlushOnExit() ExporterOption {
+	return flushOnExit(true)
+}
+
+type defaultSpanAttributes map[string]interface{}
+
+var _ ExporterOption = (*defaultSpanAttributes)(nil)
+
+func (dsa defaultSpanAttributes) withExporter(e *Exporter) {
+	e.defaultSpanAttributes = transform.Attributes(dsa).GetAttributeMap()
+}
+
+// WithDefaultSpanAttributes adds attrs to every span exported with ExportSpan,
+// e.g. deployment-level dimensions like the version or region that aren't
+// labels of the resource. They don't override the attributes of a span with
+// the same keys, after the renaming of WithAttributeKeyMapping. Values can be
+// of the same types as the attributes of spans: bool, int64, float64 and string.
+func WithDefaultSpanAttributes(attrs map[string]interface{}) ExporterOption {
+	return defaultSpanAttributes(attrs)
+}
+
+type mirror struct {
+	m Mirror
+}
+
+var _ ExporterOption = (*mirror)(nil)
+
+func (m mirror) withExporter(e *Exporter) {
+	e.mirror = m.m
+}
+
+// WithMirror makes the exporter send a copy of every batch of spans and
+// metrics to m as well, e.g. to validate an OTLP pipeline before cutting
+// over to it. m fails independently of the agent: its errors are only
+// logged, with the logger of WithLogger, and a slow m drops its copies
+// rather than delaying the agent.
+func WithMirror(m Mirror) ExporterOption {
+	return mirror{m: m}
+}
+
+type runtimeMetricsInterval time.Duration
+
+var _ ExporterOption = (*runtimeMetricsInterval)(nil)
+
+func (rm runtimeMetricsInterval) withExporter(e *Exporter) {
+	e.runtimeMetricsInterval = time.Duration(rm)
+}
+
+// WithRuntimeMetrics makes the exporter send, every interval, metrics of the
+// Go runtime named with RuntimeMetricsPrefix: the number of goroutines, the
+// heap in use and obtained from the OS, and the GC cycles and pauses. They
+// go through the same processing as the metrics of the views.
+func WithRuntimeMetrics(interval time.Duration) ExporterOption {
+	return runtimeMetricsInterval(interval)
+}
+
+type processMetricsInterval time.Duration
+
+var _ ExporterOption = (*processMetricsInterval)(nil)
+
+func (pm processMetricsInterval) withExporter(e *Exporter) {
+	e.processMetricsInterval = time.Duration(pm)
+}
+
+// WithProcessMetrics makes the exporter send, every interval, metrics of the
+// resources used by the process, named with ProcessMetricsPrefix: its CPU
+// time, its resident memory and its open file descriptors. They are only
+// available on Linux; elsewhere, the failure to read them is logged with the
+// logger of WithLogger and nothing is sent.
+func WithProcessMetrics(interval time.Duration) ExporterOption {
+	return processMetricsInterval(interval)
+}
+
+type nodeStartTime time.Time
+
+var _ ExporterOption = (*nodeStartTime)(nil)
+
+func (st nodeStartTime) withExporter(e *Exporter) {
+	e.nodeStartTime = time.Time(st)
+}
+
+// WithStartTime overrides the start timestamp of the Node identifying the
+// process to the agent, which NodeWithStartTime otherwise takes from the
+// time the process started. This is useful for forked workers, processes
+// restored from a checkpoint, or tests that need a deterministic identity.
+func WithStartTime(t time.Time) ExporterOption {
+	return nodeStartTime(t)
+}
+
+type flowControl FlowControlParams
+
+var _ ExporterOption = (*flowControl)(nil)
+
+func (fc flowControl) withExporter(e *Exporter) {
+	params := FlowControlParams(fc)
+	e.flowControl = &params
+}
+
+// WithFlowControl makes the exporter back off when the agent applies
+// backpressure: once sending a batch takes as long as params.SlowSend, which
+// happens when the agent doesn't read as fast as the exporter writes, the
+// exporter stops sending for params.Pause rather than streaming into the
+// congested connection until it fails. Meanwhile, spans and metrics keep being
+// buffered within the limits of the bundlers. The pauses are recorded as
+// EventThrottled events.
+func WithFlowControl(params FlowControlParams) ExporterOption {
+	return flowControl(params)
+}
+
+type transportParams TransportParams
+
+var _ ExporterOption = (*transportParams)(nil)
+
+func (tp transportParams) withExporter(e *Exporter) {
+	params := TransportParams(tp)
+	e.transportParams = &params
+}
+
+// WithTransportParams tunes the flow control windows and the buffers of the
+// connection to the agent, whose gRPC defaults cap the throughput of links
+// with a high latency, e.g. to a centralized agent. Dial options passed to
+// WithGRPCDialOption take precedence.
+func WithTransportParams(params TransportParams) ExporterOption {
+	return transportParams(params)
+}
+
+type traceHeaders map[string]string
+
+var _ ExporterOption = (*traceHeaders)(nil)
+
+func (h traceHeaders) withExporter(e *Exporter) {
+	e.traceHeaders = map[string]string(h)
+}
+
+// WithTraceHeaders sets headers sent on the trace streams only, e.g. an API key
+// that differs from the one of the metrics. They take precedence over the ones
+// of WithHeaders, which are sent on all the streams.
+func WithTraceHeaders(headers map[string]string) ExporterOption {
+	return traceHeaders(headers)
+}
+
+type metricsHeaders map[string]string
+
+var _ ExporterOption = (*metricsHeaders)(nil)
+
+func (h metricsHeaders) withExporter(e *Exporter) {
+	e.metricsHeaders = map[string]string(h)
+}
+
+// WithMetricsHeaders sets headers sent on the metrics streams only, e.g. an API
+// key that differs from the one of the traces. They take precedence over the
+// ones of WithHeaders, which are sent on all the streams.
+func WithMetricsHeaders(headers map[string]string) ExporterOption {
+	return metricsHeaders(headers)
+}
+
+type callOptions []grpc.CallOption
+
+var _ ExporterOption = (*callOptions)(nil)
+
+func (opts callOptions) withExporter(e *Exporter) {
+	e.callOptions = opts
+}
+
+// WithCallOptions adds opts to the options of the RPCs that export spans and
+// metrics, both when the Export streams are created and for the unary exports,
+// e.g. grpc.MaxCallSendMsgSize to raise the size of the messages accepted by
+// the agent. The compressor set by UseCompressor is applied after them.
+func WithCallOptions(opts ...grpc.CallOption) ExporterOption {
+	return callOptions(opts)
+}
+
+type maxSpanAge time.Duration
+
+var _ ExporterOption = (*maxSpanAge)(nil)
+
+func (age maxSpanAge) withExporter(e *Exporter) {
+	e.maxSpanAge = time.Duration(age)
+}
+
+// WithMaxSpanAge evicts the buffered spans that ended more than age ago
+// instead of sending them, so that after a long outage, or a long pause
+// requested by the agent, the freshest spans go out rather than hours-old
+// ones. This applies to the spans waiting to be sent and to those replayed
+// from the spool of WithSpool. The evicted spans are counted as dropped.
+func WithMaxSpanAge(age time.Duration) ExporterOption {
+	return maxSpanAge(age)
+}
+
+type lazyConnection bool
+
+var _ ExporterOption = (*lazyConnection)(nil)
+
+func (lc lazyConnection) withExporter(e *Exporter) {
+	e.lazyConnection = bool(lc)
+}
+
+// WithLazyConnection defers dialing the agent from Start until the first span
+// or view data is exported, so that tools that may never emit telemetry, such
+// as CLIs or cron jobs, neither pay for the connection nor log connection
+// errors at startup. The exporter's own metrics, e.g. of WithHeartbeat, don't
+// count as exports, and are dropped until then.
+func WithLazyConnection() ExporterOption {
+	return lazyConnection(true)
+}
+
+type adaptiveBatching AdaptiveBatchingParams
+
+var _ ExporterOption = (*adaptiveBatching)(nil)
+
+func (ab adaptiveBatching) withExporter(e *Exporter) {
+	params := AdaptiveBatchingParams(ab)
+	e.adaptiveBatching = &params
+}
+
+// WithAdaptiveBatching adjusts the batching of spans to the recent exports:
+// while the agent is healthy, the trace bundler sends larger batches less
+// often, and while it is struggling, with a slow average export latency or
+// failing exports, it sends smaller batches more often. The delay and the
+// size of the batches stay within the bounds of params. Each adjustment
+// replaces the trace bundler, like UpdateOptions.
+func WithAdaptiveBatching(params AdaptiveBatchingParams) ExporterOption {
+	return adaptiveBatching(params)
+}
+
+type disconnectionAlert struct {
+	threshold time.Duration
+	fn        func(DisconnectionAlert)
+}
+
+var _ ExporterOption = (*disconnectionAlert)(nil)
+
+func (da disconnectionAlert) withExporter(e *Exporter) {
+	if da.threshold <= 0 || da.fn == nil {
+		e.disconnectionAlert = nil
+		return
+	}
+	e.disconnectionAlertThreshold = da.threshold
+	e.disconnectionAlert = da.fn
+}
+
+// WithDisconnectionAlert invokes fn once the exporter has been disconnected
+// from the agent for longer than threshold, and again once it reconnects,
+// with Recovered set, so that teams can be paged about a sustained failure of
+// their telemetry pipeline rather than discover gaps later. The alert can be
+// up to a quarter of threshold, or a second, late. fn is invoked from a
+// goroutine of the exporter, which it should return to promptly.
+func WithDisconnectionAlert(threshold time.Duration, fn func(DisconnectionAlert)) ExporterOption {
+	return disconnectionAlert{threshold: threshold, fn: fn}
+}
+
+type droppedLabelKeys struct {
+	viewName string
+	keys     []string
+}
+
+var _ ExporterOption = (*droppedLabelKeys)(nil)
+
+func (dlk droppedLabelKeys) withExporter(e *Exporter) {
+	if len(dlk.keys) == 0 {
+		return
+	}
+	if e.labelDropper == nil {
+		e.labelDropper = new(labelDropper)
+	}
+	e.labelDropper.add(dlk.viewName, dlk.keys)
+}
+
+// WithDroppedLabelKeys strips the tag keys keys from the label sets of the
+// metrics of all the views passed to ExportView, to curb their cardinality
+// without changing the definitions of the views. The values of the series
+// that only differed by the dropped labels are added up into a single series.
+// The option can be passed several times, the keys accumulate.
+func WithDroppedLabelKeys(keys ...string) ExporterOption {
+	return droppedLabelKeys{keys: keys}
+}
+
+// WithDroppedViewLabelKeys is like WithDroppedLabelKeys, but only strips keys
+// from the metric of the view named viewName.
+func WithDroppedViewLabelKeys(viewName string, keys ...string) ExporterOption {
+	return droppedLabelKeys{viewName: viewName, keys: keys}
+}
+
+type spanRollupOption SpanRollupParams
+
+var _ ExporterOption = (*spanRollupOption)(nil)
+
+func (sro spanRollupOption) withExporter(e *Exporter) {
+	if sro.Match == nil {
+		e.spanRollup = nil
+		return
+	}
+	e.spanRollup = newSpanRollup(SpanRollupParams(sro))
+}
+
+// WithSpanRollup collapses the high-volume, low-value spans selected by
+// params.Match, e.g. health checks or cache lookups, into summary spans, to
+// cut the cost of chatty services at the agent and the backend. Every
+// params.Interval, a summary span is exported for each name and kind of the
+// spans rolled up meanwhile: it spans from the first start to the last end
+// of those spans, and its SpanRollup*AttributeKey attributes hold their
+// number, their number of errors and their durations. Flush and Stop export
+// the summary spans right away. The rolled up spans are counted by
+// RolledUpSpansView.
+func WithSpanRollup(params SpanRollupParams) ExporterOption {
+	return spanRollupOption(params)
+}
+
+type metricsPullOption MetricsPullParams
+
+var _ ExporterOption = (*metricsPullOption)(nil)
+
+func (mpo metricsPullOption) withExporter(e *Exporter) {
+	e.metricsPull = &metricsPull{params: MetricsPullParams(mpo), ae: e}
+}
+
+// WithMetricsPull makes the agent pull the metrics from the exporter, for
+// the network topologies where the application can't dial out to the agent.
+// Start serves the agent MetricsService on params.Address, rather than
+// pushing the metrics: the agent opens an Export stream on it, and every
+// message that it sends on the stream is answered with an
+// ExportMetricsServiceRequest holding the latest point of every metric, like a
+// scrape. The metrics are then cumulative, whatever WithDeltaTemporality. The
+// spans are still pushed to the agent, which WithLazyConnection defers until
+// the first span is exported.
+func WithMetricsPull(params MetricsPullParams) ExporterOption {
+	return metricsPullOption(params)
+}
+
+type batchIDsOption bool
+
+var _ ExporterOption = (*batchIDsOption)(nil)
+
+func (bio batchIDsOption) withExporter(e *Exporter) {
+	if bio {
+		e.batchIDs = newBatchIDs()
+	}
+}
+
+// WithBatchIDs attaches a unique ID and a sequence number to every export
+// request, as the BatchIDAttributeKey and BatchSequenceAttributeKey attributes
+// of its node, so that the logs of the agent and of the application can be
+// correlated when debugging losses: a gap in the sequence numbers received by
+// the agent is a lost batch. The unary exports also carry the ID in the
+// BatchIDHeader metadata. A batch keeps its ID when it is retried or replayed
+// from the spool. With WithLogger, the ID of every batch is logged.
+func WithBatchIDs() ExporterOption {
+	return batchIDsOption(true)
+}
+
+type strictOrdering bool
+
+var _ ExporterOption = (*strictOrdering)(nil)
+
+func (so strictOrdering) withExporter(e *Exporter) {
+	e.strictOrdering = bool(so)
+}
+
+// WithStrictOrdering guarantees that spans reach the agent in the order that
+// ExportSpan was called, for downstream processors that rely on it: spans are
+// batched and handed over one batch at a time, all batches go out on a single
+// trace stream, overriding WithTraceStreams and the compressed twin stream of
+// WithTraceCompressionThreshold, and batches that fail are retried, from the
+// spool of WithSpool, ahead of newer ones. It can't be combined with
+// WithTraceCompleteBatching, which reorders spans by trace. Concurrent calls
+// to ExportSpan are ordered as they reach the exporter.
+func WithStrictOrdering() ExporterOption {
+	return strictOrdering(true)
+}
+
+type spanAttributeLimit struct {
+	max          int
+	priorityKeys []string
+}
+
+var _ ExporterOption = (*spanAttributeLimit)(nil)
+
+func (sal spanAttributeLimit) withExporter(e *Exporter) {
+	if sal.max < 0 {
+		return
+	}
+	e.attributeLimit = newAttributeLimit(sal.max, sal.priorityKeys)
+}
+
+// WithSpanAttributeLimit caps the attributes exported per span at max, for
+// agents and backends that reject or truncate spans with more. The attributes
+// of priorityKeys are kept first, in that order, then the others by key. The
+// number of attributes dropped is added to the DroppedAttributesCount of the
+// span. The limit applies after WithAttributeKeyMapping and
+// WithDefaultSpanAttributes, to the attributes as the agent receives them.
+// A negative max leaves the attributes unlimited.
+func WithSpanAttributeLimit(max int, priorityKeys ...string) ExporterOption {
+	return spanAttributeLimit{max: max, priorityKeys: priorityKeys}
+}
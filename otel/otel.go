@@ -0,0 +1,170 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otel adapts the spans of the OpenTelemetry-Go SDK to the
+// OpenCensus agent exporter, for codebases instrumented with both APIs
+// while they migrate from one to the other. Its OTLPMirror sends the
+// batches of the exporter to an OTLP endpoint as well, to validate the
+// new pipeline before cutting over to it. It is a module of its own,
+// so that the exporter doesn't depend on the OpenTelemetry SDK.
+package otel // import "contrib.go.opencensus.io/exporter/ocagent/otel"
+
+import (
+	"context"
+	"strings"
+
+	"go.opencensus.io/trace"
+	"go.opencensus.io/trace/tracestate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+// SpanExporter is an OpenTelemetry SDK span exporter that converts the spans
+// and exports them with an ocagent.Exporter, going through the same
+// processing, batching and connection as the spans of OpenCensus.
+type SpanExporter struct {
+	exporter *ocagent.Exporter
+}
+
+var _ sdktrace.SpanExporter = (*SpanExporter)(nil)
+
+// NewSpanExporter returns a SpanExporter exporting with exporter.
+func NewSpanExporter(exporter *ocagent.Exporter) *SpanExporter {
+	return &SpanExporter{exporter: exporter}
+}
+
+// ExportSpans implements sdktrace.SpanExporter. The spans are
+// buffered by the exporter, as those passed to ExportSpan.
+func (se *SpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	for _, span := range spans {
+		se.exporter.ExportSpan(SpanData(span))
+	}
+	return nil
+}
+
+// Shutdown implements sdktrace.SpanExporter. It flushes the exporter but
+// doesn't stop it, since it may be used by OpenCensus as well: that's up
+// to its owner.
+func (se *SpanExporter) Shutdown(ctx context.Context) error {
+	flushed := make(chan struct{})
+	go func() {
+		se.exporter.Flush()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SpanData converts an OpenTelemetry span to the span data of OpenCensus.
+func SpanData(span sdktrace.ReadOnlySpan) *trace.SpanData {
+	sc := span.SpanContext()
+	sd := &trace.SpanData{
+		SpanContext:            spanContext(sc),
+		ParentSpanID:           trace.SpanID(span.Parent().SpanID()),
+		SpanKind:               spanKind(span.SpanKind()),
+		Name:                   span.Name(),
+		StartTime:              span.StartTime(),
+		EndTime:                span.EndTime(),
+		Attributes:             attributes(span.Attributes()),
+		HasRemoteParent:        span.Parent().IsRemote(),
+		DroppedAttributeCount:  span.DroppedAttributes(),
+		DroppedAnnotationCount: span.DroppedEvents(),
+		DroppedLinkCount:       span.DroppedLinks(),
+		ChildSpanCount:         span.ChildSpanCount(),
+	}
+	if status := span.Status(); status.Code == codes.Error {
+		// UNKNOWN, the closest to an error without more details.
+		sd.Status = trace.Status{Code: trace.StatusCodeUnknown, Message: status.Description}
+	}
+	for _, event := range span.Events() {
+		sd.Annotations = append(sd.Annotations, trace.Annotation{
+			Time:       event.Time,
+			Message:    event.Name,
+			Attributes: attributes(event.Attributes),
+		})
+	}
+	for _, link := range span.Links() {
+		sd.Links = append(sd.Links, trace.Link{
+			TraceID:    trace.TraceID(link.SpanContext.TraceID()),
+			SpanID:     trace.SpanID(link.SpanContext.SpanID()),
+			Attributes: attributes(link.Attributes),
+		})
+	}
+	return sd
+}
+
+func spanContext(sc oteltrace.SpanContext) trace.SpanContext {
+	osc := trace.SpanContext{
+		TraceID: trace.TraceID(sc.TraceID()),
+		SpanID:  trace.SpanID(sc.SpanID()),
+	}
+	if sc.IsSampled() {
+		osc.TraceOptions = 1
+	}
+	if ts := sc.TraceState(); ts.Len() > 0 {
+		var entries []tracestate.Entry
+		// The list members are in their W3C encoding, key=value separated by commas.
+		for _, member := range strings.Split(ts.String(), ",") {
+			if i := strings.IndexByte(member, '='); i > 0 {
+				entries = append(entries, tracestate.Entry{Key: member[:i], Value: member[i+1:]})
+			}
+		}
+		// The keys of OpenCensus are stricter, the trace state is dropped if it doesn't fit.
+		osc.Tracestate, _ = tracestate.New(nil, entries...)
+	}
+	return osc
+}
+
+func spanKind(kind oteltrace.SpanKind) int {
+	switch kind {
+	case oteltrace.SpanKindServer, oteltrace.SpanKindConsumer:
+		return trace.SpanKindServer
+	case oteltrace.SpanKindClient, oteltrace.SpanKindProducer:
+		return trace.SpanKindClient
+	default:
+		return trace.SpanKindUnspecified
+	}
+}
+
+// attributes converts the attributes of OpenTelemetry, with
+// their slices as strings which OpenCensus doesn't have.
+func attributes(kvs []attribute.KeyValue) map[string]interface{} {
+	if len(kvs) == 0 {
+		return nil
+	}
+	attrs := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		switch kv.Value.Type() {
+		case attribute.BOOL:
+			attrs[string(kv.Key)] = kv.Value.AsBool()
+		case attribute.INT64:
+			attrs[string(kv.Key)] = kv.Value.AsInt64()
+		case attribute.FLOAT64:
+			attrs[string(kv.Key)] = kv.Value.AsFloat64()
+		case attribute.STRING:
+			attrs[string(kv.Key)] = kv.Value.AsString()
+		default:
+			attrs[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+	return attrs
+}
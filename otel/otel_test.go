@@ -0,0 +1,81 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanData(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer("test")
+
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, span := tracer.Start(ctx, "child",
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(
+			attribute.String("s", "v"),
+			attribute.Int64("i", 1),
+			attribute.Bool("b", true),
+			attribute.StringSlice("ss", []string{"a", "b"}),
+		))
+	span.AddEvent("event", oteltrace.WithAttributes(attribute.String("e", "v")))
+	span.SetStatus(codes.Error, "failed")
+	span.End()
+	parent.End()
+
+	ended := recorder.Ended()
+	if len(ended) != 2 {
+		t.Fatalf("Got %d spans, want 2", len(ended))
+	}
+	sd := SpanData(ended[0])
+
+	otelSC := ended[0].SpanContext()
+	if sd.TraceID != trace.TraceID(otelSC.TraceID()) || sd.SpanID != trace.SpanID(otelSC.SpanID()) {
+		t.Errorf("Span context: got %v, want %v", sd.SpanContext, otelSC)
+	}
+	if !sd.IsSampled() {
+		t.Error("The span isn't sampled")
+	}
+	if sd.ParentSpanID != trace.SpanID(ended[1].SpanContext().SpanID()) {
+		t.Errorf("Parent: got %v, want %v", sd.ParentSpanID, ended[1].SpanContext().SpanID())
+	}
+	if sd.Name != "child" || sd.SpanKind != trace.SpanKindClient {
+		t.Errorf("Got name %q, kind %d, want %q, %d", sd.Name, sd.SpanKind, "child", trace.SpanKindClient)
+	}
+	wantAttrs := map[string]interface{}{"s": "v", "i": int64(1), "b": true, "ss": "[a b]"}
+	if !reflect.DeepEqual(sd.Attributes, wantAttrs) {
+		t.Errorf("Attributes: got %v, want %v", sd.Attributes, wantAttrs)
+	}
+	if len(sd.Annotations) != 1 || sd.Annotations[0].Message != "event" || sd.Annotations[0].Attributes["e"] != "v" {
+		t.Errorf("Annotations: got %v", sd.Annotations)
+	}
+	if want := (trace.Status{Code: trace.StatusCodeUnknown, Message: "failed"}); sd.Status != want {
+		t.Errorf("Status: got %v, want %v", sd.Status, want)
+	}
+	if !sd.StartTime.Equal(ended[0].StartTime()) || !sd.EndTime.Equal(ended[0].EndTime()) {
+		t.Errorf("Times: got %v-%v", sd.StartTime, sd.EndTime)
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+
+	occommonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	ocagentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	ocagenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	ocmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	ocresourcepb "github.com/census-instrumentation/opencensus-proto/gen-go/resource/v1"
+	octracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+// OTLPMirror is an ocagent.Mirror that converts the batches of the
+// exporter to OTLP and sends them to an OTLP endpoint, so that a new
+// OpenTelemetry pipeline can be validated alongside the agent before
+// cutting over to it. See ocagent.WithMirror.
+type OTLPMirror struct {
+	traces  coltracepb.TraceServiceClient
+	metrics colmetricspb.MetricsServiceClient
+}
+
+var _ ocagent.Mirror = (*OTLPMirror)(nil)
+
+// NewOTLPMirror returns an OTLPMirror sending to the OTLP endpoint that
+// cc is connected to. cc is not closed by the mirror.
+func NewOTLPMirror(cc grpc.ClientConnInterface) *OTLPMirror {
+	return &OTLPMirror{
+		traces:  coltracepb.NewTraceServiceClient(cc),
+		metrics: colmetricspb.NewMetricsServiceClient(cc),
+	}
+}
+
+// MirrorTraces implements ocagent.Mirror.
+func (om *OTLPMirror) MirrorTraces(ctx context.Context, req *ocagenttracepb.ExportTraceServiceRequest) error {
+	_, err := om.traces.Export(ctx, &coltracepb.ExportTraceServiceRequest{ResourceSpans: resourceSpans(req)})
+	return err
+}
+
+// MirrorMetrics implements ocagent.Mirror.
+func (om *OTLPMirror) MirrorMetrics(ctx context.Context, req *ocagentmetricspb.ExportMetricsServiceRequest) error {
+	_, err := om.metrics.Export(ctx, &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: resourceMetrics(req)})
+	return err
+}
+
+var scope = &commonpb.InstrumentationScope{
+	Name:    "contrib.go.opencensus.io/exporter/ocagent",
+	Version: ocagent.Version,
+}
+
+// resourceSpans converts the spans of req, those with a resource of their
+// own going to a ResourceSpans of their own.
+func resourceSpans(req *ocagenttracepb.ExportTraceServiceRequest) []*tracepb.ResourceSpans {
+	shared := &tracepb.ScopeSpans{Scope: scope}
+	rss := []*tracepb.ResourceSpans{{
+		Resource:   resource(req.Node, req.Resource),
+		ScopeSpans: []*tracepb.ScopeSpans{shared},
+	}}
+	for _, span := range req.Spans {
+		if span == nil {
+			continue
+		}
+		if span.Resource == nil {
+			shared.Spans = append(shared.Spans, otlpSpan(span))
+			continue
+		}
+		rss = append(rss, &tracepb.ResourceSpans{
+			Resource: resource(req.Node, span.Resource),
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: scope,
+				Spans: []*tracepb.Span{otlpSpan(span)},
+			}},
+		})
+	}
+	if len(shared.Spans) == 0 {
+		rss = rss[1:]
+	}
+	return rss
+}
+
+func otlpSpan(span *octracepb.Span) *tracepb.Span {
+	attrs, droppedAttrs := attributeMap(span.Attributes)
+	os := &tracepb.Span{
+		TraceId:                span.TraceId,
+		SpanId:                 span.SpanId,
+		TraceState:             traceState(span.Tracestate),
+		ParentSpanId:           span.ParentSpanId,
+		Name:                   span.Name.GetValue(),
+		Kind:                   otlpSpanKind(span.Kind),
+		StartTimeUnixNano:      unixNano(span.StartTime),
+		EndTimeUnixNano:        unixNano(span.EndTime),
+		Attributes:             attrs,
+		DroppedAttributesCount: droppedAttrs,
+		DroppedEventsCount:     uint32(span.TimeEvents.GetDroppedAnnotationsCount() + span.TimeEvents.GetDroppedMessageEventsCount()),
+		DroppedLinksCount:      uint32(span.Links.GetDroppedLinksCount()),
+	}
+	for _, te := range span.TimeEvents.GetTimeEvent() {
+		event := &tracepb.Span_Event{TimeUnixNano: unixNano(te.Time)}
+		if annotation := te.GetAnnotation(); annotation != nil {
+			event.Name = annotation.Description.GetValue()
+			event.Attributes, event.DroppedAttributesCount = attributeMap(annotation.Attributes)
+		} else if me := te.GetMessageEvent(); me != nil {
+			// The semantic conventions of OpenTelemetry for RPC messages.
+			event.Name = "message"
+			event.Attributes = []*commonpb.KeyValue{
+				stringAttribute("message.type", messageEventType(me.Type)),
+				intAttribute("message.id", int64(me.Id)),
+				intAttribute("message.uncompressed_size", int64(me.UncompressedSize)),
+				intAttribute("message.compressed_size", int64(me.CompressedSize)),
+			}
+		}
+		os.Events = append(os.Events, event)
+	}
+	for _, link := range span.Links.GetLink() {
+		ol := &tracepb.Span_Link{
+			TraceId:    link.TraceId,
+			SpanId:     link.SpanId,
+			TraceState: traceState(link.Tracestate),
+		}
+		ol.Attributes, ol.DroppedAttributesCount = attributeMap(link.Attributes)
+		os.Links = append(os.Links, ol)
+	}
+	if status := span.Status; status != nil {
+		os.Status = &tracepb.Status{Message: status.Message}
+		if status.Code != 0 {
+			os.Status.Code = tracepb.Status_STATUS_CODE_ERROR
+		}
+	}
+	return os
+}
+
+func otlpSpanKind(kind octracepb.Span_SpanKind) tracepb.Span_SpanKind {
+	switch kind {
+	case octracepb.Span_SERVER:
+		return tracepb.Span_SPAN_KIND_SERVER
+	case octracepb.Span_CLIENT:
+		return tracepb.Span_SPAN_KIND_CLIENT
+	default:
+		return tracepb.Span_SPAN_KIND_UNSPECIFIED
+	}
+}
+
+func messageEventType(t octracepb.Span_TimeEvent_MessageEvent_Type) string {
+	switch t {
+	case octracepb.Span_TimeEvent_MessageEvent_SENT:
+		return "SENT"
+	case octracepb.Span_TimeEvent_MessageEvent_RECEIVED:
+		return "RECEIVED"
+	default:
+		return "UNSPECIFIED"
+	}
+}
+
+// traceState encodes ts in its W3C form, which is that of OTLP.
+func traceState(ts *octracepb.Span_Tracestate) string {
+	members := make([]string, 0, len(ts.GetEntries()))
+	for _, entry := range ts.GetEntries() {
+		members = append(members, entry.Key+"="+entry.Value)
+	}
+	return strings.Join(members, ",")
+}
+
+func attributeMap(attrs *octracepb.Span_Attributes) ([]*commonpb.KeyValue, uint32) {
+	if attrs == nil {
+		return nil, 0
+	}
+	kvs := make([]*commonpb.KeyValue, 0, len(attrs.AttributeMap))
+	for key, value := range attrs.AttributeMap {
+		kv := &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{}}
+		switch v := value.GetValue().(type) {
+		case *octracepb.AttributeValue_StringValue:
+			kv.Value.Value = &commonpb.AnyValue_StringValue{StringValue: v.StringValue.GetValue()}
+		case *octracepb.AttributeValue_IntValue:
+			kv.Value.Value = &commonpb.AnyValue_IntValue{IntValue: v.IntValue}
+		case *octracepb.AttributeValue_BoolValue:
+			kv.Value.Value = &commonpb.AnyValue_BoolValue{BoolValue: v.BoolValue}
+		case *octracepb.AttributeValue_DoubleValue:
+			kv.Value.Value = &commonpb.AnyValue_DoubleValue{DoubleValue: v.DoubleValue}
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs, uint32(attrs.DroppedAttributesCount)
+}
+
+// resource converts the identification of the exporter to an OTLP resource,
+// with the attributes of the OpenTelemetry semantic conventions.
+func resource(node *occommonpb.Node, res *ocresourcepb.Resource) *resourcepb.Resource {
+	r := &resourcepb.Resource{}
+	if name := node.GetServiceInfo().GetName(); name != "" {
+		r.Attributes = append(r.Attributes, stringAttribute("service.name", name))
+	}
+	if host := node.GetIdentifier().GetHostName(); host != "" {
+		r.Attributes = append(r.Attributes, stringAttribute("host.name", host))
+	}
+	if pid := node.GetIdentifier().GetPid(); pid != 0 {
+		r.Attributes = append(r.Attributes, intAttribute("process.pid", int64(pid)))
+	}
+	for key, value := range node.GetAttributes() {
+		r.Attributes = append(r.Attributes, stringAttribute(key, value))
+	}
+	if t := res.GetType(); t != "" {
+		r.Attributes = append(r.Attributes, stringAttribute("opencensus.resourcetype", t))
+	}
+	for key, value := range res.GetLabels() {
+		r.Attributes = append(r.Attributes, stringAttribute(key, value))
+	}
+	return r
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func intAttribute(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}}}
+}
+
+func unixNano(ts *timestamp.Timestamp) uint64 {
+	if ts == nil {
+		return 0
+	}
+	return uint64(ts.Seconds)*1e9 + uint64(ts.Nanos)
+}
+
+// resourceMetrics converts the metrics of req, those with a resource of
+// their own going to a ResourceMetrics of their own. Metrics of an
+// UNSPECIFIED type are dropped.
+func resourceMetrics(req *ocagentmetricspb.ExportMetricsServiceRequest) []*metricspb.ResourceMetrics {
+	shared := &metricspb.ScopeMetrics{Scope: scope}
+	rms := []*metricspb.ResourceMetrics{{
+		Resource:     resource(req.Node, req.Resource),
+		ScopeMetrics: []*metricspb.ScopeMetrics{shared},
+	}}
+	for _, metric := range req.Metrics {
+		om := otlpMetric(metric)
+		if om == nil {
+			continue
+		}
+		if metric.Resource == nil {
+			shared.Metrics = append(shared.Metrics, om)
+			continue
+		}
+		rms = append(rms, &metricspb.ResourceMetrics{
+			Resource: resource(req.Node, metric.Resource),
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   scope,
+				Metrics: []*metricspb.Metric{om},
+			}},
+		})
+	}
+	if len(shared.Metrics) == 0 {
+		rms = rms[1:]
+	}
+	return rms
+}
+
+func otlpMetric(metric *ocmetricspb.Metric) *metricspb.Metric {
+	md := metric.GetMetricDescriptor()
+	if md == nil {
+		return nil
+	}
+	om := &metricspb.Metric{
+		Name:        md.Name,
+		Description: md.Description,
+		Unit:        md.Unit,
+	}
+	keys := md.LabelKeys
+	switch md.Type {
+	case ocmetricspb.MetricDescriptor_GAUGE_INT64, ocmetricspb.MetricDescriptor_GAUGE_DOUBLE:
+		om.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: numberDataPoints(keys, metric.Timeseries),
+		}}
+	case ocmetricspb.MetricDescriptor_CUMULATIVE_INT64, ocmetricspb.MetricDescriptor_CUMULATIVE_DOUBLE:
+		om.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			DataPoints:             numberDataPoints(keys, metric.Timeseries),
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	case ocmetricspb.MetricDescriptor_GAUGE_DISTRIBUTION:
+		om.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             histogramDataPoints(keys, metric.Timeseries),
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+		}}
+	case ocmetricspb.MetricDescriptor_CUMULATIVE_DISTRIBUTION:
+		om.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints:             histogramDataPoints(keys, metric.Timeseries),
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}}
+	case ocmetricspb.MetricDescriptor_SUMMARY:
+		om.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+			DataPoints: summaryDataPoints(keys, metric.Timeseries),
+		}}
+	default:
+		return nil
+	}
+	return om
+}
+
+// labels converts the label values of a time series, those without a value
+// being left out.
+func labels(keys []*ocmetricspb.LabelKey, values []*ocmetricspb.LabelValue) []*commonpb.KeyValue {
+	var attrs []*commonpb.KeyValue
+	for i, key := range keys {
+		if i < len(values) && values[i].GetHasValue() {
+			attrs = append(attrs, stringAttribute(key.Key, values[i].Value))
+		}
+	}
+	return attrs
+}
+
+func numberDataPoints(keys []*ocmetricspb.LabelKey, timeseries []*ocmetricspb.TimeSeries) []*metricspb.NumberDataPoint {
+	var dps []*metricspb.NumberDataPoint
+	for _, ts := range timeseries {
+		attrs := labels(keys, ts.LabelValues)
+		for _, point := range ts.Points {
+			dp := &metricspb.NumberDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: unixNano(ts.StartTimestamp),
+				TimeUnixNano:      unixNano(point.Timestamp),
+			}
+			switch value := point.Value.(type) {
+			case *ocmetricspb.Point_Int64Value:
+				dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: value.Int64Value}
+			case *ocmetricspb.Point_DoubleValue:
+				dp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: value.DoubleValue}
+			default:
+				continue
+			}
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
+
+func histogramDataPoints(keys []*ocmetricspb.LabelKey, timeseries []*ocmetricspb.TimeSeries) []*metricspb.HistogramDataPoint {
+	var dps []*metricspb.HistogramDataPoint
+	for _, ts := range timeseries {
+		attrs := labels(keys, ts.LabelValues)
+		for _, point := range ts.Points {
+			dv := point.GetDistributionValue()
+			if dv == nil {
+				continue
+			}
+			sum := dv.Sum
+			dp := &metricspb.HistogramDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: unixNano(ts.StartTimestamp),
+				TimeUnixNano:      unixNano(point.Timestamp),
+				Count:             uint64(dv.Count),
+				Sum:               &sum,
+				ExplicitBounds:    dv.GetBucketOptions().GetExplicit().GetBounds(),
+			}
+			for _, bucket := range dv.Buckets {
+				dp.BucketCounts = append(dp.BucketCounts, uint64(bucket.Count))
+			}
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
+
+func summaryDataPoints(keys []*ocmetricspb.LabelKey, timeseries []*ocmetricspb.TimeSeries) []*metricspb.SummaryDataPoint {
+	var dps []*metricspb.SummaryDataPoint
+	for _, ts := range timeseries {
+		attrs := labels(keys, ts.LabelValues)
+		for _, point := range ts.Points {
+			sv := point.GetSummaryValue()
+			if sv == nil {
+				continue
+			}
+			dp := &metricspb.SummaryDataPoint{
+				Attributes:        attrs,
+				StartTimeUnixNano: unixNano(ts.StartTimestamp),
+				TimeUnixNano:      unixNano(point.Timestamp),
+				Count:             uint64(sv.Count.GetValue()),
+				Sum:               sv.Sum.GetValue(),
+			}
+			// OpenCensus percentiles are in (0, 100], OTLP quantiles in [0, 1].
+			for _, vp := range sv.Snapshot.GetPercentileValues() {
+				dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+					Quantile: vp.Percentile / 100,
+					Value:    vp.Value,
+				})
+			}
+			dps = append(dps, dp)
+		}
+	}
+	return dps
+}
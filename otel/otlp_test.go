@@ -0,0 +1,209 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opencensus.io/trace"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+
+	occommonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+	ocagentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	ocagenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	ocmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	octracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+func TestResourceSpans(t *testing.T) {
+	req := &ocagenttracepb.ExportTraceServiceRequest{
+		Node: &occommonpb.Node{ServiceInfo: &occommonpb.ServiceInfo{Name: "svc"}},
+		Spans: []*octracepb.Span{{
+			TraceId:   []byte{1, 2},
+			SpanId:    []byte{3},
+			Name:      &octracepb.TruncatableString{Value: "span"},
+			Kind:      octracepb.Span_CLIENT,
+			StartTime: &timestamp.Timestamp{Seconds: 1, Nanos: 2},
+			Tracestate: &octracepb.Span_Tracestate{Entries: []*octracepb.Span_Tracestate_Entry{
+				{Key: "a", Value: "1"}, {Key: "b", Value: "2"},
+			}},
+			Attributes: &octracepb.Span_Attributes{
+				AttributeMap: map[string]*octracepb.AttributeValue{
+					"n": {Value: &octracepb.AttributeValue_IntValue{IntValue: 7}},
+				},
+				DroppedAttributesCount: 3,
+			},
+			Status: &octracepb.Status{Code: 5, Message: "not found"},
+		}},
+	}
+
+	rss := resourceSpans(req)
+	if len(rss) != 1 {
+		t.Fatalf("Got %d ResourceSpans, want 1", len(rss))
+	}
+	if attr := rss[0].Resource.Attributes[0]; attr.Key != "service.name" || attr.Value.GetStringValue() != "svc" {
+		t.Errorf("Resource: got %v, want service.name=svc", attr)
+	}
+	span := rss[0].ScopeSpans[0].Spans[0]
+	if span.Name != "span" || span.Kind != tracepb.Span_SPAN_KIND_CLIENT || span.StartTimeUnixNano != 1e9+2 {
+		t.Errorf("Span: got %v", span)
+	}
+	if span.TraceState != "a=1,b=2" {
+		t.Errorf("TraceState: got %q, want %q", span.TraceState, "a=1,b=2")
+	}
+	if len(span.Attributes) != 1 || span.Attributes[0].Value.GetIntValue() != 7 || span.DroppedAttributesCount != 3 {
+		t.Errorf("Attributes: got %v, %d dropped", span.Attributes, span.DroppedAttributesCount)
+	}
+	if span.Status.Code != tracepb.Status_STATUS_CODE_ERROR || span.Status.Message != "not found" {
+		t.Errorf("Status: got %v", span.Status)
+	}
+}
+
+func TestResourceMetrics(t *testing.T) {
+	keys := []*ocmetricspb.LabelKey{{Key: "method"}, {Key: "missing"}}
+	values := []*ocmetricspb.LabelValue{{Value: "Get", HasValue: true}, {}}
+	req := &ocagentmetricspb.ExportMetricsServiceRequest{
+		Metrics: []*ocmetricspb.Metric{
+			{
+				MetricDescriptor: &ocmetricspb.MetricDescriptor{
+					Name:      "calls",
+					Type:      ocmetricspb.MetricDescriptor_CUMULATIVE_INT64,
+					LabelKeys: keys,
+				},
+				Timeseries: []*ocmetricspb.TimeSeries{{
+					LabelValues: values,
+					Points:      []*ocmetricspb.Point{{Value: &ocmetricspb.Point_Int64Value{Int64Value: 4}}},
+				}},
+			},
+			{
+				MetricDescriptor: &ocmetricspb.MetricDescriptor{
+					Name: "latency",
+					Type: ocmetricspb.MetricDescriptor_SUMMARY,
+				},
+				Timeseries: []*ocmetricspb.TimeSeries{{
+					Points: []*ocmetricspb.Point{{Value: &ocmetricspb.Point_SummaryValue{SummaryValue: &ocmetricspb.SummaryValue{
+						Count: &wrappers.Int64Value{Value: 2},
+						Snapshot: &ocmetricspb.SummaryValue_Snapshot{
+							PercentileValues: []*ocmetricspb.SummaryValue_Snapshot_ValueAtPercentile{{Percentile: 99, Value: 10}},
+						},
+					}}}},
+				}},
+			},
+			{MetricDescriptor: &ocmetricspb.MetricDescriptor{Name: "unspecified"}},
+		},
+	}
+
+	rms := resourceMetrics(req)
+	metrics := rms[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("Got %d metrics, want 2 as UNSPECIFIED ones are dropped", len(metrics))
+	}
+	sum := metrics[0].GetSum()
+	if sum == nil || !sum.IsMonotonic || sum.DataPoints[0].GetAsInt() != 4 {
+		t.Errorf("Cumulative: got %v", metrics[0])
+	}
+	if attrs := sum.DataPoints[0].Attributes; len(attrs) != 1 || attrs[0].Key != "method" {
+		t.Errorf("Attributes: got %v, want only method", attrs)
+	}
+	dp := metrics[1].GetSummary().GetDataPoints()[0]
+	if dp.Count != 2 || dp.QuantileValues[0].Quantile != 0.99 || dp.QuantileValues[0].Value != 10 {
+		t.Errorf("Summary: got %v", dp)
+	}
+}
+
+type otlpTraceServer struct {
+	coltracepb.UnimplementedTraceServiceServer
+
+	mu   sync.Mutex
+	reqs []*coltracepb.ExportTraceServiceRequest
+}
+
+func (s *otlpTraceServer) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func TestOTLPMirror(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	ots := new(otlpTraceServer)
+	srv := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(srv, ots)
+	colmetricspb.RegisterMetricsServiceServer(srv, colmetricspb.UnimplementedMetricsServiceServer{})
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to dial the OTLP endpoint: %v", err)
+	}
+	defer cc.Close()
+
+	// The agent isn't running: the mirror still receives the spans.
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress("localhost:1"),
+		ocagent.WithServiceName("mirrored"),
+		ocagent.WithMirror(NewOTLPMirror(cc)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{
+		SpanContext: trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+		Name:        "span",
+		StartTime:   time.Now(),
+		EndTime:     time.Now(),
+	})
+	exp.Flush()
+
+	ots.mu.Lock()
+	defer ots.mu.Unlock()
+	if len(ots.reqs) != 1 {
+		t.Fatalf("Got %d OTLP requests, want 1", len(ots.reqs))
+	}
+	rs := ots.reqs[0].ResourceSpans[0]
+	if got := rs.ScopeSpans[0].Spans[0].Name; got != "span" {
+		t.Errorf("Span name: got %q, want %q", got, "span")
+	}
+	var service string
+	for _, attr := range rs.Resource.Attributes {
+		if attr.Key == "service.name" {
+			service = attr.Value.GetStringValue()
+		}
+	}
+	if service != "mirrored" {
+		t.Errorf("service.name: got %q, want %q", service, "mirrored")
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import "time"
+
+// preset is a set of options applied in order, as a single option.
+type preset []ExporterOption
+
+var _ ExporterOption = (*preset)(nil)
+
+func (p preset) withExporter(e *Exporter) {
+	for _, opt := range p {
+		opt.withExporter(e)
+	}
+}
+
+// WithHighThroughputPreset tunes the exporter for services that produce many
+// spans and metrics, trading latency for fewer, larger batches: they are sent
+// every 5s or 1000 items, with a 64MiB buffer of spans, and failed batches
+// are retried up to 5 times. Options passed after it override its settings.
+func WithHighThroughputPreset() ExporterOption {
+	return preset{
+		WithTraceBundlerOptions(BundlerOptions{
+			DelayThreshold:       5 * time.Second,
+			BundleCountThreshold: 1000,
+			BufferedByteLimit:    64 << 20,
+		}),
+		WithViewDataBundlerOptions(BundlerOptions{
+			DelayThreshold:       5 * time.Second,
+			BundleCountThreshold: 1000,
+		}),
+		WithRetry(RetryParams{
+			MaxAttempts: 5,
+			Backoff:     ExponentialBackoff{Initial: 200 * time.Millisecond, Max: 10 * time.Second},
+		}),
+	}
+}
+
+// WithLowLatencyPreset tunes the exporter for spans and metrics to reach the
+// agent quickly: they are sent every 100ms or 50 items, a failed batch is
+// retried once, and the exporter reconnects to the agent every second.
+// Options passed after it override its settings.
+func WithLowLatencyPreset() ExporterOption {
+	return preset{
+		WithTraceBundlerOptions(BundlerOptions{
+			DelayThreshold:       100 * time.Millisecond,
+			BundleCountThreshold: 50,
+		}),
+		WithViewDataBundlerOptions(BundlerOptions{
+			DelayThreshold:       100 * time.Millisecond,
+			BundleCountThreshold: 50,
+		}),
+		WithRetry(RetryParams{
+			MaxAttempts:    2,
+			Backoff:        ConstantBackoff{Period: 50 * time.Millisecond},
+			MaxElapsedTime: time.Second,
+		}),
+		WithReconnectionPeriod(time.Second),
+	}
+}
+
+// WithServerlessPreset tunes the exporter for short-lived processes, such as
+// functions, CLIs or cron jobs: the agent is only dialed on the first export,
+// as with WithLazyConnection, batches are sent every 200ms or 100 items, with
+// an 8MiB buffer of spans, the batches of ExportTraceServiceRequest are sent
+// with unary RPCs that time out after 5s, retries give up after 2s, and the
+// exporter is flushed on exit, as with WithFlushOnExit. Options passed after
+// it override its settings.
+func WithServerlessPreset() ExporterOption {
+	return preset{
+		WithLazyConnection(),
+		WithTraceBundlerOptions(BundlerOptions{
+			DelayThreshold:       200 * time.Millisecond,
+			BundleCountThreshold: 100,
+			BufferedByteLimit:    8 << 20,
+		}),
+		WithViewDataBundlerOptions(BundlerOptions{
+			DelayThreshold:       200 * time.Millisecond,
+			BundleCountThreshold: 100,
+		}),
+		WithUnaryBatchExporter(UnaryExporterParams{Timeout: 5 * time.Second}),
+		WithRetry(RetryParams{
+			MaxAttempts:    2,
+			Backoff:        ConstantBackoff{Period: 100 * time.Millisecond},
+			MaxElapsedTime: 2 * time.Second,
+		}),
+		WithFlushOnExit(),
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresets(t *testing.T) {
+	exp, err := NewUnstartedExporter(WithInsecure(), WithServerlessPreset())
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	if !exp.lazyConnection || !exp.flushOnExit || !exp.useUnaryBatchExporter {
+		t.Errorf("The serverless preset doesn't connect lazily, flush on exit and export unary batches")
+	}
+	if got := exp.traceBundler.DelayThreshold; got != 200*time.Millisecond {
+		t.Errorf("DelayThreshold = %v, want 200ms", got)
+	}
+
+	// The options that follow a preset override it.
+	exp, err = NewUnstartedExporter(
+		WithInsecure(),
+		WithHighThroughputPreset(),
+		WithTraceBundlerOptions(BundlerOptions{DelayThreshold: time.Second}))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	if got := exp.traceBundler.DelayThreshold; got != time.Second {
+		t.Errorf("DelayThreshold = %v, want 1s", got)
+	}
+	if got := exp.viewDataBundler.BundleCountThreshold; got != 1000 {
+		t.Errorf("BundleCountThreshold = %d, want 1000", got)
+	}
+	if exp.retryParams == nil || exp.retryParams.MaxAttempts != 5 {
+		t.Errorf("Got retry params %+v, want 5 attempts", exp.retryParams)
+	}
+}
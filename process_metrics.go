@@ -0,0 +1,104 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// ProcessMetricsPrefix prefixes the names of the metrics of WithProcessMetrics.
+const ProcessMetricsPrefix = "process/"
+
+var (
+	cpuSecondsDescriptor = &metricspb.MetricDescriptor{
+		Name:        ProcessMetricsPrefix + "cpu_seconds",
+		Description: "User and system CPU time spent by the process",
+		Unit:        "s",
+		Type:        metricspb.MetricDescriptor_CUMULATIVE_DOUBLE,
+	}
+	residentMemoryDescriptor = &metricspb.MetricDescriptor{
+		Name:        ProcessMetricsPrefix + "resident_memory",
+		Description: "Resident set size of the process",
+		Unit:        "By",
+		Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+	}
+	openFDsDescriptor = &metricspb.MetricDescriptor{
+		Name:        ProcessMetricsPrefix + "open_fds",
+		Description: "Number of file descriptors open in the process",
+		Unit:        "1",
+		Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+	}
+)
+
+// processStats are the resources used by the process, as read from the OS.
+type processStats struct {
+	cpuSeconds     float64
+	residentMemory int64
+	openFDs        int64
+}
+
+// processMetrics returns the metrics of stats at now.
+func processMetrics(now time.Time, stats processStats) []*metricspb.Metric {
+	ts := transform.Timestamp(now)
+	gauge := func(descriptor *metricspb.MetricDescriptor, value int64) *metricspb.Metric {
+		return &metricspb.Metric{
+			MetricDescriptor: descriptor,
+			Timeseries: []*metricspb.TimeSeries{{
+				Points: []*metricspb.Point{{Timestamp: ts, Value: &metricspb.Point_Int64Value{Int64Value: value}}},
+			}},
+		}
+	}
+
+	return []*metricspb.Metric{
+		{
+			MetricDescriptor: cpuSecondsDescriptor,
+			Timeseries: []*metricspb.TimeSeries{{
+				StartTimestamp: transform.Timestamp(startTime),
+				Points:         []*metricspb.Point{{Timestamp: ts, Value: &metricspb.Point_DoubleValue{DoubleValue: stats.cpuSeconds}}},
+			}},
+		},
+		gauge(residentMemoryDescriptor, stats.residentMemory),
+		gauge(openFDsDescriptor, stats.openFDs),
+	}
+}
+
+// collectProcessMetrics exports the process metrics every process metrics
+// interval, until stopCh is closed or they fail to be read, as they do on
+// the platforms other than Linux.
+func (ae *Exporter) collectProcessMetrics(stopCh <-chan bool) {
+	ticker := time.NewTicker(ae.processMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case now := <-ticker.C:
+			stats, err := readProcessStats()
+			if err != nil {
+				if ae.logger != nil {
+					ae.logger("ocagent: failed to read the process metrics: %v", err)
+				}
+				return
+			}
+			ae.uploadMetrics(processMetrics(now, stats))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package ocagent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func readProcessStats() (processStats, error) {
+	var stats processStats
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return stats, err
+	}
+	cpu := time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+	stats.cpuSeconds = cpu.Seconds()
+
+	// The second field of statm is the resident set size, in pages.
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return stats, err
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return stats, fmt.Errorf("unexpected /proc/self/statm: %q", statm)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return stats, err
+	}
+	stats.residentMemory = pages * int64(os.Getpagesize())
+
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return stats, err
+	}
+	stats.openFDs = int64(len(fds))
+	return stats, nil
+}
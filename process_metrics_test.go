@@ -0,0 +1,60 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	metrics := processMetrics(startTime.Add(time.Minute), processStats{cpuSeconds: 1.5, residentMemory: 4096, openFDs: 9})
+
+	got := make(map[string]float64)
+	for _, metric := range metrics {
+		pt := metric.Timeseries[0].Points[0]
+		got[metric.GetMetricDescriptor().GetName()] = float64(pt.GetInt64Value()) + pt.GetDoubleValue()
+	}
+	want := map[string]float64{
+		ProcessMetricsPrefix + "cpu_seconds":     1.5,
+		ProcessMetricsPrefix + "resident_memory": 4096,
+		ProcessMetricsPrefix + "open_fds":        9,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got metrics %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s: got %v, want %v", name, got[name], value)
+		}
+	}
+}
+
+func TestReadProcessStats(t *testing.T) {
+	stats, err := readProcessStats()
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Error("Expected an error outside of Linux")
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Failed to read the process stats: %v", err)
+	}
+	if stats.residentMemory <= 0 || stats.openFDs <= 0 {
+		t.Errorf("Implausible process stats: %+v", stats)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+
+	commonpb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/common/v1"
+)
+
+// ReconnectsAttributeKey is the key of the node attribute holding the number
+// of times the exporter re-established its streams to the agent, so that
+// agent operators can spot flapping clients.
+const ReconnectsAttributeKey = "ocagent.reconnects"
+
+// The self-metric of the reconnections. Register ReconnectsView to export it.
+var (
+	MeasureReconnects = stats.Int64(
+		"contrib.go.opencensus.io/exporter/ocagent/reconnects",
+		"Number of times the exporter re-established its streams to the agent",
+		stats.UnitDimensionless)
+
+	ReconnectsView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/reconnects",
+		Description: "Number of times the exporter re-established its streams to the agent",
+		Measure:     MeasureReconnects,
+		Aggregation: view.Sum(),
+	}
+)
+
+// countConnection is invoked whenever the streams to the agent
+// are established, every time but the first is a reconnection.
+func (ae *Exporter) countConnection() {
+	if atomic.CompareAndSwapInt32(&ae.connectedOnce, 0, 1) {
+		return
+	}
+	atomic.AddInt64(&ae.counters.reconnects, 1)
+	stats.Record(context.Background(), MeasureReconnects.M(1))
+}
+
+// connectionNode returns node, with the number of reconnections
+// that the streams about to be opened will account for.
+func (ae *Exporter) connectionNode(node *commonpb.Node) *commonpb.Node {
+	reconnects := atomic.LoadInt64(&ae.counters.reconnects) + int64(atomic.LoadInt32(&ae.connectedOnce))
+
+	cp := *node
+	cp.Attributes = make(map[string]string, len(node.Attributes)+1)
+	for k, v := range node.Attributes {
+		cp.Attributes[k] = v
+	}
+	cp.Attributes[ReconnectsAttributeKey] = strconv.FormatInt(reconnects, 10)
+	return &cp
+}
@@ -0,0 +1,42 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+)
+
+func TestConnectionNode(t *testing.T) {
+	ae := new(Exporter)
+	node := NodeWithStartTime("svc")
+	node.Attributes["a"] = "b"
+
+	for i, want := range []string{"0", "1", "2"} {
+		got := ae.connectionNode(node)
+		if g := got.Attributes[ReconnectsAttributeKey]; g != want {
+			t.Errorf("Connection #%d: got %q want %q", i, g, want)
+		}
+		if g := got.Attributes["a"]; g != "b" {
+			t.Errorf("Connection #%d: attribute a: got %q want %q", i, g, "b")
+		}
+		ae.countConnection()
+	}
+	if _, ok := node.Attributes[ReconnectsAttributeKey]; ok {
+		t.Error("The node of the exporter was modified")
+	}
+	if g, w := ae.counters.reconnects, int64(2); g != w {
+		t.Errorf("reconnects: got %d want %d", g, w)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// ReloadConfigFile reads the file at path, in the format of LoadConfigFile,
+// and applies to the live exporter the settings that changed since the last
+// reload among address, headers, trace_headers, metrics_headers, tls,
+// trace_batching and view_data_batching. The other settings are ignored, and
+// a setting removed from the file keeps its current value. If the address,
+// the headers or the TLS settings changed, the exporter reconnects to the
+// agent right away, like Reconnect. Nothing is applied if the file is
+// invalid, or if the TLS settings are set on an exporter that was created
+// WithInsecure. The address is applied last, like SetAgentAddress, and the
+// other settings remain applied if it fails.
+func (ae *Exporter) ReloadConfigFile(path string) error {
+	cfg, err := LoadExporterConfig(path)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("ocagent: config file %q: %v", path, err)
+	}
+
+	ae.reloadMu.Lock()
+	defer ae.reloadMu.Unlock()
+
+	prev := ae.reloadedConfig
+	if prev == nil {
+		prev = new(ExporterConfig)
+	}
+	changed := make(map[string]bool)
+	for _, setting := range prev.Diff(cfg) {
+		changed[setting] = true
+	}
+
+	var creds credentials.TransportCredentials
+	if changed["tls"] && cfg.TLS != nil {
+		if creds, err = credentials.NewClientTLSFromFile(cfg.TLS.CAFile, cfg.TLS.ServerName); err != nil {
+			return fmt.Errorf("ocagent: config file %q: %v", path, err)
+		}
+	}
+
+	var opts []ExporterOption
+	if changed["headers"] && cfg.Headers != nil {
+		opts = append(opts, WithHeaders(cfg.Headers))
+	}
+	if changed["trace_headers"] && cfg.TraceHeaders != nil {
+		opts = append(opts, WithTraceHeaders(cfg.TraceHeaders))
+	}
+	if changed["metrics_headers"] && cfg.MetricsHeaders != nil {
+		opts = append(opts, WithMetricsHeaders(cfg.MetricsHeaders))
+	}
+	reconnect := len(opts) > 0
+	if b := cfg.TraceBatching; changed["trace_batching"] && b != nil {
+		opts = append(opts, WithTraceBundlerOptions(b.bundlerOptions()))
+	}
+	if b := cfg.ViewDataBatching; changed["view_data_batching"] && b != nil {
+		opts = append(opts, WithViewDataBundlerOptions(b.bundlerOptions()))
+	}
+
+	if creds != nil {
+		if err := ae.setTransportCredentials(creds); err != nil {
+			return err
+		}
+		reconnect = true
+	}
+	if err := ae.UpdateOptions(opts...); err != nil {
+		return err
+	}
+	if changed["address"] && cfg.Address != "" {
+		// SetAgentAddress reconnects on its own.
+		if err := ae.SetAgentAddress(cfg.Address); err != nil {
+			return err
+		}
+		reconnect = false
+	}
+	if reconnect {
+		ae.mu.RLock()
+		started := ae.started
+		ae.mu.RUnlock()
+		if started {
+			ae.redial(errConfigReloaded)
+		}
+	}
+
+	ae.reloadedConfig = cfg
+	return nil
+}
+
+var errConfigReloaded = errors.New("configuration reloaded")
+
+// setTransportCredentials makes the exporter dial the agent with creds.
+func (ae *Exporter) setTransportCredentials(creds credentials.TransportCredentials) error {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+
+	switch {
+	case ae.stopped:
+		return errStopped
+	case ae.canDialInsecure:
+		return errors.New("ocagent: TLS can't be enabled on an exporter created WithInsecure")
+	}
+	ae.clientTransportCredentials = creds
+	ae.tlsFromAddress = false
+	return nil
+}
+
+// ReloadConfigOnSignal invokes ReloadConfigFile with path whenever the process
+// receives one of signals, SIGHUP by default, so that operators can retarget
+// the exporter, e.g. to another agent, without restarting the service. The
+// reloads that fail are logged with the logger of WithLogger. The returned
+// function stops intercepting the signals.
+func (ae *Exporter) ReloadConfigOnSignal(path string, signals ...os.Signal) (cancel func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	sigCh := make(chan os.Signal, 1)
+	doneCh := make(chan struct{})
+	signal.Notify(sigCh, signals...)
+
+	go func() {
+		for {
+			select {
+			case <-doneCh:
+				return
+			case <-sigCh:
+				if err := ae.ReloadConfigFile(path); err != nil && ae.logger != nil {
+					ae.logger("ocagent: failed to reload the config file: %v", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(doneCh)
+		})
+	}
+}
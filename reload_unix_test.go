@@ -0,0 +1,112 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package ocagent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+func TestExporter_ReloadConfigOnSignal(t *testing.T) {
+	startAgent := func() (*metricsAgent, string, func()) {
+		ln, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("Failed to get an available TCP address: %v", err)
+		}
+		ma := new(metricsAgent)
+		srv := grpc.NewServer()
+		agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+		return ma, ln.Addr().String(), srv.Stop
+	}
+	_, firstAddr, stopFirst := startAgent()
+	defer stopFirst()
+	second, secondAddr, stopSecond := startAgent()
+	defer stopSecond()
+
+	dir, err := ioutil.TempDir("", "ocagent-reload")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	config := fmt.Sprintf(`
+address: %q
+service_name: "ignored"
+headers:
+  api-key: "rotated"
+trace_batching:
+  count: 10
+`, secondAddr)
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write the config file: %v", err)
+	}
+
+	ocexp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(firstAddr),
+		WithServiceName("frontend"),
+		// Long enough that only the reload can trigger the reconnection.
+		WithReconnectionPeriod(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	cancel := ocexp.ReloadConfigOnSignal(path, syscall.SIGUSR2)
+	defer cancel()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatalf("Failed to send the signal: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for requests := 0; requests == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("The exporter did not connect to the agent of the reloaded config")
+		}
+		time.Sleep(10 * time.Millisecond)
+		second.forEachRequest(func(*agentmetricspb.ExportMetricsServiceRequest) {
+			requests++
+		})
+	}
+
+	ocexp.mu.RLock()
+	defer ocexp.mu.RUnlock()
+	if got := ocexp.headers["api-key"]; got != "rotated" {
+		t.Errorf("api-key header = %q, want %q", got, "rotated")
+	}
+	if got := ocexp.traceBundlerOptions.BundleCountThreshold; got != 10 {
+		t.Errorf("BundleCountThreshold = %d, want 10", got)
+	}
+	if ocexp.serviceName != "frontend" {
+		t.Errorf("The service name was reloaded: %q", ocexp.serviceName)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// maxReplayRecordSize bounds the size of a request read back by Replay.
+const maxReplayRecordSize = 64 << 20
+
+// Replay sends the requests recorded in the file at path by WithTeeFile, in
+// either format, through the exporter, in the order in which they were
+// recorded, e.g. to backfill the agent after an outage or to load test it.
+// The trace requests are exported like with ExportTraceServiceRequestContext,
+// and the metrics requests like with ExportMetricsServiceRequest. Replay stops
+// at the first request that fails to be read or exported, or once ctx is done,
+// and returns the number of requests replayed so far, so that a replay can be
+// resumed.
+func (ae *Exporter) Replay(ctx context.Context, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("ocagent: replay: %v", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	next := readProtoRecord
+	if first, err := r.Peek(1); err == nil && first[0] == '{' {
+		next = newJSONRecordReader()
+	}
+
+	n := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		signal, req, err := next(r)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("ocagent: replay: request #%d: %v", n, err)
+		}
+		switch req := req.(type) {
+		case *agenttracepb.ExportTraceServiceRequest:
+			err = ae.ExportTraceServiceRequestContext(ctx, req)
+		case *agentmetricspb.ExportMetricsServiceRequest:
+			err = ae.ExportMetricsServiceRequest(req)
+		}
+		if err != nil {
+			return n, fmt.Errorf("ocagent: replay: %s request #%d: %v", signal, n, err)
+		}
+		n++
+	}
+}
+
+// newReplayRequest returns an empty request of signal.
+func newReplayRequest(signal string) (proto.Message, error) {
+	switch signal {
+	case teeSignalTraces:
+		return new(agenttracepb.ExportTraceServiceRequest), nil
+	case teeSignalMetrics:
+		return new(agentmetricspb.ExportMetricsServiceRequest), nil
+	}
+	return nil, fmt.Errorf("unknown signal %q", signal)
+}
+
+// readProtoRecord reads the next request written in the TeeFormatProto format.
+func readProtoRecord(r *bufio.Reader) (string, proto.Message, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	signal := teeSignalMetrics
+	if b == teeSignalTraces[0] {
+		signal = teeSignalTraces
+	} else if b != teeSignalMetrics[0] {
+		return "", nil, fmt.Errorf("unknown signal %q", b)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", nil, unexpectedEOF(err)
+	}
+	if size > maxReplayRecordSize {
+		return "", nil, fmt.Errorf("request of %d bytes is too large", size)
+	}
+	blob := make([]byte, size)
+	if _, err := io.ReadFull(r, blob); err != nil {
+		return "", nil, unexpectedEOF(err)
+	}
+	req, _ := newReplayRequest(signal)
+	if err := proto.Unmarshal(blob, req); err != nil {
+		return "", nil, err
+	}
+	return signal, req, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// newJSONRecordReader returns a reader of the requests
+// written in the TeeFormatJSON format, one per line.
+func newJSONRecordReader() func(*bufio.Reader) (string, proto.Message, error) {
+	var scanner *bufio.Scanner
+	return func(r *bufio.Reader) (string, proto.Message, error) {
+		if scanner == nil {
+			scanner = bufio.NewScanner(r)
+			scanner.Buffer(nil, maxReplayRecordSize)
+		}
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var rec struct {
+				Signal  string          `json:"signal"`
+				Request json.RawMessage `json:"request"`
+			}
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return "", nil, err
+			}
+			req, err := newReplayRequest(rec.Signal)
+			if err != nil {
+				return "", nil, err
+			}
+			if err := jsonpb.Unmarshal(bytes.NewReader(rec.Request), req); err != nil {
+				return "", nil, err
+			}
+			return rec.Signal, req, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return "", nil, err
+		}
+		return "", nil, io.EOF
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestExporter_Replay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-replay")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, format := range []ocagent.TeeFormat{ocagent.TeeFormatProto, ocagent.TeeFormatJSON} {
+		path := filepath.Join(dir, "requests")
+
+		// Record two requests.
+		recorded := runMockAgent(t)
+		exp, err := ocagent.NewExporter(
+			ocagent.WithInsecure(),
+			ocagent.WithAddress(recorded.address),
+			ocagent.WithTeeFile(ocagent.TeeFileParams{Path: path, Format: format}),
+		)
+		if err != nil {
+			t.Fatalf("Format %d: failed to create the recording exporter: %v", format, err)
+		}
+		for _, name := range []string{"first", "second"} {
+			req := &agenttracepb.ExportTraceServiceRequest{Spans: []*tracepb.Span{{
+				TraceId: make([]byte, 16),
+				SpanId:  make([]byte, 8),
+				Name:    &tracepb.TruncatableString{Value: name},
+			}}}
+			if err := exp.ExportTraceServiceRequest(req); err != nil {
+				t.Fatalf("Format %d: failed to export %q: %v", format, name, err)
+			}
+		}
+		_ = exp.Stop()
+		recorded.stop()
+
+		// Replay them to another agent.
+		replayed := runMockAgent(t)
+		exp, err = ocagent.NewExporter(ocagent.WithInsecure(), ocagent.WithAddress(replayed.address))
+		if err != nil {
+			t.Fatalf("Format %d: failed to create the replaying exporter: %v", format, err)
+		}
+		n, err := exp.Replay(context.Background(), path)
+		if err != nil || n != 2 {
+			t.Errorf("Format %d: Replay = %d, %v, want 2 requests", format, n, err)
+		}
+		<-time.After(50 * time.Millisecond)
+		_ = exp.Stop()
+		replayed.stop()
+
+		var names []string
+		for _, span := range replayed.getSpans() {
+			names = append(names, span.GetName().GetValue())
+		}
+		if len(names) != 2 || names[0] != "first" || names[1] != "second" {
+			t.Errorf("Format %d: replayed spans %v, want [first second]", format, names)
+		}
+		_ = os.Remove(path)
+	}
+}
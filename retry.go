@@ -0,0 +1,89 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryParams configures the retries of ExportTraceServiceRequest, see WithRetry.
+type RetryParams struct {
+	// MaxAttempts is the number of attempts to export a batch, including the
+	// first one. It defaults to 3 if it's not positive.
+	MaxAttempts int
+	// Backoff decides how long to wait between attempts. It defaults to
+	// an ExponentialBackoff starting at 100ms and capped at 5s.
+	Backoff BackoffPolicy
+	// MaxElapsedTime, if positive, bounds the time spent retrying a batch:
+	// no attempt is made that would start after it.
+	MaxElapsedTime time.Duration
+}
+
+const defaultRetryMaxAttempts = 3
+
+var defaultRetryBackoff = ExponentialBackoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second}
+
+// retryable reports whether the failure of an export is transient: the
+// agent is unavailable or too slow, or the connection to it was lost, in
+// which case the next attempt goes out once the exporter has reconnected,
+// or the export raced with a reconnection.
+func (ae *Exporter) retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return err == ErrTemporarilyDisconnected || (err != errStopped && !ae.connected())
+}
+
+// exportTraceRequestWithRetry is exportTraceRequest retried as per WithRetry.
+func (ae *Exporter) exportTraceRequestWithRetry(ctx context.Context, batch *marshaledTraceRequest) error {
+	err := ae.exportTraceRequest(ctx, batch)
+	if err == nil || ae.retryParams == nil {
+		return err
+	}
+	maxAttempts, backoff := ae.retryParams.MaxAttempts, ae.retryParams.Backoff
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	if backoff == nil {
+		backoff = defaultRetryBackoff
+	}
+
+	start := time.Now()
+	for attempt := 1; attempt < maxAttempts && ctx.Err() == nil && ae.retryable(err); attempt++ {
+		delay := backoff.NextDelay(attempt, err)
+		if maxElapsed := ae.retryParams.MaxElapsedTime; maxElapsed > 0 && time.Since(start)+delay > maxElapsed {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-ae.stopCh:
+			timer.Stop()
+			return err
+		}
+		if err = ae.exportTraceRequest(ctx, batch); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestNewExporter_withRetry(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	// The first two unary exports fail as if the agent were unavailable.
+	var calls int32
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		if method, _ := grpc.MethodFromServerStream(stream); method != exportOneMethod {
+			<-stream.Context().Done()
+			return nil
+		}
+		if err := stream.RecvMsg(new(agenttracepb.ExportTraceServiceRequest)); err != nil {
+			return err
+		}
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return status.Error(codes.Unavailable, "unavailable")
+		}
+		return stream.SendMsg(new(agenttracepb.ExportTraceServiceResponse))
+	}))
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	newExporter := func(maxAttempts int) *Exporter {
+		ae, err := NewExporter(
+			WithInsecure(),
+			WithAddress(ln.Addr().String()),
+			WithReconnectionPeriod(time.Millisecond),
+			WithUnaryBatchExporter(UnaryExporterParams{}),
+			WithRetry(RetryParams{
+				MaxAttempts: maxAttempts,
+				Backoff:     ExponentialBackoff{Initial: 50 * time.Millisecond, Max: 50 * time.Millisecond},
+			}),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create a new agent exporter: %v", err)
+		}
+		return ae
+	}
+	batch := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}}},
+	}
+
+	ae := newExporter(2)
+	if err := ae.ExportTraceServiceRequest(batch); err == nil {
+		t.Error("With 2 attempts: the batch was exported despite two failures")
+	}
+	ae.Stop()
+
+	atomic.StoreInt32(&calls, 0)
+	ae = newExporter(5)
+	defer ae.Stop()
+	if err := ae.ExportTraceServiceRequest(batch); err != nil {
+		t.Errorf("With 5 attempts: got %v, want the batch exported", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("Got %d calls, want 3", got)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"runtime"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// RuntimeMetricsPrefix prefixes the names of the metrics of WithRuntimeMetrics.
+const RuntimeMetricsPrefix = "runtime/go/"
+
+var (
+	goroutinesDescriptor = &metricspb.MetricDescriptor{
+		Name:        RuntimeMetricsPrefix + "goroutines",
+		Description: "Number of goroutines that currently exist",
+		Unit:        "1",
+		Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+	}
+	heapAllocDescriptor = &metricspb.MetricDescriptor{
+		Name:        RuntimeMetricsPrefix + "heap_alloc",
+		Description: "Bytes of allocated heap objects",
+		Unit:        "By",
+		Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+	}
+	heapObjectsDescriptor = &metricspb.MetricDescriptor{
+		Name:        RuntimeMetricsPrefix + "heap_objects",
+		Description: "Number of allocated heap objects",
+		Unit:        "1",
+		Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+	}
+	heapSysDescriptor = &metricspb.MetricDescriptor{
+		Name:        RuntimeMetricsPrefix + "heap_sys",
+		Description: "Bytes of heap memory obtained from the OS",
+		Unit:        "By",
+		Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+	}
+	gcCountDescriptor = &metricspb.MetricDescriptor{
+		Name:        RuntimeMetricsPrefix + "gc_count",
+		Description: "Number of completed GC cycles",
+		Unit:        "1",
+		Type:        metricspb.MetricDescriptor_CUMULATIVE_INT64,
+	}
+	gcPauseDescriptor = &metricspb.MetricDescriptor{
+		Name:        RuntimeMetricsPrefix + "gc_pause_total",
+		Description: "Total time the GC stopped the world",
+		Unit:        "s",
+		Type:        metricspb.MetricDescriptor_CUMULATIVE_DOUBLE,
+	}
+)
+
+// runtimeMetrics returns the Go runtime metrics of ms and goroutines at now.
+func runtimeMetrics(now time.Time, ms *runtime.MemStats, goroutines int) []*metricspb.Metric {
+	ts := transform.Timestamp(now)
+	gauge := func(descriptor *metricspb.MetricDescriptor, value int64) *metricspb.Metric {
+		return &metricspb.Metric{
+			MetricDescriptor: descriptor,
+			Timeseries: []*metricspb.TimeSeries{{
+				Points: []*metricspb.Point{{Timestamp: ts, Value: &metricspb.Point_Int64Value{Int64Value: value}}},
+			}},
+		}
+	}
+	cumulative := func(descriptor *metricspb.MetricDescriptor, point *metricspb.Point) *metricspb.Metric {
+		point.Timestamp = ts
+		return &metricspb.Metric{
+			MetricDescriptor: descriptor,
+			Timeseries: []*metricspb.TimeSeries{{
+				StartTimestamp: transform.Timestamp(startTime),
+				Points:         []*metricspb.Point{point},
+			}},
+		}
+	}
+
+	return []*metricspb.Metric{
+		gauge(goroutinesDescriptor, int64(goroutines)),
+		gauge(heapAllocDescriptor, int64(ms.HeapAlloc)),
+		gauge(heapObjectsDescriptor, int64(ms.HeapObjects)),
+		gauge(heapSysDescriptor, int64(ms.HeapSys)),
+		cumulative(gcCountDescriptor, &metricspb.Point{
+			Value: &metricspb.Point_Int64Value{Int64Value: int64(ms.NumGC)},
+		}),
+		cumulative(gcPauseDescriptor, &metricspb.Point{
+			Value: &metricspb.Point_DoubleValue{DoubleValue: time.Duration(ms.PauseTotalNs).Seconds()},
+		}),
+	}
+}
+
+// collectRuntimeMetrics exports the Go runtime metrics every runtime
+// metrics interval, until stopCh is closed.
+func (ae *Exporter) collectRuntimeMetrics(stopCh <-chan bool) {
+	ticker := time.NewTicker(ae.runtimeMetricsInterval)
+	defer ticker.Stop()
+
+	var ms runtime.MemStats
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case now := <-ticker.C:
+			runtime.ReadMemStats(&ms)
+			ae.uploadMetrics(runtimeMetrics(now, &ms, runtime.NumGoroutine()))
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+func TestRuntimeMetrics(t *testing.T) {
+	ms := &runtime.MemStats{HeapAlloc: 1024, NumGC: 3, PauseTotalNs: 1500000000}
+	metrics := runtimeMetrics(startTime.Add(time.Minute), ms, 7)
+
+	got := make(map[string]float64)
+	for _, metric := range metrics {
+		pt := metric.Timeseries[0].Points[0]
+		value := float64(pt.GetInt64Value()) + pt.GetDoubleValue()
+		got[metric.GetMetricDescriptor().GetName()] = value
+	}
+	want := map[string]float64{
+		RuntimeMetricsPrefix + "goroutines":     7,
+		RuntimeMetricsPrefix + "heap_alloc":     1024,
+		RuntimeMetricsPrefix + "heap_objects":   0,
+		RuntimeMetricsPrefix + "heap_sys":       0,
+		RuntimeMetricsPrefix + "gc_count":       3,
+		RuntimeMetricsPrefix + "gc_pause_total": 1.5,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Got metrics %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s: got %v, want %v", name, got[name], value)
+		}
+	}
+}
+
+func TestExporter_sendsRuntimeMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	_, agentPortStr, _ := net.SplitHostPort(ln.Addr().String())
+	ma := new(metricsAgent)
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	ocexp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(":"+agentPortStr),
+		WithReconnectionPeriod(2*time.Millisecond),
+		WithRuntimeMetrics(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer ocexp.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		goroutines := int64(0)
+		ma.forEachRequest(func(req *agentmetricspb.ExportMetricsServiceRequest) {
+			for _, metric := range req.Metrics {
+				if metric.GetMetricDescriptor().GetName() == RuntimeMetricsPrefix+"goroutines" {
+					goroutines = metric.Timeseries[0].Points[0].GetInt64Value()
+				}
+			}
+		})
+		if goroutines > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("No runtime metrics were received")
+}
@@ -0,0 +1,108 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/api/support/bundler"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// exporterCounters are the counters of the exporter's own activity.
+// They are only ever accessed atomically.
+type exporterCounters struct {
+	exportedSpans   int64
+	exportedMetrics int64
+	// droppedSpans includes the spans handed to WithSpillExporter,
+	// since they weren't sent to the agent either.
+	droppedSpans   int64
+	droppedMetrics int64
+	reconnects     int64
+}
+
+// bundlerDropReason returns the reason for dropping
+// an item that a bundler failed to add with err.
+func bundlerDropReason(err error) string {
+	if err == bundler.ErrOversizedItem {
+		return dropReasonOversized
+	}
+	return dropReasonBufferFull
+}
+
+// dropViewData accounts for vd, which won't be sent to the agent for reason.
+func (ae *Exporter) dropViewData(vd *view.Data, reason string) {
+	atomic.AddInt64(&ae.counters.droppedMetrics, 1)
+	ae.recordEvent(EventDropped, "metrics: "+reason, 1)
+	if ae.logger != nil && vd.View != nil {
+		ae.logger("ocagent: dropped the view data of %q: %s", vd.View.Name, reason)
+	}
+}
+
+// dropRequest accounts for req, which won't be sent to the agent for reason.
+func (ae *Exporter) dropRequest(req proto.Message, reason string) {
+	switch req := unwrapRequest(req).(type) {
+	case *agenttracepb.ExportTraceServiceRequest:
+		atomic.AddInt64(&ae.counters.droppedSpans, int64(len(req.Spans)))
+		ae.recordEvent(EventDropped, "spans: "+reason, int64(len(req.Spans)))
+	case *agentmetricspb.ExportMetricsServiceRequest:
+		atomic.AddInt64(&ae.counters.droppedMetrics, int64(len(req.Metrics)))
+		ae.recordEvent(EventDropped, "metrics: "+reason, int64(len(req.Metrics)))
+	}
+}
+
+// dropUnmarshalable drops req, which failed to be marshaled with err.
+func (ae *Exporter) dropUnmarshalable(req proto.Message, err error) {
+	ae.dropRequest(req, dropReasonMarshal)
+	if ae.logger != nil {
+		ae.logger("ocagent: dropped a request that failed to be marshaled: %v", err)
+	}
+}
+
+// expvarMu serializes the exporters publishing their counters, since
+// expvar.Publish panics if the name was published in the meantime.
+var expvarMu sync.Mutex
+
+// publishExpvar publishes the counters of the exporter for WithExpvar.
+func (ae *Exporter) publishExpvar() error {
+	if ae.expvarName == "" {
+		return nil
+	}
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if expvar.Get(ae.expvarName) != nil {
+		return fmt.Errorf("ocagent: expvar %q is already published", ae.expvarName)
+	}
+	counter := func(c *int64) expvar.Func {
+		return func() interface{} { return atomic.LoadInt64(c) }
+	}
+	m := new(expvar.Map).Init()
+	m.Set("exported_spans", counter(&ae.counters.exportedSpans))
+	m.Set("exported_metrics", counter(&ae.counters.exportedMetrics))
+	m.Set("dropped_spans", counter(&ae.counters.droppedSpans))
+	m.Set("dropped_metrics", counter(&ae.counters.droppedMetrics))
+	m.Set("reconnects", counter(&ae.counters.reconnects))
+	m.Set("queue_depth", expvar.Func(func() interface{} { return len(ae.sendQueue) }))
+	expvar.Publish(ae.expvarName, m)
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+const (
+	// SelfTestSpanName is the name of the span sent by SelfTest.
+	SelfTestSpanName = "contrib.go.opencensus.io/exporter/ocagent/selftest"
+
+	// SelfTestMetricName is the name of the metric sent by SelfTestMetrics.
+	SelfTestMetricName = "contrib.go.opencensus.io/exporter/ocagent/selftest"
+)
+
+// SelfTest sends a marker span, named SelfTestSpanName, to the agent and
+// waits until the agent acknowledges it, so that deployment pipelines can
+// check that telemetry gets through before rolling out. The span is sent
+// with the unary ExportOne RPC, bypassing the bundlers and the trace streams,
+// whose sends aren't acknowledged. ctx bounds the RPC.
+//
+// SelfTest returns an error if the exporter isn't connected, or if the agent
+// failed the RPC.
+func (ae *Exporter) SelfTest(ctx context.Context) error {
+	cc, err := ae.selfTestConn()
+	if err != nil {
+		return err
+	}
+	headers, err := ae.headersFor(ctx, teeSignalTraces)
+	if err != nil {
+		return err
+	}
+	req := &agenttracepb.ExportTraceServiceRequest{
+		Node:     ae.nodeInfo,
+		Resource: ae.resource,
+		Spans:    []*tracepb.Span{selfTestSpan(time.Now())},
+	}
+	err = cc.Invoke(withOutgoingHeaders(ctx, headers), exportOneMethod, req, new(agenttracepb.ExportTraceServiceResponse), ae.exportCallOptions(false)...)
+	if err != nil {
+		return fmt.Errorf("ocagent: self test span: %v", err)
+	}
+	return nil
+}
+
+// SelfTestMetrics is like SelfTest for metrics: it sends a marker metric,
+// named SelfTestMetricName, on a stream of its own, then ends the stream
+// and waits until the agent ends it too. ctx bounds the stream.
+func (ae *Exporter) SelfTestMetrics(ctx context.Context) error {
+	cc, err := ae.selfTestConn()
+	if err != nil {
+		return err
+	}
+	headers, err := ae.headersFor(ctx, teeSignalMetrics)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(withOutgoingHeaders(ctx, headers))
+	defer cancel()
+
+	stream, err := openMetricsStream(ctx, agentmetricspb.NewMetricsServiceClient(cc), ae.nodeInfo, ae.resource, ae.exportCallOptions(false))
+	if err == nil {
+		err = stream.Send(&agentmetricspb.ExportMetricsServiceRequest{
+			Metrics: []*metricspb.Metric{selfTestMetric(time.Now())},
+		})
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if err != io.EOF && !isEchoedEOF(err) {
+		return fmt.Errorf("ocagent: self test metric: %v", err)
+	}
+	return nil
+}
+
+// isEchoedEOF reports whether err is the status of an agent that ended
+// the stream by returning the io.EOF that its Recv returned.
+func isEchoedEOF(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.Unknown && s.Message() == io.EOF.Error()
+}
+
+// selfTestConn returns the connection to the agent to self test on.
+func (ae *Exporter) selfTestConn() (*grpc.ClientConn, error) {
+	ae.mu.RLock()
+	started, stopped := ae.started, ae.stopped
+	cc := ae.grpcClientConn
+	ae.mu.RUnlock()
+
+	switch {
+	case stopped:
+		return nil, errStopped
+	case !started:
+		return nil, errNotStarted
+	case cc == nil || !ae.connected():
+		if err := ae.lastConnectError(); err != nil {
+			return nil, err
+		}
+		return nil, errNoConnection
+	}
+	return cc, nil
+}
+
+var errNoConnection = errors.New("not connected")
+
+func selfTestSpan(now time.Time) *tracepb.Span {
+	span := &tracepb.Span{
+		TraceId:   make([]byte, 16),
+		SpanId:    make([]byte, 8),
+		Name:      &tracepb.TruncatableString{Value: SelfTestSpanName},
+		Kind:      tracepb.Span_CLIENT,
+		StartTime: transform.Timestamp(now),
+		EndTime:   transform.Timestamp(now),
+	}
+	_, _ = rand.Read(span.TraceId)
+	_, _ = rand.Read(span.SpanId)
+	return span
+}
+
+func selfTestMetric(now time.Time) *metricspb.Metric {
+	return &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{
+			Name:        SelfTestMetricName,
+			Description: "Marker sent to check that metrics reach the agent",
+			Unit:        "1",
+			Type:        metricspb.MetricDescriptor_GAUGE_INT64,
+		},
+		Timeseries: []*metricspb.TimeSeries{{
+			Points: []*metricspb.Point{{
+				Timestamp: transform.Timestamp(now),
+				Value:     &metricspb.Point_Int64Value{Int64Value: 1},
+			}},
+		}},
+	}
+}
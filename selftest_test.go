@@ -0,0 +1,69 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+func TestSelfTestMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	ma := new(metricsAgent)
+	srv := grpc.NewServer()
+	agentmetricspb.RegisterMetricsServiceServer(srv, ma)
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	exp, err := NewExporter(
+		WithInsecure(),
+		WithAddress(ln.Addr().String()),
+		WithReconnectionPeriod(2*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create the ocagent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for !exp.connected() && ctx.Err() == nil {
+		<-time.After(2 * time.Millisecond)
+	}
+	if err := exp.SelfTestMetrics(ctx); err != nil {
+		t.Fatalf("SelfTestMetrics: %v", err)
+	}
+	var names []string
+	ma.forEachRequest(func(req *agentmetricspb.ExportMetricsServiceRequest) {
+		for _, metric := range req.Metrics {
+			names = append(names, metric.GetMetricDescriptor().GetName())
+		}
+	})
+	if len(names) != 1 || names[0] != SelfTestMetricName {
+		t.Errorf("Got metrics %v, want the self test metric", names)
+	}
+}
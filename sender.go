@@ -0,0 +1,117 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"sync/atomic"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// sendQueueSize is the number of converted batches that can be waiting
+// on the sender goroutine before the bundler handlers start to block.
+const sendQueueSize = 64
+
+// outgoingBatch is a unit of work for the sender goroutine. Only one of
+// its fields is set. A non-nil flushed channel is a barrier: it is closed
+// once every batch that was queued before it has been sent.
+type outgoingBatch struct {
+	traces  *agenttracepb.ExportTraceServiceRequest
+	metrics *agentmetricspb.ExportMetricsServiceRequest
+	flushed chan struct{}
+	// replaySpool asks the sender to send the batches that were
+	// spooled while the exporter was disconnected.
+	replaySpool bool
+}
+
+// runSender is the only goroutine that writes batches produced by the
+// bundlers to the agent, so that slow writes to the agent never stall
+// the conversion of spans and view data in the bundler handlers.
+func (ae *Exporter) runSender(stopCh <-chan bool) {
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case batch := <-ae.sendQueue:
+			ae.sendBatch(batch)
+		}
+	}
+}
+
+func (ae *Exporter) sendBatch(batch outgoingBatch) {
+	ae.uploads.begin()
+	defer ae.uploads.end()
+
+	if batch.flushed == nil {
+		ae.mirrorBatch(batch)
+		// If stopped, the batch fails to be sent right away.
+		_ = ae.waitThrottle(context.Background())
+	}
+	// Spooled batches always go out ahead of newer ones.
+	ae.replaySpool()
+
+	switch {
+	case batch.flushed != nil:
+		close(batch.flushed)
+
+	case batch.traces != nil:
+		n := len(batch.traces.Spans)
+		ae.sendTraces(batch.traces)
+		atomic.AddInt64(&ae.pendingSpans, -int64(n))
+
+	case batch.metrics != nil:
+		mr, err := ae.marshal(batch.metrics)
+		if err != nil {
+			ae.dropUnmarshalable(batch.metrics, err)
+			return
+		}
+		if err := ae.exportMetricsRequest(mr); err != nil {
+			ae.spoolRequest(teeSignalMetrics, mr)
+		}
+	}
+}
+
+// enqueue hands batch over to the sender goroutine. It reports
+// false if the exporter was stopped before batch could be queued.
+func (ae *Exporter) enqueue(batch outgoingBatch) bool {
+	select {
+	case ae.sendQueue <- batch:
+		return true
+	case <-ae.stopCh:
+		return false
+	}
+}
+
+// waitForSender blocks until all the batches queued so far have been sent.
+func (ae *Exporter) waitForSender() {
+	ae.mu.RLock()
+	started := ae.started
+	ae.mu.RUnlock()
+	if !started {
+		return
+	}
+
+	flushed := make(chan struct{})
+	if !ae.enqueue(outgoingBatch{flushed: flushed}) {
+		return
+	}
+	select {
+	case <-flushed:
+	case <-ae.stopCh:
+	}
+}
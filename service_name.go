@@ -0,0 +1,31 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultServiceName returns the service name used without WithServiceName:
+// the name of the executable, or else the last element of the path of the
+// main package, rather than an empty name that backends show as unknown.
+func defaultServiceName() string {
+	if len(os.Args) > 0 && os.Args[0] != "" {
+		return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	}
+	return mainPackageName()
+}
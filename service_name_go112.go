@@ -0,0 +1,32 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.12
+// +build go1.12
+
+package ocagent
+
+import (
+	"path"
+	"runtime/debug"
+)
+
+// mainPackageName returns the last element of the path of the main
+// package, read from the build info embedded since Go 1.12.
+func mainPackageName() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Path != "" {
+		return path.Base(bi.Path)
+	}
+	return ""
+}
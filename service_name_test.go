@@ -0,0 +1,48 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDefaultServiceName(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	os.Args = []string{"/usr/local/bin/checkout", "-v"}
+	if got, want := defaultServiceName(), "checkout"; got != want {
+		t.Errorf("defaultServiceName() = %q, want %q", got, want)
+	}
+	os.Args = []string{"./billing.exe"}
+	if got, want := defaultServiceName(), "billing"; got != want {
+		t.Errorf("defaultServiceName() = %q, want %q", got, want)
+	}
+
+	exp, err := NewUnstartedExporter(WithInsecure())
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	if got := exp.nodeInfo.ServiceInfo.Name; got != defaultServiceName() {
+		t.Errorf("Service name = %q, want %q", got, defaultServiceName())
+	}
+	exp, err = NewUnstartedExporter(WithInsecure(), WithServiceName("cart"))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	if got := exp.nodeInfo.ServiceInfo.Name; got != "cart" {
+		t.Errorf("Service name = %q, want %q", got, "cart")
+	}
+}
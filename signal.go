@@ -0,0 +1,88 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reraiseSignal delivers sig to the process again, once the exporter is
+// stopped and the signal isn't intercepted anymore, so that the process
+// terminates as it would have without StopOnSignal.
+var reraiseSignal = func(sig os.Signal) {
+	if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+		return
+	}
+	// The signal can't be delivered, e.g. on Windows.
+	os.Exit(1)
+}
+
+// StopOnSignal stops the exporter when the process receives one of signals,
+// SIGTERM and SIGINT by default, so that command-line tools and batch jobs
+// deliver their last batches with a single line of setup. The buffered spans
+// and view data are flushed and the exporter is stopped, waiting no longer
+// than deadline if it is positive. The signal is then delivered again, so that
+// the process terminates as usual. The returned function stops intercepting
+// the signals, e.g. once the exporter was stopped otherwise.
+func (ae *Exporter) StopOnSignal(deadline time.Duration, signals ...os.Signal) (cancel func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, os.Interrupt}
+	}
+	sigCh := make(chan os.Signal, 1)
+	doneCh := make(chan struct{})
+	signal.Notify(sigCh, signals...)
+
+	go func() {
+		select {
+		case <-doneCh:
+			return
+		case sig := <-sigCh:
+			signal.Stop(sigCh)
+			_ = ae.stopWithin(deadline)
+			reraiseSignal(sig)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sigCh)
+			close(doneCh)
+		})
+	}
+}
+
+// stopWithin stops the exporter, waiting no longer than deadline if it is
+// positive. It returns the error of Stop, or errCloseTimeout past deadline.
+func (ae *Exporter) stopWithin(deadline time.Duration) error {
+	stopped := make(chan error, 1)
+	go func() {
+		// Stop flushes the exporter first.
+		stopped <- ae.Stop()
+	}()
+	if deadline <= 0 {
+		return <-stopped
+	}
+	select {
+	case err := <-stopped:
+		return err
+	case <-time.After(deadline):
+		return errCloseTimeout
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package ocagent
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExporter_StopOnSignal(t *testing.T) {
+	reraised := make(chan os.Signal, 1)
+	defer func(f func(os.Signal)) { reraiseSignal = f }(reraiseSignal)
+	reraiseSignal = func(sig os.Signal) { reraised <- sig }
+
+	ae, err := NewUnstartedExporter(WithInsecure(), WithDryRun(nil))
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	if err := ae.Start(); err != nil {
+		t.Fatalf("Failed to start the exporter: %v", err)
+	}
+	cancel := ae.StopOnSignal(time.Second, syscall.SIGUSR1)
+	defer cancel()
+
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGUSR1); err != nil {
+		t.Skipf("Can't signal the process: %v", err)
+	}
+	select {
+	case sig := <-reraised:
+		if sig != syscall.SIGUSR1 {
+			t.Errorf("Got signal %v again, want %v", sig, syscall.SIGUSR1)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The signal wasn't handled")
+	}
+	ae.mu.RLock()
+	stopped := ae.stopped
+	ae.mu.RUnlock()
+	if !stopped {
+		t.Error("The exporter wasn't stopped")
+	}
+}
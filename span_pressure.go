@@ -0,0 +1,197 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"container/list"
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// bundledSpan is a span buffered in the trace bundler, along
+// with its size, which is accounted in Exporter.bufferedSpanBytes.
+type bundledSpan struct {
+	span *tracepb.Span
+	size int
+	// sd is only kept for WithSpillExporter.
+	sd *trace.SpanData
+
+	// batch, if span is nil, holds the spans added at once by AddSpans,
+	// and batchData their SpanData, only kept for WithSpillExporter.
+	batch     []*tracepb.Span
+	batchData []*trace.SpanData
+}
+
+// ErrorSpanPriorityUtilization is the utilization of the span buffer, the
+// fraction of the trace bundler's BufferedByteLimit in use, from which
+// WithErrorSpanPriority starts dropping the spans that aren't errors.
+const ErrorSpanPriorityUtilization = 0.8
+
+// maxErrorTraces bounds the number of traces remembered by
+// WithErrorSpanPriority until their local root span ends.
+const maxErrorTraces = 4096
+
+// errorTraces is the set of the traces with an error span whose local root
+// span hasn't been exported yet. Beyond maxErrorTraces, the oldest traces
+// are forgotten first, which only risks dropping their roots under pressure.
+type errorTraces struct {
+	mu  sync.Mutex
+	ids map[trace.TraceID]*list.Element
+	// order holds the trace IDs of ids, the oldest first.
+	order list.List
+}
+
+func (et *errorTraces) add(traceID trace.TraceID) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	if et.ids == nil {
+		et.ids = make(map[trace.TraceID]*list.Element)
+	}
+	if _, ok := et.ids[traceID]; ok {
+		return
+	}
+	if len(et.ids) >= maxErrorTraces {
+		oldest := et.order.Front()
+		et.order.Remove(oldest)
+		delete(et.ids, oldest.Value.(trace.TraceID))
+	}
+	et.ids[traceID] = et.order.PushBack(traceID)
+}
+
+// remove reports whether traceID was in the set.
+func (et *errorTraces) remove(traceID trace.TraceID) bool {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	e, ok := et.ids[traceID]
+	if ok {
+		et.order.Remove(e)
+		delete(et.ids, traceID)
+	}
+	return ok
+}
+
+// spanBufferUtilization returns the fraction of limit, the trace bundler's
+// BufferedByteLimit, that would be used once size more bytes are buffered.
+func (ae *Exporter) spanBufferUtilization(size, limit int) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&ae.bufferedSpanBytes)+int64(size)) / float64(limit)
+}
+
+// DefaultLoadSheddingStartUtilization is the utilization of the span buffer
+// from which WithLoadShedding starts dropping spans, unless configured otherwise.
+const DefaultLoadSheddingStartUtilization = 0.5
+
+// LoadSheddingParams configures WithLoadShedding.
+type LoadSheddingParams struct {
+	// StartUtilization is the fraction of the trace bundler's BufferedByteLimit
+	// in use from which spans start being dropped. The probability to drop a
+	// span then rises linearly with the utilization, up to 1 when the buffer
+	// is full. It defaults to DefaultLoadSheddingStartUtilization.
+	StartUtilization float64
+}
+
+func (lsp *LoadSheddingParams) dropProbability(utilization float64) float64 {
+	start := lsp.StartUtilization
+	if start <= 0 || start >= 1 {
+		start = DefaultLoadSheddingStartUtilization
+	}
+	switch {
+	case utilization <= start:
+		return 0
+	case utilization >= 1:
+		return 1
+	default:
+		return (utilization - start) / (1 - start)
+	}
+}
+
+// The self-metrics of WithLoadShedding. Register ShedSpansView and
+// SheddingDropProbabilityView to export them.
+var (
+	MeasureShedSpans = stats.Int64(
+		"contrib.go.opencensus.io/exporter/ocagent/shed_spans",
+		"Number of spans dropped by load shedding",
+		stats.UnitDimensionless)
+	MeasureSheddingDropProbability = stats.Float64(
+		"contrib.go.opencensus.io/exporter/ocagent/shedding_drop_probability",
+		"Probability with which load shedding drops spans",
+		stats.UnitDimensionless)
+
+	ShedSpansView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/shed_spans",
+		Description: "Number of spans dropped by load shedding",
+		Measure:     MeasureShedSpans,
+		Aggregation: view.Sum(),
+	}
+	SheddingDropProbabilityView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/shedding_drop_probability",
+		Description: "Latest probability with which load shedding dropped spans",
+		Measure:     MeasureSheddingDropProbability,
+		Aggregation: view.LastValue(),
+	}
+)
+
+// shedSpan reports whether sd, whose conversion is size bytes, must be dropped
+// to relieve the span buffer, given limit, the trace bundler's BufferedByteLimit.
+func (ae *Exporter) shedSpan(sd *trace.SpanData, size, limit int) bool {
+	if !ae.errorSpanPriority && ae.loadShedding == nil {
+		return false
+	}
+	if ae.errorSpanPriority && ae.isErrorSpan(sd) {
+		return false
+	}
+
+	utilization := ae.spanBufferUtilization(size, limit)
+	if ae.errorSpanPriority && utilization >= ErrorSpanPriorityUtilization {
+		return true
+	}
+	if ae.loadShedding == nil {
+		return false
+	}
+	p := ae.loadShedding.dropProbability(utilization)
+	if p <= 0 {
+		return false
+	}
+	stats.Record(context.Background(), MeasureSheddingDropProbability.M(p))
+	if rand.Float64() >= p {
+		return false
+	}
+	stats.Record(context.Background(), MeasureShedSpans.M(1))
+	return true
+}
+
+// isErrorSpan reports whether sd, or the local root of its trace, must be kept
+// under pressure by WithErrorSpanPriority. It must be invoked on every span.
+func (ae *Exporter) isErrorSpan(sd *trace.SpanData) bool {
+	if sd.Status.Code != trace.StatusCodeOK {
+		if !isLocalRoot(sd) {
+			ae.errorTraces.add(sd.TraceID)
+		}
+		return true
+	}
+	return isLocalRoot(sd) && ae.errorTraces.remove(sd.TraceID)
+}
@@ -0,0 +1,80 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestLoadSheddingParams_dropProbability(t *testing.T) {
+	tests := []struct {
+		start       float64
+		utilization float64
+		want        float64
+	}{
+		{start: 0, utilization: 0.25, want: 0},
+		{start: 0, utilization: 0.5, want: 0},
+		{start: 0, utilization: 0.75, want: 0.5},
+		{start: 0.8, utilization: 0.9, want: 0.5},
+		{start: 0.8, utilization: 1, want: 1},
+		{start: 0.8, utilization: 1.5, want: 1},
+	}
+	for i, tt := range tests {
+		lsp := &LoadSheddingParams{StartUtilization: tt.start}
+		if got := lsp.dropProbability(tt.utilization); got < tt.want-1e-9 || got > tt.want+1e-9 {
+			t.Errorf("#%d: dropProbability(%v) = %v, want %v", i, tt.utilization, got, tt.want)
+		}
+	}
+}
+
+func TestExporter_shedSpan(t *testing.T) {
+	ae := &Exporter{loadShedding: &LoadSheddingParams{}, bufferedSpanBytes: 100}
+	sd := &trace.SpanData{}
+	if ae.shedSpan(sd, 0, 1000) {
+		t.Error("A span was shed while the buffer is mostly empty")
+	}
+	if !ae.shedSpan(sd, 900, 1000) {
+		t.Error("A span that fills up the buffer wasn't shed")
+	}
+
+	ae.errorSpanPriority = true
+	sd.Status.Code = trace.StatusCodeInternal
+	if ae.shedSpan(sd, 900, 1000) {
+		t.Error("An error span was shed despite WithErrorSpanPriority")
+	}
+}
+
+func TestErrorTraces_forgetsTheOldestFirst(t *testing.T) {
+	var et errorTraces
+	id := func(i int) trace.TraceID {
+		var traceID trace.TraceID
+		binary.BigEndian.PutUint64(traceID[:], uint64(i))
+		return traceID
+	}
+	for i := 0; i <= maxErrorTraces; i++ {
+		et.add(id(i))
+	}
+	if et.remove(id(0)) {
+		t.Error("The oldest trace wasn't forgotten")
+	}
+	for _, i := range []int{1, maxErrorTraces / 2, maxErrorTraces} {
+		if !et.remove(id(i)) {
+			t.Errorf("Trace #%d was forgotten", i)
+		}
+	}
+}
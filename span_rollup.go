@@ -0,0 +1,200 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+)
+
+// The attributes of the summary spans of WithSpanRollup.
+const (
+	// SpanRollupCountAttributeKey holds the number of spans summarized.
+	SpanRollupCountAttributeKey = "ocagent.rollup.count"
+	// SpanRollupErrorCountAttributeKey holds the number of them
+	// that ended with a status other than OK.
+	SpanRollupErrorCountAttributeKey = "ocagent.rollup.error_count"
+	// SpanRollupDurationSumAttributeKey holds the sum of their
+	// durations, in microseconds.
+	SpanRollupDurationSumAttributeKey = "ocagent.rollup.duration_sum_us"
+	// SpanRollupDurationMaxAttributeKey holds the longest of their
+	// durations, in microseconds.
+	SpanRollupDurationMaxAttributeKey = "ocagent.rollup.duration_max_us"
+)
+
+// DefaultSpanRollupInterval is the interval of WithSpanRollup
+// if SpanRollupParams.Interval isn't positive.
+const DefaultSpanRollupInterval = time.Minute
+
+// The self-metric of WithSpanRollup. Register RolledUpSpansView to export it.
+var (
+	MeasureRolledUpSpans = stats.Int64(
+		"contrib.go.opencensus.io/exporter/ocagent/rolled_up_spans",
+		"Number of spans rolled up rather than exported",
+		stats.UnitDimensionless)
+
+	RolledUpSpansView = &view.View{
+		Name:        "contrib.go.opencensus.io/exporter/ocagent/rolled_up_spans",
+		Description: "Number of spans rolled up rather than exported",
+		Measure:     MeasureRolledUpSpans,
+		Aggregation: view.Sum(),
+	}
+)
+
+// SpanRollupParams configures WithSpanRollup.
+type SpanRollupParams struct {
+	// Match reports whether a span is rolled up rather than exported,
+	// e.g. based on its name or attributes. It must be set.
+	Match func(*trace.SpanData) bool
+
+	// Interval is how often the summary spans are exported,
+	// DefaultSpanRollupInterval if it isn't positive.
+	Interval time.Duration
+
+	// CountOnly drops the rolled up spans without exporting summary spans,
+	// so that they are only accounted for by RolledUpSpansView.
+	CountOnly bool
+}
+
+// rollupKey identifies the spans summarized by the same span.
+type rollupKey struct {
+	name string
+	kind int
+}
+
+// spanSummary summarizes the spans rolled up during an interval.
+type spanSummary struct {
+	start, end  time.Time
+	count       int64
+	errorCount  int64
+	durationSum time.Duration
+	durationMax time.Duration
+}
+
+// spanRollup summarizes the spans of WithSpanRollup by name and kind.
+type spanRollup struct {
+	params SpanRollupParams
+
+	mu        sync.Mutex
+	summaries map[rollupKey]*spanSummary
+}
+
+func newSpanRollup(params SpanRollupParams) *spanRollup {
+	if params.Interval <= 0 {
+		params.Interval = DefaultSpanRollupInterval
+	}
+	return &spanRollup{params: params, summaries: make(map[rollupKey]*spanSummary)}
+}
+
+// add reports whether sd is rolled up, in which case it is summarized.
+func (sr *spanRollup) add(sd *trace.SpanData) bool {
+	if !sr.params.Match(sd) {
+		return false
+	}
+	stats.Record(context.Background(), MeasureRolledUpSpans.M(1))
+	if sr.params.CountOnly {
+		return true
+	}
+
+	key := rollupKey{name: sd.Name, kind: sd.SpanKind}
+	duration := sd.EndTime.Sub(sd.StartTime)
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	s := sr.summaries[key]
+	if s == nil {
+		s = &spanSummary{start: sd.StartTime, end: sd.EndTime}
+		sr.summaries[key] = s
+	}
+	if sd.StartTime.Before(s.start) {
+		s.start = sd.StartTime
+	}
+	if sd.EndTime.After(s.end) {
+		s.end = sd.EndTime
+	}
+	s.count++
+	if sd.Code != trace.StatusCodeOK {
+		s.errorCount++
+	}
+	s.durationSum += duration
+	if duration > s.durationMax {
+		s.durationMax = duration
+	}
+	return true
+}
+
+// summarize removes and returns the summary spans of the spans rolled up so far.
+func (sr *spanRollup) summarize() []*trace.SpanData {
+	sr.mu.Lock()
+	summaries := sr.summaries
+	sr.summaries = make(map[rollupKey]*spanSummary)
+	sr.mu.Unlock()
+
+	sds := make([]*trace.SpanData, 0, len(summaries))
+	for key, s := range summaries {
+		sd := &trace.SpanData{
+			Name:      key.name,
+			SpanKind:  key.kind,
+			StartTime: s.start,
+			EndTime:   s.end,
+			Attributes: map[string]interface{}{
+				SpanRollupCountAttributeKey:       s.count,
+				SpanRollupErrorCountAttributeKey:  s.errorCount,
+				SpanRollupDurationSumAttributeKey: int64(s.durationSum / time.Microsecond),
+				SpanRollupDurationMaxAttributeKey: int64(s.durationMax / time.Microsecond),
+			},
+		}
+		_, _ = rand.Read(sd.TraceID[:])
+		_, _ = rand.Read(sd.SpanID[:])
+		sd.TraceOptions = 1 // Sampled.
+		sds = append(sds, sd)
+	}
+	return sds
+}
+
+// rollUpSpans periodically exports the summary spans.
+func (ae *Exporter) rollUpSpans(stopCh <-chan bool) {
+	ticker := time.NewTicker(ae.spanRollup.params.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case <-ticker.C:
+			ae.flushSpanRollups()
+		}
+	}
+}
+
+// flushSpanRollups exports the summary spans of the spans rolled up so far.
+func (ae *Exporter) flushSpanRollups() {
+	if ae.spanRollup == nil {
+		return
+	}
+	ae.mu.RLock()
+	traceBundler := ae.traceBundler
+	ae.mu.RUnlock()
+	for _, sd := range ae.spanRollup.summarize() {
+		_ = ae.bufferSpan(sd, traceBundler)
+	}
+}
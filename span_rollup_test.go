@@ -0,0 +1,77 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+func TestSpanRollup(t *testing.T) {
+	sr := newSpanRollup(SpanRollupParams{
+		Match: func(sd *trace.SpanData) bool { return sd.Name == "cache.get" },
+	})
+	start := time.Unix(1000, 0)
+	span := func(name string, offset, duration time.Duration, code int32) *trace.SpanData {
+		return &trace.SpanData{
+			Name:      name,
+			StartTime: start.Add(offset),
+			EndTime:   start.Add(offset + duration),
+			Status:    trace.Status{Code: code},
+		}
+	}
+
+	if sr.add(span("checkout", 0, time.Second, trace.StatusCodeOK)) {
+		t.Error("A span that doesn't match was rolled up")
+	}
+	for _, sd := range []*trace.SpanData{
+		span("cache.get", 2*time.Second, 3*time.Millisecond, trace.StatusCodeOK),
+		span("cache.get", 0, time.Millisecond, trace.StatusCodeNotFound),
+		span("cache.get", time.Second, 2*time.Millisecond, trace.StatusCodeOK),
+	} {
+		if !sr.add(sd) {
+			t.Errorf("Span %v wasn't rolled up", sd)
+		}
+	}
+
+	summaries := sr.summarize()
+	if len(summaries) != 1 {
+		t.Fatalf("Got %d summary spans, want 1", len(summaries))
+	}
+	got := summaries[0]
+	if got.Name != "cache.get" || !got.StartTime.Equal(start) || !got.EndTime.Equal(start.Add(2*time.Second+3*time.Millisecond)) {
+		t.Errorf("Got summary span %q from %v to %v", got.Name, got.StartTime, got.EndTime)
+	}
+	if got.TraceID == (trace.TraceID{}) || got.SpanID == (trace.SpanID{}) {
+		t.Error("The summary span has no IDs")
+	}
+	want := map[string]interface{}{
+		SpanRollupCountAttributeKey:       int64(3),
+		SpanRollupErrorCountAttributeKey:  int64(1),
+		SpanRollupDurationSumAttributeKey: int64(6000),
+		SpanRollupDurationMaxAttributeKey: int64(3000),
+	}
+	for k, v := range want {
+		if got.Attributes[k] != v {
+			t.Errorf("Attribute %q = %v, want %v", k, got.Attributes[k], v)
+		}
+	}
+
+	if summaries := sr.summarize(); len(summaries) != 0 {
+		t.Errorf("Got %d summary spans once summarized, want none", len(summaries))
+	}
+}
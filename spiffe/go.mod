@@ -0,0 +1,36 @@
+module contrib.go.opencensus.io/exporter/ocagent/spiffe
+
+go 1.17
+
+require (
+	contrib.go.opencensus.io/exporter/ocagent v0.0.0
+	github.com/spiffe/go-spiffe/v2 v2.1.1
+	google.golang.org/grpc v1.46.0
+)
+
+require (
+	cloud.google.com/go v0.38.0 // indirect
+	github.com/Microsoft/go-winio v0.5.2 // indirect
+	github.com/census-instrumentation/opencensus-proto v0.2.1 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/grpc-ecosystem/grpc-gateway v1.16.0 // indirect
+	github.com/hashicorp/golang-lru v0.5.1 // indirect
+	github.com/zeebo/errs v1.2.2 // indirect
+	go.opencensus.io v0.22.0 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d // indirect
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58 // indirect
+	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0c // indirect
+	golang.org/x/text v0.3.3 // indirect
+	google.golang.org/api v0.7.0 // indirect
+	google.golang.org/appengine v1.5.0 // indirect
+	google.golang.org/genproto v0.0.0-20200806141610-86f49bd18e98 // indirect
+	google.golang.org/protobuf v1.28.0 // indirect
+	gopkg.in/square/go-jose.v2 v2.4.1 // indirect
+	gopkg.in/yaml.v2 v2.2.3 // indirect
+)
+
+replace contrib.go.opencensus.io/exporter/ocagent => ../
+
+replace github.com/census-instrumentation/opencensus-proto => github.com/omnition/opencensus-proto v0.2.2-omnition-1
@@ -0,0 +1,81 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spiffe authenticates the OpenCensus agent exporter with SPIFFE
+// workload identities, for meshes where the agent requires mTLS with X.509
+// SVIDs. It is a module of its own, so that the exporter doesn't depend on
+// go-spiffe.
+package spiffe // import "contrib.go.opencensus.io/exporter/ocagent/spiffe"
+
+import (
+	"context"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffegrpc/grpccredentials"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+// X509Source provides X.509 SVIDs and the bundles to verify the agent with,
+// as workloadapi.X509Source does.
+type X509Source interface {
+	x509svid.Source
+	x509bundle.Source
+}
+
+// WithX509Source makes the exporter present the X.509 SVID of source to the
+// agent, and accept the agent if it presents an SVID that verifies against
+// the bundles of source and that authorizer allows, e.g.
+// tlsconfig.AuthorizeID(agentID).
+//
+// Both are read from source on every handshake, so the SVIDs and bundles
+// that a workloadapi.X509Source keeps up to date are rotated without any
+// action. source must not be closed before the exporter is stopped.
+func WithX509Source(source X509Source, authorizer tlsconfig.Authorizer) ocagent.ExporterOption {
+	return ocagent.WithTLSCredentials(grpccredentials.MTLSClientCredentials(source, source, authorizer))
+}
+
+// Credentials are the workload identity of the exporter, as obtained from
+// the SPIFFE Workload API and kept up to date by it.
+type Credentials struct {
+	source     *workloadapi.X509Source
+	authorizer tlsconfig.Authorizer
+}
+
+// NewCredentials connects to the SPIFFE Workload API, at the address in
+// the SPIFFE_ENDPOINT_SOCKET environment variable unless opts configure
+// another one, and waits for the first X.509 SVID of the workload, or
+// until ctx is done. The agent is accepted if authorizer allows it.
+func NewCredentials(ctx context.Context, authorizer tlsconfig.Authorizer, opts ...workloadapi.X509SourceOption) (*Credentials, error) {
+	source, err := workloadapi.NewX509Source(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Credentials{source: source, authorizer: authorizer}, nil
+}
+
+// ExporterOption returns the option that makes an exporter authenticate
+// with c, see WithX509Source.
+func (c *Credentials) ExporterOption() ocagent.ExporterOption {
+	return WithX509Source(c.source, c.authorizer)
+}
+
+// Close closes the connection to the Workload API. It must only be called
+// once the exporters using c are stopped.
+func (c *Credentials) Close() error {
+	return c.source.Close()
+}
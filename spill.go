@@ -0,0 +1,70 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+
+	"go.opencensus.io/trace"
+)
+
+type spillExporter struct {
+	trace.Exporter
+}
+
+var _ ExporterOption = (*spillExporter)(nil)
+
+func (se *spillExporter) withExporter(e *Exporter) {
+	e.spillExporter = se.Exporter
+}
+
+// WithSpillExporter registers a fallback exporter, e.g. one that writes to a
+// local file or to a log, that receives the spans which would otherwise be
+// dropped, either because the span buffer overflowed, including the spans
+// dropped by WithErrorSpanPriority and WithLoadShedding, or because the
+// exporter was disconnected from the agent when their batch was due, unless
+// WithSpool was used. exp must not block for long, since it is invoked from
+// ExportSpan and from the goroutine that batches spans.
+func WithSpillExporter(exp trace.Exporter) ExporterOption {
+	return &spillExporter{Exporter: exp}
+}
+
+// spill hands sd, which is dropped for reason, over
+// to the spill exporter, if one was registered.
+func (ae *Exporter) spill(sd *trace.SpanData, reason string) {
+	atomic.AddInt64(&ae.counters.droppedSpans, 1)
+	ae.recordEvent(EventDropped, "spans: "+reason, 1)
+	if ae.spillExporter != nil && sd != nil {
+		ae.spillExporter.ExportSpan(sd)
+	}
+}
+
+// spillBundle hands the spans of bundled over to the spill exporter if they
+// would be dropped for lack of a connection. It reports whether it did so.
+func (ae *Exporter) spillBundle(bundled []*bundledSpan) bool {
+	if ae.spillExporter == nil || ae.spool != nil || ae.connected() {
+		return false
+	}
+	for _, bs := range bundled {
+		if bs.span == nil {
+			for _, sd := range bs.batchData {
+				ae.spill(sd, dropReasonDisconnected)
+			}
+			continue
+		}
+		ae.spill(bs.sd, dropReasonDisconnected)
+	}
+	return true
+}
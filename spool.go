@@ -0,0 +1,308 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+const defaultSpoolMaxBytes = 32 * 1024 * 1024
+
+var errSpoolFull = errors.New("spool is full")
+
+// SpoolParams configures the on-disk buffer that batches are
+// written to while the exporter is disconnected from the agent.
+type SpoolParams struct {
+	// Path is the spool file. Batches left over in it by a previous
+	// process are replayed once the exporter connects to the agent.
+	// How far they were replayed is kept in Path+".offset".
+	Path string
+	// MaxBytes bounds the size of the spool file, batches that do
+	// not fit are dropped. It defaults to 32MiB. The batches already
+	// replayed count until all of them are and the file is emptied.
+	MaxBytes int64
+}
+
+// record is a single request read back from a file
+// written in the TeeFormatProto format.
+type record struct {
+	traces  *agenttracepb.ExportTraceServiceRequest
+	metrics *agentmetricspb.ExportMetricsServiceRequest
+	// data is the encoding of the request, as read.
+	data []byte
+}
+
+func (rec *record) request() *marshaledRequest {
+	if rec.traces != nil {
+		return &marshaledRequest{Message: rec.traces, data: rec.data}
+	}
+	return &marshaledRequest{Message: rec.metrics, data: rec.data}
+}
+
+var errTruncatedRecord = errors.New("truncated record")
+
+func decodeProtoRecord(signal byte, msg []byte) (*record, error) {
+	rec := &record{data: msg}
+	var err error
+	switch signal {
+	case teeSignalTraces[0]:
+		rec.traces = new(agenttracepb.ExportTraceServiceRequest)
+		err = proto.Unmarshal(msg, rec.traces)
+	case teeSignalMetrics[0]:
+		rec.metrics = new(agentmetricspb.ExportMetricsServiceRequest)
+		err = proto.Unmarshal(msg, rec.metrics)
+	default:
+		err = fmt.Errorf("unknown signal %q", signal)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// spool is a bounded, append-only file of batches that could not be sent.
+// They are replayed from a read offset, saved in a file next to the spool
+// as each batch is sent, so that a crash during the replay only sends the
+// batch in flight again. The spool is emptied once all were replayed.
+type spool struct {
+	maxBytes int64
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// offsetFile holds offset, where the first batch not yet replayed starts.
+	offsetFile *os.File
+	offset     int64
+}
+
+func openSpool(params SpoolParams) (*spool, error) {
+	if params.Path == "" {
+		return nil, fmt.Errorf("ocagent: spool: empty path")
+	}
+	maxBytes := params.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	f, err := os.OpenFile(params.Path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("ocagent: spool: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("ocagent: spool: %v", err)
+	}
+	offsetFile, err := os.OpenFile(params.Path+".offset", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("ocagent: spool: %v", err)
+	}
+	sp := &spool{maxBytes: maxBytes, f: f, size: fi.Size(), offsetFile: offsetFile}
+	var b [8]byte
+	if n, _ := offsetFile.ReadAt(b[:], 0); n == len(b) {
+		sp.offset = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	if sp.offset < 0 || sp.offset > sp.size {
+		// The spool was emptied before the offset could be reset.
+		sp.offset = 0
+	}
+	return sp, nil
+}
+
+func (sp *spool) append(signal string, req proto.Message) error {
+	blob, err := encodeProtoRecord(signal, req)
+	if err != nil {
+		return err
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.f == nil {
+		return errStopped
+	}
+	if sp.size+int64(len(blob)) > sp.maxBytes {
+		return errSpoolFull
+	}
+	n, err := sp.f.Write(blob)
+	sp.size += int64(n)
+	return err
+}
+
+// empty reports whether all the spooled batches were replayed.
+func (sp *spool) empty() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	return sp.offset >= sp.size
+}
+
+// next reads the first record not yet replayed, and returns it along with
+// the offset where it ends, to pass to ack once it is sent. It returns a nil
+// record once all were replayed. A record that can't be decoded is returned
+// with an error and the offset past it, or past all the records if it is
+// truncated, so that it is skipped; a failure to read it with a zero offset.
+func (sp *spool) next() (*record, int64, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.f == nil || sp.offset >= sp.size {
+		return nil, 0, nil
+	}
+	var header [1 + binary.MaxVarintLen64]byte
+	n, err := sp.f.ReadAt(header[:], sp.offset)
+	if err != nil && err != io.EOF {
+		return nil, 0, err
+	}
+	size, sizeLen := proto.DecodeVarint(header[1:n])
+	start := sp.offset + 1 + int64(sizeLen)
+	if sizeLen == 0 || size > uint64(sp.size-start) {
+		// A partially written record, after a crash.
+		return nil, sp.size, errTruncatedRecord
+	}
+	msg := make([]byte, size)
+	if _, err := sp.f.ReadAt(msg, start); err != nil {
+		return nil, 0, err
+	}
+	end := start + int64(size)
+	rec, err := decodeProtoRecord(header[0], msg)
+	return rec, end, err
+}
+
+// ack marks the records before end as replayed,
+// emptying the spool once all of them are.
+func (sp *spool) ack(end int64) error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.f == nil {
+		return errStopped
+	}
+	if end >= sp.size {
+		if err := sp.f.Truncate(0); err != nil {
+			return err
+		}
+		sp.size, end = 0, 0
+	}
+	sp.offset = end
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(sp.offset))
+	_, err := sp.offsetFile.WriteAt(b[:], 0)
+	return err
+}
+
+func (sp *spool) close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.f == nil {
+		return nil
+	}
+	err := sp.f.Close()
+	if oerr := sp.offsetFile.Close(); err == nil {
+		err = oerr
+	}
+	sp.f = nil
+	return err
+}
+
+// spoolRequest saves req to the spool, if one was configured,
+// so that it can be replayed once the connection recovers.
+func (ae *Exporter) spoolRequest(signal string, req proto.Message) {
+	if ae.spool == nil {
+		ae.dropRequest(req, dropReasonDisconnected)
+	} else if ae.spool.append(signal, req) != nil {
+		ae.dropRequest(req, dropReasonSpoolFull)
+	}
+}
+
+// replaySpool sends the spooled batches in order. It must only be invoked
+// by the sender goroutine, which keeps the spooled batches ahead of any
+// batch produced after them. A batch stays in the spool until it is sent.
+func (ae *Exporter) replaySpool() {
+	if ae.spool == nil || ae.spool.empty() {
+		return
+	}
+	for ae.connected() {
+		rec, end, err := ae.spool.next()
+		if err != nil && end == 0 {
+			return
+		}
+		if err == nil {
+			if rec == nil {
+				return
+			}
+			if ae.replayRecord(rec) != nil {
+				return
+			}
+		}
+		// A corrupt record can't be replayed, it is skipped.
+		if ae.spool.ack(end) != nil {
+			return
+		}
+	}
+}
+
+// replayRecord sends rec. It only fails if rec can be sent again later.
+func (ae *Exporter) replayRecord(rec *record) error {
+	if rec.metrics != nil {
+		return ae.exportMetricsRequest(rec.request())
+	}
+	// Spooled batches are sent as they were encoded, without marshaling them again.
+	var mtr *marshaledTraceRequest
+	var err error
+	if ae.evictStaleSpans(rec.traces, time.Now()) {
+		if len(rec.traces.Spans) == 0 {
+			return nil
+		}
+		if mtr, err = ae.marshalTraceRequest(rec.traces); err != nil {
+			return nil
+		}
+	} else if mtr, err = splitTraceRequest(rec.traces, rec.data); err != nil {
+		// A corrupt record can't be replayed, drop it.
+		return nil
+	}
+	start := time.Now()
+	switch err = ae.sendOnCurrentTraceStreams(mtr); {
+	case err == nil:
+		ae.traceExported(mtr, start)
+	case err != ErrTemporarilyDisconnected:
+		ae.setStateDisconnected(err)
+	}
+	return err
+}
+
+// kickSpool asks the sender goroutine to replay the spool, without
+// waiting for it, e.g. right after the connection was re-established.
+func (ae *Exporter) kickSpool() {
+	if ae.spool == nil || ae.spool.empty() {
+		return
+	}
+	select {
+	case ae.sendQueue <- outgoingBatch{replaySpool: true}:
+	default:
+	}
+}
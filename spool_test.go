@@ -0,0 +1,114 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestSpool_keepsBatchesUntilReplayed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-spool")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	params := SpoolParams{Path: filepath.Join(dir, "spool")}
+
+	sp, err := openSpool(params)
+	if err != nil {
+		t.Fatalf("Failed to open the spool: %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		req := &agenttracepb.ExportTraceServiceRequest{Spans: []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: name}}}}
+		if err := sp.append(teeSignalTraces, req); err != nil {
+			t.Fatalf("Failed to spool %q: %v", name, err)
+		}
+	}
+	next := func(sp *spool) (string, int64) {
+		rec, end, err := sp.next()
+		if err != nil || rec == nil {
+			t.Fatalf("next: got %v, %v", rec, err)
+		}
+		return rec.traces.Spans[0].Name.GetValue(), end
+	}
+	name, end := next(sp)
+	if name != "a" {
+		t.Errorf("First batch: got %q want %q", name, "a")
+	}
+	if err := sp.ack(end); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	// The process dies while "b" is being sent.
+	next(sp)
+	if err := sp.close(); err != nil {
+		t.Fatalf("Failed to close the spool: %v", err)
+	}
+
+	sp, err = openSpool(params)
+	if err != nil {
+		t.Fatalf("Failed to reopen the spool: %v", err)
+	}
+	defer sp.close()
+	for _, want := range []string{"b", "c"} {
+		name, end := next(sp)
+		if name != want {
+			t.Errorf("Replayed batch: got %q want %q", name, want)
+		}
+		if err := sp.ack(end); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+	}
+	if !sp.empty() {
+		t.Error("The spool isn't empty once all was replayed")
+	}
+	if fi, err := os.Stat(params.Path); err != nil || fi.Size() != 0 {
+		t.Errorf("The spool file wasn't emptied: %v, %v", fi, err)
+	}
+}
+
+func TestSpool_skipsTruncatedRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-spool")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spool")
+	// A record of 100 bytes, cut short by a crash.
+	if err := ioutil.WriteFile(path, []byte{teeSignalTraces[0], 100, 1, 2}, 0644); err != nil {
+		t.Fatalf("Failed to write the spool: %v", err)
+	}
+
+	sp, err := openSpool(SpoolParams{Path: path})
+	if err != nil {
+		t.Fatalf("Failed to open the spool: %v", err)
+	}
+	defer sp.close()
+	rec, end, err := sp.next()
+	if rec != nil || err != errTruncatedRecord || end != 4 {
+		t.Fatalf("next: got %v, %d, %v", rec, end, err)
+	}
+	if err := sp.ack(end); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if !sp.empty() {
+		t.Error("The truncated record wasn't skipped")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync/atomic"
+	"time"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// evictStaleSpans removes from req the spans that ended more than the
+// max span age before now, and accounts for them as dropped. It reports
+// whether any span was evicted.
+func (ae *Exporter) evictStaleSpans(req *agenttracepb.ExportTraceServiceRequest, now time.Time) bool {
+	if ae.maxSpanAge <= 0 {
+		return false
+	}
+	cutoff := now.Add(-ae.maxSpanAge)
+	fresh := req.Spans[:0:0]
+	for _, span := range req.Spans {
+		if !endedBefore(span, cutoff) {
+			fresh = append(fresh, span)
+		}
+	}
+	evicted := int64(len(req.Spans) - len(fresh))
+	if evicted == 0 {
+		return false
+	}
+	req.Spans = fresh
+	atomic.AddInt64(&ae.counters.droppedSpans, evicted)
+	ae.recordEvent(EventDropped, "spans: "+dropReasonStale, evicted)
+	return true
+}
+
+// endedBefore reports whether span ended, or started if it has
+// no end time, before t. The age of a span without either is unknown.
+func endedBefore(span *tracepb.Span, t time.Time) bool {
+	ts := span.EndTime
+	if ts == nil {
+		ts = span.StartTime
+	}
+	return ts != nil && time.Unix(ts.Seconds, int64(ts.Nanos)).Before(t)
+}
@@ -0,0 +1,72 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+
+	"contrib.go.opencensus.io/exporter/ocagent/transform"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestEvictStaleSpans(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	span := func(name string, start, end time.Time) *tracepb.Span {
+		s := &tracepb.Span{Name: &tracepb.TruncatableString{Value: name}}
+		if !start.IsZero() {
+			s.StartTime = transform.Timestamp(start)
+		}
+		if !end.IsZero() {
+			s.EndTime = transform.Timestamp(end)
+		}
+		return s
+	}
+	req := &agenttracepb.ExportTraceServiceRequest{Spans: []*tracepb.Span{
+		span("stale", now.Add(-3*time.Hour), now.Add(-2*time.Hour)),
+		span("fresh", now.Add(-3*time.Hour), now.Add(-time.Minute)),
+		span("stale-unended", now.Add(-2*time.Hour), time.Time{}),
+		span("unknown", time.Time{}, time.Time{}),
+	}}
+
+	ae := &Exporter{maxSpanAge: time.Hour, events: newEventRing(4)}
+	if !ae.evictStaleSpans(req, now) {
+		t.Fatal("No span was evicted")
+	}
+	var names []string
+	for _, s := range req.Spans {
+		names = append(names, s.Name.Value)
+	}
+	if len(names) != 2 || names[0] != "fresh" || names[1] != "unknown" {
+		t.Errorf("Got spans %v, want [fresh unknown]", names)
+	}
+	if got := ae.counters.droppedSpans; got != 2 {
+		t.Errorf("Got %d dropped spans, want 2", got)
+	}
+	if events := ae.RecentEvents(); len(events) != 1 || events[0].Detail != "spans: "+dropReasonStale || events[0].Count != 2 {
+		t.Errorf("Got events %+v, want 2 stale spans dropped", events)
+	}
+
+	if ae.evictStaleSpans(req, now) {
+		t.Error("Fresh spans were evicted")
+	}
+	if (&Exporter{}).evictStaleSpans(&agenttracepb.ExportTraceServiceRequest{Spans: []*tracepb.Span{
+		span("stale", now.Add(-3*time.Hour), now.Add(-2*time.Hour)),
+	}}, now) {
+		t.Error("Spans were evicted without WithMaxSpanAge")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+)
+
+// ErrTemporarilyDisconnected is returned by the exports that raced with a
+// reconnection to the agent: either the streams to send on weren't open yet,
+// or they were replaced while the batch was being sent on them. The batch
+// can be exported again once the exporter has reconnected.
+var ErrTemporarilyDisconnected = errors.New("ocagent: temporarily disconnected from the agent")
+
+// streamGenerations count the times that the trace and the metrics
+// streams were replaced, so that a send that fails on streams replaced
+// meanwhile isn't taken for a failure of the current streams.
+type streamGenerations struct {
+	traces  uint64
+	metrics uint64
+}
+
+// sendOnCurrentTraceStreams sends batch on the current trace streams.
+// It returns ErrTemporarilyDisconnected if there are none, or if they
+// were replaced while the send failed.
+func (ae *Exporter) sendOnCurrentTraceStreams(batch *marshaledTraceRequest) error {
+	ae.mu.RLock()
+	streams, gen := ae.traceStreams, ae.streamGenerations.traces
+	ae.mu.RUnlock()
+	if len(streams) == 0 {
+		return ErrTemporarilyDisconnected
+	}
+
+	err := sendOnTraceStreams(streams, batch)
+	if err != nil {
+		ae.mu.RLock()
+		replaced := ae.streamGenerations.traces != gen
+		ae.mu.RUnlock()
+		if replaced {
+			return ErrTemporarilyDisconnected
+		}
+	}
+	return err
+}
+
+// metricsStreamReplaced reports whether the metrics streams
+// were replaced since they were at generation gen.
+func (ae *Exporter) metricsStreamReplaced(gen uint64) bool {
+	ae.mu.RLock()
+	defer ae.mu.RUnlock()
+	return ae.streamGenerations.metrics != gen
+}
@@ -0,0 +1,69 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+	"testing"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// failingTraceClient fails every send, after invoking onSend.
+type failingTraceClient struct {
+	agenttracepb.TraceService_ExportClient
+	onSend func()
+}
+
+var errSendFailed = errors.New("send failed")
+
+func (ftc *failingTraceClient) SendMsg(interface{}) error {
+	ftc.onSend()
+	return errSendFailed
+}
+
+func TestExporter_sendOnCurrentTraceStreams(t *testing.T) {
+	ae := new(Exporter)
+	batch, err := ae.marshalTraceRequest(&agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: make([]byte, 16), SpanId: make([]byte, 8)}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal the batch: %v", err)
+	}
+
+	if err := ae.sendOnCurrentTraceStreams(batch); err != ErrTemporarilyDisconnected {
+		t.Errorf("Without streams: got %v, want ErrTemporarilyDisconnected", err)
+	}
+
+	replace := false
+	client := &failingTraceClient{onSend: func() {
+		if replace {
+			ae.mu.Lock()
+			ae.streamGenerations.traces++
+			ae.mu.Unlock()
+		}
+	}}
+	ae.traceStreams = []*traceStream{{client: client, done: make(chan struct{})}}
+	if err := ae.sendOnCurrentTraceStreams(batch); err != errSendFailed {
+		t.Errorf("On the current streams: got %v, want %v", err, errSendFailed)
+	}
+
+	// The streams are replaced while the send fails.
+	replace = true
+	if err := ae.sendOnCurrentTraceStreams(batch); err != ErrTemporarilyDisconnected {
+		t.Errorf("On replaced streams: got %v, want ErrTemporarilyDisconnected", err)
+	}
+}
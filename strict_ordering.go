@@ -0,0 +1,42 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import "errors"
+
+var errStrictOrderingTraceComplete = errors.New("ocagent: WithStrictOrdering can't be combined with WithTraceCompleteBatching")
+
+// checkStrictOrdering rejects the options that reorder spans,
+// if the exporter was asked to keep them in order.
+func (ae *Exporter) checkStrictOrdering() error {
+	if ae.strictOrdering && ae.traceAssembler != nil {
+		return errStrictOrderingTraceComplete
+	}
+	return nil
+}
+
+// traceStreamLayout returns the number of trace streams to open and the
+// size in bytes above which batches go out on compressed twin streams,
+// or 0 for none. Strict ordering needs all the spans on a single stream.
+func (ae *Exporter) traceStreamLayout() (numStreams, compressAbove int) {
+	if ae.strictOrdering {
+		return 1, 0
+	}
+	numStreams = ae.numTraceStreams
+	if numStreams < 1 {
+		numStreams = 1
+	}
+	return numStreams, ae.traceCompressionThreshold
+}
@@ -0,0 +1,92 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+)
+
+func TestWithStrictOrdering(t *testing.T) {
+	ma := runMockAgent(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithAddress(ma.address),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithTraceStreams(4),
+		ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BundleCountThreshold: 3}),
+		ocagent.WithStrictOrdering())
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	n := 60
+	for i := 0; i < n; i++ {
+		if i == n/2 {
+			// Replacing the bundler doesn't let the new spans overtake the buffered ones.
+			if err := exp.UpdateOptions(ocagent.WithTraceBundlerOptions(ocagent.BundlerOptions{BundleCountThreshold: 5})); err != nil {
+				t.Fatalf("UpdateOptions: %v", err)
+			}
+		}
+		exp.ExportSpan(&trace.SpanData{
+			SpanContext: trace.SpanContext{TraceID: trace.TraceID{byte(i), 1, 2, 3}},
+			Name:        fmt.Sprintf("span-%02d", i),
+		})
+	}
+	exp.Flush()
+	<-time.After(50 * time.Millisecond)
+
+	if err := exp.Stop(); err != nil {
+		t.Errorf("Failed to stop the exporter: %v", err)
+	}
+	ma.stop()
+
+	spans := ma.getSpans()
+	if g, w := len(spans), n; g != w {
+		t.Fatalf("Spans: got %d want %d", g, w)
+	}
+	for i, span := range spans {
+		if g, w := span.GetName().GetValue(), fmt.Sprintf("span-%02d", i); g != w {
+			t.Errorf("Span #%d: got %q want %q", i, g, w)
+		}
+	}
+	var nodes int
+	for _, node := range ma.getTraceNodes() {
+		if node != nil {
+			nodes++
+		}
+	}
+	if g, w := nodes, 1; g != w {
+		t.Errorf("Initiated streams: got %d want %d", g, w)
+	}
+}
+
+func TestWithStrictOrdering_traceCompleteBatching(t *testing.T) {
+	_, err := ocagent.NewUnstartedExporter(
+		ocagent.WithInsecure(),
+		ocagent.WithStrictOrdering(),
+		ocagent.WithTraceCompleteBatching(time.Second))
+	if err == nil {
+		t.Fatal("NewUnstartedExporter succeeded, want an error")
+	}
+}
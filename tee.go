@@ -0,0 +1,177 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// TeeFormat is the encoding of the requests written by WithTeeFile.
+type TeeFormat int
+
+const (
+	// TeeFormatProto writes each request as a single signal byte ('t' for
+	// traces, 'm' for metrics) followed by the varint length-prefixed
+	// binary protobuf encoding of the request.
+	TeeFormatProto TeeFormat = iota
+	// TeeFormatJSON writes each request as one line of JSON of the form
+	//   {"signal":"traces","request":{...}}
+	// where request is the JSON protobuf encoding of the request.
+	TeeFormatJSON
+)
+
+const (
+	teeSignalTraces  = "traces"
+	teeSignalMetrics = "metrics"
+)
+
+// TeeFileParams configures the file that outgoing requests are copied to.
+type TeeFileParams struct {
+	// Path is the file that requests are appended to.
+	Path   string
+	Format TeeFormat
+	// MaxBytes is the size after which the file is rotated to Path.1,
+	// the previous Path.1 to Path.2 and so on. Zero disables rotation.
+	MaxBytes int64
+	// MaxBackups is the number of rotated files that are kept,
+	// it defaults to 1.
+	MaxBackups int
+}
+
+// teeFile appends every request sent to the agent to a local file.
+type teeFile struct {
+	params TeeFileParams
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openTeeFile(params TeeFileParams) (*teeFile, error) {
+	if params.Path == "" {
+		return nil, fmt.Errorf("ocagent: tee file: empty path")
+	}
+	if params.MaxBackups <= 0 {
+		params.MaxBackups = 1
+	}
+	tf := &teeFile{params: params}
+	if err := tf.open(); err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+func (tf *teeFile) open() error {
+	f, err := os.OpenFile(tf.params.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("ocagent: tee file: %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("ocagent: tee file: %v", err)
+	}
+	tf.f = f
+	tf.size = fi.Size()
+	return nil
+}
+
+func (tf *teeFile) rotate() error {
+	if err := tf.f.Close(); err != nil {
+		return err
+	}
+	path := tf.params.Path
+	for i := tf.params.MaxBackups; i > 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", path, i-1), fmt.Sprintf("%s.%d", path, i))
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+	return tf.open()
+}
+
+func (tf *teeFile) encode(signal string, req proto.Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	switch tf.params.Format {
+	case TeeFormatJSON:
+		fmt.Fprintf(buf, `{"signal":%q,"request":`, signal)
+		if err := new(jsonpb.Marshaler).Marshal(buf, unwrapRequest(req)); err != nil {
+			return nil, err
+		}
+		buf.WriteString("}\n")
+
+	default:
+		return encodeProtoRecord(signal, req)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeProtoRecord encodes req in the TeeFormatProto format.
+func encodeProtoRecord(signal string, req proto.Message) ([]byte, error) {
+	pb := proto.NewBuffer([]byte{signal[0]})
+	if err := pb.EncodeMessage(req); err != nil {
+		return nil, err
+	}
+	return pb.Bytes(), nil
+}
+
+func (tf *teeFile) write(signal string, req proto.Message) error {
+	blob, err := tf.encode(signal, req)
+	if err != nil {
+		return err
+	}
+
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	if tf.f == nil {
+		return errStopped
+	}
+	if max := tf.params.MaxBytes; max > 0 && tf.size > 0 && tf.size+int64(len(blob)) > max {
+		if err := tf.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := tf.f.Write(blob)
+	tf.size += int64(n)
+	return err
+}
+
+func (tf *teeFile) close() error {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	if tf.f == nil {
+		return nil
+	}
+	err := tf.f.Close()
+	tf.f = nil
+	return err
+}
+
+// teeRequest copies req to the tee file, if one was configured, and prints
+// it with DebugEnvVar. Failing to do so must not affect the export itself.
+func (ae *Exporter) teeRequest(signal string, req proto.Message) {
+	ae.debugRequest(signal, req)
+	if ae.teeFile != nil {
+		_ = ae.teeFile.write(signal, req)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func TestTeeFile_jsonWithRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-tee")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "requests.json")
+	tf, err := openTeeFile(TeeFileParams{Path: path, Format: TeeFormatJSON, MaxBytes: 100})
+	if err != nil {
+		t.Fatalf("Failed to open the tee file: %v", err)
+	}
+	defer tf.close()
+
+	req := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: "teed"}}},
+	}
+	for i := 0; i < 3; i++ {
+		if err := tf.write(teeSignalTraces, req); err != nil {
+			t.Fatalf("#%d: Failed to write to the tee file: %v", i, err)
+		}
+	}
+
+	want := `{"signal":"traces","request":{"spans":[{"name":{"value":"teed"}}]}}` + "\n"
+	for _, p := range []string{path, path + ".1"} {
+		blob, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatalf("Failed to read %q: %v", p, err)
+		}
+		if g := string(blob); g != want {
+			t.Errorf("%q:\nGot:  %q\nWant: %q", p, g, want)
+		}
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("Expected only a single backup, got error: %v", err)
+	}
+}
+
+func TestTeeFile_proto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent-tee")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "requests.pb")
+	tf, err := openTeeFile(TeeFileParams{Path: path})
+	if err != nil {
+		t.Fatalf("Failed to open the tee file: %v", err)
+	}
+	req := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{Name: &tracepb.TruncatableString{Value: "teed"}}},
+	}
+	if err := tf.write(teeSignalTraces, req); err != nil {
+		t.Fatalf("Failed to write to the tee file: %v", err)
+	}
+	if err := tf.close(); err != nil {
+		t.Fatalf("Failed to close the tee file: %v", err)
+	}
+
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the tee file: %v", err)
+	}
+	if !strings.HasPrefix(string(blob), "t") || !strings.Contains(string(blob), "teed") {
+		t.Errorf("Unexpected tee file content: %q", blob)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+)
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx that associates the batches exported with it
+// with tenant. ExportTraceServiceRequestContext and ExportMetricsServiceRequestContext
+// then send them with the headers configured for tenant by WithTenantHeaders.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+func tenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok
+}
+
+// headersFor returns the headers to send the batches of signal of the tenant of
+// ctx with, the ones of signalHeaders overridden by the ones of the tenant, if any.
+func (ae *Exporter) headersFor(ctx context.Context, signal string) (map[string]string, error) {
+	headers := ae.signalHeaders(signal)
+	tenant, ok := tenantFromContext(ctx)
+	if !ok {
+		return headers, nil
+	}
+	tenantHeaders, ok := ae.tenantHeaders[tenant]
+	if !ok {
+		return nil, fmt.Errorf("ocagent: no headers for tenant %q", tenant)
+	}
+	merged := make(map[string]string, len(headers)+len(tenantHeaders))
+	for k, v := range headers {
+		merged[k] = v
+	}
+	for k, v := range tenantHeaders {
+		merged[k] = v
+	}
+	return merged, nil
+}
+
+// tenantMetricsStream is the metrics stream of a tenant, opened with its headers.
+type tenantMetricsStream struct {
+	mu     sync.Mutex
+	cc     *grpc.ClientConn
+	client agentmetricspb.MetricsService_ExportClient
+}
+
+// ExportMetricsServiceRequestContext is like ExportMetricsServiceRequest but, if ctx was
+// returned by WithTenant, the batch is sent on a metrics stream of its own for the tenant,
+// opened with its headers. Such a stream failing, e.g. because the agent rejected the
+// credentials of the tenant, doesn't affect the state of the connection to the agent.
+func (ae *Exporter) ExportMetricsServiceRequestContext(ctx context.Context, batch *agentmetricspb.ExportMetricsServiceRequest) error {
+	tenant, ok := tenantFromContext(ctx)
+	if !ok {
+		return ae.ExportMetricsServiceRequest(batch)
+	}
+	if batch == nil || len(batch.Metrics) == 0 {
+		return nil
+	}
+	if ae.dryRun != nil {
+		for _, metric := range batch.Metrics {
+			ae.validateMetric(metric)
+		}
+		return nil
+	}
+	headers, err := ae.headersFor(ctx, teeSignalMetrics)
+	if err != nil {
+		return err
+	}
+	mr, err := ae.marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ae.stopCh:
+		return errStopped
+	default:
+	}
+	if lastConnectErr := ae.lastConnectError(); lastConnectErr != nil {
+		return fmt.Errorf("ExportMetricsServiceRequestContext: no active connection, last connection error: %v", lastConnectErr)
+	}
+
+	if err := ae.waitThrottle(ctx); err != nil {
+		return err
+	}
+	ts := ae.tenantMetricsStream(tenant)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ae.mu.RLock()
+	cc := ae.grpcClientConn
+	ae.mu.RUnlock()
+	if ts.client == nil || ts.cc != cc {
+		// The stream outlives ctx, it is opened, or reopened after a
+		// reconnection, on the current connection.
+		client, err := openMetricsStream(withOutgoingHeaders(context.Background(), headers), agentmetricspb.NewMetricsServiceClient(cc), ae.nodeInfo, ae.resource, ae.exportCallOptions(true))
+		if err != nil {
+			return err
+		}
+		ts.cc, ts.client = cc, client
+	}
+
+	ae.teeRequest(teeSignalMetrics, mr)
+	start := time.Now()
+	if err := ts.client.SendMsg(mr); err != nil {
+		if err == io.EOF {
+			// Perform a .Recv to try to find out why the RPC actually ended.
+			for {
+				_, err = ts.client.Recv()
+				if err != nil {
+					break
+				}
+			}
+		}
+		ts.client = nil
+		ae.throttleOn(err)
+		return err
+	}
+	ae.metricsExported(mr, start)
+	return nil
+}
+
+func (ae *Exporter) tenantMetricsStream(tenant string) *tenantMetricsStream {
+	ae.tenantStreamsMu.Lock()
+	defer ae.tenantStreamsMu.Unlock()
+	ts, ok := ae.tenantMetricsStreams[tenant]
+	if !ok {
+		if ae.tenantMetricsStreams == nil {
+			ae.tenantMetricsStreams = make(map[string]*tenantMetricsStream)
+		}
+		ts = new(tenantMetricsStream)
+		ae.tenantMetricsStreams[tenant] = ts
+	}
+	return ts
+}
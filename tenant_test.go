@@ -0,0 +1,160 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	agentmetricspb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/metrics/v1"
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// headersAgent records the "tenant-id" and "authorization" headers of every
+// message that it receives, on any service.
+type headersAgent struct {
+	mu       sync.Mutex
+	received map[string][]string
+}
+
+func (ha *headersAgent) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	record := func() {
+		ha.mu.Lock()
+		ha.received[method] = append(ha.received[method], firstValue(md["tenant-id"])+"/"+firstValue(md["authorization"]))
+		ha.mu.Unlock()
+	}
+	switch method {
+	case exportOneMethod:
+		if err := stream.RecvMsg(new(agenttracepb.ExportTraceServiceRequest)); err != nil {
+			return err
+		}
+		record()
+		return stream.SendMsg(new(agenttracepb.ExportTraceServiceResponse))
+	case "/opencensus.proto.agent.metrics.v1.MetricsService/Export":
+		for {
+			req := new(agentmetricspb.ExportMetricsServiceRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			if len(req.Metrics) > 0 {
+				record()
+			}
+		}
+	default:
+		for {
+			if err := stream.RecvMsg(new(agenttracepb.ExportTraceServiceRequest)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (ha *headersAgent) headers(method string) []string {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+	headers := append([]string(nil), ha.received[method]...)
+	sort.Strings(headers)
+	return headers
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func TestExporter_tenantHeaders(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+	ha := &headersAgent{received: make(map[string][]string)}
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(ha.handle))
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	ae, err := NewExporter(
+		WithInsecure(),
+		WithAddress(ln.Addr().String()),
+		WithReconnectionPeriod(10*time.Millisecond),
+		WithHeaders(map[string]string{"authorization": "shared"}),
+		WithTenantHeaders(map[string]map[string]string{
+			"a": {"tenant-id": "a", "authorization": "token-a"},
+			"b": {"tenant-id": "b"},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer ae.Stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for !ae.connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("The exporter didn't connect to the agent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	spans := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}}},
+	}
+	metrics := &agentmetricspb.ExportMetricsServiceRequest{
+		Metrics: []*metricspb.Metric{{MetricDescriptor: &metricspb.MetricDescriptor{Name: "m"}}},
+	}
+	for _, tenant := range []string{"a", "b"} {
+		ctx := WithTenant(context.Background(), tenant)
+		if err := ae.ExportTraceServiceRequestContext(ctx, spans); err != nil {
+			t.Errorf("Tenant %q: failed to export spans: %v", tenant, err)
+		}
+		if err := ae.ExportMetricsServiceRequestContext(ctx, metrics); err != nil {
+			t.Errorf("Tenant %q: failed to export metrics: %v", tenant, err)
+		}
+	}
+	unknown := WithTenant(context.Background(), "c")
+	if err := ae.ExportTraceServiceRequestContext(unknown, spans); err == nil {
+		t.Error("Exported spans for a tenant without headers")
+	}
+	if err := ae.ExportMetricsServiceRequestContext(unknown, metrics); err == nil {
+		t.Error("Exported metrics for a tenant without headers")
+	}
+
+	want := []string{"a/token-a", "b/shared"}
+	if got := ha.headers(exportOneMethod); !reflect.DeepEqual(got, want) {
+		t.Errorf("Span headers: got %q, want %q", got, want)
+	}
+	metricsMethod := "/opencensus.proto.agent.metrics.v1.MetricsService/Export"
+	for time.Now().Before(deadline) && len(ha.headers(metricsMethod)) < len(want) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := ha.headers(metricsMethod); !reflect.DeepEqual(got, want) {
+		t.Errorf("Metric headers: got %q, want %q", got, want)
+	}
+}
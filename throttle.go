@@ -0,0 +1,100 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxThrottleDelay caps the pauses requested by the agent, so that a bogus
+// RetryInfo can't hold the exporter, and Stop, indefinitely.
+const maxThrottleDelay = time.Minute
+
+// retryDelay returns the delay that the agent asks to wait before the next
+// export, in the RetryInfo details of a RESOURCE_EXHAUSTED err.
+func retryDelay(err error) (time.Duration, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+	for _, detail := range st.Details() {
+		ri, ok := detail.(*errdetails.RetryInfo)
+		if !ok {
+			continue
+		}
+		delay, err := ptypes.Duration(ri.GetRetryDelay())
+		if err != nil || delay <= 0 {
+			return 0, false
+		}
+		if delay > maxThrottleDelay {
+			delay = maxThrottleDelay
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// throttleOn pauses the exports for the delay that err asks for, if any. It
+// reports whether it did, in which case the batch shouldn't be retried or
+// split, which would only worsen the overload of the agent.
+func (ae *Exporter) throttleOn(err error) bool {
+	delay, ok := retryDelay(err)
+	if !ok {
+		return false
+	}
+	ae.pauseExports(delay, delay.String())
+	return true
+}
+
+// pauseExports pauses the exports for delay, unless they are already paused
+// for longer, and records an EventThrottled with detail if it did.
+func (ae *Exporter) pauseExports(delay time.Duration, detail string) {
+	until := time.Now().Add(delay).UnixNano()
+	for {
+		prev := atomic.LoadInt64(&ae.throttledUntilUnixNano)
+		if prev >= until {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&ae.throttledUntilUnixNano, prev, until) {
+			ae.recordEvent(EventThrottled, detail, 0)
+			return
+		}
+	}
+}
+
+// waitThrottle waits until the pause requested by the agent, if any, is over.
+func (ae *Exporter) waitThrottle(ctx context.Context) error {
+	delay := time.Until(time.Unix(0, atomic.LoadInt64(&ae.throttledUntilUnixNano)))
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-ae.stopCh:
+		return errStopped
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+func resourceExhausted(t *testing.T, delay time.Duration) error {
+	st, err := status.New(codes.ResourceExhausted, "overloaded").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: ptypes.DurationProto(delay),
+	})
+	if err != nil {
+		t.Fatalf("Failed to add the RetryInfo: %v", err)
+	}
+	return st.Err()
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		want   time.Duration
+		wantOK bool
+	}{
+		{"retry info", resourceExhausted(t, 3*time.Second), 3 * time.Second, true},
+		{"capped", resourceExhausted(t, time.Hour), maxThrottleDelay, true},
+		{"no retry info", status.Error(codes.ResourceExhausted, "overloaded"), 0, false},
+		{"other code", status.Error(codes.Unavailable, "down"), 0, false},
+		{"not a status", errors.New("failed"), 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryDelay(tt.err)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: got %v, %t, want %v, %t", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestExporter_honorsRetryInfo(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	const delay = 200 * time.Millisecond
+	var mu sync.Mutex
+	var calls []time.Time
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		if method, _ := grpc.MethodFromServerStream(stream); method != exportOneMethod {
+			<-stream.Context().Done()
+			return nil
+		}
+		if err := stream.RecvMsg(new(agenttracepb.ExportTraceServiceRequest)); err != nil {
+			return err
+		}
+		mu.Lock()
+		calls = append(calls, time.Now())
+		first := len(calls) == 1
+		mu.Unlock()
+		if first {
+			return resourceExhausted(t, delay)
+		}
+		return stream.SendMsg(new(agenttracepb.ExportTraceServiceResponse))
+	}))
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	ae, err := NewExporter(
+		WithInsecure(),
+		WithAddress(ln.Addr().String()),
+		WithUnaryBatchExporter(UnaryExporterParams{}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer ae.Stop()
+
+	batch := &agenttracepb.ExportTraceServiceRequest{
+		Spans: []*tracepb.Span{{TraceId: []byte{1}, SpanId: []byte{1}}},
+	}
+	if err := ae.ExportTraceServiceRequest(batch); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Got %v, want a RESOURCE_EXHAUSTED error", err)
+	}
+	if !ae.connected() {
+		t.Error("The exporter was disconnected by a throttled unary export")
+	}
+	if err := ae.ExportTraceServiceRequest(batch); err != nil {
+		t.Fatalf("Failed to export after the pause: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 {
+		t.Fatalf("Got %d calls, want 2", len(calls))
+	}
+	if pause := calls[1].Sub(calls[0]); pause < delay*3/4 {
+		t.Errorf("The second export came %v after the first, want at least %v", pause, delay)
+	}
+}
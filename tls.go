@@ -0,0 +1,95 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"google.golang.org/grpc/credentials"
+)
+
+type systemCertPool []string
+
+var _ ExporterOption = (*systemCertPool)(nil)
+
+func (scp systemCertPool) withExporter(e *Exporter) {
+	e.systemCertPoolPEMFiles = append([]string{}, scp...)
+}
+
+// WithSystemCertPool makes the exporter connect to the agent over TLS,
+// verifying it against the host's root certificate authorities plus the
+// certificates in the optional extraPEMFiles. This covers agents behind a
+// public TLS load balancer, as well as those signed by a private CA that is
+// distributed as PEM files.
+//
+// The PEM files are read by NewExporter and NewUnstartedExporter, which fail
+// if a file can't be read or contains no certificates. WithTLSCredentials
+// takes precedence over this option.
+func WithSystemCertPool(extraPEMFiles ...string) ExporterOption {
+	return systemCertPool(extraPEMFiles)
+}
+
+func systemCertPoolCredentials(extraPEMFiles []string) (credentials.TransportCredentials, error) {
+	pool, err := systemCertPoolWith(extraPEMFiles)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{RootCAs: pool}), nil
+}
+
+// systemCertPoolWith returns the system certificate pool
+// plus the certificates in extraPEMFiles.
+func systemCertPoolWith(extraPEMFiles []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("ocagent: failed to load the system certificate pool: %v", err)
+	}
+	for _, path := range extraPEMFiles {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ocagent: failed to read PEM file: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ocagent: no certificates found in PEM file %q", path)
+		}
+	}
+	return pool, nil
+}
+
+// The options below are meant for development and staging environments
+// only. Production deployments should use WithTLSCredentials or
+// WithSystemCertPool, or rely on the default of verifying the agent against
+// the system's roots.
+
+type tlsInsecureSkipVerify int
+
+var _ ExporterOption = (*tlsInsecureSkipVerify)(nil)
+
+func (tlsInsecureSkipVerify) withExporter(e *Exporter) {
+	e.clientTransportCredentials = credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+}
+
+// WithTLSInsecureSkipVerify makes the exporter connect to the agent over TLS
+// without verifying the agent's certificate chain or host name. This is
+// intended for development and staging agents that serve self-signed
+// certificates: the connection is encrypted but open to man-in-the-middle
+// attacks, so it must not be used in production.
+//
+// It replaces any credentials set by WithTLSCredentials and, like them, takes
+// precedence over WithInsecure.
+func WithTLSInsecureSkipVerify() ExporterOption { return new(tlsInsecureSkipVerify) }
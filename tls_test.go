@@ -0,0 +1,201 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"contrib.go.opencensus.io/exporter/ocagent"
+	"go.opencensus.io/trace"
+)
+
+// runMockAgentWithSelfSignedTLS starts a mock agent serving the self-signed
+// certificate that net/http/httptest uses, valid for 127.0.0.1.
+func runMockAgentWithSelfSignedTLS(t *testing.T) (*mockAgent, *httptest.Server) {
+	ts := httptest.NewTLSServer(nil)
+	ts.Close()
+	cert := ts.TLS.Certificates[0]
+	creds := credentials.NewServerTLSFromCert(&cert)
+	ma := runMockAgentWithServerOptions(t, "127.0.0.1:0", grpc.Creds(creds))
+	ma.address = strings.Replace(ma.address, "localhost", "127.0.0.1", 1)
+	return ma, ts
+}
+
+func TestNewExporter_withTLSInsecureSkipVerify(t *testing.T) {
+	ma, _ := runMockAgentWithSelfSignedTLS(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithTLSInsecureSkipVerify(),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "self-signed"})
+	<-time.After(20 * time.Millisecond)
+	exp.Flush()
+	<-time.After(40 * time.Millisecond)
+
+	if got := len(ma.getSpans()); got != 1 {
+		t.Errorf("Got %d spans, want 1", got)
+	}
+}
+
+func TestNewExporter_tlsVerifiesByDefault(t *testing.T) {
+	ma, _ := runMockAgentWithSelfSignedTLS(t)
+	defer ma.stop()
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithTLSCredentials(credentials.NewTLS(&tls.Config{})),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "self-signed"})
+	<-time.After(20 * time.Millisecond)
+	exp.Flush()
+	<-time.After(40 * time.Millisecond)
+
+	if got := len(ma.getSpans()); got != 0 {
+		t.Errorf("Got %d spans from an unverified agent, want 0", got)
+	}
+}
+
+func TestNewExporter_withSystemCertPool(t *testing.T) {
+	ma, ts := runMockAgentWithSelfSignedTLS(t)
+	defer ma.stop()
+
+	dir, err := ioutil.TempDir("", "ocagent")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	pemPath := filepath.Join(dir, "agent.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := ioutil.WriteFile(pemPath, certPEM, 0600); err != nil {
+		t.Fatalf("Failed to write the PEM file: %v", err)
+	}
+
+	exp, err := ocagent.NewExporter(
+		ocagent.WithSystemCertPool(pemPath),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "private-ca"})
+	<-time.After(20 * time.Millisecond)
+	exp.Flush()
+	<-time.After(40 * time.Millisecond)
+
+	if got := len(ma.getSpans()); got != 1 {
+		t.Errorf("Got %d spans, want 1", got)
+	}
+}
+
+func TestNewUnstartedExporter_withSystemCertPoolBadPEMFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ocagent")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("Failed to write the file: %v", err)
+	}
+
+	for _, path := range []string{notPEM, filepath.Join(dir, "missing.pem")} {
+		if _, err := ocagent.NewUnstartedExporter(ocagent.WithSystemCertPool(path)); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestNewExporter_withFIPSTLS(t *testing.T) {
+	ma, ts := runMockAgentWithSelfSignedTLS(t)
+	defer ma.stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	exp, err := ocagent.NewExporter(
+		ocagent.WithFIPSTLS(&tls.Config{RootCAs: roots}),
+		ocagent.WithReconnectionPeriod(50*time.Millisecond),
+		ocagent.WithAddress(ma.address))
+	if err != nil {
+		t.Fatalf("Failed to create a new exporter: %v", err)
+	}
+	defer exp.Stop()
+
+	exp.ExportSpan(&trace.SpanData{Name: "fips"})
+	<-time.After(20 * time.Millisecond)
+	exp.Flush()
+	<-time.After(40 * time.Millisecond)
+
+	if got := len(ma.getSpans()); got != 1 {
+		t.Errorf("Got %d spans, want 1", got)
+	}
+}
+
+func TestNewUnstartedExporter_withFIPSTLSChecksTheAddressFirst(t *testing.T) {
+	// The FIPS configuration is invalid too, but the address is reported.
+	fips := ocagent.WithFIPSTLS(&tls.Config{InsecureSkipVerify: true})
+	for _, addr := range []string{"grpc://agent:55678", "xds:///agent", "grpcs://agent/path"} {
+		_, err := ocagent.NewUnstartedExporter(fips, ocagent.WithAddress(addr))
+		if err == nil || !strings.Contains(err.Error(), "agent address") {
+			t.Errorf("%s: got %v, want an agent address error", addr, err)
+		}
+	}
+	if _, err := ocagent.NewUnstartedExporter(ocagent.WithFIPSTLS(nil), ocagent.WithAddress("grpcs://agent:55678")); err != nil {
+		t.Errorf("grpcs address: unexpected error: %v", err)
+	}
+}
+
+func TestNewUnstartedExporter_withFIPSTLSRefusesInsecureFallbacks(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []ocagent.ExporterOption
+	}{
+		{"insecure", []ocagent.ExporterOption{ocagent.WithFIPSTLS(nil), ocagent.WithInsecure()}},
+		{"insecure address", []ocagent.ExporterOption{ocagent.WithFIPSTLS(nil), ocagent.WithAddress("grpc://agent:55678")}},
+		{"skip verify", []ocagent.ExporterOption{ocagent.WithTLSInsecureSkipVerify(), ocagent.WithFIPSTLS(nil)}},
+		{"skip verify config", []ocagent.ExporterOption{ocagent.WithFIPSTLS(&tls.Config{InsecureSkipVerify: true})}},
+		{"credentials", []ocagent.ExporterOption{ocagent.WithFIPSTLS(nil), ocagent.WithTLSCredentials(credentials.NewTLS(nil))}},
+	}
+	for _, tt := range tests {
+		if _, err := ocagent.NewUnstartedExporter(tt.opts...); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+
+	tracepb "github.com/census-instrumentation/opencensus-proto/gen-go/trace/v1"
+)
+
+// pendingTrace holds the spans of a trace whose local root hasn't ended yet.
+type pendingTrace struct {
+	spans     []*tracepb.Span
+	firstSeen time.Time
+}
+
+// maxPendingTraces bounds the traces that the trace assembler buffers
+// at once: the spans of new traces are dropped beyond it.
+const maxPendingTraces = 10000
+
+// minTraceSweepInterval bounds how often the traces that
+// waited for too long are looked for, however short maxWait is.
+const minTraceSweepInterval = time.Millisecond
+
+// traceAssembler buffers spans by trace ID, so that a whole trace
+// can be shipped in a single request once its local root span ends.
+type traceAssembler struct {
+	maxWait time.Duration
+
+	mu      sync.Mutex
+	pending map[trace.TraceID]*pendingTrace
+
+	// uploads tracks the complete traces being uploaded
+	// in the background, which flushes wait for.
+	uploads sync.WaitGroup
+}
+
+func newTraceAssembler(maxWait time.Duration) *traceAssembler {
+	return &traceAssembler{
+		maxWait: maxWait,
+		pending: make(map[trace.TraceID]*pendingTrace),
+	}
+}
+
+func isLocalRoot(sd *trace.SpanData) bool {
+	return sd.ParentSpanID == (trace.SpanID{}) || sd.HasRemoteParent
+}
+
+// add buffers span, the conversion of sd, and returns the spans of its
+// trace if sd completes it. It reports false if span was dropped because
+// maxPendingTraces are already buffered.
+func (ta *traceAssembler) add(sd *trace.SpanData, span *tracepb.Span) ([]*tracepb.Span, bool) {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+
+	pt := ta.pending[sd.TraceID]
+	if pt == nil {
+		if len(ta.pending) >= maxPendingTraces {
+			return nil, false
+		}
+		pt = &pendingTrace{firstSeen: time.Now()}
+		ta.pending[sd.TraceID] = pt
+	}
+	pt.spans = append(pt.spans, span)
+	if !isLocalRoot(sd) {
+		return nil, true
+	}
+	delete(ta.pending, sd.TraceID)
+	return pt.spans, true
+}
+
+// expired removes and returns the traces that have been waiting for
+// their local root for longer than maxWait, or all of them if all is set.
+func (ta *traceAssembler) expired(now time.Time, all bool) [][]*tracepb.Span {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+
+	var traces [][]*tracepb.Span
+	for traceID, pt := range ta.pending {
+		if all || now.Sub(pt.firstSeen) >= ta.maxWait {
+			traces = append(traces, pt.spans)
+			delete(ta.pending, traceID)
+		}
+	}
+	return traces
+}
+
+// sweepTraces periodically ships the traces that have waited for too long.
+func (ae *Exporter) sweepTraces(stopCh <-chan bool) {
+	interval := ae.traceAssembler.maxWait / 2
+	if interval < minTraceSweepInterval {
+		interval = minTraceSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+
+		case now := <-ticker.C:
+			for _, spans := range ae.traceAssembler.expired(now, false) {
+				ae.uploadTraces(spans)
+			}
+		}
+	}
+}
+
+// uploadCompleteTrace uploads spans, a complete trace, in the background,
+// so that the ExportSpan that completed it doesn't wait on the agent.
+func (ae *Exporter) uploadCompleteTrace(spans []*tracepb.Span) {
+	ae.traceAssembler.uploads.Add(1)
+	go func() {
+		defer ae.traceAssembler.uploads.Done()
+		ae.uploadTraces(spans)
+	}()
+}
+
+// flushPendingTraces ships all the traces buffered so far, complete or not.
+func (ae *Exporter) flushPendingTraces() {
+	if ae.traceAssembler == nil {
+		return
+	}
+	for _, spans := range ae.traceAssembler.expired(time.Now(), true) {
+		ae.uploadTraces(spans)
+	}
+	ae.traceAssembler.uploads.Wait()
+}
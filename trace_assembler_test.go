@@ -0,0 +1,68 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opencensus.io/trace"
+	"google.golang.org/api/support/bundler"
+)
+
+func TestExporter_traceAssemblerIsBounded(t *testing.T) {
+	ae, err := NewUnstartedExporter(WithInsecure(), WithTraceCompleteBatching(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	child := func(i int) *trace.SpanData {
+		sd := &trace.SpanData{SpanContext: trace.SpanContext{SpanID: trace.SpanID{2}}, ParentSpanID: trace.SpanID{1}}
+		binary.BigEndian.PutUint64(sd.TraceID[:], uint64(i))
+		return sd
+	}
+	for i := 0; i < maxPendingTraces; i++ {
+		if err := ae.TryExportSpan(child(i)); err != nil {
+			t.Fatalf("Span #%d: %v", i, err)
+		}
+	}
+
+	if err := ae.TryExportSpan(child(maxPendingTraces)); err != bundler.ErrOverflow {
+		t.Errorf("Span of a new trace: got %v want %v", err, bundler.ErrOverflow)
+	}
+	if g, w := atomic.LoadInt64(&ae.counters.droppedSpans), int64(1); g != w {
+		t.Errorf("Dropped spans: got %d want %d", g, w)
+	}
+	if err := ae.TryExportSpan(child(0)); err != nil {
+		t.Errorf("Span of a buffered trace: %v", err)
+	}
+}
+
+func TestExporter_traceAssemblerWithTinyMaxWait(t *testing.T) {
+	ae, err := NewUnstartedExporter(WithInsecure(), WithTraceCompleteBatching(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	stopCh := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ae.sweepTraces(stopCh)
+	}()
+	<-time.After(10 * time.Millisecond)
+	close(stopCh)
+	<-done
+}
@@ -0,0 +1,172 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"hash/fnv"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+// traceStream is a single Export stream on the trace service. Send and Recv
+// on a gRPC stream are not safe for concurrent use, hence each stream carries
+// its own lock so that batches on different streams can proceed in parallel.
+type traceStream struct {
+	// senderMu protects the concurrent unsafe send on client
+	senderMu sync.Mutex
+	client   agenttracepb.TraceService_ExportClient
+
+	// done is closed by the receiving goroutine once the stream has
+	// ended, with err, which is io.EOF if the agent closed it cleanly.
+	done chan struct{}
+	err  error
+
+	// compressed, if non-nil, is a twin stream created with the configured
+	// compressor, used for batches of at least compressAbove bytes.
+	compressed    *traceStream
+	compressAbove int
+}
+
+// newTraceStream starts receiving on client, passing the responses of the
+// agent to onResponse, if non-nil, and the error that ends the stream to onEnd.
+func newTraceStream(client agenttracepb.TraceService_ExportClient, onResponse func(*agenttracepb.ExportTraceServiceResponse), onEnd func(*traceStream, error)) *traceStream {
+	ts := &traceStream{client: client, done: make(chan struct{})}
+	go ts.receive(onResponse, onEnd)
+	return ts
+}
+
+// receive reads from the stream until it ends, so that a stream closed by
+// the agent is noticed right away rather than on the next send.
+func (ts *traceStream) receive(onResponse func(*agenttracepb.ExportTraceServiceResponse), onEnd func(*traceStream, error)) {
+	for {
+		resp, err := ts.client.Recv()
+		if err != nil {
+			ts.err = err
+			close(ts.done)
+			onEnd(ts, err)
+			return
+		}
+		if onResponse != nil {
+			onResponse(resp)
+		}
+	}
+}
+
+func (ts *traceStream) send(batch *marshaledTraceRequest) error {
+	if ts.compressed != nil && len(batch.data) >= ts.compressAbove {
+		return ts.compressed.send(batch)
+	}
+
+	select {
+	case <-ts.done:
+		return ts.err
+	default:
+	}
+	ts.senderMu.Lock()
+	err := ts.client.SendMsg(batch.marshaledRequest)
+	ts.senderMu.Unlock()
+	if err == io.EOF {
+		// The RPC actually ended with the error that the receiving goroutine got.
+		// See:
+		//   * https://github.com/grpc/grpc-go/blob/d389f9fac68eea0dcc49957d0b4cca5b3a0a7171/stream.go#L98-L100
+		//   * https://groups.google.com/forum/#!msg/grpc-io/XcN4hA9HonI/F_UDiejTAwAJ
+		<-ts.done
+		err = ts.err
+	}
+	return err
+}
+
+// traceStreamIndex maps a trace ID onto one of n streams so that
+// all the spans of a trace are always sent on the same stream.
+func traceStreamIndex(traceID []byte, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(traceID)
+	return int(h.Sum32() % uint32(n))
+}
+
+func shardSpansByTraceID(spans []marshaledSpan, n int) [][]marshaledSpan {
+	shards := make([][]marshaledSpan, n)
+	for _, ms := range spans {
+		i := traceStreamIndex(ms.span.GetTraceId(), n)
+		shards[i] = append(shards[i], ms)
+	}
+	return shards
+}
+
+// sendOnTraceStreams sends batch on streams, sharding its spans by trace ID
+// when there is more than one stream. The shards are sent concurrently and
+// the first error encountered, if any, is returned.
+func sendOnTraceStreams(streams []*traceStream, batch *marshaledTraceRequest) error {
+	if len(streams) == 1 {
+		return streams[0].send(batch)
+	}
+
+	shards := shardSpansByTraceID(batch.spans, len(streams))
+	errs := make([]error, len(streams))
+	var wg sync.WaitGroup
+	for i, spans := range shards {
+		if len(spans) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, spans []marshaledSpan) {
+			defer wg.Done()
+			errs[i] = streams[i].send(batch.withSpans(spans))
+		}(i, spans)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// traceStreamEnded marks the exporter disconnected as soon as one of its
+// current trace streams ends, unless it was canceled by the exporter itself
+// closing the connection, to reconnect or because it is stopped, or the
+// agent doesn't implement the trace service, which reconnecting won't fix.
+func (ae *Exporter) traceStreamEnded(ts *traceStream, err error) {
+	if ae.isDraining() {
+		// Stop half-closed the stream, it isn't reopened.
+		return
+	}
+	switch status.Code(err) {
+	case codes.Canceled:
+		return
+	case codes.Unimplemented:
+		// The agent doesn't implement the trace service, unless it
+		// only rejected the compressor: then the streams are reopened.
+		if !isCompressionRejection(err) {
+			return
+		}
+	}
+	for _, current := range ae.currentTraceStreams() {
+		if current == ts || current.compressed == ts {
+			ae.setStateDisconnected(err)
+			return
+		}
+	}
+}
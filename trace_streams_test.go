@@ -0,0 +1,94 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	agenttracepb "github.com/census-instrumentation/opencensus-proto/gen-go/agent/trace/v1"
+)
+
+const traceExportMethod = "/opencensus.proto.agent.trace.v1.TraceService/Export"
+
+func TestExporter_noticesTraceStreamsClosedByTheAgent(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to get an available TCP address: %v", err)
+	}
+	defer ln.Close()
+
+	// The agent acknowledges the first message of the first trace
+	// stream and then closes it, the other streams stay open.
+	var traceStreams int32
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		if method == traceExportMethod && atomic.AddInt32(&traceStreams, 1) == 1 {
+			if err := stream.RecvMsg(new(agenttracepb.ExportTraceServiceRequest)); err != nil {
+				return err
+			}
+			if err := stream.SendMsg(new(agenttracepb.ExportTraceServiceResponse)); err != nil {
+				return err
+			}
+			return status.Error(codes.Unavailable, "the agent is going away")
+		}
+		<-stream.Context().Done()
+		return nil
+	}))
+	defer srv.Stop()
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+
+	responses := make(chan *agenttracepb.ExportTraceServiceResponse, 1)
+	ae, err := NewExporter(
+		WithInsecure(),
+		WithAddress(ln.Addr().String()),
+		WithReconnectionPeriod(time.Hour),
+		WithEventHistory(10),
+		WithTraceResponseHandler(func(resp *agenttracepb.ExportTraceServiceResponse) {
+			responses <- resp
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create a new agent exporter: %v", err)
+	}
+	defer ae.Stop()
+
+	select {
+	case <-responses:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The response of the agent wasn't handled")
+	}
+
+	// No span is sent, yet the exporter notices that the stream was closed.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, event := range ae.RecentEvents() {
+			if event.Kind == EventDisconnected && strings.Contains(event.Detail, "the agent is going away") {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("The closed stream wasn't noticed, events: %v", ae.RecentEvents())
+}
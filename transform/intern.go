@@ -0,0 +1,66 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// The bounds of the strings interned by the conversions.
+const (
+	// maxInternedStrings is the number of distinct strings interned, beyond
+	// which new strings are converted as is, so that high-cardinality values
+	// don't grow the table forever.
+	maxInternedStrings = 1 << 14
+	// maxInternedLength is the length beyond which strings aren't interned,
+	// as long values such as SQL statements rarely repeat.
+	maxInternedLength = 256
+)
+
+// interner deduplicates the strings that the converted spans and metrics
+// keep, e.g. span names, attribute keys and tag values, so that the spans
+// and view data buffered until they are sent share a single copy of each.
+// Strings built at run time, such as tag values propagated from a request,
+// would otherwise be retained once per span or series.
+type interner struct {
+	strings sync.Map // map[string]string
+	n       int64
+}
+
+var defaultInterner interner
+
+// intern returns a string equal to s, shared with
+// the previous strings equal to s if possible.
+func (in *interner) intern(s string) string {
+	if s == "" || len(s) > maxInternedLength {
+		return s
+	}
+	if interned, ok := in.strings.Load(s); ok {
+		return interned.(string)
+	}
+	if atomic.LoadInt64(&in.n) >= maxInternedStrings {
+		return s
+	}
+	interned, loaded := in.strings.LoadOrStore(s, s)
+	if !loaded {
+		atomic.AddInt64(&in.n, 1)
+	}
+	return interned.(string)
+}
+
+func intern(s string) string {
+	return defaultInterner.intern(s)
+}
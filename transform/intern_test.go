@@ -0,0 +1,69 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// sameString reports whether a and b share their bytes.
+func sameString(a, b string) bool {
+	return len(a) == len(b) && (len(a) == 0 || stringData(a) == stringData(b))
+}
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInterner_intern(t *testing.T) {
+	var in interner
+	a := fmt.Sprintf("user-%d", 42)
+	b := fmt.Sprintf("user-%d", 42)
+	if sameString(a, b) {
+		t.Fatal("The strings to intern already share their bytes")
+	}
+	if got := in.intern(a); !sameString(got, a) {
+		t.Errorf("The first string wasn't interned as is")
+	}
+	if got := in.intern(b); got != b || !sameString(got, a) {
+		t.Errorf("intern(%q) didn't return the interned string", b)
+	}
+
+	long := strings.Repeat("x", maxInternedLength+1)
+	if got := in.intern(long); !sameString(got, long) {
+		t.Error("A long string was interned")
+	}
+	if _, ok := in.strings.Load(long); ok {
+		t.Error("A long string was kept")
+	}
+}
+
+func TestInterner_bounded(t *testing.T) {
+	var in interner
+	for i := 0; i < maxInternedStrings+10; i++ {
+		in.intern(fmt.Sprint(i))
+	}
+	if in.n != maxInternedStrings {
+		t.Errorf("Got %d interned strings, want %d", in.n, maxInternedStrings)
+	}
+	s := fmt.Sprint(maxInternedStrings + 5)
+	if got := in.intern(s); !sameString(got, s) {
+		t.Error("A string beyond the bound was interned")
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opencensus.io/metric/metricdata"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+var errNilMetric = errors.New("expecting a non-nil metricdata.Metric")
+
+// MetricToProto converts m, as read from a metricproducer.Producer such as
+// the one backing the registered views, to its protobuf form. Its unit is
+// normalized by NormalizeUnit.
+func MetricToProto(m *metricdata.Metric) (*metricspb.Metric, error) {
+	if m == nil {
+		return nil, errNilMetric
+	}
+
+	labelKeys := make([]*metricspb.LabelKey, 0, len(m.Descriptor.LabelKeys))
+	for _, key := range m.Descriptor.LabelKeys {
+		labelKeys = append(labelKeys, &metricspb.LabelKey{
+			Key:         key.Key,
+			Description: key.Description,
+		})
+	}
+
+	timeseries := make([]*metricspb.TimeSeries, 0, len(m.TimeSeries))
+	for _, ts := range m.TimeSeries {
+		if ts == nil {
+			continue
+		}
+		timeseries = append(timeseries, timeSeriesToProto(ts))
+	}
+
+	metric := &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{
+			Name:        m.Descriptor.Name,
+			Description: m.Descriptor.Description,
+			Unit:        NormalizeUnit(string(m.Descriptor.Unit)),
+			Type:        metricTypeToProto(m.Descriptor.Type),
+			LabelKeys:   labelKeys,
+		},
+		Timeseries: timeseries,
+	}
+	return metric, nil
+}
+
+func metricTypeToProto(t metricdata.Type) metricspb.MetricDescriptor_Type {
+	switch t {
+	case metricdata.TypeGaugeInt64:
+		return metricspb.MetricDescriptor_GAUGE_INT64
+	case metricdata.TypeGaugeFloat64:
+		return metricspb.MetricDescriptor_GAUGE_DOUBLE
+	case metricdata.TypeGaugeDistribution:
+		return metricspb.MetricDescriptor_GAUGE_DISTRIBUTION
+	case metricdata.TypeCumulativeInt64:
+		return metricspb.MetricDescriptor_CUMULATIVE_INT64
+	case metricdata.TypeCumulativeFloat64:
+		return metricspb.MetricDescriptor_CUMULATIVE_DOUBLE
+	case metricdata.TypeCumulativeDistribution:
+		return metricspb.MetricDescriptor_CUMULATIVE_DISTRIBUTION
+	case metricdata.TypeSummary:
+		return metricspb.MetricDescriptor_SUMMARY
+	default:
+		return metricspb.MetricDescriptor_UNSPECIFIED
+	}
+}
+
+func timeSeriesToProto(ts *metricdata.TimeSeries) *metricspb.TimeSeries {
+	labelValues := make([]*metricspb.LabelValue, 0, len(ts.LabelValues))
+	for _, lv := range ts.LabelValues {
+		labelValues = append(labelValues, &metricspb.LabelValue{
+			Value:    intern(lv.Value),
+			HasValue: lv.Present,
+		})
+	}
+
+	points := make([]*metricspb.Point, 0, len(ts.Points))
+	for _, p := range ts.Points {
+		points = append(points, pointToProto(p))
+	}
+
+	pts := &metricspb.TimeSeries{
+		LabelValues: labelValues,
+		Points:      points,
+	}
+	if !ts.StartTime.IsZero() {
+		pts.StartTimestamp = timeToProtoTimestamp(ts.StartTime)
+	}
+	return pts
+}
+
+func pointToProto(p metricdata.Point) *metricspb.Point {
+	pt := &metricspb.Point{
+		Timestamp: timeToProtoTimestamp(p.Time),
+	}
+
+	switch value := p.Value.(type) {
+	case int64:
+		pt.Value = &metricspb.Point_Int64Value{Int64Value: value}
+
+	case float64:
+		pt.Value = &metricspb.Point_DoubleValue{DoubleValue: value}
+
+	case *metricdata.Distribution:
+		dv := &metricspb.DistributionValue{
+			Count:                 value.Count,
+			Sum:                   value.Sum,
+			SumOfSquaredDeviation: value.SumOfSquaredDeviation,
+			Buckets:               make([]*metricspb.DistributionValue_Bucket, 0, len(value.Buckets)),
+		}
+		for _, b := range value.Buckets {
+			dv.Buckets = append(dv.Buckets, &metricspb.DistributionValue_Bucket{Count: b.Count})
+		}
+		if value.BucketOptions != nil {
+			dv.BucketOptions = &metricspb.DistributionValue_BucketOptions{
+				Type: &metricspb.DistributionValue_BucketOptions_Explicit_{
+					Explicit: &metricspb.DistributionValue_BucketOptions_Explicit{
+						Bounds: value.BucketOptions.Bounds,
+					},
+				},
+			}
+		}
+		pt.Value = &metricspb.Point_DistributionValue{DistributionValue: dv}
+
+	case *metricdata.Summary:
+		sv := &metricspb.SummaryValue{
+			Snapshot: &metricspb.SummaryValue_Snapshot{
+				Count: &wrappers.Int64Value{Value: value.Snapshot.Count},
+				Sum:   &wrappers.DoubleValue{Value: value.Snapshot.Sum},
+			},
+		}
+		if value.HasCountAndSum {
+			sv.Count = &wrappers.Int64Value{Value: value.Count}
+			sv.Sum = &wrappers.DoubleValue{Value: value.Sum}
+		}
+		// The agent requires the percentiles to be strictly increasing.
+		percentiles := make([]float64, 0, len(value.Snapshot.Percentiles))
+		for percentile := range value.Snapshot.Percentiles {
+			percentiles = append(percentiles, percentile)
+		}
+		sort.Float64s(percentiles)
+		for _, percentile := range percentiles {
+			sv.Snapshot.PercentileValues = append(sv.Snapshot.PercentileValues, &metricspb.SummaryValue_Snapshot_ValueAtPercentile{
+				Percentile: percentile,
+				Value:      value.Snapshot.Percentiles[percentile],
+			})
+		}
+		pt.Value = &metricspb.Point_SummaryValue{SummaryValue: sv}
+	}
+
+	return pt
+}
@@ -0,0 +1,144 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"go.opencensus.io/metric/metricdata"
+
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+func TestMetricToProto(t *testing.T) {
+	start := time.Unix(1543160298, 997)
+	end := start.Add(100 * time.Millisecond)
+
+	got, err := MetricToProto(&metricdata.Metric{
+		Descriptor: metricdata.Descriptor{
+			Name:        "ocagent.io/latency",
+			Description: "The latency of the various methods",
+			Unit:        metricdata.UnitMilliseconds,
+			Type:        metricdata.TypeCumulativeDistribution,
+			LabelKeys:   []metricdata.LabelKey{{Key: "method"}},
+		},
+		TimeSeries: []*metricdata.TimeSeries{
+			{
+				StartTime:   start,
+				LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("Get")},
+				Points: []metricdata.Point{
+					metricdata.NewDistributionPoint(end, &metricdata.Distribution{
+						Count:         3,
+						Sum:           30,
+						BucketOptions: &metricdata.BucketOptions{Bounds: []float64{10}},
+						Buckets:       []metricdata.Bucket{{Count: 1}, {Count: 2}},
+					}),
+				},
+			},
+			{
+				StartTime:   start,
+				LabelValues: []metricdata.LabelValue{metricdata.NewLabelValue("")},
+				Points:      []metricdata.Point{},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := &metricspb.Metric{
+		MetricDescriptor: &metricspb.MetricDescriptor{
+			Name:        "ocagent.io/latency",
+			Description: "The latency of the various methods",
+			Unit:        "ms",
+			Type:        metricspb.MetricDescriptor_CUMULATIVE_DISTRIBUTION,
+			LabelKeys:   []*metricspb.LabelKey{{Key: "method"}},
+		},
+		Timeseries: []*metricspb.TimeSeries{
+			{
+				StartTimestamp: &timestamp.Timestamp{Seconds: 1543160298, Nanos: 997},
+				LabelValues:    []*metricspb.LabelValue{{Value: "Get", HasValue: true}},
+				Points: []*metricspb.Point{
+					{
+						Timestamp: &timestamp.Timestamp{Seconds: 1543160298, Nanos: 100000997},
+						Value: &metricspb.Point_DistributionValue{
+							DistributionValue: &metricspb.DistributionValue{
+								Count: 3,
+								Sum:   30,
+								BucketOptions: &metricspb.DistributionValue_BucketOptions{
+									Type: &metricspb.DistributionValue_BucketOptions_Explicit_{
+										Explicit: &metricspb.DistributionValue_BucketOptions_Explicit{
+											Bounds: []float64{10},
+										},
+									},
+								},
+								Buckets: []*metricspb.DistributionValue_Bucket{{Count: 1}, {Count: 2}},
+							},
+						},
+					},
+				},
+			},
+			{
+				StartTimestamp: &timestamp.Timestamp{Seconds: 1543160298, Nanos: 997},
+				LabelValues:    []*metricspb.LabelValue{{Value: "", HasValue: true}},
+				Points:         []*metricspb.Point{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Mismatch\nGot:  %v\nWant: %v", got, want)
+	}
+
+	if _, err := MetricToProto(nil); err == nil {
+		t.Error("Expected an error for a nil metric")
+	}
+}
+
+func TestMetricToProto_summaryPercentilesAreSorted(t *testing.T) {
+	got, err := MetricToProto(&metricdata.Metric{
+		Descriptor: metricdata.Descriptor{Name: "s", Type: metricdata.TypeSummary},
+		TimeSeries: []*metricdata.TimeSeries{
+			{
+				Points: []metricdata.Point{
+					metricdata.NewSummaryPoint(time.Unix(1, 0), &metricdata.Summary{
+						Snapshot: metricdata.Snapshot{
+							Percentiles: map[float64]float64{99: 3, 50: 1, 90: 2},
+						},
+					}),
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sv := got.Timeseries[0].Points[0].GetSummaryValue()
+	if sv.Count != nil || sv.Sum != nil {
+		t.Errorf("Count and Sum should be unset without HasCountAndSum: %v", sv)
+	}
+	var percentiles []float64
+	for _, vp := range sv.Snapshot.PercentileValues {
+		percentiles = append(percentiles, vp.Percentile)
+	}
+	if want := []float64{50, 90, 99}; !reflect.DeepEqual(percentiles, want) {
+		t.Errorf("Percentiles: got %v, want %v", percentiles, want)
+	}
+	if got.Timeseries[0].StartTimestamp != nil {
+		t.Errorf("StartTimestamp should be unset for a zero start time")
+	}
+}
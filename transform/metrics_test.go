@@ -0,0 +1,61 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+)
+
+func TestViewDataToMetric_distributionSum(t *testing.T) {
+	// Points: [0.1, 0.2, 0.3]
+	data := &view.DistributionData{
+		Count:           3,
+		Min:             0.1,
+		Max:             0.3,
+		Mean:            0.2,
+		SumOfSquaredDev: 0.02,
+		CountPerBucket:  []int64{0, 3},
+	}
+	start := time.Unix(1543160298, 997)
+	vd := &view.Data{
+		View: &view.View{
+			Name:        "ocagent.io/latency",
+			Aggregation: view.Distribution(0, 1),
+			Measure:     stats.Float64("ocagent.io/latency", "", stats.UnitMilliseconds),
+		},
+		Start: start,
+		End:   start.Add(100 * time.Millisecond),
+		Rows:  []*view.Row{{Data: data}},
+	}
+
+	metric, err := ViewDataToMetric(vd)
+	if err != nil {
+		t.Fatalf("Failed to convert the view data: %v", err)
+	}
+	dist := metric.Timeseries[0].Points[0].GetDistributionValue()
+	if dist == nil {
+		t.Fatalf("Got %v, want a distribution point", metric.Timeseries[0].Points[0])
+	}
+	if g, w := dist.Sum, data.Sum(); g != w {
+		t.Errorf("Sum: got %v, want %v", g, w)
+	}
+	if g, w := dist.Count, data.Count; g != w {
+		t.Errorf("Count: got %d, want %d", g, w)
+	}
+}
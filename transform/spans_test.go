@@ -0,0 +1,58 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestOCTimeEventsToProtoTimeEvents_dropsOldest(t *testing.T) {
+	var as []trace.Annotation
+	for i := 0; i < 5; i++ {
+		as = append(as, trace.Annotation{Message: fmt.Sprintf("a%d", i)})
+	}
+	var es []trace.MessageEvent
+	for i := 0; i < 4; i++ {
+		es = append(es, trace.MessageEvent{MessageID: int64(i)})
+	}
+
+	tes := ocTimeEventsToProtoTimeEvents(as, es, TimeEventLimits{MaxAnnotations: 2, MaxMessageEvents: 3})
+	if tes.DroppedAnnotationsCount != 3 || tes.DroppedMessageEventsCount != 1 {
+		t.Errorf("Got %d dropped annotations and %d dropped message events, want 3 and 1",
+			tes.DroppedAnnotationsCount, tes.DroppedMessageEventsCount)
+	}
+	var got []string
+	for _, te := range tes.TimeEvent {
+		if a := te.GetAnnotation(); a != nil {
+			got = append(got, a.Description.Value)
+		} else {
+			got = append(got, fmt.Sprintf("m%d", te.GetMessageEvent().Id))
+		}
+	}
+	if want := "[a3 a4 m1 m2 m3]"; fmt.Sprint(got) != want {
+		t.Errorf("Got time events %v, want %s", got, want)
+	}
+}
+
+func TestOCTimeEventsToProtoTimeEvents_defaultLimits(t *testing.T) {
+	as := make([]trace.Annotation, DefaultMaxAnnotations+1)
+	tes := ocTimeEventsToProtoTimeEvents(as, nil, TimeEventLimits{})
+	if len(tes.TimeEvent) != DefaultMaxAnnotations || tes.DroppedAnnotationsCount != 1 {
+		t.Errorf("Got %d time events and %d dropped annotations", len(tes.TimeEvent), tes.DroppedAnnotationsCount)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+// ucumUnits maps the common spellings of units to
+// the Unified Code for Units of Measure (UCUM).
+var ucumUnits = map[string]string{
+	"":              "1",
+	"dimensionless": "1",
+
+	"byte":  "By",
+	"bytes": "By",
+
+	"msec":         "ms",
+	"millisecond":  "ms",
+	"milliseconds": "ms",
+
+	"sec":     "s",
+	"second":  "s",
+	"seconds": "s",
+
+	"µs":           "us",
+	"usec":         "us",
+	"microsecond":  "us",
+	"microseconds": "us",
+
+	"nsec":        "ns",
+	"nanosecond":  "ns",
+	"nanoseconds": "ns",
+
+	"minute":  "min",
+	"minutes": "min",
+
+	"hour":  "h",
+	"hours": "h",
+
+	"percent": "%",
+}
+
+// NormalizeUnit returns the UCUM spelling of unit. Units that are
+// already in UCUM, like "ms", "By", "1" or "{req}", are unchanged.
+func NormalizeUnit(unit string) string {
+	if ucum, ok := ucumUnits[unit]; ok {
+		return ucum
+	}
+	return unit
+}
@@ -114,6 +114,8 @@ func TestOCSpanToProtoSpan_endToEnd(t *testing.T) {
 			"agent":      "ocagent",
 			"cache_hit":  true,
 			"ping_count": int(25), // Should be transformed into int64
+			"load":       float64(0.75),
+			"ratio":      float32(0.5), // Should be transformed into a double
 		},
 	}
 
@@ -235,6 +237,8 @@ func TestOCSpanToProtoSpan_endToEnd(t *testing.T) {
 				"cache_hit":  {Value: &tracepb.AttributeValue_BoolValue{BoolValue: true}},
 				"timeout_ns": {Value: &tracepb.AttributeValue_IntValue{IntValue: 12e9}},
 				"ping_count": {Value: &tracepb.AttributeValue_IntValue{IntValue: 25}},
+				"load":       {Value: &tracepb.AttributeValue_DoubleValue{DoubleValue: 0.75}},
+				"ratio":      {Value: &tracepb.AttributeValue_DoubleValue{DoubleValue: 0.5}},
 				"agent": {Value: &tracepb.AttributeValue_StringValue{
 					StringValue: &tracepb.TruncatableString{Value: "ocagent"},
 				}},
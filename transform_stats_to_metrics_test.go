@@ -16,6 +16,7 @@ package ocagent
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
@@ -758,7 +759,7 @@ func TestViewDataToMetrics_Count(t *testing.T) {
 						Tags: []tag.Tag{
 							{Key: keyField, Value: "main-field"},
 							{Key: keyName, Value: "sprinter-#10"},
-							{Key: keyName, Value: "player_1"},
+							{Key: keyPlayerName, Value: "player_1"},
 						},
 						Data: &view.CountData{Value: 3},
 					},
@@ -766,7 +767,7 @@ func TestViewDataToMetrics_Count(t *testing.T) {
 						Tags: []tag.Tag{
 							{Key: keyField, Value: "small-field"},
 							{Key: keyName, Value: "sprints"},
-							{Key: keyName, Value: "player_2"},
+							{Key: keyPlayerName, Value: "player_2"},
 						},
 						Data: &view.CountData{Value: 1},
 					},
@@ -944,7 +945,7 @@ func TestViewDataToMetrics_Sum(t *testing.T) {
 						Tags: []tag.Tag{
 							{Key: keyField, Value: "main-field"},
 							{Key: keyName, Value: "sprinter-#10"},
-							{Key: keyName, Value: "player_1"},
+							{Key: keyPlayerName, Value: "player_1"},
 						},
 						Data: &view.SumData{Value: 3},
 					},
@@ -952,7 +953,7 @@ func TestViewDataToMetrics_Sum(t *testing.T) {
 						Tags: []tag.Tag{
 							{Key: keyField, Value: "small-field"},
 							{Key: keyName, Value: "sprints"},
-							{Key: keyName, Value: "player_2"},
+							{Key: keyPlayerName, Value: "player_2"},
 						},
 						Data: &view.SumData{Value: 1},
 					},
@@ -1126,10 +1127,11 @@ func TestViewDataToMetrics_MissingVsEmptyLabelValues(t *testing.T) {
 							Seconds: 1543160298,
 							Nanos:   997,
 						},
+						// Aligned with the label keys, whatever the order of the tags.
 						LabelValues: []*metricspb.LabelValue{
-							{Value: "", HasValue: false},
-							{Value: "player_1", HasValue: true},
 							{Value: "", HasValue: true},
+							{Value: "player_1", HasValue: true},
+							{Value: "", HasValue: false},
 						},
 						Points: []*metricspb.Point{
 							{
@@ -1177,6 +1179,56 @@ func testViewDataToMetrics(t *testing.T, tests []*test) {
 	}
 }
 
+func TestViewToMetricDescriptor_cachedPerView(t *testing.T) {
+	m := stats.Int64("cache/measure", "", stats.UnitDimensionless)
+	v1 := &view.View{Name: "cache/view", Measure: m, Aggregation: view.Count(), TagKeys: []tag.Key{keyField}}
+	v2 := &view.View{Name: "cache/view", Measure: m, Aggregation: view.Count(), TagKeys: []tag.Key{keyName}}
+
+	d1, err := viewToMetricDescriptor(v1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again, _ := viewToMetricDescriptor(v1); again != d1 {
+		t.Error("The descriptor of the same view was rebuilt")
+	}
+
+	// Another view with the same name gets its own descriptor.
+	d2, err := viewToMetricDescriptor(v2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if d2 == d1 || d2.LabelKeys[0].Key != "name" {
+		t.Errorf("Got the descriptor of a previous view with the same name: %v", d2)
+	}
+}
+
+func TestViewToMetricDescriptor_normalizesUnits(t *testing.T) {
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{unit: "", want: "1"},
+		{unit: "1", want: "1"},
+		{unit: "bytes", want: "By"},
+		{unit: "By", want: "By"},
+		{unit: "milliseconds", want: "ms"},
+		{unit: "ms", want: "ms"},
+		{unit: "{req}", want: "{req}"},
+	}
+	for i, tt := range tests {
+		// Measures are registered by name, hence one per unit.
+		m := stats.Int64(fmt.Sprintf("units/measure/%d", i), "", tt.unit)
+		v := &view.View{Name: "units/view", Measure: m, Aggregation: view.Sum()}
+		desc, err := viewToMetricDescriptor(v)
+		if err != nil {
+			t.Fatalf("#%d: Unexpected error: %v", i, err)
+		}
+		if desc.Unit != tt.want {
+			t.Errorf("#%d: Unit for %q: got %q, want %q", i, tt.unit, desc.Unit, tt.want)
+		}
+	}
+}
+
 func serializeAsJSON(v interface{}) string {
 	blob, _ := json.MarshalIndent(v, "", "  ")
 	return string(blob)
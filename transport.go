@@ -0,0 +1,51 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"google.golang.org/grpc"
+)
+
+// TransportParams configures WithTransportParams. The zero value of a
+// field keeps the default of gRPC.
+type TransportParams struct {
+	// InitialWindowSize is the flow control window of each stream, in bytes.
+	// gRPC only honors values of at least 64KiB.
+	InitialWindowSize int32
+	// InitialConnWindowSize is the flow control window of the connection,
+	// shared by its streams, in bytes. gRPC only honors values of at least 64KiB.
+	InitialConnWindowSize int32
+	// ReadBufferSize is the size of the buffer of the reads from the connection.
+	ReadBufferSize int
+	// WriteBufferSize is the size of the buffer of the writes to the connection.
+	WriteBufferSize int
+}
+
+func (tp *TransportParams) dialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if tp.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(tp.InitialWindowSize))
+	}
+	if tp.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(tp.InitialConnWindowSize))
+	}
+	if tp.ReadBufferSize > 0 {
+		opts = append(opts, grpc.WithReadBufferSize(tp.ReadBufferSize))
+	}
+	if tp.WriteBufferSize > 0 {
+		opts = append(opts, grpc.WithWriteBufferSize(tp.WriteBufferSize))
+	}
+	return opts
+}
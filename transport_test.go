@@ -0,0 +1,34 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+)
+
+func TestTransportParamsDialOptions(t *testing.T) {
+	if got := (&TransportParams{}).dialOptions(); len(got) != 0 {
+		t.Errorf("Zero TransportParams: got %d dial options, want none", len(got))
+	}
+	tp := &TransportParams{
+		InitialWindowSize:     1 << 20,
+		InitialConnWindowSize: 4 << 20,
+		ReadBufferSize:        256 << 10,
+		WriteBufferSize:       256 << 10,
+	}
+	if got := tp.dialOptions(); len(got) != 4 {
+		t.Errorf("Got %d dial options, want 4", len(got))
+	}
+}
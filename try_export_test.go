@@ -0,0 +1,85 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+	"google.golang.org/api/support/bundler"
+)
+
+func TestTryExportSpan(t *testing.T) {
+	exp, err := NewUnstartedExporter(
+		WithInsecure(),
+		WithEventHistory(10),
+		WithTraceBundlerOptions(BundlerOptions{DelayThreshold: time.Hour, BundleCountThreshold: 1000, BufferedByteLimit: 200}))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+
+	if err := exp.TryExportSpan(&trace.SpanData{Name: strings.Repeat("a", 300)}); err != bundler.ErrOverflow {
+		t.Errorf("Span larger than the buffer: got %v want %v", err, bundler.ErrOverflow)
+	}
+	for i := 0; ; i++ {
+		err := exp.TryExportSpan(&trace.SpanData{Name: "span"})
+		if err == bundler.ErrOverflow {
+			break
+		}
+		if err != nil || i == 100 {
+			t.Fatalf("Span #%d: got %v want nil until %v", i, err, bundler.ErrOverflow)
+		}
+	}
+	if g, w := atomic.LoadInt64(&exp.counters.droppedSpans), int64(2); g != w {
+		t.Errorf("Dropped spans: got %d want %d", g, w)
+	}
+
+	var details []string
+	for _, ev := range exp.RecentEvents() {
+		details = append(details, ev.Detail)
+	}
+	// Consecutive drops for the same reason are coalesced.
+	if want := "spans: buffer full"; strings.Join(details, ",") != want {
+		t.Errorf("Events: got %q want %q", details, want)
+	}
+}
+
+func TestTryExportView_whileStopping(t *testing.T) {
+	var logged []string
+	exp, err := NewUnstartedExporter(WithInsecure(), WithLogger(func(format string, args ...interface{}) {
+		logged = append(logged, format)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create the exporter: %v", err)
+	}
+	atomic.StoreInt32(&exp.draining, 1)
+
+	if err := exp.TryExportView(&view.Data{View: &view.View{Name: "v"}}); err != ErrStopping {
+		t.Errorf("Got %v want %v", err, ErrStopping)
+	}
+	if err := exp.TryExportSpan(&trace.SpanData{Name: "span"}); err != ErrStopping {
+		t.Errorf("Got %v want %v", err, ErrStopping)
+	}
+	if g, w := atomic.LoadInt64(&exp.counters.droppedMetrics), int64(1); g != w {
+		t.Errorf("Dropped metrics: got %d want %d", g, w)
+	}
+	if len(logged) != 1 {
+		t.Errorf("Got %d log messages, want 1", len(logged))
+	}
+}
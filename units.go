@@ -0,0 +1,38 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	metricspb "github.com/census-instrumentation/opencensus-proto/gen-go/metrics/v1"
+)
+
+// mapUnits applies WithUnitMapping to metrics.
+func (ae *Exporter) mapUnits(metrics []*metricspb.Metric) {
+	if ae.unitMapping == nil {
+		return
+	}
+	for _, metric := range metrics {
+		desc := metric.MetricDescriptor
+		if desc == nil {
+			continue
+		}
+		if unit := ae.unitMapping(desc.Unit); unit != desc.Unit {
+			// The descriptors are shared, see transform.ViewToMetricDescriptor.
+			mapped := *desc
+			mapped.Unit = unit
+			metric.MetricDescriptor = &mapped
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"fmt"
+
+	"google.golang.org/api/support/bundler"
+)
+
+// updatableOption is implemented by the options that are safe
+// to apply on a live exporter, see Exporter.UpdateOptions.
+type updatableOption interface {
+	ExporterOption
+	updatable()
+}
+
+func (headerSetter) updatable()           {}
+func (traceHeaders) updatable()           {}
+func (metricsHeaders) updatable()         {}
+func (compressorSetter) updatable()       {}
+func (traceBundlerOptions) updatable()    {}
+func (viewDataBundlerOptions) updatable() {}
+func (spanFilter) updatable()             {}
+
+// UpdateOptions changes the settings of a live exporter. Only the following
+// options are accepted, any other one fails the whole update:
+//   - WithHeaders, WithTraceHeaders, WithMetricsHeaders and UseCompressor,
+//     which apply to the streams opened on the next connection to the agent
+//     and to the next unary export.
+//   - WithTraceBundlerOptions and WithViewDataBundlerOptions, which apply to
+//     the next batch, after the data buffered so far has been flushed.
+//   - WithSpanFilter, which applies to the next span.
+func (ae *Exporter) UpdateOptions(opts ...ExporterOption) error {
+	for _, opt := range opts {
+		if _, ok := opt.(updatableOption); !ok {
+			return fmt.Errorf("ocagent: %T can't be updated on a live exporter", opt)
+		}
+	}
+
+	ae.mu.Lock()
+	prevTraceBundlerOptions := ae.traceBundlerOptions
+	prevViewDataBundlerOptions := ae.viewDataBundlerOptions
+	for _, opt := range opts {
+		opt.withExporter(ae)
+	}
+	// A bundler can't be changed once in use, so it is replaced and drained instead.
+	var replaced []*bundler.Bundler
+	var replacedTraces chan struct{}
+	if ae.traceBundlerOptions != prevTraceBundlerOptions {
+		replaced = append(replaced, ae.traceBundler)
+		if ae.strictOrdering {
+			// The new spans wait for the ones buffered so far.
+			replacedTraces = make(chan struct{})
+		}
+		ae.traceBundler = ae.newTraceBundler(replacedTraces)
+	}
+	if ae.viewDataBundlerOptions != prevViewDataBundlerOptions {
+		replaced = append(replaced, ae.viewDataBundler)
+		ae.viewDataBundler = ae.newViewDataBundler()
+	}
+	ae.mu.Unlock()
+
+	for _, b := range replaced {
+		b.Flush()
+	}
+	if replacedTraces != nil {
+		close(replacedTraces)
+	}
+	return nil
+}
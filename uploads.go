@@ -0,0 +1,81 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+	"time"
+)
+
+// uploadsTimeout bounds how long Stop waits for the uploads
+// in flight before it closes the connection to the agent.
+const uploadsTimeout = 5 * time.Second
+
+// inFlightUploads counts the batches being sent to the agent, by the sender
+// goroutine or by the callers of the Export*ServiceRequest methods, so that
+// Stop doesn't close the connection in the middle of a send.
+type inFlightUploads struct {
+	mu sync.Mutex
+	n  int
+	// idle is closed once n drops back to zero, it is nil while n is zero.
+	idle chan struct{}
+}
+
+func (ifu *inFlightUploads) begin() {
+	ifu.mu.Lock()
+	if ifu.n == 0 {
+		ifu.idle = make(chan struct{})
+	}
+	ifu.n++
+	ifu.mu.Unlock()
+}
+
+func (ifu *inFlightUploads) end() {
+	ifu.mu.Lock()
+	ifu.n--
+	if ifu.n == 0 {
+		close(ifu.idle)
+		ifu.idle = nil
+	}
+	ifu.mu.Unlock()
+}
+
+// wait blocks until no upload is in flight, for at most timeout.
+// It reports whether the uploads were all done in time.
+func (ifu *inFlightUploads) wait(timeout time.Duration) bool {
+	ifu.mu.Lock()
+	idle := ifu.idle
+	ifu.mu.Unlock()
+	if idle == nil {
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// waitForUploads waits, for at most uploadsTimeout,
+// until the uploads in flight are done.
+func (ae *Exporter) waitForUploads() {
+	if !ae.uploads.wait(uploadsTimeout) && ae.logger != nil {
+		ae.logger("ocagent: stopping with uploads still in flight after %v", uploadsTimeout)
+	}
+}
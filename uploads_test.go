@@ -0,0 +1,55 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInFlightUploads(t *testing.T) {
+	var uploads inFlightUploads
+	if !uploads.wait(time.Millisecond) {
+		t.Fatal("Waited without uploads in flight")
+	}
+
+	uploads.begin()
+	uploads.begin()
+	if uploads.wait(10 * time.Millisecond) {
+		t.Fatal("Didn't wait for the uploads in flight")
+	}
+
+	uploads.end()
+	done := make(chan bool)
+	go func() {
+		done <- uploads.wait(5 * time.Second)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Didn't wait for the last upload in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+	uploads.end()
+	if !<-done {
+		t.Error("The wait timed out although the uploads were done")
+	}
+
+	// The uploads can start anew once idle.
+	uploads.begin()
+	uploads.end()
+	if !uploads.wait(time.Millisecond) {
+		t.Error("Waited without uploads in flight")
+	}
+}
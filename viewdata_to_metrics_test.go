@@ -98,10 +98,14 @@ func TestExportMetrics_conversionFromViewData(t *testing.T) {
 		received = append(received, req)
 	})
 
+	// The first message identifying this application.
+	node := NodeWithStartTime(defaultServiceName())
+	node.Attributes[ReconnectsAttributeKey] = "0"
+
 	// Now compare them with what we expect
 	want := []*agentmetricspb.ExportMetricsServiceRequest{
 		{
-			Node:     NodeWithStartTime(""), // The first message identifying this application.
+			Node:     node,
 			Metrics:  nil,
 			Resource: resourceProtoFromEnv(),
 		},
@@ -0,0 +1,91 @@
+// Copyright 2019, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ocagent
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// watchers are the channels subscribed with Watch.
+type watchers struct {
+	mu    sync.Mutex
+	chans map[chan Event]struct{}
+	// n is the number of channels, read without holding mu.
+	n int32
+}
+
+func (w *watchers) empty() bool {
+	return atomic.LoadInt32(&w.n) == 0
+}
+
+func (w *watchers) add(ch chan Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.chans == nil {
+		w.chans = make(map[chan Event]struct{})
+	}
+	w.chans[ch] = struct{}{}
+	atomic.StoreInt32(&w.n, int32(len(w.chans)))
+}
+
+func (w *watchers) remove(ch chan Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.chans[ch]; !ok {
+		return
+	}
+	delete(w.chans, ch)
+	atomic.StoreInt32(&w.n, int32(len(w.chans)))
+	close(ch)
+}
+
+// send sends ev to the channels that have room for it.
+func (w *watchers) send(ev Event) {
+	if w.empty() {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.chans {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Watch subscribes to the lifecycle events of the exporter, so that
+// applications can feed its health into their own event systems: its
+// connections to the agent (EventConnected) and their losses
+// (EventDisconnected), the batches it sent (EventBatchSent), the spans and
+// metrics it dropped (EventDropped), and the samplers it applied
+// (EventConfigUpdated). Watch works with or without WithEventHistory.
+//
+// The events are sent on the returned channel, which buffers up to buffer
+// events. The exporter never waits for a slow reader: the events that don't
+// fit in the buffer are discarded. The returned function ends the
+// subscription and closes the channel.
+func (ae *Exporter) Watch(buffer int) (<-chan Event, func()) {
+	if buffer < 0 {
+		buffer = 0
+	}
+	ch := make(chan Event, buffer)
+	ae.watchers.add(ch)
+	return ch, func() { ae.watchers.remove(ch) }
+}